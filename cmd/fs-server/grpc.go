@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"net"
+
+	"github.com/peymanmortazavi/fs-server/pkg/fsgrpc"
+	"github.com/peymanmortazavi/fs-server/pkg/fsgrpc/fspb"
+	"google.golang.org/grpc"
+)
+
+// swapService serves the gRPC service of the current server, which is
+// replaced on reload. Calls are in-flight requests of the server they started
+// on, like the requests of swapHandler.
+type swapService struct {
+	fspb.UnimplementedFileSystemServer
+	handler *swapHandler
+}
+
+// acquire returns the service of the current server along with the function
+// to call once the call is done.
+func (s *swapService) acquire() (*fsgrpc.Service, func()) {
+	s.handler.mu.RLock()
+	current := s.handler.current
+	current.requests.Add(1)
+	s.handler.mu.RUnlock()
+	return current.service, current.requests.Done
+}
+
+func (s *swapService) Stat(ctx context.Context, request *fspb.StatRequest) (*fspb.Item, error) {
+	service, done := s.acquire()
+	defer done()
+	return service.Stat(ctx, request)
+}
+
+func (s *swapService) List(request *fspb.ListRequest, stream fspb.FileSystem_ListServer) error {
+	service, done := s.acquire()
+	defer done()
+	return service.List(request, stream)
+}
+
+func (s *swapService) Read(request *fspb.ReadRequest, stream fspb.FileSystem_ReadServer) error {
+	service, done := s.acquire()
+	defer done()
+	return service.Read(request, stream)
+}
+
+func (s *swapService) Write(stream fspb.FileSystem_WriteServer) error {
+	service, done := s.acquire()
+	defer done()
+	return service.Write(stream)
+}
+
+func (s *swapService) Create(ctx context.Context, request *fspb.CreateRequest) (*fspb.Item, error) {
+	service, done := s.acquire()
+	defer done()
+	return service.Create(ctx, request)
+}
+
+func (s *swapService) Mkdir(ctx context.Context, request *fspb.MkdirRequest) (*fspb.Item, error) {
+	service, done := s.acquire()
+	defer done()
+	return service.Mkdir(ctx, request)
+}
+
+func (s *swapService) Delete(ctx context.Context, request *fspb.DeleteRequest) (*fspb.DeleteResponse, error) {
+	service, done := s.acquire()
+	defer done()
+	return service.Delete(ctx, request)
+}
+
+func (s *swapService) Move(ctx context.Context, request *fspb.MoveRequest) (*fspb.Item, error) {
+	service, done := s.acquire()
+	defer done()
+	return service.Move(ctx, request)
+}
+
+func (s *swapService) Watch(request *fspb.WatchRequest, stream fspb.FileSystem_WatchServer) error {
+	service, done := s.acquire()
+	defer done()
+	return service.Watch(request, stream)
+}
+
+// serveGRPC accepts gRPC connections at the address until the server is stopped.
+func serveGRPC(server *grpc.Server, addr string) error {
+	accepted, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return server.Serve(accepted)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/peymanmortazavi/fs-server/pkg/config"
+)
+
+// limitListener accepts a bounded number of connections at once, further
+// connections wait in the backlog of the listener until one is closed.
+type limitListener struct {
+	net.Listener
+	slots  chan struct{}
+	closed chan struct{}
+	once   sync.Once
+}
+
+func newLimitListener(listener net.Listener, max int) *limitListener {
+	return &limitListener{Listener: listener, slots: make(chan struct{}, max), closed: make(chan struct{})}
+}
+
+func (l *limitListener) Accept() (net.Conn, error) {
+	select {
+	case l.slots <- struct{}{}:
+	case <-l.closed:
+		return nil, net.ErrClosed
+	}
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		<-l.slots
+		return nil, err
+	}
+	return &limitConn{Conn: conn, release: func() { <-l.slots }}, nil
+}
+
+func (l *limitListener) Close() error {
+	l.once.Do(func() { close(l.closed) })
+	return l.Listener.Close()
+}
+
+type limitConn struct {
+	net.Conn
+	release func()
+	once    sync.Once
+}
+
+func (c *limitConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(c.release)
+	return err
+}
+
+// newHTTPServer returns a server with the connection settings of the configuration.
+func newHTTPServer(c config.HTTP, handler http.Handler) *http.Server {
+	return &http.Server{
+		Handler:           handler,
+		ReadTimeout:       c.ReadTimeout,
+		ReadHeaderTimeout: c.ReadHeaderTimeout,
+		WriteTimeout:      c.WriteTimeout,
+		IdleTimeout:       c.IdleTimeout,
+		MaxHeaderBytes:    c.MaxHeaderBytes,
+		TLSConfig:         &tls.Config{MinVersion: tls.VersionTLS12},
+	}
+}
+
+// serve accepts connections of a listener until the server is shut down.
+func serve(server *http.Server, listener config.Listener, maxConnections int) error {
+	accepted, err := net.Listen("tcp", listener.Addr)
+	if err != nil {
+		return err
+	}
+	if maxConnections > 0 {
+		accepted = newLimitListener(accepted, maxConnections)
+	}
+	if listener.TLSCert == "" {
+		return server.Serve(accepted)
+	}
+	return server.ServeTLS(accepted, listener.TLSCert, listener.TLSKey)
+}
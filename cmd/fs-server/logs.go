@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+
+	"github.com/peymanmortazavi/fs-server/pkg/config"
+	"github.com/peymanmortazavi/fs-server/pkg/fshttp"
+	"github.com/peymanmortazavi/fs-server/pkg/logfile"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+)
+
+// openLog opens a log file rotated as configured, "-" is stdout which is
+// never closed.
+func openLog(path string, c config.Logging) (io.Writer, func(), error) {
+	if path == "-" {
+		return os.Stdout, func() {}, nil
+	}
+	file, err := logfile.Open(path, c.MaxSize, c.MaxBackups)
+	if err != nil {
+		return nil, nil, err
+	}
+	return file, func() { file.Close() }, nil
+}
+
+// lastAuditRecord verifies the audit log at path and returns its last record
+// so new records follow it, the previous file is read when the log was just
+// rotated.
+func lastAuditRecord(path string, key []byte) (fshttp.AuditRecord, error) {
+	for _, name := range []string{path, logfile.Backup(path, 1)} {
+		file, err := os.Open(name)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return fshttp.AuditRecord{}, err
+		}
+		last, err := fshttp.VerifyAudit(file, key, fshttp.AuditRecord{})
+		file.Close()
+		if err != nil {
+			return last, fmt.Errorf("%s: %s", name, err)
+		}
+		if last.Hash != "" {
+			return last, nil
+		}
+	}
+	return fshttp.AuditRecord{}, nil
+}
+
+// newTracerProvider returns the tracer provider of the configuration, batching
+// spans to its exporter, nil when nothing is traced.
+func newTracerProvider(c config.Tracing) (*sdktrace.TracerProvider, error) {
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch c.Exporter {
+	case "otlp":
+		var endpoint *url.URL
+		if endpoint, err = url.Parse(c.Endpoint); err != nil {
+			return nil, err
+		}
+		options := []otlptracehttp.Option{otlptracehttp.WithEndpoint(endpoint.Host), otlptracehttp.WithURLPath(endpoint.Path)}
+		if endpoint.Scheme == "http" {
+			options = append(options, otlptracehttp.WithInsecure())
+		}
+		exporter, err = otlptracehttp.New(context.Background(), options...)
+	case "stdout":
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	default:
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	service := resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(c.Service))
+	return sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(service)), nil
+}
+
+// openLogs opens the access and audit logs of the configuration for the
+// observers, returning a function closing them.
+func openLogs(c config.Logging, o *observers) (func(), error) {
+	var closers []func()
+	closeLogs := func() {
+		for _, close := range closers {
+			close()
+		}
+	}
+	if c.Access != "" {
+		writer, close, err := openLog(c.Access, c)
+		if err != nil {
+			return closeLogs, err
+		}
+		closers = append(closers, close)
+		o.access = fshttp.NewAccessLog(writer)
+	}
+	if c.Audit != "" {
+		key, err := fshttp.LoadAuditKey(c.AuditKeyFile)
+		if err != nil {
+			return closeLogs, err
+		}
+		var last fshttp.AuditRecord
+		if c.Audit != "-" {
+			if last, err = lastAuditRecord(c.Audit, key); err != nil {
+				log.Printf("the audit log failed verification, new records follow the last valid one: %s", err)
+			}
+		}
+		writer, close, err := openLog(c.Audit, c)
+		if err != nil {
+			return closeLogs, err
+		}
+		closers = append(closers, close)
+		o.audit = fshttp.NewAuditLog(writer, key, last)
+	}
+	return closeLogs, nil
+}
@@ -1,23 +1,417 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
+	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"path"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 
-	"github.com/peymanmortazavi/fs-server/pkg/filesystem"
+	"github.com/peymanmortazavi/fs-server/pkg/config"
+	"github.com/peymanmortazavi/fs-server/pkg/fsgrpc/fspb"
 	"github.com/peymanmortazavi/fs-server/pkg/fshttp"
+	"github.com/peymanmortazavi/fs-server/pkg/metrics"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"google.golang.org/grpc"
 )
 
+// listValue is a comma separated flag value.
+type listValue struct {
+	items *[]string
+}
+
+func (l listValue) String() string {
+	if l.items == nil {
+		return ""
+	}
+	return strings.Join(*l.items, ",")
+}
+
+func (l listValue) Set(value string) error {
+	*l.items = nil
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*l.items = append(*l.items, item)
+		}
+	}
+	return nil
+}
+
+// bindFlags defines the flags of the server over the configuration, so the
+// values of flags given explicitly override the configuration.
+func bindFlags(flags *flag.FlagSet, c *config.Config, configPath *string) {
+	flags.StringVar(configPath, "config", "", "a YAML configuration file, flags given explicitly override it.")
+
+	root, compress, encrypt := new(string), new(bool), new(bool)
+	if backend, ok := c.RootBackend(); ok {
+		root, compress, encrypt = &backend.Root, &backend.Compress, &backend.Encrypt
+	}
+	flags.StringVar(root, "root", *root, "the root of the local path to serve.")
+	flags.BoolVar(compress, "compress-storage", *compress, "store files compressed with gzip beneath the root, they are still served uncompressed.")
+	flags.BoolVar(encrypt, "encrypt-storage", *encrypt, "store files encrypted with AES-GCM beneath the root, requires --encryption-keys or FS_SERVER_ENCRYPTION_KEYS.")
+	flags.StringVar(&c.Encryption.KeyFile, "encryption-keys", c.Encryption.KeyFile, "a file with an id:base64-key line per encryption key, the last one encrypting new files.")
+	flags.BoolVar(&c.Encryption.AllowPlaintext, "allow-plaintext", c.Encryption.AllowPlaintext, "serve files stored unencrypted by encrypted backends as they are, while migrating them.")
+	if len(c.Listeners) == 0 {
+		c.Listeners = []config.Listener{{}}
+	}
+	flags.StringVar(&c.Listeners[0].Addr, "addr", c.Listeners[0].Addr, "the address to listen to")
+	flags.IntVar(&c.HTTP.MaxConnections, "max-connections", c.HTTP.MaxConnections, "the number of connections every listener accepts at once, 0 is unlimited.")
+	flags.DurationVar(&c.HTTP.ShutdownDelay, "shutdown-delay", c.HTTP.ShutdownDelay, "how long requests are still served as not ready once asked to terminate.")
+	flags.DurationVar(&c.HTTP.DrainTimeout, "drain-timeout", c.HTTP.DrainTimeout, "how long in-flight requests are given to finish on termination.")
+	flags.StringVar(&c.HTTP.BasePath, "base-path", c.HTTP.BasePath, "the path prefix the API is served beneath, health checks and metrics stay at the root.")
+	flags.BoolVar(&c.HTTP.Unversioned, "unversioned", c.HTTP.Unversioned, "also serve the API beneath the base path without its /v1 version, as deprecated.")
+	flags.StringVar(&c.AdminAddr, "admin-addr", c.AdminAddr, "the address health checks and metrics are served on, they are served on every listener when empty.")
+	flags.StringVar(&c.GRPCAddr, "grpc-addr", c.GRPCAddr, "the address the file system is served on over gRPC, it is not served over gRPC when empty.")
+	flags.BoolVar(&c.Metrics, "metrics", c.Metrics, "serve Prometheus metrics at /metrics.")
+	flags.StringVar(&c.Tracing.Exporter, "tracing", c.Tracing.Exporter, "export spans of requests and backend operations with otlp or to stdout, nothing is traced when empty.")
+	flags.StringVar(&c.Tracing.Endpoint, "otlp-endpoint", c.Tracing.Endpoint, "the URL of the OTLP/HTTP collector receiving spans with --tracing=otlp.")
+	flags.StringVar(&c.Logging.File, "log-file", c.Logging.File, "the file logs are appended to, stderr when empty.")
+	flags.StringVar(&c.Logging.Access, "access-log", c.Logging.Access, "the file a JSON line per request is appended to, - writes to stdout.")
+	flags.StringVar(&c.Logging.Audit, "audit-log", c.Logging.Audit, "the file a hash-chained JSON line per mutation is appended to, - writes to stdout.")
+	flags.StringVar(&c.Logging.AuditKeyFile, "audit-key-file", c.Logging.AuditKeyFile, "the file holding the key of at least 32 bytes sealing the audit log, kept away from the log.")
+	flags.Int64Var(&c.Logging.MaxSize, "log-max-size", c.Logging.MaxSize, "the size in bytes the access and audit logs are rotated at, 0 never rotates them.")
+	flags.IntVar(&c.Logging.MaxBackups, "log-max-backups", c.Logging.MaxBackups, "the number of rotated access and audit log files kept.")
+
+	flags.BoolVar(&c.ReadOnly, "read-only", c.ReadOnly, "serve the root without allowing any change, mutations are answered with 405.")
+	flags.StringVar(&c.Limits.UploadDir, "upload-dir", c.Limits.UploadDir, "the local directory holding partial resumable uploads and gRPC writes unencrypted, in the temporary directory when empty. Required with --encrypt-storage.")
+	flags.DurationVar(&c.Limits.UploadExpiry, "upload-expiry", c.Limits.UploadExpiry, "how long an inactive resumable upload is kept.")
+	flags.Int64Var(&c.Limits.MaxUploadSize, "max-upload-size", c.Limits.MaxUploadSize, "the maximum size of a resumable upload in bytes, 0 means unlimited.")
+	flags.Float64Var(&c.Limits.Rate.Reads, "read-rate", c.Limits.Rate.Reads, "the GET, HEAD and OPTIONS requests per second allowed to every client, 0 is unlimited.")
+	flags.Float64Var(&c.Limits.Rate.Writes, "write-rate", c.Limits.Rate.Writes, "the other requests per second allowed to every client, 0 is unlimited.")
+	flags.Int64Var(&c.Limits.Rate.Bandwidth, "bandwidth", c.Limits.Rate.Bandwidth, "the bytes per second every client may upload and download, 0 is unlimited.")
+	flags.IntVar(&c.Limits.MaxOperations, "max-operations", c.Limits.MaxOperations, "how many backend operations run at once, 0 is unlimited.")
+	flags.BoolVar(&c.Compression.Enabled, "compression", c.Compression.Enabled, "compress the JSON and text responses of clients accepting one of the configured encodings.")
+	flags.BoolVar(&c.Watch, "watch", c.Watch, "watch the root for changes so clients can subscribe to them.")
+	flags.BoolVar(&c.Index, "index", c.Index, "keep an index of the tree in memory to answer searches, requires --watch.")
+	flags.DurationVar(&c.UsageMaxAge, "usage-max-age", c.UsageMaxAge, "how long measured disk usage is cached, changes made outside of the server are not seen sooner without --watch.")
+	flags.BoolVar(&c.Versions.Enabled, "versions", c.Versions.Enabled, "keep the previous content of files when they are overwritten or deleted.")
+	flags.IntVar(&c.Versions.Max, "max-versions", c.Versions.Max, "the number of versions kept for every file, 0 keeps them all.")
+	flags.DurationVar(&c.Versions.MaxAge, "max-version-age", c.Versions.MaxAge, "how long versions are kept, 0 keeps them until pruned by --max-versions.")
+	flags.BoolVar(&c.Trash.Enabled, "trash", c.Trash.Enabled, "move deleted items to a hidden trash directory so they can be restored.")
+	flags.DurationVar(&c.Trash.Retention, "trash-retention", c.Trash.Retention, "how long deleted items are kept in the trash, 0 keeps them until purged.")
+	flags.Var(listValue{&c.Limits.Protected}, "protected", "a comma separated list of paths that can never be deleted.")
+	flags.Var(listValue{&c.Auth.Admins}, "admins", "a comma separated list of principals allowed to delete permanently and purge the trash.")
+	flags.StringVar(&c.Auth.UsersFile, "users", c.Auth.UsersFile, "a file with a name:bcrypt-hash line per user allowed to sign in with basic authentication.")
+	flags.BoolVar(&c.Auth.Required, "auth-required", c.Auth.Required, "reject anonymous requests, requires --users.")
+	flags.Float64Var(&c.Auth.FailedLogins, "failed-logins", c.Auth.FailedLogins, "the failed sign-ins per second allowed to every IP address, 0 is unlimited.")
+	flags.Var(listValue{&c.CORS.AllowedOrigins}, "cors-origins", "a comma separated list of origins browsers may call the server from, like https://*.example.com.")
+	flags.StringVar(&c.Limits.QuotasFile, "quotas", c.Limits.QuotasFile, "a JSON file listing quota rules for path prefixes and principals.")
+	flags.StringVar(&c.Limits.QuotaState, "quota-state", c.Limits.QuotaState, "the file keeping the usage of principals across restarts.")
+	flags.StringVar(&c.Webhooks.File, "webhooks", c.Webhooks.File, "a JSON file listing webhook targets notified about mutations.")
+	flags.StringVar(&c.Webhooks.QueueDir, "webhook-queue-dir", c.Webhooks.QueueDir, "the local directory keeping pending webhook deliveries, in memory when empty.")
+	flags.StringVar(&c.Webhooks.DeadLetter, "webhook-dead-letter", c.Webhooks.DeadLetter, "the file failed webhook deliveries are appended to.")
+}
+
+var errDraining = errors.New("the server is shutting down")
+
+// loadConfig reads the configuration file given in args, along with the
+// environment, and overrides it with the flags given explicitly.
+func loadConfig(args []string) (config.Config, error) {
+	var configPath string
+	probe := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	bindFlags(probe, &config.Config{}, &configPath)
+	probe.Parse(args)
+
+	c := config.Default()
+	if configPath != "" {
+		var err error
+		if c, err = config.Load(configPath); err != nil {
+			return c, err
+		}
+	} else if err := config.ApplyEnv(&c, os.Environ()); err != nil {
+		return c, err
+	}
+	flags := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	bindFlags(flags, &c, &configPath)
+	flags.Parse(args)
+	return c, c.Validate()
+}
+
+// setLogOutput writes logs to the configured file, reopening it so rotated
+// logs are picked up on reload.
+func setLogOutput(c config.Config) error {
+	if c.Logging.File == "" {
+		log.SetOutput(os.Stderr)
+		return nil
+	}
+	file, err := os.OpenFile(c.Logging.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	log.SetOutput(file)
+	return nil
+}
+
+// swapHandler serves the current server, which is replaced on reload.
+type swapHandler struct {
+	mu      sync.RWMutex
+	current *server
+
+	// draining is set once the process is asked to terminate.
+	draining int32
+
+	// registry holds the metrics of every server, metrics are not recorded
+	// when it is nil.
+	registry  *metrics.Registry
+	observers observers
+}
+
+func (h *swapHandler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	h.mu.RLock()
+	current := h.current
+	current.requests.Add(1)
+	h.mu.RUnlock()
+	defer current.requests.Done()
+	current.handler.ServeHTTP(writer, request)
+}
+
+// serveHealth runs the health checks of the current server.
+func (h *swapHandler) serveHealth(writer http.ResponseWriter, request *http.Request) {
+	h.mu.RLock()
+	health := h.current.health
+	h.mu.RUnlock()
+	health.ServeHTTP(writer, request)
+}
+
+// routes returns the router serving the files beneath the base path, observed
+// and recovering from panics, and the router of the health checks and metrics.
+// They are the same router unless the admin endpoints have their own address.
+func routes(c config.Config, handler *swapHandler) (files, admin *fshttp.Router) {
+	observer := &fshttp.Observer{Metrics: handler.observers.metrics, AccessLog: handler.observers.access, Tracer: handler.observers.tracer}
+	api := path.Join(c.HTTP.BasePath, "v1")
+	files = &fshttp.Router{}
+	files.Mount(api, fshttp.Chain(handler, observer.Middleware, fshttp.Recover))
+	files.Handle(api+"/openapi.json", fshttp.Chain(http.HandlerFunc(fshttp.ServeOpenAPI), observer.Middleware, fshttp.Recover))
+	if c.HTTP.Unversioned {
+		files.Mount(c.HTTP.BasePath, fshttp.Chain(handler, observer.Middleware, fshttp.Recover, fshttp.Deprecate(api)))
+	}
+	admin = files
+	if c.AdminAddr != "" {
+		admin = &fshttp.Router{}
+	}
+	admin.Handle("/healthz", http.HandlerFunc(handler.serveHealth))
+	admin.Handle("/readyz", http.HandlerFunc(handler.serveHealth))
+	if handler.registry != nil {
+		admin.Handle("/metrics", handler.registry)
+	}
+	return files, admin
+}
+
+// build returns the server described by the configuration, which is not ready
+// once the process is draining.
+func (h *swapHandler) build(c config.Config) (*server, error) {
+	built, err := newServer(c, h.observers)
+	if err != nil {
+		return nil, err
+	}
+	built.health.Readiness = append(built.health.Readiness, fshttp.HealthCheck{Name: "draining", Check: func(context.Context) error {
+		if atomic.LoadInt32(&h.draining) == 1 {
+			return errDraining
+		}
+		return nil
+	}})
+	return built, nil
+}
+
+// swap serves the given server from now on and returns the previous one.
+func (h *swapHandler) swap(next *server) *server {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	previous := h.current
+	h.current = next
+	return previous
+}
+
+// reload replaces the server with one built from the configuration read
+// again, keeping the current one when the configuration is invalid.
+func reload(handler *swapHandler, current config.Config) config.Config {
+	next, err := loadConfig(os.Args[1:])
+	if err != nil {
+		log.Printf("keeping the current configuration: %s", err)
+		return current
+	}
+	// only the log file is reopened, the access and audit logs are kept.
+	logging := current.Logging
+	logging.File = next.Logging.File
+	if !reflect.DeepEqual(next.Listeners, current.Listeners) || next.HTTP != current.HTTP || next.AdminAddr != current.AdminAddr || next.GRPCAddr != current.GRPCAddr || next.Metrics != current.Metrics || next.Tracing != current.Tracing || next.Logging != logging {
+		log.Printf("listeners, http settings, the admin and gRPC addresses, metrics, tracing and the access and audit logs only change on restart")
+		next.Listeners, next.HTTP, next.AdminAddr, next.GRPCAddr, next.Metrics, next.Tracing, next.Logging = current.Listeners, current.HTTP, current.AdminAddr, current.GRPCAddr, current.Metrics, current.Tracing, logging
+		// the gRPC address kept may not be given along with the new settings.
+		if err := next.Validate(); err != nil {
+			log.Printf("keeping the current configuration: %s", err)
+			return current
+		}
+	}
+	if err := setLogOutput(next); err != nil {
+		log.Printf("keeping the current log output: %s", err)
+	}
+	built, err := handler.build(next)
+	if err != nil {
+		log.Printf("keeping the current configuration: %s", err)
+		return current
+	}
+	previous := handler.swap(built)
+	go previous.Close()
+	log.Printf("configuration reloaded")
+	return next
+}
+
 func main() {
-	rootDir := flag.String("root", "", "the root of the local path to serve.")
-	addr := flag.String("addr", "0.0.0.0:6000", "the address to listen to (default: 0.0.0.0:6000)")
+	c, err := loadConfig(os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if err := setLogOutput(c); err != nil {
+		log.Fatalf("failed to open log file: %s", err)
+	}
+	handler := &swapHandler{}
+	if c.Metrics {
+		handler.registry = &metrics.Registry{}
+		handler.observers.metrics = fshttp.NewMetrics(handler.registry)
+	}
+	closeLogs, err := openLogs(c.Logging, &handler.observers)
+	if err != nil {
+		log.Fatalf("failed to open the access and audit logs: %s", err)
+	}
+	defer closeLogs()
+	provider, err := newTracerProvider(c.Tracing)
+	if err != nil {
+		log.Fatalf("failed to start tracing: %s", err)
+	}
+	if provider != nil {
+		handler.observers.tracer = provider.Tracer("github.com/peymanmortazavi/fs-server")
+		defer shutdownTracing(provider)
+	}
+	if handler.current, err = handler.build(c); err != nil {
+		log.Fatalln(err)
+	}
+
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	go func(current config.Config) {
+		for range hangups {
+			current = reload(handler, current)
+		}
+	}(c)
+
+	files, admin := routes(c, handler)
+	servers := make([]*http.Server, 0, len(c.Listeners))
+	errs := make(chan error, len(c.Listeners))
+	for _, listener := range c.Listeners {
+		server := newHTTPServer(c.HTTP, files)
+		servers = append(servers, server)
+		go func(server *http.Server, listener config.Listener) {
+			if err := serve(server, listener, c.HTTP.MaxConnections); err != http.ErrServerClosed {
+				errs <- err
+			}
+		}(server, listener)
+	}
+
+	if c.AdminAddr != "" {
+		adminServer := newHTTPServer(c.HTTP, admin)
+		go func() {
+			if err := serve(adminServer, config.Listener{Addr: c.AdminAddr}, 0); err != http.ErrServerClosed {
+				errs <- err
+			}
+		}()
+		// the admin listener closes last so probes see the server draining.
+		defer adminServer.Close()
+	}
 
-	flag.Parse()
+	var grpcServer *grpc.Server
+	if c.GRPCAddr != "" {
+		grpcServer = grpc.NewServer()
+		fspb.RegisterFileSystemServer(grpcServer, &swapService{handler: handler})
+		go func() {
+			if err := serveGRPC(grpcServer, c.GRPCAddr); err != nil {
+				errs <- err
+			}
+		}()
+	}
 
-	manager := filesystem.DirManager{Root: *rootDir}
-	handler := &fshttp.Handler{Editor: manager}
-	http.Handle("/", handler)
+	terminations := make(chan os.Signal, 1)
+	signal.Notify(terminations, syscall.SIGTERM, syscall.SIGINT)
+	select {
+	case err := <-errs:
+		log.Fatalln(err)
+	case received := <-terminations:
+		log.Printf("received %s, draining", received)
+	}
+	signal.Stop(hangups)
+	shutdown(handler, servers, grpcServer, c.HTTP)
+}
+
+// shutdown stops accepting requests once load balancers had ShutdownDelay to
+// notice the server is not ready, giving in-flight requests DrainTimeout to
+// finish. The gRPC server is nil when the file system is not served over gRPC.
+func shutdown(handler *swapHandler, servers []*http.Server, grpcServer *grpc.Server, c config.HTTP) {
+	atomic.StoreInt32(&handler.draining, 1)
+	time.Sleep(c.ShutdownDelay)
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.DrainTimeout)
+	defer cancel()
+	handler.mu.RLock()
+	current := handler.current
+	handler.mu.RUnlock()
+	current.stopStreams()
+	var wg sync.WaitGroup
+	for _, server := range servers {
+		wg.Add(1)
+		go func(server *http.Server) {
+			defer wg.Done()
+			if err := server.Shutdown(ctx); err != nil {
+				log.Printf("failed to drain connections: %s", err)
+				server.Close()
+			}
+		}(server)
+	}
+	if grpcServer != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			stopped := make(chan struct{})
+			go func() {
+				grpcServer.GracefulStop()
+				close(stopped)
+			}()
+			select {
+			case <-stopped:
+			case <-ctx.Done():
+				log.Printf("failed to drain gRPC connections: %s", ctx.Err())
+				grpcServer.Stop()
+			}
+		}()
+	}
+	wg.Wait()
+	closed := make(chan struct{})
+	go func() {
+		current.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+		log.Printf("drained")
+	case <-ctx.Done():
+		log.Printf("gave up waiting for in-flight requests")
+	}
+}
 
-	log.Fatalln(http.ListenAndServe(*addr, nil))
+// shutdownTracing exports the spans still queued by the provider.
+func shutdownTracing(provider *sdktrace.TracerProvider) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := provider.Shutdown(ctx); err != nil {
+		log.Printf("failed to export the last spans: %s", err)
+	}
 }
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/peymanmortazavi/fs-server/pkg/config"
+	"github.com/peymanmortazavi/fs-server/pkg/filesystem"
+	"github.com/peymanmortazavi/fs-server/pkg/fsgrpc"
+	"github.com/peymanmortazavi/fs-server/pkg/fshttp"
+	"github.com/peymanmortazavi/fs-server/pkg/webhook"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// server is everything built from one configuration.
+//
+// Closing it first ends the streams of watchers, then waits for in-flight
+// requests before stopping background work, so a replaced server finishes
+// what it started.
+type server struct {
+	handler  http.Handler
+	service  *fsgrpc.Service
+	health   *fshttp.Health
+	requests sync.WaitGroup
+	streams  []func()
+	closers  []func()
+	stopped  sync.Once
+}
+
+// stopStreams ends the streams of watchers, they would otherwise keep their
+// requests in flight.
+func (s *server) stopStreams() {
+	s.stopped.Do(func() {
+		for _, stop := range s.streams {
+			stop()
+		}
+	})
+}
+
+// Close releases everything the server holds once in-flight requests are done.
+func (s *server) Close() {
+	s.stopStreams()
+	s.requests.Wait()
+	for _, close := range s.closers {
+		close()
+	}
+}
+
+// observers record what the servers of the process do, they are kept across
+// reloads.
+type observers struct {
+	// metrics records requests and backend operations when set.
+	metrics *fshttp.Metrics
+
+	access *fshttp.AccessLog
+	audit  *fshttp.AuditLog
+	tracer trace.Tracer
+}
+
+// newServer builds the handler described by the configuration, recording it
+// with the observers.
+func newServer(c config.Config, o observers) (s *server, err error) {
+	s = &server{}
+	defer func() {
+		if err != nil {
+			s.Close()
+		}
+	}()
+	ctx, cancel := context.WithCancel(context.Background())
+	s.closers = append(s.closers, cancel)
+
+	var editor filesystem.Editor
+	var versioned *filesystem.Versioned
+	var trash *filesystem.Trash
+	// writable are the undecorated editors probed by the readiness checks.
+	writable := make(map[string]filesystem.Editor)
+	keys, err := loadKeyring(c)
+	if err != nil {
+		return s, err
+	}
+	backend, local := c.LocalRoot()
+	if !local {
+		table, err := newMountTable(c, o.metrics, keys)
+		if err != nil {
+			return s, err
+		}
+		for _, mount := range table.Mounts() {
+			if !mount.ReadOnly {
+				writable["writable:/"+mount.Path] = mount.Editor
+			}
+		}
+		editor = table
+		if c.Limits.MaxOperations > 0 {
+			editor = filesystem.NewLimited(editor, c.Limits.MaxOperations)
+		}
+	} else {
+		editor = filesystem.DirManager{Root: backend.Root}
+		writable["writable"] = editor
+		if o.metrics != nil {
+			editor = filesystem.NewInstrumented(editor, o.metrics.ObserveOperation)
+		}
+		if c.Limits.MaxOperations > 0 {
+			editor = filesystem.NewLimited(editor, c.Limits.MaxOperations)
+		}
+		if backend.Encrypt {
+			encrypted := filesystem.NewEncrypted(editor, keys)
+			encrypted.AllowPlaintext = c.Encryption.AllowPlaintext
+			editor = encrypted
+		}
+		if backend.Compress {
+			// files are compressed before being encrypted, encrypted content
+			// does not compress.
+			editor = filesystem.NewCompressed(editor)
+		}
+		if c.Versions.Enabled {
+			versioned = filesystem.NewVersioned(editor)
+			versioned.MaxVersions = c.Versions.Max
+			versioned.MaxAge = c.Versions.MaxAge
+			if !c.ReadOnly {
+				go versioned.PruneEvery(ctx, time.Hour)
+			}
+			editor = versioned
+		}
+		if c.Trash.Enabled {
+			if trash, err = filesystem.NewTrash(editor); err != nil {
+				return s, err
+			}
+			trash.Retention = c.Trash.Retention
+			if !c.ReadOnly {
+				go trash.PurgeEvery(ctx, time.Hour)
+			}
+			editor = trash
+		}
+	}
+
+	s.health = &fshttp.Health{Readiness: []fshttp.HealthCheck{fshttp.ReadableCheck(editor, "")}}
+	if o.audit != nil {
+		s.health.Readiness = append(s.health.Readiness, fshttp.AuditCheck(o.audit))
+	}
+	if !c.ReadOnly {
+		for name, probed := range writable {
+			check := fshttp.WritableCheck(probed)
+			check.Name = name
+			s.health.Readiness = append(s.health.Readiness, check)
+		}
+	}
+
+	uploads := &fshttp.Uploads{Dir: c.Limits.UploadPath(), Expiry: c.Limits.UploadExpiry, MaxSize: c.Limits.MaxUploadSize}
+	go uploads.CollectEvery(ctx, time.Hour)
+	usage := &filesystem.UsageCache{MaxAge: c.UsageMaxAge}
+	handler := &fshttp.Handler{
+		Editor:         editor,
+		Digests:        &filesystem.DigestCache{},
+		Uploads:        uploads,
+		Usage:          usage,
+		Trash:          trash,
+		Versions:       versioned,
+		Protected:      c.Limits.Protected,
+		Administrators: c.Auth.Admins,
+		Audit:          o.audit,
+	}
+
+	if c.Watch {
+		watcher, err := filesystem.NewDirWatcher(backend.Root)
+		if err != nil {
+			log.Printf("watching for changes is disabled: %s", err)
+		} else {
+			s.streams = append(s.streams, func() { watcher.Close() })
+			handler.Watcher = watcher
+			if subscription, err := usage.Follow(watcher); err != nil {
+				log.Printf("disk usage is only invalidated by changes made through the server: %s", err)
+			} else {
+				s.closers = append(s.closers, subscription.Close)
+			}
+		}
+	}
+	if c.Index {
+		if handler.Watcher == nil {
+			return s, fmt.Errorf("indexing requires watching the root for changes")
+		}
+		index, err := filesystem.NewIndex(editor, handler.Watcher)
+		if err != nil {
+			return s, fmt.Errorf("failed to index %s: %s", backend.Root, err)
+		}
+		s.closers = append(s.closers, index.Close)
+		handler.Index = index
+	}
+	if c.Webhooks.File != "" {
+		targets, err := webhook.LoadTargets(c.Webhooks.File)
+		if err != nil {
+			return s, err
+		}
+		dispatcher := &webhook.Dispatcher{Targets: targets, QueueDir: c.Webhooks.QueueDir, DeadLetter: c.Webhooks.DeadLetter}
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			if err := dispatcher.Run(ctx); err != nil {
+				log.Printf("failed to deliver webhooks: %s", err)
+			}
+		}()
+		// the context is canceled first, this waits for pending deliveries to stop.
+		s.closers = append(s.closers, func() { <-done })
+		handler.Listeners = append(handler.Listeners, dispatcher)
+	}
+	if c.Limits.QuotasFile != "" {
+		rules, err := fshttp.LoadQuotaRules(c.Limits.QuotasFile)
+		if err != nil {
+			return s, err
+		}
+		handler.Quotas = &fshttp.Quotas{Rules: rules, StatePath: c.Limits.QuotaState, Trash: trash, Versions: versioned}
+		if versioned != nil {
+			versioned.Kept, versioned.Removed = handler.Quotas.VersionKept, handler.Quotas.VersionRemoved
+		}
+		if trash != nil {
+			trash.Purging = handler.Quotas.Purged
+		}
+		if err := handler.Quotas.Init(editor); err != nil {
+			return s, err
+		}
+	}
+
+	s.service = &fsgrpc.Service{
+		Editor:    editor,
+		Watcher:   handler.Watcher,
+		Protected: c.Limits.Protected,
+		Digests:   handler.Digests,
+		Usage:     usage,
+		Trash:     trash,
+		Quotas:    handler.Quotas,
+		Audit:     o.audit,
+		Listeners: handler.Listeners,
+		TempDir:   c.Limits.UploadPath(),
+	}
+	if c.ReadOnly {
+		readOnly := filesystem.ReadOnly{Viewer: editor}
+		handler.Editor, handler.Viewer = nil, readOnly
+		// deletes would otherwise go to the trash past the read-only editor.
+		s.service.Editor, s.service.Trash = readOnly, nil
+	}
+	s.handler = handler
+	if c.Compression.Enabled {
+		compression := &fshttp.Compression{MinSize: c.Compression.MinSize, MaxDecodedSize: c.Compression.MaxDecodedSize}
+		for _, encoding := range c.Compression.Encodings {
+			switch encoding {
+			case "zstd":
+				compression.Codecs = append(compression.Codecs, fshttp.ZstdCodec)
+			case "br":
+				compression.Codecs = append(compression.Codecs, fshttp.BrotliCodec)
+			case "gzip":
+				compression.Codecs = append(compression.Codecs, fshttp.GzipCodec)
+			case "deflate":
+				compression.Codecs = append(compression.Codecs, fshttp.DeflateCodec)
+			}
+		}
+		// responses are compressed before bandwidth is counted.
+		s.handler = fshttp.Chain(s.handler, compression.Middleware)
+	}
+	if rate := c.Limits.Rate; rate.Enabled() {
+		limit := &fshttp.RateLimit{
+			Reads:     fshttp.Rate{Limit: rate.Reads, Burst: rate.ReadBurst},
+			Writes:    fshttp.Rate{Limit: rate.Writes, Burst: rate.WriteBurst},
+			Bandwidth: fshttp.Rate{Limit: float64(rate.Bandwidth), Burst: float64(rate.BandwidthBurst)},
+		}
+		s.handler = fshttp.Chain(s.handler, limit.Middleware)
+	}
+	if c.Auth.UsersFile != "" {
+		accounts, err := fshttp.LoadUsers(c.Auth.UsersFile)
+		if err != nil {
+			return s, err
+		}
+		auth := fshttp.BasicAuth{Users: accounts, Required: c.Auth.Required}
+		if c.Auth.FailedLogins > 0 {
+			auth.Failures = &fshttp.LoginLimit{Rate: fshttp.Rate{Limit: c.Auth.FailedLogins, Burst: c.Auth.FailedLoginBurst}}
+		}
+		s.handler = fshttp.Chain(s.handler, auth.Middleware)
+		s.service.Auth = &auth
+	}
+	if len(c.CORS.AllowedOrigins) > 0 {
+		// preflight requests are answered before authentication, browsers send
+		// them without credentials.
+		cors := &fshttp.CORS{
+			AllowedOrigins:   c.CORS.AllowedOrigins,
+			AllowedMethods:   c.CORS.AllowedMethods,
+			AllowedHeaders:   c.CORS.AllowedHeaders,
+			ExposedHeaders:   c.CORS.ExposedHeaders,
+			AllowCredentials: c.CORS.AllowCredentials,
+			MaxAge:           c.CORS.MaxAge,
+		}
+		s.handler = fshttp.Chain(s.handler, cors.Middleware)
+	}
+	return s, nil
+}
+
+// loadKeyring loads the encryption keys of the configuration, nil when no
+// backend is encrypted.
+func loadKeyring(c config.Config) (*filesystem.Keyring, error) {
+	for _, backend := range c.Backends {
+		if !backend.Encrypt {
+			continue
+		}
+		if c.Encryption.KeyFile != "" {
+			return filesystem.LoadKeyring(c.Encryption.KeyFile)
+		}
+		keys, err := filesystem.ParseKeys(c.Encryption.Keys)
+		if err != nil {
+			return nil, fmt.Errorf("encryption.keys: %s", err)
+		}
+		return keys, nil
+	}
+	return nil, nil
+}
+
+// newMountTable builds an editor serving every mount of the configuration,
+// recording backend operations in m when set and encrypting the backends
+// asking for it with keys.
+func newMountTable(c config.Config, m *fshttp.Metrics, keys *filesystem.Keyring) (*filesystem.MountTable, error) {
+	mounts := make([]filesystem.Mount, 0, len(c.Mounts))
+	editors := make(map[string]filesystem.Editor, len(c.Backends))
+	for _, mount := range c.Mounts {
+		backend, ok := c.Backend(mount.Backend)
+		if !ok {
+			return nil, fmt.Errorf("no backend is named %q", mount.Backend)
+		}
+		// a backend mounted more than once shares its content.
+		editor, ok := editors[backend.Name]
+		switch {
+		case ok:
+		case backend.Type == "local":
+			editor = filesystem.DirManager{Root: backend.Root}
+		case backend.Type == "memory":
+			editor = filesystem.NewMemory()
+		default:
+			return nil, fmt.Errorf("unsupported backend type %q", backend.Type)
+		}
+		if _, shared := editors[backend.Name]; !shared {
+			if m != nil {
+				editor = filesystem.NewInstrumented(editor, m.ObserveOperation)
+			}
+			if backend.Encrypt {
+				encrypted := filesystem.NewEncrypted(editor, keys)
+				encrypted.AllowPlaintext = c.Encryption.AllowPlaintext
+				editor = encrypted
+			}
+			if backend.Compress {
+				editor = filesystem.NewCompressed(editor)
+			}
+		}
+		editors[backend.Name] = editor
+		mounts = append(mounts, filesystem.Mount{Path: mount.Path, Editor: editor, ReadOnly: mount.ReadOnly})
+	}
+	return filesystem.NewMountTable(mounts)
+}
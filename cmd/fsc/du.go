@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/peymanmortazavi/fs-server/pkg/fshttp"
+)
+
+// humanSize formats a number of bytes with a binary unit, like du -h.
+func humanSize(bytes int64) string {
+	const units = "KMGTPE"
+	if bytes < 1024 {
+		return fmt.Sprintf("%dB", bytes)
+	}
+	value, unit := float64(bytes)/1024, 0
+	for value >= 1024 && unit < len(units)-1 {
+		value /= 1024
+		unit++
+	}
+	return fmt.Sprintf("%.1f%c", value, units[unit])
+}
+
+func runDu(scheme, host string, args []string) {
+	flags := flag.NewFlagSet("du", flag.ExitOnError)
+	depth := flags.Int("d", 0, "also print the usage of the children of the path when 1.")
+	human := flags.Bool("h", false, "print sizes in human readable units.")
+	files := flags.Bool("files", false, "also print the number of files and directories.")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: fsc du [flags] [path]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if *depth != 0 && *depth != 1 {
+		log.Fatalln("only a depth of 0 or 1 is supported")
+	}
+
+	itemPath := strings.Trim(flags.Arg(0), "/")
+	target, err := url.Parse(fmt.Sprintf("%s://%s/v1/%s", scheme, host, itemPath))
+	if err != nil {
+		log.Fatalf("invalid host: %s", err)
+	}
+	query := url.Values{"usage": {"true"}}
+	if *depth == 1 {
+		query.Set("depth", "1")
+	}
+	target.RawQuery = query.Encode()
+
+	resp, err := http.Get(target.String())
+	if err != nil {
+		log.Fatalf("request failed: %s", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		log.Fatalln(responseError(resp))
+	}
+	var item fshttp.FileItem
+	if err := json.NewDecoder(resp.Body).Decode(&item); err != nil {
+		log.Fatalf("failed to parse response as JSON: %s", err)
+	}
+
+	show := func(usage *fshttp.DiskUsage, name string) {
+		if usage == nil {
+			return
+		}
+		size := fmt.Sprint(usage.Bytes)
+		if *human {
+			size = humanSize(usage.Bytes)
+		}
+		if *files {
+			fmt.Printf("%s\t%d\t%d\t%s\n", size, usage.Files, usage.Dirs, name)
+		} else {
+			fmt.Printf("%s\t%s\n", size, name)
+		}
+	}
+	if itemPath == "" {
+		itemPath = "."
+	}
+	for _, child := range item.Children {
+		show(child.Usage, path.Join(itemPath, child.Name))
+	}
+	show(item.Usage, itemPath)
+}
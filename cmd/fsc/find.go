@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/peymanmortazavi/fs-server/pkg/fshttp"
+)
+
+func runFind(scheme, host string, args []string) {
+	flags := flag.NewFlagSet("find", flag.ExitOnError)
+	name := flags.String("name", "", "glob the item names must match, like *.txt.")
+	regex := flags.String("regex", "", "regular expression the item paths must match.")
+	itemType := flags.String("type", "", "only find items of this type, file or dir.")
+	minSize := flags.Int64("min-size", 0, "minimum size in bytes.")
+	maxSize := flags.Int64("max-size", 0, "maximum size in bytes.")
+	newer := flags.Duration("newer", 0, "only find items modified within this duration, like 24h.")
+	older := flags.Duration("older", 0, "only find items modified before this duration, like 24h.")
+	grep := flags.String("grep", "", "regular expression file content must match, matching lines are printed.")
+	limit := flags.Int("limit", 0, "maximum number of results.")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: fsc find [flags] [path]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	target, err := url.Parse(fmt.Sprintf("%s://%s/v1/%s", scheme, host, strings.Trim(flags.Arg(0), "/")))
+	if err != nil {
+		log.Fatalf("invalid host: %s", err)
+	}
+	query := url.Values{"search": {*name}}
+	for key, value := range map[string]string{"regex": *regex, "type": *itemType, "grep": *grep} {
+		if value != "" {
+			query.Set(key, value)
+		}
+	}
+	for key, value := range map[string]int64{"minSize": *minSize, "maxSize": *maxSize, "limit": int64(*limit)} {
+		if value > 0 {
+			query.Set(key, strconv.FormatInt(value, 10))
+		}
+	}
+	if *newer > 0 {
+		query.Set("modifiedAfter", time.Now().Add(-*newer).Format(time.RFC3339))
+	}
+	if *older > 0 {
+		query.Set("modifiedBefore", time.Now().Add(-*older).Format(time.RFC3339))
+	}
+	target.RawQuery = query.Encode()
+
+	resp, err := http.Get(target.String())
+	if err != nil {
+		log.Fatalf("request failed: %s", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		log.Fatalln(responseError(resp))
+	}
+	var result fshttp.SearchResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		log.Fatalf("failed to parse response as JSON: %s", err)
+	}
+	for _, match := range result.Matches {
+		if len(match.Lines) == 0 {
+			fmt.Println(match.Path)
+		}
+		for _, line := range match.Lines {
+			fmt.Printf("%s:%d: %s\n", match.Path, line.Number, line.Text)
+		}
+	}
+	if result.Truncated {
+		fmt.Fprintln(os.Stderr, "more items matched, use --limit to see more.")
+	}
+}
@@ -17,19 +17,44 @@ func main() {
 	host := flag.String("host", "0.0.0.0:6000", "the host to use for the API.")
 	insecure := flag.Bool("insecure", false, "use insecure API.")
 	raw := flag.Bool("raw", false, "get raw response.")
+	checksum := flag.String("checksum", "", "include a checksum of files (sha256, sha1, md5 or crc32c).")
 
 	flag.Parse()
 
-	path := flag.Arg(0)
-
 	scheme := "https"
 	if *insecure {
 		scheme = "http"
 	}
-	url, err := url.Parse(fmt.Sprintf("%s://%s/%s", scheme, *host, path))
+
+	switch flag.Arg(0) {
+	case "upload":
+		runUpload(scheme, *host, flag.Args()[1:])
+		return
+	case "watch":
+		runWatch(scheme, *host, flag.Args()[1:])
+		return
+	case "find":
+		runFind(scheme, *host, flag.Args()[1:])
+		return
+	case "du":
+		runDu(scheme, *host, flag.Args()[1:])
+		return
+	case "trash":
+		runTrash(scheme, *host, flag.Args()[1:])
+		return
+	case "versions":
+		runVersions(scheme, *host, flag.Args()[1:])
+		return
+	}
+
+	path := flag.Arg(0)
+	url, err := url.Parse(fmt.Sprintf("%s://%s/v1/%s", scheme, *host, path))
 	if err != nil {
 		log.Fatalf("invalid host: %s", err)
 	}
+	if *checksum != "" {
+		url.RawQuery = "checksum=" + *checksum
+	}
 
 	req, err := http.NewRequest("GET", url.String(), nil)
 	if err != nil {
@@ -69,6 +94,9 @@ func printItem(item *fshttp.FileItem) {
 	fmt.Printf("owner: %s\n", item.Owner)
 	fmt.Printf("type: %s\n", item.Type)
 	fmt.Printf("size (in bytes): %d\n", item.Size)
+	if item.Checksum != nil {
+		fmt.Printf("checksum (%s): %s\n", item.Checksum.Algorithm, item.Checksum.Value)
+	}
 	switch item.Type {
 	case fshttp.DirType:
 		if len(item.Children) > 0 {
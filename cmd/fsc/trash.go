@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/peymanmortazavi/fs-server/pkg/fshttp"
+)
+
+// runTrash lists, restores or purges trash entries. Purging requires the
+// credentials of an administrator, given in the host like user:password@host.
+func runTrash(scheme, host string, args []string) {
+	flags := flag.NewFlagSet("trash", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: fsc trash [path]")
+		fmt.Fprintln(flags.Output(), "       fsc trash restore <id>")
+		fmt.Fprintln(flags.Output(), "       fsc trash purge <id>")
+	}
+	flags.Parse(args)
+
+	method, query := http.MethodGet, url.Values{"trash": {"true"}}
+	itemPath := flags.Arg(0)
+	switch flags.Arg(0) {
+	case "restore", "purge":
+		if flags.NArg() != 2 {
+			flags.Usage()
+			return
+		}
+		itemPath = ""
+		if flags.Arg(0) == "restore" {
+			method, query = http.MethodPost, url.Values{"restore": {flags.Arg(1)}}
+		} else {
+			method, query = http.MethodDelete, url.Values{"trash": {flags.Arg(1)}}
+		}
+	}
+
+	target, err := url.Parse(fmt.Sprintf("%s://%s/v1/%s", scheme, host, strings.Trim(itemPath, "/")))
+	if err != nil {
+		log.Fatalf("invalid host: %s", err)
+	}
+	target.RawQuery = query.Encode()
+	req, err := http.NewRequest(method, target.String(), nil)
+	if err != nil {
+		log.Fatalf("failed to create request: %s", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		log.Fatalf("request failed: %s", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		log.Fatalln(responseError(resp))
+	}
+
+	switch method {
+	case http.MethodGet:
+		var entries []fshttp.TrashEntry
+		if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+			log.Fatalf("failed to parse response as JSON: %s", err)
+		}
+		for _, entry := range entries {
+			fmt.Printf("%s  %s  %-4s  %-10s  /%s\n", entry.ID, entry.DeletedAt.Local().Format("2006-01-02 15:04"), entry.Type, entry.DeletedBy, entry.Path)
+		}
+	case http.MethodPost:
+		var entry fshttp.TrashEntry
+		if err := json.NewDecoder(resp.Body).Decode(&entry); err != nil {
+			log.Fatalf("failed to parse response as JSON: %s", err)
+		}
+		fmt.Printf("restored /%s\n", entry.Path)
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const tusVersion = "1.0.0"
+
+// uploadState remembers upload locations so an interrupted upload can resume
+// from where it stopped, even in a later run.
+type uploadState map[string]string
+
+func uploadStatePath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "fsc", "uploads.json"), nil
+}
+
+func loadUploadState() uploadState {
+	state := uploadState{}
+	path, err := uploadStatePath()
+	if err != nil {
+		return state
+	}
+	if data, err := ioutil.ReadFile(path); err == nil {
+		_ = json.Unmarshal(data, &state)
+	}
+	return state
+}
+
+func (s uploadState) save() {
+	path, err := uploadStatePath()
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		log.Printf("failed to save upload state: %s", err)
+		return
+	}
+	data, _ := json.Marshal(s)
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		log.Printf("failed to save upload state: %s", err)
+	}
+}
+
+func runUpload(scheme, host string, args []string) {
+	flags := flag.NewFlagSet("upload", flag.ExitOnError)
+	chunkSize := flags.Int64("chunk-size", 8<<20, "size of each uploaded chunk in bytes.")
+	retries := flags.Int("retries", 10, "number of consecutive failures before giving up.")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: fsc upload [flags] <local file> <remote path>")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 2 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	local, remote := flags.Arg(0), strings.Trim(flags.Arg(1), "/")
+	file, err := os.Open(local)
+	if err != nil {
+		log.Fatalf("failed to open %s: %s", local, err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		log.Fatalf("failed to stat %s: %s", local, err)
+	}
+	absolute, _ := filepath.Abs(local)
+
+	base := fmt.Sprintf("%s://%s/v1", scheme, host)
+	key := fmt.Sprintf("%s|%s|%s|%d|%d", base, remote, absolute, info.Size(), info.ModTime().UnixNano())
+	state := loadUploadState()
+
+	location, offset := state[key], int64(-1)
+	if location != "" {
+		if offset, err = uploadOffset(location); err != nil {
+			log.Printf("could not resume previous upload, starting over: %s", err)
+			location = ""
+		} else {
+			log.Printf("resuming upload at %d of %d bytes", offset, info.Size())
+		}
+	}
+	if location == "" {
+		if location, err = createUpload(base, remote, info.Size()); err != nil {
+			log.Fatalf("failed to create upload: %s", err)
+		}
+		offset = 0
+		state[key] = location
+		state.save()
+	}
+
+	failures := 0
+	for offset < info.Size() {
+		next, err := uploadChunk(location, file, offset, *chunkSize)
+		if err == nil {
+			offset, failures = next, 0
+			continue
+		}
+		failures++
+		if failures > *retries {
+			log.Fatalf("upload failed, run the same command again to resume: %s", err)
+		}
+		wait := time.Duration(1<<uint(failures-1)) * time.Second
+		if wait > time.Minute {
+			wait = time.Minute
+		}
+		log.Printf("chunk at %d failed, retrying in %s: %s", offset, wait, err)
+		time.Sleep(wait)
+		if current, err := uploadOffset(location); err == nil {
+			offset = current
+		}
+	}
+
+	delete(state, key)
+	state.save()
+	fmt.Printf("uploaded %d bytes to /%s\n", info.Size(), remote)
+}
+
+func createUpload(base, remote string, length int64) (string, error) {
+	req, err := http.NewRequest("POST", base+"/"+remote, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Tus-Resumable", tusVersion)
+	req.Header.Set("Upload-Length", strconv.FormatInt(length, 10))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return "", responseError(resp)
+	}
+	location, err := resp.Request.URL.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		return "", err
+	}
+	return location.String(), nil
+}
+
+func uploadOffset(location string) (int64, error) {
+	req, err := http.NewRequest("HEAD", location, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Tus-Resumable", tusVersion)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("request failed with status %d", resp.StatusCode)
+	}
+	return strconv.ParseInt(resp.Header.Get("Upload-Offset"), 10, 64)
+}
+
+// uploadChunk sends up to size bytes of the file starting at offset and
+// returns the new offset of the upload.
+func uploadChunk(location string, file *os.File, offset, size int64) (int64, error) {
+	chunk := make([]byte, size)
+	n, err := file.ReadAt(chunk, offset)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return offset, err
+	}
+	chunk = chunk[:n]
+	sum := sha256.Sum256(chunk)
+
+	req, err := http.NewRequest("PATCH", location, bytes.NewReader(chunk))
+	if err != nil {
+		return offset, err
+	}
+	req.Header.Set("Tus-Resumable", tusVersion)
+	req.Header.Set("Content-Type", "application/offset+octet-stream")
+	req.Header.Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	req.Header.Set("Upload-Checksum", "sha256 "+base64.StdEncoding.EncodeToString(sum[:]))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return offset, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		return offset, responseError(resp)
+	}
+	return strconv.ParseInt(resp.Header.Get("Upload-Offset"), 10, 64)
+}
+
+func responseError(resp *http.Response) error {
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("request failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+}
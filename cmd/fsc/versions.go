@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/peymanmortazavi/fs-server/pkg/fshttp"
+)
+
+func runVersions(scheme, host string, args []string) {
+	flags := flag.NewFlagSet("versions", flag.ExitOnError)
+	show := flags.Int("show", 0, "print the content of this version.")
+	restore := flags.Int("restore", 0, "restore this version.")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: fsc versions [flags] <path>")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 || (*show > 0 && *restore > 0) {
+		flags.Usage()
+		return
+	}
+
+	target, err := url.Parse(fmt.Sprintf("%s://%s/v1/%s", scheme, host, strings.Trim(flags.Arg(0), "/")))
+	if err != nil {
+		log.Fatalf("invalid host: %s", err)
+	}
+	method := http.MethodGet
+	switch {
+	case *show > 0:
+		target.RawQuery = "version=" + strconv.Itoa(*show)
+	case *restore > 0:
+		method = http.MethodPut
+		target.RawQuery = "version=" + strconv.Itoa(*restore)
+	default:
+		target.RawQuery = "versions"
+	}
+	req, err := http.NewRequest(method, target.String(), nil)
+	if err != nil {
+		log.Fatalf("failed to create request: %s", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		log.Fatalf("request failed: %s", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		log.Fatalln(responseError(resp))
+	}
+
+	switch {
+	case *show > 0:
+		var item fshttp.FileItem
+		if err := json.NewDecoder(resp.Body).Decode(&item); err != nil {
+			log.Fatalf("failed to parse response as JSON: %s", err)
+		}
+		fmt.Print(item.Data)
+	case *restore > 0:
+		fmt.Printf("restored version %d of /%s\n", *restore, strings.Trim(flags.Arg(0), "/"))
+	default:
+		var versions []fshttp.FileVersion
+		if err := json.NewDecoder(resp.Body).Decode(&versions); err != nil {
+			log.Fatalf("failed to parse response as JSON: %s", err)
+		}
+		for _, version := range versions {
+			fmt.Printf("%5d  %s  %10d\n", version.Version, version.Time.Local().Format("2006-01-02 15:04:05"), version.Size)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/peymanmortazavi/fs-server/pkg/fshttp"
+)
+
+func runWatch(scheme, host string, args []string) {
+	flags := flag.NewFlagSet("watch", flag.ExitOnError)
+	recursive := flags.Bool("recursive", false, "watch the whole subtree instead of direct children only.")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: fsc watch [flags] <path>")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	target, err := url.Parse(fmt.Sprintf("%s://%s/v1/%s", scheme, host, strings.Trim(flags.Arg(0), "/")))
+	if err != nil {
+		log.Fatalf("invalid host: %s", err)
+	}
+	query := url.Values{"watch": {"true"}}
+	if *recursive {
+		query.Set("recursive", "true")
+	}
+	target.RawQuery = query.Encode()
+
+	// reconnect whenever the stream ends, resuming after the last seen event.
+	lastEventID := ""
+	for {
+		var err error
+		if lastEventID, err = streamWatch(target.String(), lastEventID); err != nil {
+			log.Printf("watch interrupted, reconnecting: %s", err)
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+func streamWatch(target, lastEventID string) (string, error) {
+	req, err := http.NewRequest("GET", target, nil)
+	if err != nil {
+		return lastEventID, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return lastEventID, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		err := responseError(resp)
+		if resp.StatusCode < 500 {
+			log.Fatalln(err)
+		}
+		return lastEventID, err
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "id: "):
+			lastEventID = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "data: "):
+			var event fshttp.WatchEvent
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event); err != nil {
+				log.Printf("invalid event: %s", err)
+				continue
+			}
+			printEvent(&event)
+		}
+	}
+	return lastEventID, scanner.Err()
+}
+
+func printEvent(event *fshttp.WatchEvent) {
+	if event.OldPath != "" {
+		fmt.Fprintf(os.Stdout, "%s  %-7s %s -> %s\n", event.Time.Format(time.RFC3339), event.Type, event.OldPath, event.Path)
+		return
+	}
+	fmt.Fprintf(os.Stdout, "%s  %-7s %s\n", event.Time.Format(time.RFC3339), event.Type, event.Path)
+}
@@ -0,0 +1,599 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix prefixes the environment variables overriding configuration values.
+const EnvPrefix = "FS_SERVER"
+
+// Listener is an address the server accepts connections on, served over TLS
+// when a certificate and key are given.
+type Listener struct {
+	Addr    string `yaml:"addr"`
+	TLSCert string `yaml:"tls_cert,omitempty"`
+	TLSKey  string `yaml:"tls_key,omitempty"`
+}
+
+// HTTP configures the connections of every listener.
+type HTTP struct {
+	// ReadTimeout bounds reading a whole request including its body, and
+	// ReadHeaderTimeout reading its headers. WriteTimeout bounds writing a
+	// response and is disabled by default since watch streams and large
+	// downloads are long lived. Zero disables a timeout.
+	ReadTimeout       time.Duration `yaml:"read_timeout,omitempty"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout,omitempty"`
+	WriteTimeout      time.Duration `yaml:"write_timeout,omitempty"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout,omitempty"`
+
+	MaxHeaderBytes int `yaml:"max_header_bytes,omitempty"`
+
+	// MaxConnections is how many connections every listener accepts at once,
+	// zero is unlimited.
+	MaxConnections int `yaml:"max_connections,omitempty"`
+
+	// ShutdownDelay is how long the server keeps serving while not ready once
+	// asked to terminate, so load balancers stop sending it requests. In-flight
+	// requests are then given DrainTimeout to finish.
+	ShutdownDelay time.Duration `yaml:"shutdown_delay,omitempty"`
+	DrainTimeout  time.Duration `yaml:"drain_timeout,omitempty"`
+
+	// BasePath is the prefix the API is served beneath, like /api/files, its
+	// version 1 is at /api/files/v1. Health checks and metrics stay at the root.
+	BasePath string `yaml:"base_path,omitempty"`
+
+	// Unversioned also serves the API directly beneath BasePath as before it
+	// was versioned, marking its responses as deprecated. Root items named
+	// like the routes of the server, like v1 or healthz, are then only
+	// reachable beneath the version.
+	Unversioned bool `yaml:"unversioned"`
+}
+
+// Backend is a file system the server can mount.
+type Backend struct {
+	Name string `yaml:"name"`
+
+	// Type is the kind of backend, a local directory or memory. The content of
+	// memory backends is lost on restart and reload.
+	Type string `yaml:"type"`
+
+	// Root is the local directory of a local backend.
+	Root string `yaml:"root,omitempty"`
+
+	// Compress stores files compressed with gzip, they are still served
+	// uncompressed.
+	Compress bool `yaml:"compress,omitempty"`
+
+	// Encrypt stores files encrypted with the current key of the encryption
+	// keyring, they are still served decrypted.
+	Encrypt bool `yaml:"encrypt,omitempty"`
+}
+
+// Mount serves a backend at a path, mounts with longer paths take precedence.
+type Mount struct {
+	Path     string `yaml:"path"`
+	Backend  string `yaml:"backend"`
+	ReadOnly bool   `yaml:"read_only,omitempty"`
+}
+
+// Auth configures who can sign in and what they can do.
+type Auth struct {
+	// UsersFile lists a name:bcrypt-hash line per user allowed to sign in with
+	// basic authentication.
+	UsersFile string `yaml:"users_file,omitempty"`
+
+	// Required rejects anonymous requests.
+	Required bool `yaml:"required,omitempty"`
+
+	// Admins may delete permanently and purge the trash.
+	Admins []string `yaml:"admins,omitempty"`
+
+	// FailedLogins is the failed sign-ins per second allowed to every IP
+	// address, up to FailedLoginBurst at once, checked before credentials are
+	// verified. Zero is unlimited.
+	FailedLogins     float64 `yaml:"failed_logins,omitempty"`
+	FailedLoginBurst float64 `yaml:"failed_login_burst,omitempty"`
+}
+
+// CORS configures which origins browsers may call the server from, no origin
+// is allowed when AllowedOrigins is empty.
+type CORS struct {
+	// AllowedOrigins are origins like https://app.example.com, a * matches any
+	// part of an origin like https://*.example.com and * alone every origin.
+	AllowedOrigins []string `yaml:"allowed_origins,omitempty"`
+
+	// AllowedMethods, AllowedHeaders and ExposedHeaders default to what the
+	// server uses.
+	AllowedMethods []string `yaml:"allowed_methods,omitempty"`
+	AllowedHeaders []string `yaml:"allowed_headers,omitempty"`
+	ExposedHeaders []string `yaml:"exposed_headers,omitempty"`
+
+	AllowCredentials bool          `yaml:"allow_credentials,omitempty"`
+	MaxAge           time.Duration `yaml:"max_age,omitempty"`
+}
+
+// Compression configures compressing responses and decoding compressed
+// request bodies.
+type Compression struct {
+	// Enabled compresses the JSON and text responses of clients accepting it.
+	Enabled bool `yaml:"enabled"`
+
+	// Encodings are the content codings used in order of preference, zstd,
+	// br, gzip and deflate are supported.
+	Encodings []string `yaml:"encodings,omitempty"`
+
+	// MinSize is the size of the smallest response compressed.
+	MinSize int `yaml:"min_size,omitempty"`
+
+	// MaxDecodedSize bounds the size of compressed request bodies once
+	// decoded.
+	MaxDecodedSize int64 `yaml:"max_decoded_size,omitempty"`
+}
+
+// Encryption configures the keys of backends storing files encrypted, given
+// as id:base64-key entries of AES keys of 16, 24 or 32 bytes, the last one
+// encrypting new files. Keys are rotated by adding a new last key, the older
+// ones are kept as long as files are encrypted with them.
+type Encryption struct {
+	// KeyFile has an entry per line.
+	KeyFile string `yaml:"key_file,omitempty"`
+
+	// Keys are the entries themselves, better given with the
+	// FS_SERVER_ENCRYPTION_KEYS environment variable than written down.
+	Keys []string `yaml:"keys,omitempty"`
+
+	// AllowPlaintext serves the files of encrypted backends stored without
+	// encryption as they are, to migrate files written before encryption was
+	// enabled. They fail to read otherwise.
+	AllowPlaintext bool `yaml:"allow_plaintext,omitempty"`
+}
+
+// Limits bounds what clients can use.
+type Limits struct {
+	MaxUploadSize int64         `yaml:"max_upload_size,omitempty"`
+	UploadExpiry  time.Duration `yaml:"upload_expiry,omitempty"`
+
+	// UploadDir holds partial uploads and gRPC writes unencrypted until they
+	// are complete, it is required along with encrypted backends so they are
+	// not staged in the temporary directory by default.
+	UploadDir string `yaml:"upload_dir,omitempty"`
+
+	// QuotasFile is a JSON file listing quota rules, the usage of principals is
+	// kept in QuotaState across restarts.
+	QuotasFile string `yaml:"quotas_file,omitempty"`
+	QuotaState string `yaml:"quota_state,omitempty"`
+
+	// Protected paths can never be deleted.
+	Protected []string `yaml:"protected,omitempty"`
+
+	// Rate bounds the requests of every client.
+	Rate RateLimits `yaml:"rate,omitempty"`
+
+	// MaxOperations bounds how many backend operations run at once, zero is
+	// unlimited.
+	MaxOperations int `yaml:"max_operations,omitempty"`
+}
+
+// RateLimits bounds the requests of every client, identified by its principal
+// or its IP address. A zero rate is unlimited and a zero burst allows a second
+// worth of requests or bytes at once.
+type RateLimits struct {
+	// Reads and Writes are requests per second.
+	Reads      float64 `yaml:"reads,omitempty"`
+	ReadBurst  float64 `yaml:"read_burst,omitempty"`
+	Writes     float64 `yaml:"writes,omitempty"`
+	WriteBurst float64 `yaml:"write_burst,omitempty"`
+
+	// Bandwidth is the bytes per second of request and response bodies.
+	Bandwidth      int64 `yaml:"bandwidth,omitempty"`
+	BandwidthBurst int64 `yaml:"bandwidth_burst,omitempty"`
+}
+
+// UploadPath returns UploadDir, a directory of the temporary directory when it
+// is not set.
+func (l Limits) UploadPath() string {
+	if l.UploadDir != "" {
+		return l.UploadDir
+	}
+	return filepath.Join(os.TempDir(), "fs-server-uploads")
+}
+
+// Enabled returns if any rate is limited.
+func (r RateLimits) Enabled() bool {
+	return r.Reads > 0 || r.Writes > 0 || r.Bandwidth > 0
+}
+
+// Logging configures where logs are written.
+type Logging struct {
+	// File receives the logs when set, they are written to stderr otherwise.
+	File string `yaml:"file,omitempty"`
+
+	// Access receives a JSON line per request and Audit a hash-chained JSON
+	// line per mutation when set, "-" writes them to stdout.
+	Access string `yaml:"access,omitempty"`
+	Audit  string `yaml:"audit,omitempty"`
+
+	// AuditKeyFile holds the key sealing the records of the audit log, it is
+	// required along with Audit and cannot be in the directory of the log.
+	AuditKeyFile string `yaml:"audit_key_file,omitempty"`
+
+	// MaxSize rotates the access and audit log files once they would grow
+	// beyond it in bytes, keeping MaxBackups previous files. 0 never rotates.
+	MaxSize    int64 `yaml:"max_size,omitempty"`
+	MaxBackups int   `yaml:"max_backups,omitempty"`
+}
+
+// Tracing configures exporting the spans of requests and backend operations.
+type Tracing struct {
+	// Exporter is "otlp" to post spans to Endpoint, an OTLP/HTTP collector, or
+	// "stdout". Nothing is traced when it is empty.
+	Exporter string `yaml:"exporter,omitempty"`
+	Endpoint string `yaml:"endpoint,omitempty"`
+
+	// Service names the server in traces.
+	Service string `yaml:"service,omitempty"`
+}
+
+// Trash configures keeping deleted items.
+type Trash struct {
+	Enabled   bool          `yaml:"enabled"`
+	Retention time.Duration `yaml:"retention,omitempty"`
+}
+
+// Versions configures keeping previous content of files.
+type Versions struct {
+	Enabled bool          `yaml:"enabled"`
+	Max     int           `yaml:"max,omitempty"`
+	MaxAge  time.Duration `yaml:"max_age,omitempty"`
+}
+
+// Webhooks configures notifying HTTP endpoints about mutations.
+type Webhooks struct {
+	File       string `yaml:"file,omitempty"`
+	QueueDir   string `yaml:"queue_dir,omitempty"`
+	DeadLetter string `yaml:"dead_letter,omitempty"`
+}
+
+// Config describes everything fs-server serves and how.
+type Config struct {
+	Listeners []Listener `yaml:"listeners"`
+	HTTP      HTTP       `yaml:"http,omitempty"`
+
+	// AdminAddr is where health checks and metrics are served, they are served
+	// on every listener when it is empty.
+	AdminAddr string `yaml:"admin_addr,omitempty"`
+
+	// GRPCAddr is where the file system is served over gRPC, it is not served
+	// over gRPC when empty. Quotas, rate limits, the audit log and webhooks
+	// only apply to HTTP so they cannot be set along with it.
+	GRPCAddr string `yaml:"grpc_addr,omitempty"`
+
+	// Metrics serves Prometheus metrics at /metrics.
+	Metrics bool `yaml:"metrics"`
+
+	Tracing Tracing `yaml:"tracing,omitempty"`
+
+	Backends []Backend `yaml:"backends"`
+	Mounts   []Mount   `yaml:"mounts"`
+	Auth     Auth      `yaml:"auth,omitempty"`
+	CORS     CORS      `yaml:"cors,omitempty"`
+
+	Compression Compression `yaml:"compression,omitempty"`
+	Encryption  Encryption  `yaml:"encryption,omitempty"`
+	Limits      Limits      `yaml:"limits,omitempty"`
+	Logging     Logging     `yaml:"logging,omitempty"`
+
+	// ReadOnly serves every backend without allowing any change.
+	ReadOnly bool `yaml:"read_only,omitempty"`
+
+	// Watch follows changes of local backends so clients can subscribe to them,
+	// Index keeps the tree in memory to answer searches and requires Watch.
+	Watch bool `yaml:"watch"`
+	Index bool `yaml:"index,omitempty"`
+
+	// UsageMaxAge is how long measured disk usage is cached.
+	UsageMaxAge time.Duration `yaml:"usage_max_age,omitempty"`
+
+	Trash    Trash    `yaml:"trash"`
+	Versions Versions `yaml:"versions,omitempty"`
+	Webhooks Webhooks `yaml:"webhooks,omitempty"`
+}
+
+// Default returns the configuration used when no file is given, serving the
+// working directory on port 6000.
+func Default() Config {
+	return Config{
+		Listeners: []Listener{{Addr: "0.0.0.0:6000"}},
+		HTTP: HTTP{
+			ReadTimeout:       10 * time.Minute,
+			ReadHeaderTimeout: 10 * time.Second,
+			IdleTimeout:       2 * time.Minute,
+			MaxHeaderBytes:    1 << 20,
+			MaxConnections:    1024,
+			ShutdownDelay:     5 * time.Second,
+			DrainTimeout:      30 * time.Second,
+			BasePath:          "/",
+		},
+		Backends: []Backend{{Name: "local", Type: "local"}},
+		Mounts:   []Mount{{Path: "/", Backend: "local"}},
+		Auth:     Auth{FailedLogins: 1, FailedLoginBurst: 10},
+		Limits: Limits{
+			UploadExpiry: 24 * time.Hour,
+		},
+		Logging:     Logging{MaxSize: 100 << 20, MaxBackups: 5},
+		Metrics:     true,
+		Compression: Compression{Enabled: true, Encodings: []string{"gzip", "deflate"}, MinSize: 1024, MaxDecodedSize: 64 << 20},
+		Tracing:     Tracing{Endpoint: "http://localhost:4318/v1/traces", Service: "fs-server"},
+		Watch:       true,
+		UsageMaxAge: 5 * time.Minute,
+		Trash:       Trash{Retention: 30 * 24 * time.Hour},
+		Versions:    Versions{Max: 20},
+	}
+}
+
+// Load reads a YAML configuration file over the defaults and applies the
+// environment overrides. Unknown keys are rejected.
+func Load(path string) (Config, error) {
+	config := Default()
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return config, err
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&config); err != nil && err != io.EOF {
+		return config, fmt.Errorf("invalid configuration in %s: %s", path, err)
+	}
+	if err := ApplyEnv(&config, os.Environ()); err != nil {
+		return config, err
+	}
+	return config, nil
+}
+
+// Backend returns the backend with the given name.
+func (c *Config) Backend(name string) (*Backend, bool) {
+	for i := range c.Backends {
+		if c.Backends[i].Name == name {
+			return &c.Backends[i], true
+		}
+	}
+	return nil, false
+}
+
+// RootBackend returns the backend mounted at the root.
+func (c *Config) RootBackend() (*Backend, bool) {
+	for _, mount := range c.Mounts {
+		if strings.Trim(mount.Path, "/") == "" {
+			return c.Backend(mount.Backend)
+		}
+	}
+	return nil, false
+}
+
+// LocalRoot returns the backend when the configuration mounts a single writable
+// local backend at the root, the only layout watching, indexing, the trash and
+// versions support.
+func (c *Config) LocalRoot() (*Backend, bool) {
+	if len(c.Mounts) != 1 || c.Mounts[0].ReadOnly {
+		return nil, false
+	}
+	backend, ok := c.RootBackend()
+	return backend, ok && backend.Type == "local"
+}
+
+// Validate returns an error describing every problem of the configuration.
+func (c *Config) Validate() error {
+	var problems []string
+	problem := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if len(c.Listeners) == 0 {
+		problem("listeners: at least one listener is required")
+	}
+	for i, listener := range c.Listeners {
+		if _, _, err := net.SplitHostPort(listener.Addr); err != nil {
+			problem("listeners[%d].addr: %s", i, err)
+		}
+		if listener.Addr == c.AdminAddr {
+			problem("listeners[%d].addr: %s is the admin address", i, listener.Addr)
+		}
+		if listener.Addr == c.GRPCAddr {
+			problem("listeners[%d].addr: %s is the gRPC address", i, listener.Addr)
+		}
+		if (listener.TLSCert == "") != (listener.TLSKey == "") {
+			problem("listeners[%d]: tls_cert and tls_key must be given together", i)
+		}
+	}
+
+	if _, _, err := net.SplitHostPort(c.AdminAddr); c.AdminAddr != "" && err != nil {
+		problem("admin_addr: %s", err)
+	}
+	if _, _, err := net.SplitHostPort(c.GRPCAddr); c.GRPCAddr != "" && err != nil {
+		problem("grpc_addr: %s", err)
+	} else if c.GRPCAddr != "" && c.GRPCAddr == c.AdminAddr {
+		problem("grpc_addr: %s is the admin address", c.GRPCAddr)
+	}
+	if base := c.HTTP.BasePath; base != "" && (!strings.HasPrefix(base, "/") || path.Clean(base) != base) {
+		problem("http.base_path: %q is not a clean absolute path", c.HTTP.BasePath)
+	}
+
+	names := make(map[string]bool, len(c.Backends))
+	for i, backend := range c.Backends {
+		switch {
+		case backend.Name == "":
+			problem("backends[%d].name: a name is required", i)
+		case names[backend.Name]:
+			problem("backends[%d].name: %q is used by another backend", i, backend.Name)
+		}
+		names[backend.Name] = true
+		switch backend.Type {
+		case "local":
+			if info, err := os.Stat(backend.Root); backend.Root != "" && (err != nil || !info.IsDir()) {
+				problem("backends[%d].root: %q is not a directory", i, backend.Root)
+			}
+		case "memory":
+			if backend.Root != "" {
+				problem("backends[%d].root: memory backends have no root", i)
+			}
+		default:
+			problem("backends[%d].type: unsupported type %q, only local and memory are supported", i, backend.Type)
+		}
+		if backend.Encrypt && c.Encryption.KeyFile == "" && len(c.Encryption.Keys) == 0 {
+			problem("backends[%d].encrypt: requires encryption.key_file or encryption.keys", i)
+		}
+		if backend.Encrypt && c.Limits.UploadDir == "" {
+			problem("backends[%d].encrypt: requires limits.upload_dir, partial uploads are staged unencrypted", i)
+		}
+	}
+	if c.Encryption.KeyFile != "" && len(c.Encryption.Keys) > 0 {
+		problem("encryption.keys: cannot be given along with encryption.key_file")
+	}
+
+	if len(c.Mounts) == 0 {
+		problem("mounts: at least one mount is required")
+	}
+	paths := make(map[string]bool, len(c.Mounts))
+	for i, mount := range c.Mounts {
+		mountPath := strings.Trim(mount.Path, "/")
+		if path.Clean("/"+mountPath) != "/"+mountPath {
+			problem("mounts[%d].path: %q is not a clean path", i, mount.Path)
+		}
+		if paths[mountPath] {
+			problem("mounts[%d].path: %q is mounted more than once", i, mount.Path)
+		}
+		paths[mountPath] = true
+		if !names[mount.Backend] {
+			problem("mounts[%d].backend: no backend is named %q", i, mount.Backend)
+		}
+	}
+
+	if _, ok := c.LocalRoot(); !ok {
+		for _, feature := range []struct {
+			key     string
+			enabled bool
+		}{
+			{"watch", c.Watch},
+			{"index", c.Index},
+			{"trash.enabled", c.Trash.Enabled},
+			{"versions.enabled", c.Versions.Enabled},
+		} {
+			if feature.enabled {
+				problem("%s: requires a single writable local backend mounted at /", feature.key)
+			}
+		}
+	}
+
+	if c.Auth.Required && c.Auth.UsersFile == "" {
+		problem("auth.required: requires auth.users_file")
+	}
+	for i, origin := range c.CORS.AllowedOrigins {
+		if origin == "*" {
+			if c.CORS.AllowCredentials {
+				problem("cors.allowed_origins[%d]: every origin cannot be allowed along with credentials", i)
+			}
+			continue
+		}
+		separator := strings.Index(origin, "://")
+		if separator <= 0 || len(origin) == separator+3 || strings.Contains(origin[separator+3:], "/") {
+			problem("cors.allowed_origins[%d]: %q is not an origin like https://app.example.com", i, origin)
+		}
+	}
+	for i, encoding := range c.Compression.Encodings {
+		switch encoding {
+		case "zstd", "br", "gzip", "deflate":
+		default:
+			problem("compression.encodings[%d]: unsupported encoding %q, only zstd, br, gzip and deflate are supported", i, encoding)
+		}
+	}
+	if c.Index && !c.Watch {
+		problem("index: requires watch")
+	}
+	switch c.Tracing.Exporter {
+	case "", "stdout":
+	case "otlp":
+		if endpoint, err := url.Parse(c.Tracing.Endpoint); err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+			problem("tracing.endpoint: %q is not an http or https URL", c.Tracing.Endpoint)
+		}
+	default:
+		problem("tracing.exporter: unsupported exporter %q, only otlp and stdout are supported", c.Tracing.Exporter)
+	}
+	if c.Logging.Audit != "" && c.Logging.Audit != "-" && c.Logging.Audit == c.Logging.Access {
+		problem("logging.audit: %q is the access log", c.Logging.Audit)
+	}
+	if c.Logging.Audit != "" && c.Logging.AuditKeyFile == "" {
+		problem("logging.audit_key_file: required along with logging.audit")
+	} else if c.Logging.Audit != "" && c.Logging.Audit != "-" && sameDir(c.Logging.Audit, c.Logging.AuditKeyFile) {
+		problem("logging.audit_key_file: %q is beside the audit log", c.Logging.AuditKeyFile)
+	}
+	for _, field := range []struct {
+		name  string
+		value int64
+	}{
+		{"http.read_timeout", int64(c.HTTP.ReadTimeout)},
+		{"http.read_header_timeout", int64(c.HTTP.ReadHeaderTimeout)},
+		{"http.write_timeout", int64(c.HTTP.WriteTimeout)},
+		{"http.idle_timeout", int64(c.HTTP.IdleTimeout)},
+		{"http.max_header_bytes", int64(c.HTTP.MaxHeaderBytes)},
+		{"http.max_connections", int64(c.HTTP.MaxConnections)},
+		{"http.shutdown_delay", int64(c.HTTP.ShutdownDelay)},
+		{"http.drain_timeout", int64(c.HTTP.DrainTimeout)},
+		{"logging.max_size", c.Logging.MaxSize},
+		{"logging.max_backups", int64(c.Logging.MaxBackups)},
+		{"limits.max_upload_size", c.Limits.MaxUploadSize},
+		{"limits.upload_expiry", int64(c.Limits.UploadExpiry)},
+		{"limits.rate.bandwidth", c.Limits.Rate.Bandwidth},
+		{"limits.rate.bandwidth_burst", c.Limits.Rate.BandwidthBurst},
+		{"limits.max_operations", int64(c.Limits.MaxOperations)},
+		{"compression.min_size", int64(c.Compression.MinSize)},
+		{"compression.max_decoded_size", c.Compression.MaxDecodedSize},
+		{"usage_max_age", int64(c.UsageMaxAge)},
+		{"trash.retention", int64(c.Trash.Retention)},
+		{"versions.max", int64(c.Versions.Max)},
+		{"versions.max_age", int64(c.Versions.MaxAge)},
+		{"cors.max_age", int64(c.CORS.MaxAge)},
+	} {
+		if field.value < 0 {
+			problem("%s: must not be negative", field.name)
+		}
+	}
+	for _, field := range []struct {
+		name  string
+		value float64
+	}{
+		{"limits.rate.reads", c.Limits.Rate.Reads},
+		{"limits.rate.read_burst", c.Limits.Rate.ReadBurst},
+		{"limits.rate.writes", c.Limits.Rate.Writes},
+		{"limits.rate.write_burst", c.Limits.Rate.WriteBurst},
+		{"auth.failed_logins", c.Auth.FailedLogins},
+		{"auth.failed_login_burst", c.Auth.FailedLoginBurst},
+	} {
+		if field.value < 0 {
+			problem("%s: must not be negative", field.name)
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid configuration:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// sameDir returns if the files at both paths are in the same directory.
+func sameDir(a, b string) bool {
+	a, errA := filepath.Abs(a)
+	b, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && filepath.Dir(a) == filepath.Dir(b)
+}
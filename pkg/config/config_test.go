@@ -0,0 +1,176 @@
+package config_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/peymanmortazavi/fs-server/pkg/config"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("failed to write configuration: %s", err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	root := t.TempDir()
+	path := writeConfig(t, `
+listeners:
+  - addr: 127.0.0.1:7000
+backends:
+  - name: data
+    type: local
+    root: `+root+`
+    encrypt: true
+mounts:
+  - path: /
+    backend: data
+auth:
+  admins: [alice]
+limits:
+  upload_dir: `+root+`.uploads
+trash:
+  enabled: false
+versions:
+  enabled: true
+  max_age: 48h
+`)
+	t.Setenv("FS_SERVER_LISTENERS_0_ADDR", "127.0.0.1:7001")
+	t.Setenv("FS_SERVER_AUTH_ADMINS", "alice, bob")
+	t.Setenv("FS_SERVER_LIMITS_UPLOAD_EXPIRY", "2h")
+	t.Setenv("FS_SERVER_LIMITS_RATE_READS", "2.5")
+	t.Setenv("FS_SERVER_ENCRYPTION_KEYS", "old:b2xk, new:bmV3")
+	t.Setenv("FS_SERVER_ADMIN_ADDR", "127.0.0.1:7002")
+
+	c, err := config.Load(path)
+	if err != nil {
+		t.Fatalf("failed to load configuration: %s", err)
+	}
+	if err := c.Validate(); err != nil {
+		t.Fatalf("unexpected validation error: %s", err)
+	}
+	if c.Listeners[0].Addr != "127.0.0.1:7001" {
+		t.Errorf("expected the environment to override the address but got %s", c.Listeners[0].Addr)
+	}
+	if strings.Join(c.Auth.Admins, ",") != "alice,bob" {
+		t.Errorf("unexpected admins: %v", c.Auth.Admins)
+	}
+	if c.Limits.UploadExpiry != 2*time.Hour || c.Versions.MaxAge != 48*time.Hour {
+		t.Errorf("unexpected durations: %s %s", c.Limits.UploadExpiry, c.Versions.MaxAge)
+	}
+	if strings.Join(c.Encryption.Keys, ",") != "old:b2xk,new:bmV3" {
+		t.Errorf("expected the environment to set the encryption keys but got %v", c.Encryption.Keys)
+	}
+	if c.AdminAddr != "127.0.0.1:7002" {
+		t.Errorf("expected the environment to set the admin address but got %q", c.AdminAddr)
+	}
+	if c.Limits.Rate.Reads != 2.5 {
+		t.Errorf("expected the environment to set the read rate but got %v", c.Limits.Rate.Reads)
+	}
+	if c.Trash.Enabled || !c.Versions.Enabled || !c.Watch || c.Versions.Max != 20 || c.HTTP.Unversioned {
+		t.Errorf("expected the file to be loaded over the defaults but got %+v", c)
+	}
+	if backend, ok := c.RootBackend(); !ok || backend.Root != root {
+		t.Errorf("unexpected root backend: %+v", backend)
+	}
+
+	if _, err := config.Load(writeConfig(t, "listners: []\n")); err == nil {
+		t.Errorf("expected unknown keys to be rejected")
+	}
+	t.Setenv("FS_SERVER_WATCH", "maybe")
+	if _, err := config.Load(path); err == nil || !strings.Contains(err.Error(), "FS_SERVER_WATCH") {
+		t.Errorf("expected an invalid environment value to be rejected but got %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	c := config.Default()
+	if err := c.Validate(); err != nil {
+		t.Errorf("expected the defaults to be valid but got %s", err)
+	}
+
+	c.Listeners = append(c.Listeners, config.Listener{Addr: "nope", TLSCert: "cert.pem"})
+	c.Backends = append(c.Backends, config.Backend{Name: "local", Type: "s3", Encrypt: true})
+	c.Mounts = []config.Mount{
+		{Path: "/", Backend: "missing"},
+		{Path: "/data/../x", Backend: "local"},
+		{Path: "data/", Backend: "local", ReadOnly: true},
+		{Path: "/data", Backend: "local"},
+	}
+	c.Auth.Required = true
+	c.Index, c.Watch = true, false
+	c.Versions.Enabled = true
+	c.Trash.Retention = -time.Hour
+	c.HTTP.MaxConnections = -1
+	c.Limits.Rate.Writes = -0.5
+	c.Compression.Encodings = []string{"zstd", "br", "lz4"}
+	c.HTTP.BasePath = "/api/v1/files/"
+	c.CORS = config.CORS{AllowedOrigins: []string{"https://*.example.com", "*", "example.com", "https://example.com/app"}, AllowCredentials: true}
+	c.Logging.Access, c.Logging.Audit = "/var/log/fs-server.log", "/var/log/fs-server.log"
+	c.Logging.MaxBackups = -1
+	c.Tracing = config.Tracing{Exporter: "otlp", Endpoint: "localhost:4318"}
+	c.Webhooks.File = "webhooks.yaml"
+	c.GRPCAddr = c.Listeners[0].Addr
+	err := c.Validate()
+	if err == nil {
+		t.Fatalf("expected the configuration to be invalid")
+	}
+	for _, expected := range []string{
+		"listeners[1].addr",
+		"listeners[1]: tls_cert and tls_key",
+		"listeners[0].addr: " + c.Listeners[0].Addr + " is the gRPC address",
+		`backends[1].name: "local" is used`,
+		`backends[1].type: unsupported type "s3"`,
+		"backends[1].encrypt: requires encryption.key_file or encryption.keys",
+		"backends[1].encrypt: requires limits.upload_dir",
+		`mounts[0].backend: no backend is named "missing"`,
+		`mounts[1].path: "/data/../x" is not a clean path`,
+		`mounts[3].path: "/data" is mounted more than once`,
+		"auth.required",
+		"index: requires watch",
+		"index: requires a single writable local backend mounted at /",
+		"versions.enabled: requires a single writable local backend mounted at /",
+		"trash.retention: must not be negative",
+		"http.max_connections: must not be negative",
+		"limits.rate.writes: must not be negative",
+		`compression.encodings[2]: unsupported encoding "lz4"`,
+		`http.base_path: "/api/v1/files/" is not a clean absolute path`,
+		"cors.allowed_origins[1]: every origin cannot be allowed along with credentials",
+		`cors.allowed_origins[2]: "example.com" is not an origin`,
+		`cors.allowed_origins[3]: "https://example.com/app" is not an origin`,
+		`logging.audit: "/var/log/fs-server.log" is the access log`,
+		"logging.audit_key_file: required along with logging.audit",
+		"logging.max_backups: must not be negative",
+		`tracing.endpoint: "localhost:4318" is not an http or https URL`,
+	} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected the error to mention %q but got:\n%s", expected, err)
+		}
+	}
+	if strings.Contains(err.Error(), "watch: requires a single") {
+		t.Errorf("expected watch to be valid when it is disabled but got:\n%s", err)
+	}
+	if strings.Contains(err.Error(), "cors.allowed_origins[0]") {
+		t.Errorf("expected a wildcard origin to be valid but got:\n%s", err)
+	}
+	if strings.Contains(err.Error(), "grpc_addr") {
+		t.Errorf("expected gRPC to be served along with the audit log and webhooks but got:\n%s", err)
+	}
+
+	c = config.Default()
+	c.Logging.Audit, c.Logging.AuditKeyFile = "/var/log/fs-server/audit.log", "/var/log/fs-server/audit.key"
+	if err := c.Validate(); err == nil || !strings.Contains(err.Error(), "logging.audit_key_file: \"/var/log/fs-server/audit.key\" is beside the audit log") {
+		t.Errorf("expected a key beside the audit log to be rejected but got %v", err)
+	}
+	c.Logging.AuditKeyFile = "/etc/fs-server/audit.key"
+	if err := c.Validate(); err != nil {
+		t.Errorf("expected a key away from the audit log to be valid but got %s", err)
+	}
+}
@@ -0,0 +1,3 @@
+// Package config describes the configuration of fs-server, loaded from a YAML
+// file with overrides from the environment.
+package config
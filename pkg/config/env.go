@@ -0,0 +1,107 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// ApplyEnv overrides configuration values from environment variables given as
+// KEY=value pairs, like os.Environ returns them.
+//
+// Variables are named after the YAML keys leading to a value, prefixed with
+// EnvPrefix, so FS_SERVER_AUTH_REQUIRED overrides auth.required. Elements of
+// lists are addressed by index, like FS_SERVER_LISTENERS_0_ADDR, and lists of
+// strings are given comma separated.
+func ApplyEnv(config *Config, environ []string) error {
+	values := make(map[string]string)
+	for _, pair := range environ {
+		if i := strings.IndexByte(pair, '='); i > 0 && strings.HasPrefix(pair, EnvPrefix+"_") {
+			values[pair[:i]] = pair[i+1:]
+		}
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	return applyEnv(reflect.ValueOf(config).Elem(), EnvPrefix, values)
+}
+
+func applyEnv(value reflect.Value, name string, values map[string]string) error {
+	switch {
+	case value.Kind() == reflect.Struct:
+		for i := 0; i < value.NumField(); i++ {
+			key := strings.Split(value.Type().Field(i).Tag.Get("yaml"), ",")[0]
+			if key == "" || key == "-" {
+				continue
+			}
+			if err := applyEnv(value.Field(i), name+"_"+strings.ToUpper(key), values); err != nil {
+				return err
+			}
+		}
+		return nil
+	case value.Kind() == reflect.Slice && value.Type().Elem().Kind() == reflect.Struct:
+		for i := 0; i < value.Len(); i++ {
+			if err := applyEnv(value.Index(i), name+"_"+strconv.Itoa(i), values); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	raw, ok := values[name]
+	if !ok {
+		return nil
+	}
+	if err := setValue(value, raw); err != nil {
+		return fmt.Errorf("invalid value of %s: %s", name, err)
+	}
+	return nil
+}
+
+func setValue(value reflect.Value, raw string) error {
+	if value.Type() == durationType {
+		duration, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		value.SetInt(int64(duration))
+		return nil
+	}
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(raw)
+	case reflect.Bool:
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		value.SetBool(parsed)
+	case reflect.Int, reflect.Int64:
+		parsed, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return err
+		}
+		value.SetInt(parsed)
+	case reflect.Float64:
+		parsed, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return err
+		}
+		value.SetFloat(parsed)
+	case reflect.Slice:
+		var items []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		value.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported type %s", value.Type())
+	}
+	return nil
+}
@@ -0,0 +1,276 @@
+package filesystem
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// sizeMemberID identifies the gzip extra field recording the uncompressed size.
+var sizeMemberID = []byte{'F', 'S', 8, 0}
+
+// sizeMemberLength is the length of the gzip member recording a size.
+var sizeMemberLength = len(sizeMember(0))
+
+// DefaultStoredExtensions are the extensions of already compressed formats,
+// stored as they are by a Compressed.
+var DefaultStoredExtensions = []string{
+	".gz", ".tgz", ".zip", ".zst", ".br", ".xz", ".bz2", ".7z", ".rar",
+	".jpg", ".jpeg", ".png", ".gif", ".webp", ".avif", ".mp3", ".mp4", ".mkv", ".webm", ".mov",
+}
+
+// Compressed is an Editor storing the content of files compressed with gzip,
+// while presenting their content and sizes uncompressed.
+//
+// A file is stored as a gzip stream followed by an empty gzip member whose
+// extra field holds the uncompressed size, so stored files can still be read
+// with gunzip. Files without that member, like the ones written before
+// compression was enabled, are presented as they are. Sizes are read from the
+// stored files and remembered until they are modified.
+type Compressed struct {
+	Editor
+
+	// Level is the gzip compression level, gzip.DefaultCompression when zero.
+	Level int
+
+	// Stored are the extensions of files stored as they are,
+	// DefaultStoredExtensions when nil.
+	Stored []string
+
+	sizes sizeCache
+}
+
+// NewCompressed returns a Compressed storing files of the editor compressed.
+func NewCompressed(editor Editor) *Compressed {
+	return &Compressed{Editor: editor}
+}
+
+// Get returns the item at the given path with its uncompressed size.
+func (c *Compressed) Get(path string) (Item, error) {
+	item, err := c.Editor.Get(path)
+	if err != nil {
+		return item, err
+	}
+	c.present(path, &item)
+	for index := range item.Children {
+		c.present(childPath(path, item.Children[index].Name), &item.Children[index])
+	}
+	return item, nil
+}
+
+// CreateFile creates a file.
+func (c *Compressed) CreateFile(path string) (Item, error) {
+	item, err := c.Editor.CreateFile(path)
+	if err == nil {
+		c.present(path, &item)
+	}
+	return item, err
+}
+
+// Move moves an item when the decorated Editor is a Mover.
+func (c *Compressed) Move(oldPath, newPath string) error {
+	mover, ok := c.Editor.(Mover)
+	if !ok {
+		return MoveUnsupported
+	}
+	return mover.Move(oldPath, newPath)
+}
+
+// present makes the file item at the path present its uncompressed size and
+// content.
+func (c *Compressed) present(path string, item *Item) {
+	if !item.FileMode.IsRegular() || item.Opener == nil {
+		return
+	}
+	size, ok := c.sizes.size(path, *item, func() (int64, bool) {
+		file, err := item.Opener.Open(os.O_RDONLY)
+		if err != nil {
+			return 0, false
+		}
+		content, size, err := uncompressed(file)
+		if err != nil {
+			file.Close()
+			return 0, false
+		}
+		content.Close()
+		return size, true
+	})
+	if ok {
+		item.Size = size
+	}
+	item.Opener = compressedOpener{Opener: item.Opener, compressed: c, store: c.stores(item.Name)}
+}
+
+// stores returns if a file of the given name is stored as it is.
+func (c *Compressed) stores(name string) bool {
+	extensions := c.Stored
+	if extensions == nil {
+		extensions = DefaultStoredExtensions
+	}
+	extension := strings.ToLower(filepath.Ext(name))
+	for _, stored := range extensions {
+		if extension == stored {
+			return true
+		}
+	}
+	return false
+}
+
+type compressedOpener struct {
+	Opener
+	compressed *Compressed
+	store      bool
+}
+
+// Open opens the uncompressed content for reading, or a compressed stream
+// replacing the content for writing. Files can only be written whole, so they
+// are always truncated and cannot be opened to read and write at once.
+func (o compressedOpener) Open(flag int) (io.ReadWriteCloser, error) {
+	if flag&os.O_RDWR != 0 || flag&os.O_APPEND != 0 {
+		return nil, CompressedAccess
+	}
+	if flag&os.O_WRONLY == 0 {
+		file, err := o.Opener.Open(flag)
+		if err != nil {
+			return nil, err
+		}
+		content, _, err := uncompressed(file)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		return content, nil
+	}
+	file, err := o.Opener.Open(flag | os.O_TRUNC)
+	if err != nil || o.store {
+		return file, err
+	}
+	level := o.compressed.Level
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+	encoder, err := gzip.NewWriterLevel(file, level)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &compressedFile{file: file, encoder: encoder}, nil
+}
+
+// compressedFile compresses what is written to a file, recording the
+// uncompressed size once closed.
+type compressedFile struct {
+	file    io.ReadWriteCloser
+	encoder *gzip.Writer
+	size    int64
+}
+
+func (f *compressedFile) Read([]byte) (int, error) {
+	return 0, CompressedAccess
+}
+
+func (f *compressedFile) Write(buffer []byte) (int, error) {
+	n, err := f.encoder.Write(buffer)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *compressedFile) Close() error {
+	err := f.encoder.Close()
+	if err == nil {
+		_, err = f.file.Write(sizeMember(f.size))
+	}
+	if closeErr := f.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// sizeMember returns an empty gzip member holding the size in its extra field.
+func sizeMember(size int64) []byte {
+	var member bytes.Buffer
+	encoder := gzip.NewWriter(&member)
+	encoder.Extra = make([]byte, len(sizeMemberID)+8)
+	copy(encoder.Extra, sizeMemberID)
+	binary.LittleEndian.PutUint64(encoder.Extra[len(sizeMemberID):], uint64(size))
+	encoder.Close()
+	return member.Bytes()
+}
+
+// parseSizeMember returns the size held by a gzip member written by sizeMember.
+func parseSizeMember(member []byte) (int64, bool) {
+	decoder, err := gzip.NewReader(bytes.NewReader(member))
+	if err != nil {
+		return 0, false
+	}
+	decoder.Multistream(false)
+	extra := decoder.Header.Extra
+	if len(extra) != len(sizeMemberID)+8 || !bytes.Equal(extra[:len(sizeMemberID)], sizeMemberID) {
+		return 0, false
+	}
+	if n, err := decoder.Read(make([]byte, 1)); n != 0 || err != io.EOF {
+		return 0, false
+	}
+	return int64(binary.LittleEndian.Uint64(extra[len(sizeMemberID):])), true
+}
+
+// uncompressed returns the uncompressed content of a file opened for reading
+// and its size, the file itself when it is not compressed. Files that cannot
+// seek to their size member, like the ones in memory, are read whole.
+func uncompressed(file io.ReadCloser) (io.ReadWriteCloser, int64, error) {
+	var stored io.ReadSeeker
+	if seeker, ok := file.(io.ReadSeeker); ok {
+		stored = seeker
+	} else {
+		content, err := ioutil.ReadAll(file)
+		if err != nil {
+			return nil, 0, err
+		}
+		stored = bytes.NewReader(content)
+	}
+	length, err := stored.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, 0, err
+	}
+	size, compressed := int64(0), false
+	if length >= int64(sizeMemberLength) {
+		member := make([]byte, sizeMemberLength)
+		if _, err := stored.Seek(-int64(sizeMemberLength), io.SeekEnd); err != nil {
+			return nil, 0, err
+		}
+		if _, err := io.ReadFull(stored, member); err != nil {
+			return nil, 0, err
+		}
+		size, compressed = parseSizeMember(member)
+	}
+	if _, err := stored.Seek(0, io.SeekStart); err != nil {
+		return nil, 0, err
+	}
+	if !compressed {
+		return readCloser{stored, file}, length, nil
+	}
+	decoder, err := gzip.NewReader(io.LimitReader(stored, length-int64(sizeMemberLength)))
+	if err != nil {
+		return nil, 0, err
+	}
+	return readCloser{decoder, file}, size, nil
+}
+
+// readCloser reads from a reader and closes the file it comes from.
+type readCloser struct {
+	io.Reader
+	file io.Closer
+}
+
+func (r readCloser) Write([]byte) (int, error) {
+	return 0, CompressedAccess
+}
+
+func (r readCloser) Close() error {
+	return r.file.Close()
+}
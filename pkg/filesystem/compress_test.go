@@ -0,0 +1,150 @@
+package filesystem_test
+
+import (
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/peymanmortazavi/fs-server/pkg/filesystem"
+)
+
+func TestCompressed(t *testing.T) {
+	content := strings.Repeat("compressible content ", 500)
+	for name, backend := range map[string]func(t *testing.T) (filesystem.Editor, func(string) []byte){
+		"local": func(t *testing.T) (filesystem.Editor, func(string) []byte) {
+			root := t.TempDir()
+			return filesystem.DirManager{Root: root}, func(path string) []byte {
+				stored, _ := ioutil.ReadFile(filepath.Join(root, path))
+				return stored
+			}
+		},
+		"memory": func(t *testing.T) (filesystem.Editor, func(string) []byte) {
+			memory := filesystem.NewMemory()
+			return memory, func(path string) []byte {
+				item, _ := memory.Get(path)
+				file, _ := item.Open(os.O_RDONLY)
+				defer file.Close()
+				stored, _ := ioutil.ReadAll(file)
+				return stored
+			}
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			editor, stored := backend(t)
+			writeItem(t, editor, "plain.txt", "written before compression")
+			compressed := filesystem.NewCompressed(editor)
+			writeItem(t, compressed, "a.txt", content)
+			writeItem(t, compressed, "b.png", content)
+
+			raw := stored("a.txt")
+			if len(raw) >= len(content) {
+				t.Errorf("expected a.txt to be stored compressed but it takes %d bytes", len(raw))
+			}
+			reader, err := gzip.NewReader(strings.NewReader(string(raw)))
+			if err != nil {
+				t.Fatalf("expected a.txt to be stored as gzip: %s", err)
+			}
+			if gunzipped, err := ioutil.ReadAll(reader); err != nil || string(gunzipped) != content {
+				t.Errorf("expected gunzip to read a.txt back but got %d bytes, %v", len(gunzipped), err)
+			}
+			if string(stored("b.png")) != content {
+				t.Errorf("expected b.png to be stored as it is")
+			}
+
+			listing, err := compressed.Get("")
+			if err != nil {
+				t.Fatalf("failed to list the root: %s", err)
+			}
+			files := createFileMap(listing)
+			for name, expected := range map[string]string{"a.txt": content, "b.png": content, "plain.txt": "written before compression"} {
+				if files[name].Size != int64(len(expected)) {
+					t.Errorf("expected %s to have the uncompressed size %d but got %d", name, len(expected), files[name].Size)
+				}
+				if got := readItem(t, files[name]); got != expected {
+					t.Errorf("unexpected content of %s: %d bytes", name, len(got))
+				}
+			}
+
+			item, _ := compressed.Get("a.txt")
+			if _, err := item.Open(os.O_RDWR); err != filesystem.CompressedAccess {
+				t.Errorf("expected opening to read and write at once to fail but got %v", err)
+			}
+			writeItem(t, compressed, "a.txt", "short")
+			if item, _ := compressed.Get("a.txt"); item.Size != 5 || readItem(t, item) != "short" {
+				t.Errorf("expected a.txt to be overwritten but got %d bytes", item.Size)
+			}
+		})
+	}
+}
+
+// countingEditor counts the files opened through the items it returns.
+type countingEditor struct {
+	filesystem.Editor
+	opens *int
+}
+
+func (e countingEditor) Get(path string) (filesystem.Item, error) {
+	item, err := e.Editor.Get(path)
+	if item.Opener != nil {
+		item.Opener = openCounter{item.Opener, e.opens}
+	}
+	for index := range item.Children {
+		if child := &item.Children[index]; child.Opener != nil {
+			child.Opener = openCounter{child.Opener, e.opens}
+		}
+	}
+	return item, err
+}
+
+type openCounter struct {
+	filesystem.Opener
+	opens *int
+}
+
+func (o openCounter) Open(flag int) (io.ReadWriteCloser, error) {
+	*o.opens++
+	return o.Opener.Open(flag)
+}
+
+// testPresentedSizes checks that a listing only opens files modified since the
+// previous one.
+func testPresentedSizes(t *testing.T, decorate func(filesystem.Editor) filesystem.Editor) {
+	opens := 0
+	editor := decorate(countingEditor{Editor: filesystem.DirManager{Root: t.TempDir()}, opens: &opens})
+	writeItem(t, editor, "a.txt", strings.Repeat("a", 100))
+	writeItem(t, editor, "b.txt", strings.Repeat("b", 200))
+
+	sizes := func() map[string]int64 {
+		item, err := editor.Get("")
+		if err != nil {
+			t.Fatalf("failed to list the root: %s", err)
+		}
+		sizes := make(map[string]int64)
+		for _, child := range item.Children {
+			sizes[child.Name] = child.Size
+		}
+		return sizes
+	}
+	if listed := sizes(); listed["a.txt"] != 100 || listed["b.txt"] != 200 {
+		t.Errorf("unexpected sizes: %v", listed)
+	}
+	opens = 0
+	if listed := sizes(); listed["a.txt"] != 100 || listed["b.txt"] != 200 || opens != 0 {
+		t.Errorf("expected the sizes to be remembered but got %v after %d opens", listed, opens)
+	}
+	writeItem(t, editor, "a.txt", strings.Repeat("a", 300))
+	opens = 0
+	if listed := sizes(); listed["a.txt"] != 300 || listed["b.txt"] != 200 || opens != 1 {
+		t.Errorf("expected only the modified file to be opened but got %v after %d opens", listed, opens)
+	}
+}
+
+func TestCompressedSizes(t *testing.T) {
+	testPresentedSizes(t, func(editor filesystem.Editor) filesystem.Editor {
+		return filesystem.NewCompressed(editor)
+	})
+}
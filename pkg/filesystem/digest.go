@@ -0,0 +1,179 @@
+package filesystem
+
+import (
+	"container/list"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DigestAlgorithm names a content hashing algorithm.
+type DigestAlgorithm string
+
+const (
+	// SHA256 is the SHA-256 digest algorithm.
+	SHA256 DigestAlgorithm = "sha256"
+
+	// SHA1 is the SHA-1 digest algorithm.
+	SHA1 DigestAlgorithm = "sha1"
+
+	// MD5 is the MD5 digest algorithm.
+	MD5 DigestAlgorithm = "md5"
+
+	// CRC32C is the CRC-32 checksum using the Castagnoli polynomial.
+	CRC32C DigestAlgorithm = "crc32c"
+)
+
+var castagnoliTable = crc32.MakeTable(crc32.Castagnoli)
+
+// ParseDigestAlgorithm returns the algorithm for the given name.
+//
+// Names are case insensitive and dashes are ignored so "SHA-256" and "sha256"
+// both resolve to SHA256.
+func ParseDigestAlgorithm(name string) (DigestAlgorithm, error) {
+	switch algorithm := DigestAlgorithm(strings.ToLower(strings.ReplaceAll(name, "-", ""))); algorithm {
+	case SHA256, SHA1, MD5, CRC32C:
+		return algorithm, nil
+	case "sha":
+		return SHA1, nil
+	}
+	return "", UnsupportedDigest
+}
+
+// NewHash creates a new hash for the given algorithm.
+func (a DigestAlgorithm) NewHash() (hash.Hash, error) {
+	switch a {
+	case SHA256:
+		return sha256.New(), nil
+	case SHA1:
+		return sha1.New(), nil
+	case MD5:
+		return md5.New(), nil
+	case CRC32C:
+		return crc32.New(castagnoliTable), nil
+	}
+	return nil, UnsupportedDigest
+}
+
+// ComputeDigest reads the content of a file item and returns its digest.
+func ComputeDigest(item Item, algorithm DigestAlgorithm) ([]byte, error) {
+	h, err := algorithm.NewHash()
+	if err != nil {
+		return nil, err
+	}
+	if item.Opener == nil {
+		return nil, NotRegularFile
+	}
+	file, err := item.Open(os.O_RDONLY)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	if _, err := io.Copy(h, file); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// DefaultDigestCacheEntries is the number of digests a DigestCache keeps when
+// its MaxEntries is not set.
+const DefaultDigestCacheEntries = 10000
+
+type digestKey struct {
+	path      string
+	algorithm DigestAlgorithm
+}
+
+type digestEntry struct {
+	key     digestKey
+	modTime time.Time
+	size    int64
+	sum     []byte
+}
+
+// DigestCache remembers file digests so unchanged files are not hashed again.
+//
+// An entry is only reused while the modification time and the size of the file
+// match the ones it was computed for. The zero value is ready to use and a nil
+// cache simply computes every digest.
+type DigestCache struct {
+	// MaxEntries bounds the number of digests kept, the least recently used
+	// ones are dropped first. DefaultDigestCacheEntries is used when it is 0.
+	MaxEntries int
+
+	mu      sync.Mutex
+	entries map[digestKey]*list.Element
+
+	// recent orders the entries from the most to the least recently used.
+	recent *list.List
+}
+
+// Digest returns the digest of the file item found at path.
+func (c *DigestCache) Digest(path string, item Item, algorithm DigestAlgorithm) ([]byte, error) {
+	if c == nil {
+		return ComputeDigest(item, algorithm)
+	}
+	key := digestKey{path: path, algorithm: algorithm}
+
+	c.mu.Lock()
+	if element, ok := c.entries[key]; ok {
+		entry := element.Value.(*digestEntry)
+		if entry.size == item.Size && entry.modTime.Equal(item.ModTime) {
+			c.recent.MoveToFront(element)
+			c.mu.Unlock()
+			return entry.sum, nil
+		}
+	}
+	c.mu.Unlock()
+
+	sum, err := ComputeDigest(item, algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[digestKey]*list.Element)
+		c.recent = list.New()
+	}
+	entry := &digestEntry{key: key, modTime: item.ModTime, size: item.Size, sum: sum}
+	if element, ok := c.entries[key]; ok {
+		element.Value = entry
+		c.recent.MoveToFront(element)
+		return sum, nil
+	}
+	c.entries[key] = c.recent.PushFront(entry)
+	max := c.MaxEntries
+	if max <= 0 {
+		max = DefaultDigestCacheEntries
+	}
+	for c.recent.Len() > max {
+		oldest := c.recent.Back()
+		c.recent.Remove(oldest)
+		delete(c.entries, oldest.Value.(*digestEntry).key)
+	}
+	return sum, nil
+}
+
+// Forget drops every cached digest of the given path and anything beneath it.
+func (c *DigestCache) Forget(path string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, element := range c.entries {
+		if path == "" || key.path == path || strings.HasPrefix(key.path, path+"/") {
+			c.recent.Remove(element)
+			delete(c.entries, key)
+		}
+	}
+}
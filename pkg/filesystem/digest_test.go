@@ -0,0 +1,116 @@
+package filesystem_test
+
+import (
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/peymanmortazavi/fs-server/pkg/filesystem"
+)
+
+func TestParseDigestAlgorithm(t *testing.T) {
+	cases := map[string]filesystem.DigestAlgorithm{
+		"sha256":  filesystem.SHA256,
+		"SHA-256": filesystem.SHA256,
+		"sha":     filesystem.SHA1,
+		"MD5":     filesystem.MD5,
+		"crc32c":  filesystem.CRC32C,
+	}
+	for name, expected := range cases {
+		algorithm, err := filesystem.ParseDigestAlgorithm(name)
+		if err != nil {
+			t.Errorf("ParseDigestAlgorithm(%s) failed: %s", name, err)
+		}
+		if algorithm != expected {
+			t.Errorf("ParseDigestAlgorithm(%s): expected %s, got %s", name, expected, algorithm)
+		}
+	}
+	if _, err := filesystem.ParseDigestAlgorithm("sha512"); !filesystem.IsUnsupportedDigest(err) {
+		t.Errorf("expected unsupported digest error for sha512 but got: %v", err)
+	}
+}
+
+func TestDigestCache(t *testing.T) {
+	root := setupTestDir(t)
+	createBasicDirStructure(root)
+	manager := filesystem.DirManager{Root: root}
+	cache := &filesystem.DigestCache{}
+
+	digestOf := func() string {
+		item, err := manager.Get("a.txt")
+		if err != nil {
+			t.Fatalf("manager.Get(a.txt) failed: %s", err)
+		}
+		sum, err := cache.Digest("a.txt", item, filesystem.SHA256)
+		if err != nil {
+			t.Fatalf("failed to compute digest: %s", err)
+		}
+		return hex.EncodeToString(sum)
+	}
+
+	if digest := digestOf(); digest != "fe599a5727285b6a0318a50aace211016346c5a82c4aed1614bd3dc03026a2c6" {
+		t.Errorf("unexpected digest for a.txt: %s", digest)
+	}
+
+	// a change in content and modification time must not return the cached digest.
+	path := filepath.Join(root, "a.txt")
+	if err := ioutil.WriteFile(path, []byte("new content"), 0664); err != nil {
+		t.Fatalf("failed to rewrite file: %s", err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatalf("failed to change modification time: %s", err)
+	}
+	if digest := digestOf(); digest != "fe32608c9ef5b6cf7e3f946480253ff76f24f4ec0678f3d0f07f9844cbff9601" {
+		t.Errorf("unexpected digest for a.txt after the change: %s", digest)
+	}
+}
+
+// countingOpener serves a fixed content and counts how often it is opened.
+type countingOpener struct {
+	content string
+	opened  *int
+}
+
+func (o countingOpener) Open(int) (io.ReadWriteCloser, error) {
+	*o.opened++
+	return nopWriteCloser{strings.NewReader(o.content)}, nil
+}
+
+type nopWriteCloser struct {
+	io.Reader
+}
+
+func (nopWriteCloser) Write([]byte) (int, error) { return 0, os.ErrPermission }
+func (nopWriteCloser) Close() error              { return nil }
+
+func TestDigestCacheBound(t *testing.T) {
+	cache := &filesystem.DigestCache{MaxEntries: 2}
+	opened := make(map[string]int)
+	digest := func(name string) {
+		count := opened[name]
+		item := filesystem.Item{Name: name, Size: 1, Opener: countingOpener{content: name, opened: &count}}
+		if _, err := cache.Digest(name, item, filesystem.SHA256); err != nil {
+			t.Fatalf("failed to compute the digest of %s: %s", name, err)
+		}
+		opened[name] = count
+	}
+
+	digest("a")
+	digest("b")
+	digest("a")
+	digest("c")
+	if opened["a"] != 1 {
+		t.Errorf("expected the recently used digest of a to be kept but a was read %d times", opened["a"])
+	}
+	digest("a")
+	digest("b")
+	if opened["a"] != 1 || opened["b"] != 2 {
+		t.Errorf("expected the least recently used digest of b to be dropped but a and b were read %d and %d times", opened["a"], opened["b"])
+	}
+}
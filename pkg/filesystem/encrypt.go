@@ -0,0 +1,568 @@
+package filesystem
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// encryptedMagic starts the header of every encrypted file.
+var encryptedMagic = []byte("FSE2")
+
+// subkeyInfo binds the subkeys derived for files to their use.
+var subkeyInfo = []byte("fs-server file encryption")
+
+const (
+	// DefaultChunkSize is the size of the plaintext chunks sealed on their own,
+	// so a read only decrypts the chunks it covers.
+	DefaultChunkSize = 64 << 10
+
+	// nonceTag bytes are added to every chunk by AES-GCM.
+	nonceTag = 16
+
+	nonceSize   = 12
+	saltSize    = 32
+	maxKeyIDLen = 255
+)
+
+// Keyring holds the AES keys files are encrypted with by ID. New files are
+// encrypted with the current key, older keys are kept to read the files
+// encrypted with them, so keys are rotated by adding a new current key.
+type Keyring struct {
+	keys    map[string][]byte
+	current string
+}
+
+// NewKeyring returns a keyring of the keys by ID, current encrypting new
+// files. Keys are 16, 24 or 32 bytes long for AES-128, AES-192 or AES-256.
+func NewKeyring(keys map[string][]byte, current string) (*Keyring, error) {
+	ring := &Keyring{keys: make(map[string][]byte, len(keys)), current: current}
+	for id, key := range keys {
+		if id == "" || len(id) > maxKeyIDLen || strings.ContainsAny(id, ": \t") {
+			return nil, fmt.Errorf("invalid key ID %q", id)
+		}
+		if _, err := aes.NewCipher(key); err != nil {
+			return nil, fmt.Errorf("key %s: %s", id, err)
+		}
+		ring.keys[id] = key
+	}
+	if _, ok := ring.keys[current]; !ok {
+		return nil, fmt.Errorf("no key has the current ID %q", current)
+	}
+	return ring, nil
+}
+
+// aead returns the cipher sealing the chunks of the file with the header, keyed
+// by a subkey derived with HKDF-SHA256 from the key of the header and the salt
+// of the file, so no two files share a key.
+func (k *Keyring) aead(header *encryptedHeader) (cipher.AEAD, error) {
+	key, ok := k.keys[header.keyID]
+	if !ok {
+		return nil, UnknownKey
+	}
+	subkey := make([]byte, len(key))
+	if _, err := io.ReadFull(hkdf.New(sha256.New, key, header.salt, subkeyInfo), subkey); err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(subkey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// ParseKeys returns the keyring of "id:base64-key" entries, the last one
+// being the current key.
+func ParseKeys(entries []string) (*Keyring, error) {
+	keys := make(map[string][]byte, len(entries))
+	var current string
+	for i, entry := range entries {
+		parts := strings.SplitN(strings.TrimSpace(entry), ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("key %d: expected id:base64-key", i+1)
+		}
+		key, err := base64.StdEncoding.DecodeString(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %s", parts[0], err)
+		}
+		if _, ok := keys[parts[0]]; ok {
+			return nil, fmt.Errorf("key %s: given more than once", parts[0])
+		}
+		keys[parts[0]], current = key, parts[0]
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no key is given")
+	}
+	return NewKeyring(keys, current)
+}
+
+// LoadKeyring reads a keyring from a file with an "id:base64-key" line per key,
+// the last one being the current key. Empty lines and lines starting with #
+// are ignored.
+func LoadKeyring(path string) (*Keyring, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var entries []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" && !strings.HasPrefix(line, "#") {
+			entries = append(entries, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	ring, err := ParseKeys(entries)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return ring, nil
+}
+
+// Encrypted is an Editor encrypting the content of files with AES-GCM, while
+// presenting their plaintext content and sizes.
+//
+// A file starts with a header naming the key it is encrypted with and holding
+// a random salt, followed by chunks of ChunkSize plaintext bytes sealed on
+// their own with a subkey derived from the key and the salt, so content can be
+// read from any offset and a chunk changed, removed or reordered fails to
+// decrypt. Every file having its own subkey, the nonce of a chunk is its
+// index. Files without the header fail to read with CorruptedEncryption
+// unless AllowPlaintext is set, empty files are read as they are. Sizes are
+// read from the headers of the stored files and remembered until they are
+// modified.
+type Encrypted struct {
+	Editor
+	Keys *Keyring
+
+	// AllowPlaintext presents files without the header as they are, to serve
+	// the files written before encryption was enabled while migrating them.
+	AllowPlaintext bool
+
+	// ChunkSize is the size of plaintext chunks of new files, DefaultChunkSize
+	// when zero.
+	ChunkSize int
+
+	sizes sizeCache
+}
+
+// NewEncrypted returns an Encrypted encrypting files of the editor with the keys.
+func NewEncrypted(editor Editor, keys *Keyring) *Encrypted {
+	return &Encrypted{Editor: editor, Keys: keys}
+}
+
+// Get returns the item at the given path with its plaintext size.
+func (e *Encrypted) Get(path string) (Item, error) {
+	item, err := e.Editor.Get(path)
+	if err != nil {
+		return item, err
+	}
+	e.present(path, &item)
+	for index := range item.Children {
+		e.present(childPath(path, item.Children[index].Name), &item.Children[index])
+	}
+	return item, nil
+}
+
+// CreateFile creates a file.
+func (e *Encrypted) CreateFile(path string) (Item, error) {
+	item, err := e.Editor.CreateFile(path)
+	if err == nil {
+		e.present(path, &item)
+	}
+	return item, err
+}
+
+// Move moves an item when the decorated Editor is a Mover.
+func (e *Encrypted) Move(oldPath, newPath string) error {
+	mover, ok := e.Editor.(Mover)
+	if !ok {
+		return MoveUnsupported
+	}
+	return mover.Move(oldPath, newPath)
+}
+
+// present makes the file item at the path present its plaintext size and
+// content.
+func (e *Encrypted) present(path string, item *Item) {
+	if !item.FileMode.IsRegular() || item.Opener == nil {
+		return
+	}
+	size, ok := e.sizes.size(path, *item, func() (int64, bool) {
+		file, err := item.Opener.Open(os.O_RDONLY)
+		if err != nil {
+			return 0, false
+		}
+		defer file.Close()
+		header, err := readEncryptedHeader(file)
+		if err != nil {
+			return 0, false
+		}
+		if header == nil {
+			return item.Size, e.plaintext(item.Size)
+		}
+		return header.plaintextSize(item.Size), true
+	})
+	if ok {
+		item.Size = size
+	}
+	item.Opener = encryptedOpener{Opener: item.Opener, encrypted: e}
+}
+
+type encryptedOpener struct {
+	Opener
+	encrypted *Encrypted
+}
+
+// Open opens the plaintext content for reading, or an encrypted stream
+// replacing the content for writing. Files can only be written whole, so they
+// are always truncated and cannot be opened to read and write at once.
+func (o encryptedOpener) Open(flag int) (io.ReadWriteCloser, error) {
+	if flag&os.O_RDWR != 0 || flag&os.O_APPEND != 0 {
+		return nil, EncryptedAccess
+	}
+	if flag&os.O_WRONLY == 0 {
+		file, err := o.Opener.Open(flag)
+		if err != nil {
+			return nil, err
+		}
+		content, err := o.encrypted.decrypt(file)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		return content, nil
+	}
+	file, err := o.Opener.Open(flag | os.O_TRUNC)
+	if err != nil {
+		return nil, err
+	}
+	content, err := o.encrypted.encrypt(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return content, nil
+}
+
+// encryptedHeader describes how a file is encrypted.
+type encryptedHeader struct {
+	chunkSize int
+	salt      []byte
+	keyID     string
+
+	// raw is the encoded header, authenticated along with every chunk.
+	raw []byte
+}
+
+func (h *encryptedHeader) encode() {
+	var raw bytes.Buffer
+	raw.Write(encryptedMagic)
+	binary.Write(&raw, binary.BigEndian, uint32(h.chunkSize))
+	raw.Write(h.salt)
+	raw.WriteByte(byte(len(h.keyID)))
+	raw.WriteString(h.keyID)
+	h.raw = raw.Bytes()
+}
+
+// readEncryptedHeader reads the header of a file, nil when it is not encrypted.
+func readEncryptedHeader(file io.Reader) (*encryptedHeader, error) {
+	fixed := make([]byte, len(encryptedMagic)+4+saltSize+1)
+	if _, err := io.ReadFull(file, fixed); err == io.EOF || err == io.ErrUnexpectedEOF {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(fixed[:len(encryptedMagic)], encryptedMagic) {
+		return nil, nil
+	}
+	keyID := make([]byte, fixed[len(fixed)-1])
+	if _, err := io.ReadFull(file, keyID); err != nil {
+		return nil, CorruptedEncryption
+	}
+	header := &encryptedHeader{
+		chunkSize: int(binary.BigEndian.Uint32(fixed[len(encryptedMagic):])),
+		salt:      fixed[len(encryptedMagic)+4 : len(encryptedMagic)+4+saltSize],
+		keyID:     string(keyID),
+	}
+	if header.chunkSize <= 0 {
+		return nil, CorruptedEncryption
+	}
+	header.raw = append(fixed, keyID...)
+	return header, nil
+}
+
+// plaintextSize returns the plaintext size of a file of the stored size.
+func (h *encryptedHeader) plaintextSize(stored int64) int64 {
+	body := stored - int64(len(h.raw))
+	if body <= 0 {
+		return 0
+	}
+	sealed := int64(h.chunkSize + nonceTag)
+	chunks := (body + sealed - 1) / sealed
+	if size := body - chunks*nonceTag; size > 0 {
+		return size
+	}
+	return 0
+}
+
+// nonce returns the nonce of a chunk, its index, the last one being marked so
+// a file cut at a chunk boundary fails to decrypt.
+func nonce(index int64, last bool) []byte {
+	nonce := make([]byte, nonceSize)
+	binary.BigEndian.PutUint64(nonce, uint64(index))
+	if last {
+		nonce[nonceSize-1] = 1
+	}
+	return nonce
+}
+
+// encrypt returns a writer encrypting what is written to the file with the
+// current key.
+func (e *Encrypted) encrypt(file io.ReadWriteCloser) (io.ReadWriteCloser, error) {
+	chunkSize := e.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
+	header := &encryptedHeader{chunkSize: chunkSize, salt: make([]byte, saltSize), keyID: e.Keys.current}
+	if _, err := rand.Read(header.salt); err != nil {
+		return nil, err
+	}
+	header.encode()
+	aead, err := e.Keys.aead(header)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := file.Write(header.raw); err != nil {
+		return nil, err
+	}
+	return &encryptingFile{file: file, header: header, aead: aead, buffer: make([]byte, 0, chunkSize)}, nil
+}
+
+// encryptingFile seals the chunks written to a file. A full chunk is only
+// sealed once more is written, since the last chunk is sealed differently.
+type encryptingFile struct {
+	file   io.ReadWriteCloser
+	header *encryptedHeader
+	aead   cipher.AEAD
+	buffer []byte
+	index  int64
+}
+
+func (f *encryptingFile) Read([]byte) (int, error) {
+	return 0, EncryptedAccess
+}
+
+func (f *encryptingFile) Write(data []byte) (int, error) {
+	written := 0
+	for len(data) > 0 {
+		if len(f.buffer) == f.header.chunkSize {
+			if err := f.seal(false); err != nil {
+				return written, err
+			}
+		}
+		n := copy(f.buffer[len(f.buffer):f.header.chunkSize], data)
+		f.buffer = f.buffer[:len(f.buffer)+n]
+		data = data[n:]
+		written += n
+	}
+	return written, nil
+}
+
+func (f *encryptingFile) seal(last bool) error {
+	sealed := f.aead.Seal(nil, nonce(f.index, last), f.buffer, f.header.raw)
+	f.index++
+	f.buffer = f.buffer[:0]
+	_, err := f.file.Write(sealed)
+	return err
+}
+
+func (f *encryptingFile) Close() error {
+	err := f.seal(true)
+	if closeErr := f.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// plaintext returns if a stored file of the length without the header is
+// presented as it is.
+func (e *Encrypted) plaintext(length int64) bool {
+	return length == 0 || e.AllowPlaintext
+}
+
+// decrypt returns the plaintext content of a file opened for reading, the
+// file itself when it is not encrypted and plaintext is allowed. Files that
+// cannot be read at any offset, like the ones in memory, are read whole.
+func (e *Encrypted) decrypt(file io.ReadWriteCloser) (io.ReadWriteCloser, error) {
+	stored, ok := file.(interface {
+		io.ReaderAt
+		io.Seeker
+	})
+	if !ok {
+		content, err := ioutil.ReadAll(file)
+		if err != nil {
+			return nil, err
+		}
+		stored = bytes.NewReader(content)
+	}
+	length, err := stored.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	header, err := readEncryptedHeader(io.NewSectionReader(stored, 0, length))
+	if err != nil {
+		return nil, err
+	}
+	if header == nil {
+		if !e.plaintext(length) {
+			return nil, CorruptedEncryption
+		}
+		return &plainFile{SectionReader: io.NewSectionReader(stored, 0, length), file: file}, nil
+	}
+	aead, err := e.Keys.aead(header)
+	if err != nil {
+		return nil, err
+	}
+	return &decryptingFile{stored: stored, file: file, header: header, aead: aead, length: length, size: header.plaintextSize(length)}, nil
+}
+
+// plainFile reads a file that is not encrypted.
+type plainFile struct {
+	*io.SectionReader
+	file io.Closer
+}
+
+func (f *plainFile) Write([]byte) (int, error) {
+	return 0, EncryptedAccess
+}
+
+func (f *plainFile) Close() error {
+	return f.file.Close()
+}
+
+// decryptingFile reads the plaintext of an encrypted file from any offset,
+// decrypting the chunks it covers.
+type decryptingFile struct {
+	stored io.ReaderAt
+	file   io.Closer
+	header *encryptedHeader
+	aead   cipher.AEAD
+	length int64
+	size   int64
+	offset int64
+
+	// chunk is the plaintext of the chunk at index, the last one decrypted.
+	chunk []byte
+	index int64
+}
+
+// Size returns the plaintext size.
+func (f *decryptingFile) Size() int64 {
+	return f.size
+}
+
+// load decrypts the chunk at the index.
+func (f *decryptingFile) load(index int64) error {
+	if f.chunk != nil && f.index == index {
+		return nil
+	}
+	sealedSize := int64(f.header.chunkSize + nonceTag)
+	start := int64(len(f.header.raw)) + index*sealedSize
+	end := start + sealedSize
+	if end > f.length {
+		end = f.length
+	}
+	if start >= end {
+		return CorruptedEncryption
+	}
+	sealed := make([]byte, end-start)
+	if _, err := f.stored.ReadAt(sealed, start); err != nil && err != io.EOF {
+		return err
+	}
+	last := end == f.length
+	chunk, err := f.aead.Open(nil, nonce(index, last), sealed, f.header.raw)
+	if err != nil {
+		return CorruptedEncryption
+	}
+	f.chunk, f.index = chunk, index
+	return nil
+}
+
+func (f *decryptingFile) ReadAt(buffer []byte, offset int64) (int, error) {
+	if offset < 0 {
+		return 0, os.ErrInvalid
+	}
+	read := 0
+	for read < len(buffer) {
+		if offset >= f.size {
+			return read, io.EOF
+		}
+		index := offset / int64(f.header.chunkSize)
+		if err := f.load(index); err != nil {
+			return read, err
+		}
+		n := copy(buffer[read:], f.chunk[offset-index*int64(f.header.chunkSize):])
+		read += n
+		offset += int64(n)
+	}
+	return read, nil
+}
+
+func (f *decryptingFile) Read(buffer []byte) (int, error) {
+	if f.offset >= f.size {
+		if f.offset == f.size && f.size == 0 {
+			// the single empty chunk is still authenticated.
+			if err := f.load(0); err != nil {
+				return 0, err
+			}
+		}
+		return 0, io.EOF
+	}
+	n, err := f.ReadAt(buffer, f.offset)
+	f.offset += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+func (f *decryptingFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.size
+	default:
+		return 0, os.ErrInvalid
+	}
+	if offset < 0 {
+		return 0, os.ErrInvalid
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+func (f *decryptingFile) Write([]byte) (int, error) {
+	return 0, EncryptedAccess
+}
+
+func (f *decryptingFile) Close() error {
+	return f.file.Close()
+}
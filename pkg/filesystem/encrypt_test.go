@@ -0,0 +1,182 @@
+package filesystem_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/peymanmortazavi/fs-server/pkg/filesystem"
+)
+
+func testKey(b byte) string {
+	return base64.StdEncoding.EncodeToString([]byte(strings.Repeat(string(rune(b)), 32)))
+}
+
+func TestParseKeys(t *testing.T) {
+	for _, entries := range [][]string{
+		nil,
+		{"old"},
+		{"old:not base64"},
+		{"old:" + base64.StdEncoding.EncodeToString([]byte("short"))},
+		{"old:" + testKey('a'), "old:" + testKey('b')},
+		{":" + testKey('a')},
+	} {
+		if _, err := filesystem.ParseKeys(entries); err == nil {
+			t.Errorf("expected keys %v to be rejected", entries)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "keys")
+	ioutil.WriteFile(path, []byte("# rotated in 2026\nold:"+testKey('a')+"\n\nnew:"+testKey('b')+"\n"), 0600)
+	if _, err := filesystem.LoadKeyring(path); err != nil {
+		t.Errorf("failed to load the keyring: %s", err)
+	}
+}
+
+func TestEncrypted(t *testing.T) {
+	content := strings.Repeat("0123456789", 1000)
+	old, err := filesystem.ParseKeys([]string{"old:" + testKey('a')})
+	if err != nil {
+		t.Fatalf("failed to parse the keys: %s", err)
+	}
+	rotated, err := filesystem.ParseKeys([]string{"old:" + testKey('a'), "new:" + testKey('b')})
+	if err != nil {
+		t.Fatalf("failed to parse the keys: %s", err)
+	}
+	for name, backend := range map[string]func(t *testing.T) (filesystem.Editor, func(string) []byte, func(string, []byte)){
+		"local": func(t *testing.T) (filesystem.Editor, func(string) []byte, func(string, []byte)) {
+			root := t.TempDir()
+			return filesystem.DirManager{Root: root}, func(path string) []byte {
+					stored, _ := ioutil.ReadFile(filepath.Join(root, path))
+					return stored
+				}, func(path string, data []byte) {
+					ioutil.WriteFile(filepath.Join(root, path), data, 0644)
+				}
+		},
+		"memory": func(t *testing.T) (filesystem.Editor, func(string) []byte, func(string, []byte)) {
+			memory := filesystem.NewMemory()
+			return memory, func(path string) []byte {
+					item, _ := memory.Get(path)
+					file, _ := item.Open(os.O_RDONLY)
+					defer file.Close()
+					stored, _ := ioutil.ReadAll(file)
+					return stored
+				}, func(path string, data []byte) {
+					writeItem(t, memory, path, string(data))
+				}
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			editor, stored, store := backend(t)
+			writeItem(t, editor, "plain.txt", "written before encryption")
+			encrypted := filesystem.NewEncrypted(editor, old)
+			encrypted.ChunkSize = 1024
+			writeItem(t, encrypted, "a.txt", content)
+			writeItem(t, encrypted, "empty.txt", "")
+
+			if raw := string(stored("a.txt")); strings.Contains(raw, "0123456789") || !strings.HasPrefix(raw, "FSE2") {
+				t.Errorf("expected a.txt to be stored encrypted")
+			}
+			writeItem(t, encrypted, "copy.txt", content)
+			if original, copied := stored("a.txt"), stored("copy.txt"); bytes.Equal(original[len(original)-1024:], copied[len(copied)-1024:]) {
+				t.Errorf("expected files of the same content to be sealed with different subkeys")
+			}
+
+			listing, err := encrypted.Get("")
+			if err != nil {
+				t.Fatalf("failed to list the root: %s", err)
+			}
+			files := createFileMap(listing)
+			for name, expected := range map[string]string{"a.txt": content, "empty.txt": ""} {
+				if files[name].Size != int64(len(expected)) {
+					t.Errorf("expected %s to have the plaintext size %d but got %d", name, len(expected), files[name].Size)
+				}
+				if got := readItem(t, files[name]); got != expected {
+					t.Errorf("unexpected content of %s: %d bytes", name, len(got))
+				}
+			}
+
+			file, err := files["a.txt"].Open(os.O_RDONLY)
+			if err != nil {
+				t.Fatalf("failed to open a.txt: %s", err)
+			}
+			seeker, ok := file.(io.ReadSeeker)
+			if !ok {
+				t.Fatalf("expected a.txt to be opened for random access")
+			}
+			buffer := make([]byte, 20)
+			if _, err := seeker.Seek(1020, io.SeekStart); err != nil {
+				t.Fatalf("failed to seek: %s", err)
+			}
+			if _, err := io.ReadFull(seeker, buffer); err != nil || string(buffer) != content[1020:1040] {
+				t.Errorf("expected to read across chunks %q but got %q, %v", content[1020:1040], buffer, err)
+			}
+			if _, err := seeker.Seek(-5, io.SeekEnd); err != nil {
+				t.Fatalf("failed to seek: %s", err)
+			}
+			if rest, err := ioutil.ReadAll(seeker); err != nil || string(rest) != content[len(content)-5:] {
+				t.Errorf("expected to read the end %q but got %q, %v", content[len(content)-5:], rest, err)
+			}
+			file.Close()
+
+			if _, err := files["plain.txt"].Open(os.O_RDONLY); err != filesystem.CorruptedEncryption {
+				t.Errorf("expected a file without the header to fail without AllowPlaintext but got %v", err)
+			}
+			encrypted.AllowPlaintext = true
+			if item, _ := encrypted.Get("plain.txt"); readItem(t, item) != "written before encryption" {
+				t.Errorf("expected plain.txt to be read as it is with AllowPlaintext")
+			}
+
+			if _, err := files["a.txt"].Open(os.O_RDWR); err != filesystem.EncryptedAccess {
+				t.Errorf("expected opening to read and write at once to fail but got %v", err)
+			}
+
+			encrypted.Keys = rotated
+			if item, _ := encrypted.Get("a.txt"); readItem(t, item) != content {
+				t.Errorf("expected a.txt to be read with the old key after a rotation")
+			}
+			writeItem(t, encrypted, "b.txt", "secret")
+			item, err := filesystem.NewEncrypted(editor, old).Get("b.txt")
+			if err != nil {
+				t.Fatalf("failed to get b.txt: %s", err)
+			}
+			if _, err := item.Open(os.O_RDONLY); err != filesystem.UnknownKey {
+				t.Errorf("expected b.txt to be encrypted with the new key but got %v", err)
+			}
+
+			raw := stored("a.txt")
+			raw[len(raw)/2] ^= 1
+			store("tampered.txt", raw)
+			store("truncated.txt", stored("a.txt")[:len(raw)-1040])
+			for _, name := range []string{"tampered.txt", "truncated.txt"} {
+				item, err := encrypted.Get(name)
+				if err != nil {
+					t.Fatalf("failed to get %s: %s", name, err)
+				}
+				file, err := item.Open(os.O_RDONLY)
+				if err != nil {
+					t.Fatalf("failed to open %s: %s", name, err)
+				}
+				if _, err := ioutil.ReadAll(file); err != filesystem.CorruptedEncryption {
+					t.Errorf("expected reading %s to fail but got %v", name, err)
+				}
+				file.Close()
+			}
+		})
+	}
+}
+
+func TestEncryptedSizes(t *testing.T) {
+	keys, err := filesystem.ParseKeys([]string{"key:" + testKey('a')})
+	if err != nil {
+		t.Fatalf("failed to parse the keys: %s", err)
+	}
+	testPresentedSizes(t, func(editor filesystem.Editor) filesystem.Editor {
+		return filesystem.NewEncrypted(editor, keys)
+	})
+}
@@ -1,5 +1,11 @@
 package filesystem
 
+import (
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+)
+
 type internalError struct {
 	Message string
 }
@@ -11,6 +17,35 @@ func (i internalError) Error() string {
 var (
 	// FileAlreadyExists error for when a file already exists at a path.
 	FileAlreadyExists = internalError{Message: "File already exists at the given path."}
+
+	// UnsupportedDigest error for when a digest algorithm is not supported.
+	UnsupportedDigest = internalError{Message: "Digest algorithm is not supported."}
+
+	// WatchUnsupported error for when watching is not supported on the platform.
+	WatchUnsupported = internalError{Message: "Watching a directory is not supported on this platform."}
+
+	// NotRegularFile error for when an operation only works on regular files.
+	NotRegularFile = internalError{Message: "Item at the given path is not a regular file."}
+
+	// MoveUnsupported error for when an editor cannot move items.
+	MoveUnsupported = internalError{Message: "Moving items is not supported by the editor."}
+
+	// CrossMountMove error for when an item would move between mounts.
+	CrossMountMove = internalError{Message: "Items cannot move between mounts."}
+
+	// CompressedAccess error for when a compressed file is opened to be read
+	// and written at once or appended to.
+	CompressedAccess = internalError{Message: "Compressed files can only be read or written whole."}
+
+	// EncryptedAccess error for when an encrypted file is opened to be read
+	// and written at once or appended to.
+	EncryptedAccess = internalError{Message: "Encrypted files can only be read or written whole."}
+
+	// UnknownKey error for when a file is encrypted with a key not in the keyring.
+	UnknownKey = internalError{Message: "File is encrypted with an unknown key."}
+
+	// CorruptedEncryption error for when an encrypted file fails to decrypt.
+	CorruptedEncryption = internalError{Message: "Encrypted file is corrupted or was tampered with."}
 )
 
 // IsFileAlreadyExists returns if the error is the file already exists.
@@ -20,3 +55,19 @@ func IsFileAlreadyExists(err error) bool {
 	}
 	return false
 }
+
+// IsUnsupportedDigest returns if the error is the digest algorithm is not supported.
+func IsUnsupportedDigest(err error) bool {
+	if e, ok := err.(internalError); ok {
+		return e == UnsupportedDigest
+	}
+	return false
+}
+
+// IsCorrupted returns if the error is stored content failing to decrypt or to
+// decompress, or encrypted with an unknown key.
+func IsCorrupted(err error) bool {
+	var corruptInput flate.CorruptInputError
+	return errors.Is(err, CorruptedEncryption) || errors.Is(err, UnknownKey) ||
+		errors.Is(err, gzip.ErrChecksum) || errors.Is(err, gzip.ErrHeader) || errors.As(err, &corruptInput)
+}
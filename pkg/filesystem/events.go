@@ -0,0 +1,225 @@
+package filesystem
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultHistorySize    = 1024
+	subscriptionQueueSize = 256
+)
+
+// EventType describes the kind of change an event reports.
+type EventType string
+
+const (
+	// Created is reported when a file or directory is created.
+	Created EventType = "create"
+
+	// Modified is reported when the content of a file changes.
+	Modified EventType = "modify"
+
+	// Deleted is reported when a file or directory is removed.
+	Deleted EventType = "delete"
+
+	// Renamed is reported when a file or directory moves to a new path.
+	Renamed EventType = "rename"
+
+	// Reset is reported instead of the missed events when a watcher resumes
+	// after an event that is no longer recorded, anything at the watched path
+	// may have changed since.
+	Reset EventType = "reset"
+)
+
+// Event describes a change in a file system.
+//
+// IDs increase monotonically so a watcher can resume after the last event it saw.
+type Event struct {
+	ID      uint64
+	Type    EventType
+	Path    string
+	OldPath string
+	Time    time.Time
+}
+
+// Watcher describes the ability to observe changes in a file system.
+type Watcher interface {
+
+	// Watch subscribes to events at the given path, or anywhere beneath it when
+	// recursive. Events already recorded after the given event ID are replayed
+	// first, or a Reset event when they were not all kept. Use 0 to only
+	// receive new events.
+	Watch(path string, recursive bool, after uint64) (*Subscription, error)
+}
+
+// Subscription delivers events to one watcher until it is closed.
+type Subscription struct {
+	path      string
+	recursive bool
+	events    chan Event
+	hub       *EventHub
+	overflow  bool
+	closed    bool
+}
+
+// Events returns the channel events are delivered on.
+//
+// The channel is closed when the subscription is closed or could not keep up,
+// in which case Overflowed reports true.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Overflowed returns if events were dropped because the subscriber was too slow.
+func (s *Subscription) Overflowed() bool {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	return s.overflow
+}
+
+// Close stops the delivery of events.
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	s.hub.unsubscribe(s)
+}
+
+func (s *Subscription) matches(event Event) bool {
+	return pathMatches(s.path, event.Path, s.recursive) ||
+		(event.OldPath != "" && pathMatches(s.path, event.OldPath, s.recursive))
+}
+
+// pathMatches returns if path is the watched path, a direct child of it or,
+// for recursive watches, anywhere beneath it.
+func pathMatches(watched, path string, recursive bool) bool {
+	if path == watched {
+		return true
+	}
+	if watched != "" && !strings.HasPrefix(path, watched+"/") {
+		return false
+	}
+	return recursive || !strings.Contains(strings.TrimPrefix(path[len(watched):], "/"), "/")
+}
+
+// EventHub records events and fans them out to subscriptions.
+//
+// The zero value is ready to use and keeps the last 1024 events for resuming.
+type EventHub struct {
+	// HistorySize is the number of recent events kept for resuming watchers.
+	HistorySize int
+
+	mu            sync.Mutex
+	lastID        uint64
+	history       []Event
+	subscriptions map[*Subscription]struct{}
+}
+
+// Publish records a new event and delivers it to matching subscriptions.
+func (h *EventHub) Publish(eventType EventType, path, oldPath string) Event {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastID++
+	event := Event{ID: h.lastID, Type: eventType, Path: path, OldPath: oldPath, Time: time.Now()}
+
+	size := h.HistorySize
+	if size <= 0 {
+		size = defaultHistorySize
+	}
+	if len(h.history) >= size {
+		h.history = append(h.history[:0], h.history[len(h.history)-size+1:]...)
+	}
+	h.history = append(h.history, event)
+
+	for subscription := range h.subscriptions {
+		if subscription.matches(event) {
+			h.deliver(subscription, event)
+		}
+	}
+	return event
+}
+
+// deliver sends an event without blocking, dropping subscriptions that fall behind.
+func (h *EventHub) deliver(subscription *Subscription, event Event) {
+	select {
+	case subscription.events <- event:
+	default:
+		subscription.overflow = true
+		h.unsubscribe(subscription)
+	}
+}
+
+func (h *EventHub) unsubscribe(subscription *Subscription) {
+	if subscription.closed {
+		return
+	}
+	subscription.closed = true
+	delete(h.subscriptions, subscription)
+	close(subscription.events)
+}
+
+// CloseSubscriptions ends every subscription, their watchers can resume with
+// the last event ID they received.
+func (h *EventHub) CloseSubscriptions() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for subscription := range h.subscriptions {
+		h.unsubscribe(subscription)
+	}
+}
+
+// Watch subscribes to events at path, replaying recorded events after the given ID.
+//
+// The queue of the subscription is sized for the replayed events so they
+// cannot overflow it before the watcher starts receiving.
+func (h *EventHub) Watch(path string, recursive bool, after uint64) (*Subscription, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	subscription := &Subscription{
+		path:      strings.Trim(path, "/"),
+		recursive: recursive,
+		hub:       h,
+	}
+	var replay []Event
+	switch {
+	case after == 0 || after == h.lastID:
+	case after > h.lastID || len(h.history) == 0 || h.history[0].ID > after+1:
+		// the events after the given one were dropped from the history, or
+		// recorded by a previous run when the ID is ahead of this one.
+		replay = append(replay, Event{ID: h.lastID, Type: Reset, Path: subscription.path, Time: time.Now()})
+	default:
+		for _, event := range h.history {
+			if event.ID > after && subscription.matches(event) {
+				replay = append(replay, event)
+			}
+		}
+	}
+	subscription.events = make(chan Event, len(replay)+subscriptionQueueSize)
+	for _, event := range replay {
+		subscription.events <- event
+	}
+	if h.subscriptions == nil {
+		h.subscriptions = make(map[*Subscription]struct{})
+	}
+	h.subscriptions[subscription] = struct{}{}
+	return subscription, nil
+}
+
+// VisibleEvent hides the directories reserved for the trash and for versions
+// from an event. Moving an item to the trash is reported as its deletion and
+// restoring it as its creation. It returns false when the event only concerns
+// the reserved directories or the files written by Probe.
+func VisibleEvent(event Event) (Event, bool) {
+	switch {
+	case IsProbe(event.Path):
+		return event, false
+	case event.Type == Renamed && hidden(event.Path) && event.OldPath != "" && !hidden(event.OldPath):
+		event.Type, event.Path, event.OldPath = Deleted, event.OldPath, ""
+	case event.Type == Renamed && hidden(event.OldPath) && !hidden(event.Path):
+		event.Type, event.OldPath = Created, ""
+	case hidden(event.Path):
+		return event, false
+	}
+	return event, true
+}
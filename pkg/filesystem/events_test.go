@@ -0,0 +1,135 @@
+package filesystem_test
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/peymanmortazavi/fs-server/pkg/filesystem"
+)
+
+func expectEvent(t *testing.T, subscription *filesystem.Subscription, eventType filesystem.EventType, path string) filesystem.Event {
+	t.Helper()
+	select {
+	case event, ok := <-subscription.Events():
+		if !ok {
+			t.Fatalf("subscription closed while waiting for %s %s", eventType, path)
+		}
+		if event.Type != eventType || event.Path != path {
+			t.Fatalf("expected %s %s but got %s %s", eventType, path, event.Type, event.Path)
+		}
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for %s %s", eventType, path)
+	}
+	return filesystem.Event{}
+}
+
+func TestEventHub(t *testing.T) {
+	hub := &filesystem.EventHub{}
+	direct, _ := hub.Watch("sub", false, 0)
+	recursive, _ := hub.Watch("sub", true, 0)
+	defer direct.Close()
+	defer recursive.Close()
+
+	hub.Publish(filesystem.Created, "other.txt", "")
+	first := hub.Publish(filesystem.Created, "sub/a.txt", "")
+	hub.Publish(filesystem.Modified, "sub/deep/b.txt", "")
+	hub.Publish(filesystem.Renamed, "moved.txt", "sub/a.txt")
+
+	expectEvent(t, direct, filesystem.Created, "sub/a.txt")
+	expectEvent(t, direct, filesystem.Renamed, "moved.txt")
+	expectEvent(t, recursive, filesystem.Created, "sub/a.txt")
+	expectEvent(t, recursive, filesystem.Modified, "sub/deep/b.txt")
+	expectEvent(t, recursive, filesystem.Renamed, "moved.txt")
+
+	// resuming replays everything after the given event.
+	resumed, _ := hub.Watch("", true, first.ID)
+	defer resumed.Close()
+	expectEvent(t, resumed, filesystem.Modified, "sub/deep/b.txt")
+	expectEvent(t, resumed, filesystem.Renamed, "moved.txt")
+
+	hub.CloseSubscriptions()
+	if _, ok := <-resumed.Events(); ok || resumed.Overflowed() {
+		t.Errorf("expected closing subscriptions to end them without overflowing")
+	}
+}
+
+func TestEventHubResume(t *testing.T) {
+	hub := &filesystem.EventHub{HistorySize: 2}
+	first := hub.Publish(filesystem.Created, "a.txt", "")
+	hub.Publish(filesystem.Modified, "a.txt", "")
+	hub.Publish(filesystem.Modified, "b.txt", "")
+	last := hub.Publish(filesystem.Deleted, "a.txt", "")
+
+	// events missing from the history are reported as a reset.
+	for _, after := range []uint64{first.ID, last.ID + 10} {
+		subscription, _ := hub.Watch("", true, after)
+		event := expectEvent(t, subscription, filesystem.Reset, "")
+		if event.ID != last.ID {
+			t.Errorf("expected the reset to resume after %d but got %d", last.ID, event.ID)
+		}
+		subscription.Close()
+	}
+	subscription, _ := hub.Watch("", true, first.ID+1)
+	defer subscription.Close()
+	expectEvent(t, subscription, filesystem.Modified, "b.txt")
+	expectEvent(t, subscription, filesystem.Deleted, "a.txt")
+
+	// a replay longer than the live queue is delivered whole.
+	hub = &filesystem.EventHub{}
+	start := hub.Publish(filesystem.Created, "a.txt", "")
+	for i := 0; i < 1000; i++ {
+		hub.Publish(filesystem.Modified, "a.txt", "")
+	}
+	resumed, _ := hub.Watch("", true, start.ID)
+	hub.CloseSubscriptions()
+	count := 0
+	for range resumed.Events() {
+		count++
+	}
+	if count != 1000 || resumed.Overflowed() {
+		t.Errorf("expected 1000 replayed events but received %d", count)
+	}
+}
+
+func TestEventHubOverflow(t *testing.T) {
+	hub := &filesystem.EventHub{}
+	subscription, _ := hub.Watch("", true, 0)
+	for i := 0; i < 1000; i++ {
+		hub.Publish(filesystem.Modified, "a.txt", "")
+	}
+	count := 0
+	for range subscription.Events() {
+		count++
+	}
+	if !subscription.Overflowed() || count == 1000 {
+		t.Errorf("expected a slow subscription to be dropped, received %d events", count)
+	}
+}
+
+func TestNotifier(t *testing.T) {
+	root := setupTestDir(t)
+	notifier := filesystem.NewNotifier(filesystem.DirManager{Root: root})
+	subscription, _ := notifier.Watch("", true, 0)
+	defer subscription.Close()
+
+	item, err := notifier.CreateFile("a.txt")
+	if err != nil {
+		t.Fatalf("failed to create file: %s", err)
+	}
+	expectEvent(t, subscription, filesystem.Created, "a.txt")
+
+	file, err := item.Open(os.O_WRONLY)
+	if err != nil {
+		t.Fatalf("failed to open file: %s", err)
+	}
+	file.Write([]byte("data"))
+	file.Close()
+	expectEvent(t, subscription, filesystem.Modified, "a.txt")
+
+	if err := notifier.Delete("a.txt"); err != nil {
+		t.Fatalf("failed to delete file: %s", err)
+	}
+	expectEvent(t, subscription, filesystem.Deleted, "a.txt")
+}
@@ -0,0 +1,143 @@
+package filesystem
+
+import (
+	"context"
+	"log"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Index keeps the metadata of every item in memory so searches do not need to
+// walk the tree, it is kept fresh by the events of a Watcher.
+type Index struct {
+	viewer Viewer
+
+	mu           sync.RWMutex
+	items        map[string]Item
+	subscription *Subscription
+	done         chan struct{}
+}
+
+// NewIndex walks the whole tree of viewer and follows the changes reported by watcher.
+func NewIndex(viewer Viewer, watcher Watcher) (*Index, error) {
+	// subscribe first so nothing that changes during the walk is missed.
+	subscription, err := watcher.Watch("", true, 0)
+	if err != nil {
+		return nil, err
+	}
+	index := &Index{viewer: viewer, items: make(map[string]Item), subscription: subscription, done: make(chan struct{})}
+	matches, err := Search(context.Background(), viewer, "", Query{}, 0)
+	if err != nil {
+		subscription.Close()
+		return nil, err
+	}
+	for _, match := range matches {
+		index.items[match.Path] = withoutChildren(match.Item)
+	}
+	go index.follow()
+	return index, nil
+}
+
+// Close stops following changes.
+func (x *Index) Close() {
+	x.subscription.Close()
+	<-x.done
+}
+
+// Len returns the number of indexed items.
+func (x *Index) Len() int {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return len(x.items)
+}
+
+func withoutChildren(item Item) Item {
+	item.Children = nil
+	return item
+}
+
+func (x *Index) follow() {
+	defer close(x.done)
+	for event := range x.subscription.Events() {
+		switch event.Type {
+		case Created, Modified:
+			x.refresh(event.Path)
+		case Deleted:
+			x.remove(event.Path)
+		case Renamed:
+			x.remove(event.OldPath)
+			x.refresh(event.Path)
+		}
+	}
+	if x.subscription.Overflowed() {
+		log.Printf("search index fell behind the changes, searches may be stale")
+	}
+}
+
+// refresh indexes the item at the given path again, along with its subtree.
+func (x *Index) refresh(itemPath string) {
+	item, err := x.viewer.Get(itemPath)
+	if err != nil {
+		x.remove(itemPath)
+		return
+	}
+	item.Name = path.Base(itemPath)
+	var matches []Match
+	if item.FileMode.IsDir() {
+		matches, _ = Search(context.Background(), x.viewer, itemPath, Query{}, 0)
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.items[itemPath] = withoutChildren(item)
+	for _, match := range matches {
+		x.items[match.Path] = withoutChildren(match.Item)
+	}
+}
+
+func (x *Index) remove(itemPath string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	for p := range x.items {
+		if p == itemPath || strings.HasPrefix(p, itemPath+"/") {
+			delete(x.items, p)
+		}
+	}
+}
+
+// Search returns the indexed items beneath root matching the query, sorted by path.
+func (x *Index) Search(ctx context.Context, root string, query Query) ([]Match, error) {
+	root = strings.Trim(root, "/")
+	x.mu.RLock()
+	var candidates []Match
+	for p, item := range x.items {
+		if root != "" && !strings.HasPrefix(p, root+"/") {
+			continue
+		}
+		if query.matchesMetadata(p, item) {
+			candidates = append(candidates, Match{Path: p, Item: item})
+		}
+	}
+	x.mu.RUnlock()
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].Path < candidates[j].Path })
+
+	matches := candidates[:0]
+	for _, match := range candidates {
+		if err := ctx.Err(); err != nil {
+			return matches, err
+		}
+		if query.Content != nil {
+			lines, err := grep(match.Item, query.Content)
+			if err != nil || len(lines) == 0 {
+				continue
+			}
+			match.Lines = lines
+		}
+		matches = append(matches, match)
+		if query.Limit > 0 && len(matches) == query.Limit {
+			break
+		}
+	}
+	return matches, nil
+}
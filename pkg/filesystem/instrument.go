@@ -0,0 +1,100 @@
+package filesystem
+
+import (
+	"io"
+	"time"
+)
+
+// ObserveFunc receives the duration and result of a backend operation.
+type ObserveFunc func(operation string, duration time.Duration, err error)
+
+// Instrumented is an Editor reporting how long every operation of the Editor it
+// decorates takes. Opening the content of items is reported as "open".
+//
+// It should decorate the backend directly so other decorators are not measured.
+type Instrumented struct {
+	Editor
+	Observe ObserveFunc
+}
+
+// NewInstrumented returns an Instrumented reporting operations to observe.
+func NewInstrumented(editor Editor, observe ObserveFunc) *Instrumented {
+	return &Instrumented{Editor: editor, Observe: observe}
+}
+
+func (i *Instrumented) observe(operation string, started time.Time, err error) {
+	i.Observe(operation, time.Since(started), err)
+}
+
+// Get returns the item at the given path, reporting as "get".
+func (i *Instrumented) Get(path string) (Item, error) {
+	started := time.Now()
+	item, err := i.Editor.Get(path)
+	i.observe("get", started, err)
+	if err == nil {
+		i.wrap(&item)
+	}
+	return item, err
+}
+
+// CreateFile creates a file, reporting as "create_file".
+func (i *Instrumented) CreateFile(path string) (Item, error) {
+	started := time.Now()
+	item, err := i.Editor.CreateFile(path)
+	i.observe("create_file", started, err)
+	if err == nil {
+		i.wrap(&item)
+	}
+	return item, err
+}
+
+// CreateDir creates a directory, reporting as "create_dir".
+func (i *Instrumented) CreateDir(path string) (Item, error) {
+	started := time.Now()
+	item, err := i.Editor.CreateDir(path)
+	i.observe("create_dir", started, err)
+	return item, err
+}
+
+// Delete removes an item, reporting as "delete".
+func (i *Instrumented) Delete(path string) error {
+	started := time.Now()
+	err := i.Editor.Delete(path)
+	i.observe("delete", started, err)
+	return err
+}
+
+// Move moves an item when the decorated Editor is a Mover, reporting as "move".
+func (i *Instrumented) Move(oldPath, newPath string) error {
+	mover, ok := i.Editor.(Mover)
+	if !ok {
+		return MoveUnsupported
+	}
+	started := time.Now()
+	err := mover.Move(oldPath, newPath)
+	i.observe("move", started, err)
+	return err
+}
+
+func (i *Instrumented) wrap(item *Item) {
+	if item.Opener != nil {
+		item.Opener = instrumentedOpener{item.Opener, i}
+	}
+	for index := range item.Children {
+		if item.Children[index].Opener != nil {
+			item.Children[index].Opener = instrumentedOpener{item.Children[index].Opener, i}
+		}
+	}
+}
+
+type instrumentedOpener struct {
+	Opener
+	instrumented *Instrumented
+}
+
+func (o instrumentedOpener) Open(flag int) (io.ReadWriteCloser, error) {
+	started := time.Now()
+	file, err := o.Opener.Open(flag)
+	o.instrumented.observe("open", started, err)
+	return file, err
+}
@@ -0,0 +1,45 @@
+package filesystem_test
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/peymanmortazavi/fs-server/pkg/filesystem"
+)
+
+func TestInstrumented(t *testing.T) {
+	root := setupTestDir(t)
+	createBasicDirStructure(root)
+	var observed []string
+	instrumented := filesystem.NewInstrumented(filesystem.DirManager{Root: root}, func(operation string, duration time.Duration, err error) {
+		result := "ok"
+		if err != nil {
+			result = "error"
+		}
+		observed = append(observed, operation+":"+result)
+	})
+
+	listing, _ := instrumented.Get("")
+	readItem(t, createFileMap(listing)["a.txt"])
+	instrumented.Get("missing")
+	instrumented.CreateDir("new")
+	writeItem(t, instrumented, "new/c.txt", bContent)
+	if err := instrumented.Move("new/c.txt", "c.txt"); err != nil {
+		t.Fatalf("failed to move through the decorator: %s", err)
+	}
+	instrumented.Delete("new")
+
+	expected := "get:ok open:ok get:error create_dir:ok get:error create_file:ok open:ok move:ok delete:ok"
+	if got := strings.Join(observed, " "); got != expected {
+		t.Errorf("unexpected operations:\n%s\nexpected:\n%s", got, expected)
+	}
+	if _, err := os.Stat(root + "/c.txt"); err != nil {
+		t.Errorf("expected the file to be moved: %s", err)
+	}
+
+	if err := filesystem.NewInstrumented(filesystem.NewMemory(), func(string, time.Duration, error) {}).Move("a", "b"); !os.IsNotExist(err) {
+		t.Errorf("expected moving a missing item in memory to fail but got %v", err)
+	}
+}
@@ -3,6 +3,7 @@ package filesystem
 import (
 	"io"
 	"io/fs"
+	"time"
 )
 
 // Opener describes the ability to create a reader object.
@@ -17,6 +18,7 @@ type Item struct {
 	Owner    string
 	Children []Item
 	Size     int64
+	ModTime  time.Time
 	Opener
 }
 
@@ -40,3 +42,10 @@ type Editor interface {
 	// Delete removes a file item at the given path.
 	Delete(path string) error
 }
+
+// Mover describes the ability to move items without copying their content.
+type Mover interface {
+
+	// Move moves the item at oldPath to newPath, which must not exist.
+	Move(oldPath, newPath string) error
+}
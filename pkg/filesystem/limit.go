@@ -0,0 +1,86 @@
+package filesystem
+
+import "io"
+
+// Limited is an Editor bounding how many operations of the Editor it decorates
+// run at once, operations beyond the limit wait for one to finish. Opening
+// the content of items counts as an operation, reading it does not.
+type Limited struct {
+	Editor
+	slots chan struct{}
+}
+
+// NewLimited returns a Limited running at most max operations at once.
+func NewLimited(editor Editor, max int) *Limited {
+	return &Limited{Editor: editor, slots: make(chan struct{}, max)}
+}
+
+func (l *Limited) acquire() func() {
+	l.slots <- struct{}{}
+	return func() { <-l.slots }
+}
+
+// Get returns the item at the given path.
+func (l *Limited) Get(path string) (Item, error) {
+	release := l.acquire()
+	item, err := l.Editor.Get(path)
+	release()
+	if err == nil {
+		l.wrap(&item)
+	}
+	return item, err
+}
+
+// CreateFile creates a file.
+func (l *Limited) CreateFile(path string) (Item, error) {
+	release := l.acquire()
+	item, err := l.Editor.CreateFile(path)
+	release()
+	if err == nil {
+		l.wrap(&item)
+	}
+	return item, err
+}
+
+// CreateDir creates a directory.
+func (l *Limited) CreateDir(path string) (Item, error) {
+	defer l.acquire()()
+	return l.Editor.CreateDir(path)
+}
+
+// Delete removes an item.
+func (l *Limited) Delete(path string) error {
+	defer l.acquire()()
+	return l.Editor.Delete(path)
+}
+
+// Move moves an item when the decorated Editor is a Mover.
+func (l *Limited) Move(oldPath, newPath string) error {
+	mover, ok := l.Editor.(Mover)
+	if !ok {
+		return MoveUnsupported
+	}
+	defer l.acquire()()
+	return mover.Move(oldPath, newPath)
+}
+
+func (l *Limited) wrap(item *Item) {
+	if item.Opener != nil {
+		item.Opener = limitedOpener{item.Opener, l}
+	}
+	for index := range item.Children {
+		if item.Children[index].Opener != nil {
+			item.Children[index].Opener = limitedOpener{item.Children[index].Opener, l}
+		}
+	}
+}
+
+type limitedOpener struct {
+	Opener
+	limited *Limited
+}
+
+func (o limitedOpener) Open(flag int) (io.ReadWriteCloser, error) {
+	defer o.limited.acquire()()
+	return o.Opener.Open(flag)
+}
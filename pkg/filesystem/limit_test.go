@@ -0,0 +1,62 @@
+package filesystem_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/peymanmortazavi/fs-server/pkg/filesystem"
+)
+
+// concurrencyEditor records how many operations run at once.
+type concurrencyEditor struct {
+	filesystem.Editor
+	mu      sync.Mutex
+	running int
+	max     int
+}
+
+func (e *concurrencyEditor) Get(path string) (filesystem.Item, error) {
+	e.mu.Lock()
+	e.running++
+	if e.running > e.max {
+		e.max = e.running
+	}
+	e.mu.Unlock()
+	time.Sleep(5 * time.Millisecond)
+	e.mu.Lock()
+	e.running--
+	e.mu.Unlock()
+	return e.Editor.Get(path)
+}
+
+func TestLimited(t *testing.T) {
+	memory := filesystem.NewMemory()
+	writeItem(t, memory, "a.txt", bContent)
+	backend := &concurrencyEditor{Editor: memory}
+	limited := filesystem.NewLimited(backend, 2)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := limited.Get("a.txt"); err != nil {
+				t.Errorf("failed to get through the decorator: %s", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if backend.max != 2 {
+		t.Errorf("expected 2 operations to run at once but got %d", backend.max)
+	}
+
+	item, err := limited.Get("a.txt")
+	if err != nil {
+		t.Fatalf("failed to get a.txt: %s", err)
+	}
+	readItem(t, item)
+	if err := filesystem.NewLimited(memory, 1).Move("a.txt", "b.txt"); err != nil {
+		t.Errorf("failed to move through the decorator: %s", err)
+	}
+}
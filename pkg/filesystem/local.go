@@ -54,7 +54,7 @@ func (d DirManager) Get(path string) (Item, error) {
 		return Item{}, err
 	}
 
-	item := Item{FileMode: info.Mode(), Name: info.Name(), Size: info.Size(), Owner: ownerName(info)}
+	item := Item{FileMode: info.Mode(), Name: info.Name(), Size: info.Size(), ModTime: info.ModTime(), Owner: ownerName(info)}
 
 	if info.IsDir() {
 		// create an item for the directory.
@@ -64,7 +64,7 @@ func (d DirManager) Get(path string) (Item, error) {
 		}
 		item.Children = make([]Item, 0, len(files))
 		for _, file := range files {
-			child := Item{FileMode: file.Mode(), Name: file.Name(), Size: file.Size(), Owner: ownerName(file)}
+			child := Item{FileMode: file.Mode(), Name: file.Name(), Size: file.Size(), ModTime: file.ModTime(), Owner: ownerName(file)}
 			if file.Mode().IsRegular() {
 				child.Opener = fileOpener{filepath.Join(absolutePath, file.Name())}
 			}
@@ -96,14 +96,30 @@ func (d DirManager) CreateFile(path string) (Item, error) {
 // CreateDir creates a local directory.
 func (d DirManager) CreateDir(path string) (Item, error) {
 	absolutePath := filepath.Join(d.Root, path)
-	if err := os.MkdirAll(absolutePath, 0644); err != nil {
+	if err := os.MkdirAll(absolutePath, 0755); err != nil {
 		return Item{}, err
 	}
 	return d.Get(path)
 }
 
 // Delete removes the file or directory completely.
+//
+// Error happens if nothing exists at the given path.
 func (d DirManager) Delete(path string) error {
 	absolutePath := filepath.Join(d.Root, path)
+	if _, err := os.Lstat(absolutePath); err != nil {
+		return err
+	}
 	return os.RemoveAll(absolutePath)
 }
+
+// Move renames a local file or directory, refusing to replace an existing one.
+func (d DirManager) Move(oldPath, newPath string) error {
+	absolutePath := filepath.Join(d.Root, newPath)
+	if _, err := os.Lstat(absolutePath); err == nil {
+		return FileAlreadyExists
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	return os.Rename(filepath.Join(d.Root, oldPath), absolutePath)
+}
@@ -44,6 +44,23 @@ func createBasicDirStructure(root string) {
 	ioutil.WriteFile(filepath.Join(root, "sub", "b.txt"), []byte(bContent), 0664)
 }
 
+func TestCreateDir(t *testing.T) {
+	root := setupTestDir(t)
+	manager := filesystem.DirManager{Root: root}
+	if _, err := manager.CreateDir("a/b"); err != nil {
+		t.Fatalf("failed to create directories: %s", err)
+	}
+	for _, dir := range []string{"a", "a/b"} {
+		info, err := os.Stat(filepath.Join(root, dir))
+		if err != nil {
+			t.Fatalf("failed to stat %s: %s", dir, err)
+		}
+		if info.Mode().Perm()&0100 == 0 {
+			t.Errorf("expected %s to be searchable by its owner but got %s", dir, info.Mode())
+		}
+	}
+}
+
 func TestView(t *testing.T) {
 	root := setupTestDir(t)
 	manager := filesystem.DirManager{root}
@@ -135,3 +152,19 @@ func TestView(t *testing.T) {
 		}
 	}
 }
+
+func TestDelete(t *testing.T) {
+	root := setupTestDir(t)
+	createBasicDirStructure(root)
+	manager := filesystem.DirManager{Root: root}
+
+	if err := manager.Delete("sub"); err != nil {
+		t.Errorf("failed to delete directory: %s", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "sub")); !os.IsNotExist(err) {
+		t.Errorf("expected the directory to be removed but got %v", err)
+	}
+	if err := manager.Delete("sub"); !os.IsNotExist(err) {
+		t.Errorf("expected deleting a missing path to fail but got %v", err)
+	}
+}
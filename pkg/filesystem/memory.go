@@ -0,0 +1,272 @@
+package filesystem
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Memory is an Editor keeping a tree of files in memory, useful for scratch
+// space and tests. Its content is lost when the process exits.
+type Memory struct {
+	mu   sync.RWMutex
+	root *memoryNode
+}
+
+type memoryNode struct {
+	mode     fs.FileMode
+	name     string
+	data     []byte
+	modTime  time.Time
+	children map[string]*memoryNode
+}
+
+// NewMemory returns an empty in-memory file system.
+func NewMemory() *Memory {
+	return &Memory{root: newMemoryDir("")}
+}
+
+func newMemoryDir(name string) *memoryNode {
+	return &memoryNode{mode: fs.ModeDir | 0755, name: name, modTime: time.Now(), children: map[string]*memoryNode{}}
+}
+
+func splitMemoryPath(itemPath string) []string {
+	itemPath = path.Clean("/" + itemPath)
+	if itemPath == "/" {
+		return nil
+	}
+	return strings.Split(itemPath[1:], "/")
+}
+
+// lookup returns the node at the given path, the caller must hold the lock.
+func (m *Memory) lookup(op, itemPath string) (*memoryNode, error) {
+	node := m.root
+	for _, name := range splitMemoryPath(itemPath) {
+		if !node.mode.IsDir() {
+			return nil, &os.PathError{Op: op, Path: itemPath, Err: syscall.ENOTDIR}
+		}
+		child, ok := node.children[name]
+		if !ok {
+			return nil, &os.PathError{Op: op, Path: itemPath, Err: os.ErrNotExist}
+		}
+		node = child
+	}
+	return node, nil
+}
+
+// parent returns the directory holding the item at the given path along with
+// the name of the item, the caller must hold the lock.
+func (m *Memory) parent(op, itemPath string) (*memoryNode, string, error) {
+	names := splitMemoryPath(itemPath)
+	if len(names) == 0 {
+		return nil, "", &os.PathError{Op: op, Path: itemPath, Err: os.ErrPermission}
+	}
+	dir, err := m.lookup(op, strings.Join(names[:len(names)-1], "/"))
+	if err != nil {
+		return nil, "", err
+	}
+	if !dir.mode.IsDir() {
+		return nil, "", &os.PathError{Op: op, Path: itemPath, Err: syscall.ENOTDIR}
+	}
+	return dir, names[len(names)-1], nil
+}
+
+// item describes a node, the caller must hold the lock.
+func (m *Memory) item(node *memoryNode, children bool) Item {
+	item := Item{FileMode: node.mode, Name: node.name, Size: int64(len(node.data)), ModTime: node.modTime}
+	if node.mode.IsRegular() {
+		item.Opener = memoryOpener{m, node}
+	}
+	if node.mode.IsDir() && children {
+		item.Children = make([]Item, 0, len(node.children))
+		for _, child := range node.children {
+			item.Children = append(item.Children, m.item(child, false))
+		}
+		sort.Slice(item.Children, func(i, j int) bool { return item.Children[i].Name < item.Children[j].Name })
+	}
+	return item
+}
+
+// Get returns the item at the given path.
+func (m *Memory) Get(itemPath string) (Item, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	node, err := m.lookup("stat", itemPath)
+	if err != nil {
+		return Item{}, err
+	}
+	return m.item(node, true), nil
+}
+
+// CreateFile creates an empty file, its directory must exist.
+func (m *Memory) CreateFile(itemPath string) (Item, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	dir, name, err := m.parent("create", itemPath)
+	if err != nil {
+		return Item{}, err
+	}
+	if _, ok := dir.children[name]; ok {
+		return Item{}, FileAlreadyExists
+	}
+	node := &memoryNode{mode: 0644, name: name, modTime: time.Now()}
+	dir.children[name] = node
+	dir.modTime = node.modTime
+	return m.item(node, true), nil
+}
+
+// CreateDir creates a directory along with its missing parents.
+func (m *Memory) CreateDir(itemPath string) (Item, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	node := m.root
+	for _, name := range splitMemoryPath(itemPath) {
+		if !node.mode.IsDir() {
+			return Item{}, &os.PathError{Op: "mkdir", Path: itemPath, Err: syscall.ENOTDIR}
+		}
+		child, ok := node.children[name]
+		if !ok {
+			child = newMemoryDir(name)
+			node.children[name] = child
+			node.modTime = child.modTime
+		}
+		node = child
+	}
+	if !node.mode.IsDir() {
+		return Item{}, &os.PathError{Op: "mkdir", Path: itemPath, Err: syscall.ENOTDIR}
+	}
+	return m.item(node, true), nil
+}
+
+// Delete removes the item at the given path along with everything beneath it,
+// deleting the root empties it.
+func (m *Memory) Delete(itemPath string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(splitMemoryPath(itemPath)) == 0 {
+		m.root.children = map[string]*memoryNode{}
+		m.root.modTime = time.Now()
+		return nil
+	}
+	dir, name, err := m.parent("remove", itemPath)
+	if err != nil {
+		return err
+	}
+	if _, ok := dir.children[name]; !ok {
+		return &os.PathError{Op: "remove", Path: itemPath, Err: os.ErrNotExist}
+	}
+	delete(dir.children, name)
+	dir.modTime = time.Now()
+	return nil
+}
+
+// Move moves an item to a path that does not exist yet.
+func (m *Memory) Move(oldPath, newPath string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	oldDir, oldName, err := m.parent("rename", oldPath)
+	if err != nil {
+		return err
+	}
+	node, ok := oldDir.children[oldName]
+	if !ok {
+		return &os.PathError{Op: "rename", Path: oldPath, Err: os.ErrNotExist}
+	}
+	newDir, newName, err := m.parent("rename", newPath)
+	if err != nil {
+		return err
+	}
+	if _, ok := newDir.children[newName]; ok {
+		return FileAlreadyExists
+	}
+	// a directory cannot move beneath itself.
+	if strings.HasPrefix(path.Clean("/"+newPath)+"/", path.Clean("/"+oldPath)+"/") {
+		return &os.PathError{Op: "rename", Path: newPath, Err: syscall.EINVAL}
+	}
+	delete(oldDir.children, oldName)
+	node.name = newName
+	newDir.children[newName] = node
+	now := time.Now()
+	oldDir.modTime, newDir.modTime = now, now
+	return nil
+}
+
+type memoryOpener struct {
+	memory *Memory
+	node   *memoryNode
+}
+
+// Open returns a handle reading and writing the content of a file.
+func (o memoryOpener) Open(flag int) (io.ReadWriteCloser, error) {
+	o.memory.mu.Lock()
+	defer o.memory.mu.Unlock()
+	writable := flag&(os.O_WRONLY|os.O_RDWR) != 0
+	if flag&os.O_TRUNC != 0 && writable {
+		o.node.data = nil
+		o.node.modTime = time.Now()
+	}
+	file := &memoryFile{opener: o, readable: flag&os.O_WRONLY == 0, writable: writable}
+	if flag&os.O_APPEND != 0 {
+		file.append = true
+	}
+	return file, nil
+}
+
+type memoryFile struct {
+	opener   memoryOpener
+	offset   int
+	readable bool
+	writable bool
+	append   bool
+	closed   bool
+}
+
+func (f *memoryFile) Read(buffer []byte) (int, error) {
+	if f.closed || !f.readable {
+		return 0, os.ErrPermission
+	}
+	f.opener.memory.mu.RLock()
+	defer f.opener.memory.mu.RUnlock()
+	data := f.opener.node.data
+	if f.offset >= len(data) {
+		return 0, io.EOF
+	}
+	n := copy(buffer, data[f.offset:])
+	f.offset += n
+	return n, nil
+}
+
+func (f *memoryFile) Write(buffer []byte) (int, error) {
+	if f.closed || !f.writable {
+		return 0, os.ErrPermission
+	}
+	f.opener.memory.mu.Lock()
+	defer f.opener.memory.mu.Unlock()
+	node := f.opener.node
+	if f.append {
+		f.offset = len(node.data)
+	}
+	if end := f.offset + len(buffer); end > len(node.data) {
+		data := make([]byte, end)
+		copy(data, node.data)
+		node.data = data
+	}
+	copy(node.data[f.offset:], buffer)
+	f.offset += len(buffer)
+	node.modTime = time.Now()
+	return len(buffer), nil
+}
+
+func (f *memoryFile) Close() error {
+	if f.closed {
+		return os.ErrClosed
+	}
+	f.closed = true
+	return nil
+}
@@ -0,0 +1,67 @@
+package filesystem_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/peymanmortazavi/fs-server/pkg/filesystem"
+)
+
+func TestMemory(t *testing.T) {
+	memory := filesystem.NewMemory()
+	if _, err := memory.CreateFile("sub/a.txt"); !os.IsNotExist(err) {
+		t.Errorf("expected creating a file in a missing directory to fail but got %v", err)
+	}
+	if _, err := memory.CreateDir("sub/deep"); err != nil {
+		t.Fatalf("failed to create directories: %s", err)
+	}
+	if _, err := memory.CreateFile("sub/a.txt"); err != nil {
+		t.Fatalf("failed to create file: %s", err)
+	}
+	if _, err := memory.CreateFile("sub/a.txt"); !filesystem.IsFileAlreadyExists(err) {
+		t.Errorf("expected creating an existing file to fail but got %v", err)
+	}
+	writeItem(t, memory, "sub/a.txt", aContent)
+	if item, _ := memory.Get("sub/a.txt"); item.Size != int64(len(aContent)) || readItem(t, item) != aContent {
+		t.Errorf("unexpected file after writing: %+v", item)
+	}
+
+	item, _ := memory.Get("sub/a.txt")
+	file, _ := item.Open(os.O_WRONLY | os.O_APPEND)
+	file.Write([]byte("!"))
+	file.Close()
+	if content := readItem(t, item); content != aContent+"!" {
+		t.Errorf("expected appended content but got %q", content)
+	}
+	writeItem(t, memory, "sub/a.txt", bContent)
+	if content := readItem(t, item); content != bContent {
+		t.Errorf("expected truncated content but got %q", content)
+	}
+
+	root, _ := memory.Get("/")
+	if !root.IsDir() || len(root.Children) != 1 || root.Children[0].Name != "sub" {
+		t.Errorf("unexpected root listing: %+v", root.Children)
+	}
+	if sub, _ := memory.Get("sub"); len(sub.Children) != 2 || sub.Children[0].Name != "a.txt" || sub.Children[1].Name != "deep" {
+		t.Errorf("unexpected listing of sub: %+v", sub.Children)
+	}
+
+	if err := memory.Move("sub", "sub/deep/sub"); err == nil {
+		t.Errorf("expected moving a directory beneath itself to fail")
+	}
+	if err := memory.Move("sub/a.txt", "b.txt"); err != nil {
+		t.Fatalf("failed to move file: %s", err)
+	}
+	if moved, err := memory.Get("b.txt"); err != nil || moved.Name != "b.txt" || readItem(t, moved) != bContent {
+		t.Errorf("unexpected moved file: %+v %v", moved, err)
+	}
+	if err := memory.Delete("sub"); err != nil {
+		t.Fatalf("failed to delete directory: %s", err)
+	}
+	if _, err := memory.Get("sub/deep"); !os.IsNotExist(err) {
+		t.Errorf("expected deleted directory to be gone but got %v", err)
+	}
+	if err := memory.Delete("sub"); !os.IsNotExist(err) {
+		t.Errorf("expected deleting a missing item to fail but got %v", err)
+	}
+}
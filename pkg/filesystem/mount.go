@@ -0,0 +1,234 @@
+package filesystem
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Mount serves an Editor at a path of a MountTable.
+type Mount struct {
+	Path   string
+	Editor Editor
+
+	// ReadOnly rejects every change beneath the mount with a *ReadOnlyError.
+	ReadOnly bool
+}
+
+// MountTable is an Editor composing several editors into one namespace. Every
+// path is handled by the mount with the longest matching path, and mount
+// points are listed as directories in the listing of their parent.
+//
+// Directories leading to mount points exist even when no mount covers them,
+// they cannot be changed. Mount points themselves cannot be deleted or moved.
+type MountTable struct {
+	// mounts is sorted by path, the longest first.
+	mounts []Mount
+}
+
+// NewMountTable returns a MountTable serving the given mounts.
+func NewMountTable(mounts []Mount) (*MountTable, error) {
+	table := &MountTable{mounts: make([]Mount, 0, len(mounts))}
+	seen := make(map[string]bool, len(mounts))
+	for _, mount := range mounts {
+		mount.Path = cleanMountPath(mount.Path)
+		if seen[mount.Path] {
+			return nil, fmt.Errorf("%q is mounted more than once", "/"+mount.Path)
+		}
+		seen[mount.Path] = true
+		table.mounts = append(table.mounts, mount)
+	}
+	sort.Slice(table.mounts, func(i, j int) bool { return len(table.mounts[i].Path) > len(table.mounts[j].Path) })
+	return table, nil
+}
+
+func cleanMountPath(itemPath string) string {
+	return strings.Trim(path.Clean("/"+itemPath), "/")
+}
+
+// beneath returns the path relative to dir when it is dir or beneath it.
+func beneath(itemPath, dir string) (string, bool) {
+	switch {
+	case dir == "":
+		return itemPath, true
+	case itemPath == dir:
+		return "", true
+	case strings.HasPrefix(itemPath, dir+"/"):
+		return itemPath[len(dir)+1:], true
+	}
+	return "", false
+}
+
+// Mounts returns the mounts of the table, the longest path first.
+func (t *MountTable) Mounts() []Mount {
+	return append([]Mount(nil), t.mounts...)
+}
+
+// resolve returns the mount handling the path along with the path relative to it.
+func (t *MountTable) resolve(itemPath string) (Mount, string, bool) {
+	for _, mount := range t.mounts {
+		if relative, ok := beneath(itemPath, mount.Path); ok {
+			return mount, relative, true
+		}
+	}
+	return Mount{}, "", false
+}
+
+// mountPointsBeneath returns the mounts strictly beneath the path.
+func (t *MountTable) mountPointsBeneath(itemPath string) []Mount {
+	var mounts []Mount
+	for _, mount := range t.mounts {
+		if relative, ok := beneath(mount.Path, itemPath); ok && relative != "" {
+			mounts = append(mounts, mount)
+		}
+	}
+	return mounts
+}
+
+// writable returns the mount handling a change to the path, refusing changes to
+// read-only mounts and to the paths holding mount points.
+func (t *MountTable) writable(op, itemPath string) (Mount, string, error) {
+	mount, relative, ok := t.resolve(itemPath)
+	switch {
+	case !ok:
+		return mount, "", &os.PathError{Op: op, Path: itemPath, Err: os.ErrNotExist}
+	case relative == "" && mount.Path != "", len(t.mountPointsBeneath(itemPath)) > 0:
+		return mount, "", &os.PathError{Op: op, Path: itemPath, Err: os.ErrPermission}
+	case mount.ReadOnly:
+		return mount, "", &ReadOnlyError{Op: op, Path: itemPath}
+	}
+	return mount, relative, nil
+}
+
+func mountPointItem(name string, item Item) Item {
+	if !item.IsDir() {
+		item = Item{FileMode: fs.ModeDir | 0755, ModTime: time.Now()}
+	}
+	item.Name = name
+	item.Children = nil
+	return item
+}
+
+// Get returns the item at the given path, listing the mount points beneath it.
+func (t *MountTable) Get(itemPath string) (Item, error) {
+	itemPath = cleanMountPath(itemPath)
+	mounts := t.mountPointsBeneath(itemPath)
+	mount, relative, ok := t.resolve(itemPath)
+	var item Item
+	var err error
+	if ok {
+		item, err = mount.Editor.Get(relative)
+		if mount.ReadOnly {
+			item = readOnlyItem(item)
+		}
+	} else {
+		err = &os.PathError{Op: "stat", Path: itemPath, Err: os.ErrNotExist}
+	}
+	if relative == "" && itemPath != "" && err == nil {
+		item.Name = path.Base(itemPath)
+	}
+	if len(mounts) == 0 {
+		return item, err
+	}
+	if err != nil || !item.IsDir() {
+		if err != nil && !os.IsNotExist(err) {
+			return item, err
+		}
+		// a directory leading to mount points.
+		item = Item{FileMode: fs.ModeDir | 0555, Name: path.Base("/" + itemPath), ModTime: time.Now()}
+		if itemPath == "" {
+			item.Name = ""
+		}
+	}
+
+	points := make(map[string]Item)
+	for _, point := range mounts {
+		relative, _ := beneath(point.Path, itemPath)
+		name := strings.SplitN(relative, "/", 2)[0]
+		if _, ok := points[name]; ok {
+			continue
+		}
+		var child Item
+		if !strings.Contains(relative, "/") {
+			child, _ = point.Editor.Get("")
+		}
+		points[name] = mountPointItem(name, child)
+	}
+	children := make([]Item, 0, len(item.Children)+len(points))
+	for _, child := range item.Children {
+		if _, ok := points[child.Name]; !ok {
+			children = append(children, child)
+		}
+	}
+	for _, point := range points {
+		children = append(children, point)
+	}
+	sort.Slice(children, func(i, j int) bool { return children[i].Name < children[j].Name })
+	item.Children = children
+	return item, nil
+}
+
+// CreateFile creates a file in the mount handling the path.
+func (t *MountTable) CreateFile(itemPath string) (Item, error) {
+	itemPath = cleanMountPath(itemPath)
+	mount, relative, err := t.writable("create", itemPath)
+	if err != nil {
+		return Item{}, err
+	}
+	item, err := mount.Editor.CreateFile(relative)
+	item.Name = path.Base(itemPath)
+	return item, err
+}
+
+// CreateDir creates a directory in the mount handling the path, the
+// directories leading to mount points already exist.
+func (t *MountTable) CreateDir(itemPath string) (Item, error) {
+	itemPath = cleanMountPath(itemPath)
+	if mount, relative, ok := t.resolve(itemPath); (ok && relative == "" && mount.Path != "") || len(t.mountPointsBeneath(itemPath)) > 0 {
+		return t.Get(itemPath)
+	}
+	mount, relative, err := t.writable("mkdir", itemPath)
+	if err != nil {
+		return Item{}, err
+	}
+	if _, err := mount.Editor.CreateDir(relative); err != nil {
+		return Item{}, err
+	}
+	return t.Get(itemPath)
+}
+
+// Delete removes the item at the given path from the mount handling it.
+func (t *MountTable) Delete(itemPath string) error {
+	itemPath = cleanMountPath(itemPath)
+	mount, relative, err := t.writable("remove", itemPath)
+	if err != nil {
+		return err
+	}
+	return mount.Editor.Delete(relative)
+}
+
+// Move moves an item within a mount that is a Mover, items cannot move
+// between mounts.
+func (t *MountTable) Move(oldPath, newPath string) error {
+	oldPath, newPath = cleanMountPath(oldPath), cleanMountPath(newPath)
+	oldMount, oldRelative, err := t.writable("rename", oldPath)
+	if err != nil {
+		return err
+	}
+	newMount, newRelative, err := t.writable("rename", newPath)
+	if err != nil {
+		return err
+	}
+	if oldMount.Path != newMount.Path {
+		return CrossMountMove
+	}
+	mover, ok := oldMount.Editor.(Mover)
+	if !ok {
+		return MoveUnsupported
+	}
+	return mover.Move(oldRelative, newRelative)
+}
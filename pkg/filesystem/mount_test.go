@@ -0,0 +1,99 @@
+package filesystem_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/peymanmortazavi/fs-server/pkg/filesystem"
+)
+
+func TestMountTable(t *testing.T) {
+	root := setupTestDir(t)
+	createBasicDirStructure(root)
+	scratch := filesystem.NewMemory()
+	archive := filesystem.NewMemory()
+	writeItem(t, archive, "old.txt", aContent)
+
+	table, err := filesystem.NewMountTable([]filesystem.Mount{
+		{Path: "/", Editor: filesystem.DirManager{Root: root}},
+		{Path: "/scratch", Editor: scratch},
+		{Path: "/sub/archive", Editor: archive, ReadOnly: true},
+	})
+	if err != nil {
+		t.Fatalf("failed to create mount table: %s", err)
+	}
+	if _, err := filesystem.NewMountTable([]filesystem.Mount{{Path: "a"}, {Path: "/a/"}}); err == nil {
+		t.Errorf("expected mounting a path twice to fail")
+	}
+
+	listing := createFileMap(mustGet(t, table, ""))
+	if len(listing) != 3 || !listing["scratch"].IsDir() || !listing["sub"].IsDir() {
+		t.Errorf("unexpected root listing: %+v", listing)
+	}
+	listing = createFileMap(mustGet(t, table, "sub"))
+	if len(listing) != 2 || !listing["archive"].IsDir() || listing["b.txt"].Size != int64(len(bContent)) {
+		t.Errorf("unexpected listing of sub: %+v", listing)
+	}
+	if item := mustGet(t, table, "sub/archive"); item.Name != "archive" || len(item.Children) != 1 {
+		t.Errorf("unexpected mount point: %+v", item)
+	}
+
+	if _, err := table.CreateFile("scratch/new.txt"); err != nil {
+		t.Fatalf("failed to create a file in a mount: %s", err)
+	}
+	if _, err := scratch.Get("new.txt"); err != nil {
+		t.Errorf("expected the file to be created in the mounted editor: %s", err)
+	}
+	if _, err := os.Stat(root + "/scratch"); !os.IsNotExist(err) {
+		t.Errorf("expected nothing to be created beneath the root mount")
+	}
+
+	if _, err := table.CreateFile("sub/archive/new.txt"); !filesystem.IsReadOnly(err) {
+		t.Errorf("expected creating in a read-only mount to fail but got %v", err)
+	}
+	old := mustGet(t, table, "sub/archive/old.txt")
+	if _, err := old.Open(os.O_WRONLY); !filesystem.IsReadOnly(err) {
+		t.Errorf("expected writing to a read-only mount to fail but got %v", err)
+	}
+	if content := readItem(t, old); content != aContent {
+		t.Errorf("expected to read a read-only mount but got %q", content)
+	}
+
+	for _, path := range []string{"scratch", "sub", "sub/archive"} {
+		if err := table.Delete(path); !os.IsPermission(err) {
+			t.Errorf("expected deleting %s holding a mount point to fail but got %v", path, err)
+		}
+	}
+	if _, err := table.CreateDir("scratch"); err != nil {
+		t.Errorf("expected creating a mount point to be a no-op but got %v", err)
+	}
+	if err := table.Move("scratch/new.txt", "moved.txt"); err != filesystem.CrossMountMove {
+		t.Errorf("expected moving between mounts to fail but got %v", err)
+	}
+	if err := table.Move("scratch/new.txt", "scratch/moved.txt"); err != nil {
+		t.Errorf("failed to move within a mount: %s", err)
+	}
+	if err := table.Delete("scratch/moved.txt"); err != nil {
+		t.Errorf("failed to delete in a mount: %s", err)
+	}
+
+	virtual, _ := filesystem.NewMountTable([]filesystem.Mount{{Path: "a/b", Editor: scratch}})
+	if item := mustGet(t, virtual, "a"); !item.IsDir() || len(item.Children) != 1 || item.Children[0].Name != "b" {
+		t.Errorf("unexpected directory leading to a mount point: %+v", item)
+	}
+	if _, err := virtual.Get("c"); !os.IsNotExist(err) {
+		t.Errorf("expected a path outside of mounts to not exist but got %v", err)
+	}
+	if _, err := virtual.CreateFile("a/c"); !os.IsNotExist(err) {
+		t.Errorf("expected creating outside of mounts to fail but got %v", err)
+	}
+}
+
+func mustGet(t *testing.T, viewer filesystem.Viewer, path string) filesystem.Item {
+	t.Helper()
+	item, err := viewer.Get(path)
+	if err != nil {
+		t.Fatalf("failed to get %s: %s", path, err)
+	}
+	return item
+}
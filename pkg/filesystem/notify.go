@@ -0,0 +1,107 @@
+package filesystem
+
+import (
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// Notifier wraps an Editor and publishes an event for every change made through it.
+//
+// It suits in-process backends where every change goes through the Editor, local
+// directories that are changed by other processes should use a DirWatcher instead.
+type Notifier struct {
+	Editor
+	EventHub
+}
+
+// NewNotifier creates a Notifier publishing the changes made through editor.
+func NewNotifier(editor Editor) *Notifier {
+	return &Notifier{Editor: editor}
+}
+
+// Get returns the item at path, publishing a modify event when it is written to.
+func (n *Notifier) Get(itemPath string) (Item, error) {
+	item, err := n.Editor.Get(itemPath)
+	if err != nil {
+		return item, err
+	}
+	itemPath = strings.Trim(itemPath, "/")
+	n.wrap(&item, itemPath)
+	for i := range item.Children {
+		n.wrap(&item.Children[i], path.Join(itemPath, item.Children[i].Name))
+	}
+	return item, nil
+}
+
+// CreateFile creates a file and publishes a create event.
+func (n *Notifier) CreateFile(itemPath string) (Item, error) {
+	item, err := n.Editor.CreateFile(itemPath)
+	if err != nil {
+		return item, err
+	}
+	itemPath = strings.Trim(itemPath, "/")
+	n.Publish(Created, itemPath, "")
+	n.wrap(&item, itemPath)
+	return item, nil
+}
+
+// CreateDir creates a directory and publishes a create event.
+func (n *Notifier) CreateDir(itemPath string) (Item, error) {
+	item, err := n.Editor.CreateDir(itemPath)
+	if err != nil {
+		return item, err
+	}
+	n.Publish(Created, strings.Trim(itemPath, "/"), "")
+	return item, nil
+}
+
+// Delete removes an item and publishes a delete event.
+func (n *Notifier) Delete(itemPath string) error {
+	if err := n.Editor.Delete(itemPath); err != nil {
+		return err
+	}
+	n.Publish(Deleted, strings.Trim(itemPath, "/"), "")
+	return nil
+}
+
+func (n *Notifier) wrap(item *Item, itemPath string) {
+	if item.Opener != nil {
+		item.Opener = notifyingOpener{Opener: item.Opener, notifier: n, path: itemPath}
+	}
+}
+
+type notifyingOpener struct {
+	Opener
+	notifier *Notifier
+	path     string
+}
+
+func (o notifyingOpener) Open(flag int) (io.ReadWriteCloser, error) {
+	file, err := o.Opener.Open(flag)
+	if err != nil || flag&(os.O_WRONLY|os.O_RDWR) == 0 {
+		return file, err
+	}
+	return &notifyingFile{ReadWriteCloser: file, opener: o, written: flag&os.O_TRUNC != 0}, nil
+}
+
+// notifyingFile publishes a modify event when it is closed after being written to.
+type notifyingFile struct {
+	io.ReadWriteCloser
+	opener  notifyingOpener
+	written bool
+}
+
+func (f *notifyingFile) Write(data []byte) (int, error) {
+	f.written = true
+	return f.ReadWriteCloser.Write(data)
+}
+
+func (f *notifyingFile) Close() error {
+	err := f.ReadWriteCloser.Close()
+	if f.written {
+		f.opener.notifier.Publish(Modified, f.opener.path, "")
+	}
+	return err
+}
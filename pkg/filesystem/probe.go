@@ -0,0 +1,77 @@
+package filesystem
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// ProbePrefix starts the names of the files beneath the root written by Probe,
+// every probe writes a file of its own so concurrent probes do not race.
+const ProbePrefix = ".fs-server-probe"
+
+var probeContent = []byte("fs-server probe")
+
+// IsProbe returns if the path is one of the files written by Probe.
+func IsProbe(itemPath string) bool {
+	itemPath = strings.Trim(itemPath, "/")
+	return strings.HasPrefix(itemPath, ProbePrefix) && !strings.Contains(itemPath, "/")
+}
+
+// WithoutProbes returns the item at the given path without the files written
+// by Probe among its children, those are only ever beneath the root.
+func WithoutProbes(itemPath string, item Item) Item {
+	if strings.Trim(itemPath, "/") != "" || item.Children == nil {
+		return item
+	}
+	children := item.Children[:0:0]
+	for _, child := range item.Children {
+		if !IsProbe(child.Name) {
+			children = append(children, child)
+		}
+	}
+	item.Children = children
+	return item
+}
+
+// Probe checks the editor can create, write, read back and delete a file,
+// using a file named after ProbePrefix beneath the root.
+func Probe(editor Editor) error {
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	name := ProbePrefix + "-" + hex.EncodeToString(suffix)
+	item, err := editor.CreateFile(name)
+	if err != nil {
+		return err
+	}
+	defer editor.Delete(name)
+	file, err := item.Open(os.O_WRONLY | os.O_TRUNC)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(probeContent); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if file, err = item.Open(os.O_RDONLY); err != nil {
+		return err
+	}
+	defer file.Close()
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(data, probeContent) {
+		return fmt.Errorf("read back %d bytes of the %d written", len(data), len(probeContent))
+	}
+	return editor.Delete(name)
+}
@@ -0,0 +1,47 @@
+package filesystem_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/peymanmortazavi/fs-server/pkg/filesystem"
+)
+
+func TestProbe(t *testing.T) {
+	root := setupTestDir(t)
+	manager := filesystem.DirManager{Root: root}
+
+	// concurrent probes write files of their own.
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- filesystem.Probe(manager)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("failed to probe: %s", err)
+		}
+	}
+	if item, _ := manager.Get(""); len(item.Children) != 0 {
+		t.Errorf("expected the probes to be removed but found %+v", item.Children)
+	}
+
+	// leftover probes are hidden from listings and watchers.
+	ioutil.WriteFile(filepath.Join(root, filesystem.ProbePrefix+"-1"), nil, 0664)
+	ioutil.WriteFile(filepath.Join(root, "a.txt"), nil, 0664)
+	item, _ := manager.Get("")
+	if children := filesystem.WithoutProbes("", item).Children; len(children) != 1 || children[0].Name != "a.txt" {
+		t.Errorf("unexpected children without probes: %+v", children)
+	}
+	if _, visible := filesystem.VisibleEvent(filesystem.Event{Type: filesystem.Created, Path: filesystem.ProbePrefix + "-1"}); visible {
+		t.Errorf("expected events of probes to be hidden")
+	}
+}
@@ -0,0 +1,88 @@
+package filesystem
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ReadOnlyError is returned for every change to a read-only file system.
+type ReadOnlyError struct {
+	Op   string
+	Path string
+}
+
+func (e *ReadOnlyError) Error() string {
+	if e.Path == "" {
+		return fmt.Sprintf("%s: read-only file system", e.Op)
+	}
+	return fmt.Sprintf("%s %s: read-only file system", e.Op, e.Path)
+}
+
+// IsReadOnly returns if the error is a change rejected by a read-only file system.
+func IsReadOnly(err error) bool {
+	var e *ReadOnlyError
+	return errors.As(err, &e)
+}
+
+// ReadOnly is an Editor serving the items of a Viewer, rejecting every change
+// including writes to the content of files with a *ReadOnlyError.
+type ReadOnly struct {
+	Viewer
+}
+
+// Get returns the item at the given path, its content cannot be written.
+func (r ReadOnly) Get(path string) (Item, error) {
+	item, err := r.Viewer.Get(path)
+	if err != nil {
+		return item, err
+	}
+	return readOnlyItem(item), nil
+}
+
+// CreateFile is rejected.
+func (r ReadOnly) CreateFile(path string) (Item, error) {
+	return Item{}, &ReadOnlyError{Op: "create", Path: path}
+}
+
+// CreateDir is rejected.
+func (r ReadOnly) CreateDir(path string) (Item, error) {
+	return Item{}, &ReadOnlyError{Op: "mkdir", Path: path}
+}
+
+// Delete is rejected.
+func (r ReadOnly) Delete(path string) error {
+	return &ReadOnlyError{Op: "remove", Path: path}
+}
+
+// Move is rejected.
+func (r ReadOnly) Move(oldPath, newPath string) error {
+	return &ReadOnlyError{Op: "rename", Path: oldPath}
+}
+
+// readOnlyItem returns the item with its content and children refusing writes.
+func readOnlyItem(item Item) Item {
+	if item.Opener != nil {
+		item.Opener = readOnlyOpener{item.Opener}
+	}
+	if len(item.Children) > 0 {
+		children := make([]Item, len(item.Children))
+		for i, child := range item.Children {
+			children[i] = readOnlyItem(child)
+		}
+		item.Children = children
+	}
+	return item
+}
+
+type readOnlyOpener struct {
+	Opener
+}
+
+func (o readOnlyOpener) Open(flag int) (io.ReadWriteCloser, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) != 0 {
+		return nil, &ReadOnlyError{Op: "open"}
+	}
+	return o.Opener.Open(flag)
+}
@@ -0,0 +1,49 @@
+package filesystem_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/peymanmortazavi/fs-server/pkg/filesystem"
+)
+
+func TestReadOnly(t *testing.T) {
+	root := setupTestDir(t)
+	createBasicDirStructure(root)
+	readOnly := filesystem.ReadOnly{Viewer: filesystem.DirManager{Root: root}}
+
+	if _, err := readOnly.CreateFile("c.txt"); !filesystem.IsReadOnly(err) {
+		t.Errorf("expected creating a file to fail but got %v", err)
+	}
+	if _, err := readOnly.CreateDir("new"); !filesystem.IsReadOnly(err) {
+		t.Errorf("expected creating a directory to fail but got %v", err)
+	}
+	if err := readOnly.Delete("a.txt"); !filesystem.IsReadOnly(err) {
+		t.Errorf("expected deleting to fail but got %v", err)
+	}
+	if err := readOnly.Move("a.txt", "c.txt"); !filesystem.IsReadOnly(err) {
+		t.Errorf("expected moving to fail but got %v", err)
+	}
+
+	item, err := readOnly.Get("a.txt")
+	if err != nil {
+		t.Fatalf("failed to get file: %s", err)
+	}
+	if content := readItem(t, item); content != aContent {
+		t.Errorf("expected to read %q but got %q", aContent, content)
+	}
+	for _, flag := range []int{os.O_WRONLY, os.O_RDWR, os.O_RDONLY | os.O_APPEND} {
+		if _, err := item.Open(flag); !filesystem.IsReadOnly(err) {
+			t.Errorf("expected opening with flag %d to fail but got %v", flag, err)
+		}
+	}
+	listing, _ := readOnly.Get("")
+	if sub := createFileMap(listing)["a.txt"]; sub.Opener == nil {
+		t.Fatalf("expected children to be readable")
+	} else if _, err := sub.Open(os.O_WRONLY | os.O_TRUNC); !filesystem.IsReadOnly(err) {
+		t.Errorf("expected writing to a child to fail but got %v", err)
+	}
+	if _, err := os.Stat(root + "/c.txt"); !os.IsNotExist(err) {
+		t.Errorf("expected nothing to be created")
+	}
+}
@@ -0,0 +1,170 @@
+package filesystem
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	defaultSearchConcurrency = 8
+	maxLineMatches           = 100
+	maxGrepLineSize          = 1 << 20
+)
+
+// Query describes what Search looks for, zero fields match everything.
+type Query struct {
+	// Name is a path.Match glob matched against item names.
+	Name string
+
+	// Pattern is matched against the path of items relative to the search root.
+	Pattern *regexp.Regexp
+
+	// Type limits results to "file" or "dir" items.
+	Type string
+
+	MinSize int64
+	// MaxSize is ignored when not positive.
+	MaxSize int64
+
+	ModifiedAfter  time.Time
+	ModifiedBefore time.Time
+
+	// Content limits results to regular files with a line matching it.
+	Content *regexp.Regexp
+
+	// Limit stops the search after this many results when positive.
+	Limit int
+}
+
+// LineMatch is a line of a file matching the content of a query.
+type LineMatch struct {
+	Number int
+	Text   string
+}
+
+// Match is an item found by a search.
+type Match struct {
+	// Path of the item relative to the root of the file system.
+	Path  string
+	Item  Item
+	Lines []LineMatch
+}
+
+// matchesMetadata checks everything but the content of an item.
+func (q Query) matchesMetadata(relative string, item Item) bool {
+	if q.Name != "" {
+		if ok, _ := path.Match(q.Name, item.Name); !ok {
+			return false
+		}
+	}
+	if q.Pattern != nil && !q.Pattern.MatchString(relative) {
+		return false
+	}
+	switch q.Type {
+	case "file":
+		if !item.FileMode.IsRegular() {
+			return false
+		}
+	case "dir":
+		if !item.FileMode.IsDir() {
+			return false
+		}
+	}
+	if item.Size < q.MinSize || (q.MaxSize > 0 && item.Size > q.MaxSize) {
+		return false
+	}
+	if !q.ModifiedAfter.IsZero() && !item.ModTime.After(q.ModifiedAfter) {
+		return false
+	}
+	if !q.ModifiedBefore.IsZero() && !item.ModTime.Before(q.ModifiedBefore) {
+		return false
+	}
+	return true
+}
+
+// grep returns the lines of a file matching the pattern, skipping binary files.
+func grep(item Item, pattern *regexp.Regexp) ([]LineMatch, error) {
+	if !item.FileMode.IsRegular() || item.Opener == nil {
+		return nil, nil
+	}
+	file, err := item.Open(os.O_RDONLY)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var matches []LineMatch
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64<<10), maxGrepLineSize)
+	for number := 1; scanner.Scan(); number++ {
+		line := scanner.Bytes()
+		if bytes.IndexByte(line, 0) >= 0 {
+			return nil, nil
+		}
+		if pattern.Match(line) {
+			matches = append(matches, LineMatch{Number: number, Text: string(line)})
+			if len(matches) == maxLineMatches {
+				break
+			}
+		}
+	}
+	// lines that are too long are not worth reporting, keep what was found.
+	return matches, nil
+}
+
+// collector gathers matches from concurrent workers, honouring the limit.
+type collector struct {
+	mu      sync.Mutex
+	query   Query
+	matches []Match
+	cancel  context.CancelFunc
+}
+
+func (c *collector) consider(relative string, item Item) {
+	if !c.query.matchesMetadata(relative, item) {
+		return
+	}
+	match := Match{Path: relative, Item: item}
+	if c.query.Content != nil {
+		lines, err := grep(item, c.query.Content)
+		if err != nil || len(lines) == 0 {
+			return
+		}
+		match.Lines = lines
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.query.Limit > 0 && len(c.matches) >= c.query.Limit {
+		return
+	}
+	c.matches = append(c.matches, match)
+	if c.query.Limit > 0 && len(c.matches) == c.query.Limit {
+		c.cancel()
+	}
+}
+
+func (c *collector) results() []Match {
+	sort.Slice(c.matches, func(i, j int) bool { return c.matches[i].Path < c.matches[j].Path })
+	return c.matches
+}
+
+// Search walks the tree beneath root and returns the items matching the query,
+// sorted by path. At most concurrency directories or files are read at once.
+func Search(ctx context.Context, viewer Viewer, root string, query Query, concurrency int) ([]Match, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	c := &collector{query: query, cancel: cancel}
+	err := Walk(ctx, viewer, root, concurrency, c.consider)
+	if query.Limit > 0 && len(c.matches) >= query.Limit {
+		// the walk was cut short once enough items were found.
+		return c.results(), nil
+	}
+	return c.results(), err
+}
@@ -0,0 +1,99 @@
+package filesystem_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/peymanmortazavi/fs-server/pkg/filesystem"
+)
+
+func matchPaths(matches []filesystem.Match) string {
+	paths := make([]string, 0, len(matches))
+	for _, match := range matches {
+		paths = append(paths, match.Path)
+	}
+	return strings.Join(paths, ",")
+}
+
+func TestSearch(t *testing.T) {
+	root := setupTestDir(t)
+	createBasicDirStructure(root)
+	os.MkdirAll(filepath.Join(root, "sub", "deep"), 0775)
+	ioutil.WriteFile(filepath.Join(root, "sub", "deep", "c.log"), []byte("first\nneedle here\nlast\n"), 0664)
+	manager := filesystem.DirManager{Root: root}
+
+	cases := []struct {
+		query    filesystem.Query
+		root     string
+		expected string
+	}{
+		{query: filesystem.Query{}, expected: "a.txt,sub,sub/b.txt,sub/deep,sub/deep/c.log"},
+		{query: filesystem.Query{Name: "*.txt"}, expected: "a.txt,sub/b.txt"},
+		{query: filesystem.Query{Name: "*.txt"}, root: "sub", expected: "sub/b.txt"},
+		{query: filesystem.Query{Pattern: regexp.MustCompile(`^sub/.*\.log$`)}, expected: "sub/deep/c.log"},
+		{query: filesystem.Query{Type: "dir"}, expected: "sub,sub/deep"},
+		{query: filesystem.Query{Type: "file", MinSize: 20}, expected: "sub/deep/c.log"},
+		{query: filesystem.Query{Type: "file", MaxSize: 16}, expected: "a.txt,sub/b.txt"},
+		{query: filesystem.Query{ModifiedAfter: time.Now().Add(time.Hour)}, expected: ""},
+		{query: filesystem.Query{Content: regexp.MustCompile("needle|content")}, expected: "a.txt,sub/b.txt,sub/deep/c.log"},
+	}
+	for _, testCase := range cases {
+		matches, err := filesystem.Search(context.Background(), manager, testCase.root, testCase.query, 2)
+		if err != nil {
+			t.Errorf("search failed: %s", err)
+		}
+		if got := matchPaths(matches); got != testCase.expected {
+			t.Errorf("unexpected results for %+v: expected %s, got %s", testCase.query, testCase.expected, got)
+		}
+	}
+
+	matches, _ := filesystem.Search(context.Background(), manager, "", filesystem.Query{Content: regexp.MustCompile("needle")}, 0)
+	if len(matches) != 1 || len(matches[0].Lines) != 1 || matches[0].Lines[0].Number != 2 {
+		t.Errorf("unexpected line matches: %+v", matches)
+	}
+
+	matches, _ = filesystem.Search(context.Background(), manager, "", filesystem.Query{Limit: 2}, 0)
+	if len(matches) != 2 {
+		t.Errorf("expected the limit to stop the search at 2 results but got %d", len(matches))
+	}
+}
+
+func TestIndex(t *testing.T) {
+	root := setupTestDir(t)
+	createBasicDirStructure(root)
+	notifier := filesystem.NewNotifier(filesystem.DirManager{Root: root})
+	index, err := filesystem.NewIndex(notifier, notifier)
+	if err != nil {
+		t.Fatalf("failed to build index: %s", err)
+	}
+	defer index.Close()
+
+	search := func(expected string) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			matches, _ := index.Search(context.Background(), "", filesystem.Query{Name: "*.txt"})
+			got := matchPaths(matches)
+			if got == expected {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("expected %s but the index has %s", expected, got)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	search("a.txt,sub/b.txt")
+	notifier.CreateDir("new")
+	notifier.CreateFile("new/c.txt")
+	search("a.txt,new/c.txt,sub/b.txt")
+	notifier.Delete("sub")
+	search("a.txt,new/c.txt")
+}
@@ -0,0 +1,81 @@
+package filesystem
+
+import (
+	"container/list"
+	"path"
+	"sync"
+	"time"
+)
+
+// defaultSizeCacheEntries is the number of sizes a sizeCache keeps.
+const defaultSizeCacheEntries = 10000
+
+type sizeEntry struct {
+	path    string
+	modTime time.Time
+	stored  int64
+	size    int64
+}
+
+// sizeCache remembers the sizes Compressed and Encrypted present for stored
+// files, so listing a directory does not open every file in it again.
+//
+// An entry is only reused while the modification time and the stored size of
+// the file match the ones it was read for, items without a modification time
+// are never cached. The zero value is ready to use.
+type sizeCache struct {
+	mu      sync.Mutex
+	entries map[string]*list.Element
+
+	// recent orders the entries from the most to the least recently used.
+	recent *list.List
+}
+
+// size returns the presented size of the file item at the path, calling read
+// when it is not cached. ok is false when read fails.
+func (c *sizeCache) size(itemPath string, item Item, read func() (int64, bool)) (int64, bool) {
+	itemPath = cleanMountPath(itemPath)
+	cacheable := !item.ModTime.IsZero()
+	if cacheable {
+		c.mu.Lock()
+		if element, ok := c.entries[itemPath]; ok {
+			entry := element.Value.(*sizeEntry)
+			if entry.stored == item.Size && entry.modTime.Equal(item.ModTime) {
+				c.recent.MoveToFront(element)
+				c.mu.Unlock()
+				return entry.size, true
+			}
+		}
+		c.mu.Unlock()
+	}
+
+	size, ok := read()
+	if !ok || !cacheable {
+		return size, ok
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[string]*list.Element)
+		c.recent = list.New()
+	}
+	entry := &sizeEntry{path: itemPath, modTime: item.ModTime, stored: item.Size, size: size}
+	if element, ok := c.entries[itemPath]; ok {
+		element.Value = entry
+		c.recent.MoveToFront(element)
+		return size, true
+	}
+	c.entries[itemPath] = c.recent.PushFront(entry)
+	for c.recent.Len() > defaultSizeCacheEntries {
+		oldest := c.recent.Back()
+		c.recent.Remove(oldest)
+		delete(c.entries, oldest.Value.(*sizeEntry).path)
+	}
+	return size, true
+}
+
+// childPath returns the path of a child of the directory at the path.
+func childPath(dir, name string) string {
+	return path.Join(dir, name)
+}
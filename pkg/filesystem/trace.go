@@ -0,0 +1,103 @@
+package filesystem
+
+import "io"
+
+// SpanFunc starts a span around an operation on the item at path, returning
+// the function ending it with the result of the operation.
+type SpanFunc func(operation, path string) func(error)
+
+// Traced is an Editor starting a span around every operation of the Editor it
+// decorates, operations are named like the ones of Instrumented.
+//
+// Spans usually belong to a request so a Traced is meant to be built for
+// every request.
+type Traced struct {
+	Editor
+	Start SpanFunc
+}
+
+// NewTraced returns a Traced starting spans with start.
+func NewTraced(editor Editor, start SpanFunc) *Traced {
+	return &Traced{Editor: editor, Start: start}
+}
+
+// Get returns the item at the given path, traced as "get".
+func (t *Traced) Get(path string) (Item, error) {
+	end := t.Start("get", path)
+	item, err := t.Editor.Get(path)
+	end(err)
+	if err == nil {
+		t.wrap(path, &item)
+	}
+	return item, err
+}
+
+// CreateFile creates a file, traced as "create_file".
+func (t *Traced) CreateFile(path string) (Item, error) {
+	end := t.Start("create_file", path)
+	item, err := t.Editor.CreateFile(path)
+	end(err)
+	if err == nil {
+		t.wrap(path, &item)
+	}
+	return item, err
+}
+
+// CreateDir creates a directory, traced as "create_dir".
+func (t *Traced) CreateDir(path string) (Item, error) {
+	end := t.Start("create_dir", path)
+	item, err := t.Editor.CreateDir(path)
+	end(err)
+	return item, err
+}
+
+// Delete removes an item, traced as "delete".
+func (t *Traced) Delete(path string) error {
+	end := t.Start("delete", path)
+	err := t.Editor.Delete(path)
+	end(err)
+	return err
+}
+
+// Move moves an item when the decorated Editor is a Mover, traced as "move"
+// on the old path.
+func (t *Traced) Move(oldPath, newPath string) error {
+	mover, ok := t.Editor.(Mover)
+	if !ok {
+		return MoveUnsupported
+	}
+	end := t.Start("move", oldPath)
+	err := mover.Move(oldPath, newPath)
+	end(err)
+	return err
+}
+
+func (t *Traced) wrap(path string, item *Item) {
+	if item.Opener != nil {
+		item.Opener = tracedOpener{item.Opener, t, path}
+	}
+	for index := range item.Children {
+		child := &item.Children[index]
+		if child.Opener == nil {
+			continue
+		}
+		childPath := child.Name
+		if path != "" {
+			childPath = path + "/" + child.Name
+		}
+		child.Opener = tracedOpener{child.Opener, t, childPath}
+	}
+}
+
+type tracedOpener struct {
+	Opener
+	traced *Traced
+	path   string
+}
+
+func (o tracedOpener) Open(flag int) (io.ReadWriteCloser, error) {
+	end := o.traced.Start("open", o.path)
+	file, err := o.Opener.Open(flag)
+	end(err)
+	return file, err
+}
@@ -0,0 +1,35 @@
+package filesystem_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/peymanmortazavi/fs-server/pkg/filesystem"
+)
+
+func TestTraced(t *testing.T) {
+	var spans []string
+	traced := filesystem.NewTraced(filesystem.NewMemory(), func(operation, path string) func(error) {
+		return func(err error) {
+			result := "ok"
+			if err != nil {
+				result = "error"
+			}
+			spans = append(spans, operation+":"+path+":"+result)
+		}
+	})
+
+	traced.CreateDir("sub")
+	writeItem(t, traced, "sub/a.txt", aContent)
+	listing, _ := traced.Get("sub")
+	readItem(t, createFileMap(listing)["a.txt"])
+	if err := traced.Move("sub/a.txt", "b.txt"); err != nil {
+		t.Fatalf("failed to move through the decorator: %s", err)
+	}
+	traced.Delete("missing")
+
+	expected := "create_dir:sub:ok get:sub/a.txt:error create_file:sub/a.txt:ok open:sub/a.txt:ok get:sub:ok open:sub/a.txt:ok move:sub/a.txt:ok delete:missing:error"
+	if got := strings.Join(spans, " "); got != expected {
+		t.Errorf("unexpected spans:\n%s\nexpected:\n%s", got, expected)
+	}
+}
@@ -0,0 +1,440 @@
+package filesystem
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TrashDir is the hidden directory beneath the root holding deleted items.
+const TrashDir = ".trash"
+
+// TrashEntry describes an item moved to the trash.
+type TrashEntry struct {
+	ID        string    `json:"id"`
+	Path      string    `json:"path"`
+	Dir       bool      `json:"dir,omitempty"`
+	DeletedBy string    `json:"deleted_by,omitempty"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+// Trash is an Editor moving deleted items to a hidden trash directory so they
+// can be restored until they are purged.
+//
+// The trash directory is hidden from every path handled by the Trash, so it
+// should be used in place of the Editor it decorates.
+type Trash struct {
+	Editor
+
+	// Retention is how long deleted items are kept by PurgeExpired, they are
+	// kept until purged explicitly when it is not positive.
+	Retention time.Duration
+
+	// Purging is called with every entry about to be purged, while its
+	// content can still be measured with Usage.
+	Purging func(TrashEntry)
+
+	mover Mover
+	mu    sync.Mutex
+}
+
+// NewTrash returns a Trash keeping deleted items of an Editor that is a Mover.
+func NewTrash(editor Editor) (*Trash, error) {
+	mover, ok := editor.(Mover)
+	if !ok {
+		return nil, MoveUnsupported
+	}
+	return &Trash{Editor: editor, mover: mover}, nil
+}
+
+// hidden returns if the path is beneath a directory reserved for the trash or
+// for versions.
+func hidden(itemPath string) bool {
+	itemPath = strings.Trim(itemPath, "/")
+	for _, dir := range []string{TrashDir, VersionsDir} {
+		if itemPath == dir || strings.HasPrefix(itemPath, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func hiddenError(op, itemPath string) error {
+	return &os.PathError{Op: op, Path: itemPath, Err: os.ErrNotExist}
+}
+
+// Get returns the item at the given path, the reserved directories do not exist.
+func (t *Trash) Get(itemPath string) (Item, error) {
+	if hidden(itemPath) {
+		return Item{}, hiddenError("get", itemPath)
+	}
+	item, err := t.Editor.Get(itemPath)
+	if err != nil || strings.Trim(itemPath, "/") != "" {
+		return item, err
+	}
+	children := item.Children[:0:0]
+	for _, child := range item.Children {
+		if !hidden(child.Name) {
+			children = append(children, child)
+		}
+	}
+	item.Children = children
+	return item, nil
+}
+
+// CreateFile creates a file outside of the reserved directories.
+func (t *Trash) CreateFile(itemPath string) (Item, error) {
+	if hidden(itemPath) {
+		return Item{}, &os.PathError{Op: "create", Path: itemPath, Err: os.ErrPermission}
+	}
+	return t.Editor.CreateFile(itemPath)
+}
+
+// CreateDir creates a directory outside of the reserved directories.
+func (t *Trash) CreateDir(itemPath string) (Item, error) {
+	if hidden(itemPath) {
+		return Item{}, &os.PathError{Op: "create", Path: itemPath, Err: os.ErrPermission}
+	}
+	return t.Editor.CreateDir(itemPath)
+}
+
+// Delete moves the item at the given path to the trash.
+func (t *Trash) Delete(itemPath string) error {
+	_, err := t.Recycle(itemPath, "")
+	return err
+}
+
+// Move moves an item outside of the reserved directories when the decorated
+// Editor is a Mover.
+func (t *Trash) Move(oldPath, newPath string) error {
+	mover, ok := t.Editor.(Mover)
+	if !ok {
+		return MoveUnsupported
+	}
+	if hidden(oldPath) || hidden(newPath) {
+		return hiddenError("move", oldPath)
+	}
+	return mover.Move(oldPath, newPath)
+}
+
+// Erase removes the item at the given path permanently, bypassing the trash.
+func (t *Trash) Erase(itemPath string) error {
+	if hidden(itemPath) {
+		return hiddenError("delete", itemPath)
+	}
+	return t.Editor.Delete(itemPath)
+}
+
+func newTrashID() (string, error) {
+	buffer := make([]byte, 16)
+	if _, err := rand.Read(buffer); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buffer), nil
+}
+
+func validTrashID(id string) bool {
+	if len(id) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
+
+func entryDir(id string) string {
+	return path.Join(TrashDir, id)
+}
+
+func entryMetaPath(id string) string {
+	return path.Join(TrashDir, id+".json")
+}
+
+// contentPaths returns where the moved items of an entry are stored, pairing
+// each with its original path. The children of the root are moved one by one
+// since the root itself cannot move.
+func (t *Trash) contentPaths(entry TrashEntry) ([][2]string, error) {
+	if entry.Path != "" {
+		return [][2]string{{path.Join(entryDir(entry.ID), path.Base(entry.Path)), entry.Path}}, nil
+	}
+	item, err := t.Editor.Get(entryDir(entry.ID))
+	if err != nil {
+		return nil, err
+	}
+	pairs := make([][2]string, 0, len(item.Children))
+	for _, child := range item.Children {
+		pairs = append(pairs, [2]string{path.Join(entryDir(entry.ID), child.Name), child.Name})
+	}
+	return pairs, nil
+}
+
+// Recycle moves the item at the given path to the trash, recording who deleted it.
+//
+// Deleting the root moves everything beneath it into a single entry.
+func (t *Trash) Recycle(itemPath, deleter string) (TrashEntry, error) {
+	itemPath = strings.Trim(itemPath, "/")
+	if hidden(itemPath) {
+		return TrashEntry{}, hiddenError("delete", itemPath)
+	}
+	item, err := t.Get(itemPath)
+	if err != nil {
+		return TrashEntry{}, err
+	}
+	id, err := newTrashID()
+	if err != nil {
+		return TrashEntry{}, err
+	}
+	entry := TrashEntry{ID: id, Path: itemPath, Dir: item.IsDir(), DeletedBy: deleter, DeletedAt: time.Now().UTC()}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, err := t.Editor.CreateDir(entryDir(id)); err != nil {
+		return TrashEntry{}, err
+	}
+	// the metadata is written first so an interrupted move can still be restored.
+	if err := t.writeEntry(entry); err != nil {
+		t.Editor.Delete(entryDir(id))
+		return TrashEntry{}, err
+	}
+	if itemPath != "" {
+		if err := t.mover.Move(itemPath, path.Join(entryDir(id), path.Base(itemPath))); err != nil {
+			t.discard(id)
+			return TrashEntry{}, err
+		}
+		return entry, nil
+	}
+	for index, child := range item.Children {
+		if err := t.mover.Move(child.Name, path.Join(entryDir(id), child.Name)); err != nil {
+			// the children already moved are put back, the entry is kept to
+			// restore them from when one of them cannot be.
+			for _, moved := range item.Children[:index] {
+				if moveErr := t.mover.Move(path.Join(entryDir(id), moved.Name), moved.Name); moveErr != nil {
+					log.Printf("failed to put %s back after failing to delete the root, restore trash entry %s: %s", moved.Name, id, moveErr)
+					return TrashEntry{}, err
+				}
+			}
+			t.discard(id)
+			return TrashEntry{}, err
+		}
+	}
+	return entry, nil
+}
+
+// discard removes an entry whose content could not be moved to the trash, the
+// caller must hold the lock.
+func (t *Trash) discard(id string) {
+	if err := t.remove(id); err != nil {
+		log.Printf("failed to remove trash entry %s: %s", id, err)
+	}
+}
+
+func (t *Trash) writeEntry(entry TrashEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	item, err := t.Editor.CreateFile(entryMetaPath(entry.ID))
+	if err != nil {
+		return err
+	}
+	file, err := item.Open(os.O_WRONLY | os.O_TRUNC)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func (t *Trash) readEntry(id string) (TrashEntry, error) {
+	if !validTrashID(id) {
+		return TrashEntry{}, hiddenError("get", id)
+	}
+	item, err := t.Editor.Get(entryMetaPath(id))
+	if err != nil {
+		return TrashEntry{}, err
+	}
+	file, err := item.Open(os.O_RDONLY)
+	if err != nil {
+		return TrashEntry{}, err
+	}
+	defer file.Close()
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		return TrashEntry{}, err
+	}
+	var entry TrashEntry
+	err = json.Unmarshal(data, &entry)
+	return entry, err
+}
+
+// Entries returns every entry in the trash, oldest first.
+func (t *Trash) Entries() ([]TrashEntry, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.entries()
+}
+
+func (t *Trash) entries() ([]TrashEntry, error) {
+	item, err := t.Editor.Get(TrashDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	entries := make([]TrashEntry, 0, len(item.Children)/2)
+	for _, child := range item.Children {
+		id := strings.TrimSuffix(child.Name, ".json")
+		if id == child.Name || !validTrashID(id) {
+			continue
+		}
+		entry, err := t.readEntry(id)
+		if err != nil {
+			log.Printf("skipping unreadable trash entry %s: %s", id, err)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].DeletedAt.Before(entries[j].DeletedAt) })
+	return entries, nil
+}
+
+// Restore moves the items of a trash entry back to their original path,
+// creating missing parent directories. Nothing is restored when an item exists
+// at the original path.
+func (t *Trash) Restore(id string) (TrashEntry, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	entry, err := t.readEntry(id)
+	if err != nil {
+		return entry, err
+	}
+	pairs, err := t.contentPaths(entry)
+	if err != nil {
+		return entry, err
+	}
+	for _, pair := range pairs {
+		if _, err := t.Editor.Get(pair[1]); err == nil {
+			return entry, FileAlreadyExists
+		}
+	}
+	if parent := path.Dir(entry.Path); entry.Path != "" && parent != "." {
+		if _, err := t.Editor.CreateDir(parent); err != nil {
+			return entry, err
+		}
+	}
+	for _, pair := range pairs {
+		if err := t.mover.Move(pair[0], pair[1]); err != nil {
+			return entry, err
+		}
+	}
+	return entry, t.remove(id)
+}
+
+// remove deletes a trash entry along with its content, the caller must hold the lock.
+func (t *Trash) remove(id string) error {
+	if err := t.Editor.Delete(entryDir(id)); err != nil {
+		return err
+	}
+	return t.Editor.Delete(entryMetaPath(id))
+}
+
+// Usage measures what the items of an entry that were at itemPath, or beneath
+// it, use. The whole entry is measured when itemPath contains its path.
+func (t *Trash) Usage(entry TrashEntry, itemPath string) (DiskUsage, error) {
+	itemPath = strings.Trim(itemPath, "/")
+	var stored string
+	switch {
+	case itemPath == "" || itemPath == entry.Path || strings.HasPrefix(entry.Path, itemPath+"/"):
+		usage, _, err := Measure(context.Background(), t.Editor, entryDir(entry.ID), 0)
+		if err != nil {
+			return DiskUsage{}, err
+		}
+		// the directory of the entry itself was not deleted.
+		usage.Dirs--
+		return usage, nil
+	case entry.Path == "":
+		stored = path.Join(entryDir(entry.ID), itemPath)
+	case strings.HasPrefix(itemPath, entry.Path+"/"):
+		stored = path.Join(entryDir(entry.ID), path.Base(entry.Path), itemPath[len(entry.Path):])
+	default:
+		return DiskUsage{}, nil
+	}
+	usage, _, err := Measure(context.Background(), t.Editor, stored, 0)
+	if os.IsNotExist(err) {
+		return DiskUsage{}, nil
+	}
+	return usage, err
+}
+
+// purge removes a trash entry after reporting it to Purging, the caller must
+// hold the lock.
+func (t *Trash) purge(entry TrashEntry) error {
+	if t.Purging != nil {
+		t.Purging(entry)
+	}
+	return t.remove(entry.ID)
+}
+
+// Purge permanently removes a trash entry.
+func (t *Trash) Purge(id string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	entry, err := t.readEntry(id)
+	if err != nil {
+		return err
+	}
+	return t.purge(entry)
+}
+
+// PurgeExpired permanently removes the entries deleted longer than the
+// retention ago, returning how many were removed.
+func (t *Trash) PurgeExpired(now time.Time) (int, error) {
+	if t.Retention <= 0 {
+		return 0, nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	entries, err := t.entries()
+	if err != nil {
+		return 0, err
+	}
+	purged := 0
+	for _, entry := range entries {
+		if now.Sub(entry.DeletedAt) < t.Retention {
+			break
+		}
+		if err := t.purge(entry); err != nil {
+			return purged, err
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// PurgeEvery runs PurgeExpired periodically until the context is done.
+func (t *Trash) PurgeEvery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if _, err := t.PurgeExpired(now); err != nil {
+				log.Printf("failed to purge expired trash entries: %s", err)
+			}
+		}
+	}
+}
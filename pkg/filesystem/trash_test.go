@@ -0,0 +1,183 @@
+package filesystem_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/peymanmortazavi/fs-server/pkg/filesystem"
+)
+
+func TestTrash(t *testing.T) {
+	root := setupTestDir(t)
+	createBasicDirStructure(root)
+	trash, err := filesystem.NewTrash(filesystem.DirManager{Root: root})
+	if err != nil {
+		t.Fatalf("failed to create trash: %s", err)
+	}
+
+	entry, err := trash.Recycle("sub/b.txt", "alice")
+	if err != nil {
+		t.Fatalf("failed to delete file: %s", err)
+	}
+	if entry.Path != "sub/b.txt" || entry.DeletedBy != "alice" || entry.Dir {
+		t.Errorf("unexpected trash entry: %+v", entry)
+	}
+	if _, err := os.Stat(filepath.Join(root, "sub", "b.txt")); !os.IsNotExist(err) {
+		t.Errorf("expected the file to be moved away but got %v", err)
+	}
+	item, _ := trash.Get("")
+	for _, child := range item.Children {
+		if child.Name == filesystem.TrashDir {
+			t.Errorf("expected the trash directory to be hidden from listings")
+		}
+	}
+	if _, err := trash.Get(filesystem.TrashDir); !os.IsNotExist(err) {
+		t.Errorf("expected the trash directory to be hidden but got %v", err)
+	}
+	if _, err := trash.CreateFile(filesystem.TrashDir + "/x"); !os.IsPermission(err) {
+		t.Errorf("expected creating in the trash directory to be denied but got %v", err)
+	}
+	if err := trash.Move("a.txt", filesystem.TrashDir+"/a.txt"); !os.IsNotExist(err) {
+		t.Errorf("expected moving into the trash directory to fail but got %v", err)
+	}
+	if err := trash.Move("a.txt", "moved.txt"); err != nil {
+		t.Errorf("failed to move a.txt: %s", err)
+	}
+	trash.Move("moved.txt", "a.txt")
+
+	entries, err := trash.Entries()
+	if err != nil || len(entries) != 1 || entries[0].ID != entry.ID {
+		t.Fatalf("unexpected trash entries: %+v %v", entries, err)
+	}
+
+	// restoring recreates missing parents.
+	os.RemoveAll(filepath.Join(root, "sub"))
+	if _, err := trash.Restore(entry.ID); err != nil {
+		t.Fatalf("failed to restore entry: %s", err)
+	}
+	if data, _ := ioutil.ReadFile(filepath.Join(root, "sub", "b.txt")); string(data) != bContent {
+		t.Errorf("unexpected restored content: %q", data)
+	}
+	if entries, _ := trash.Entries(); len(entries) != 0 {
+		t.Errorf("expected the trash to be empty after restoring but got %+v", entries)
+	}
+
+	// deleting the root keeps everything in a single entry.
+	entry, err = trash.Recycle("/", "")
+	if err != nil {
+		t.Fatalf("failed to delete root: %s", err)
+	}
+	if item, _ := trash.Get(""); len(item.Children) != 0 {
+		t.Errorf("expected the root to be empty but got %+v", item.Children)
+	}
+	ioutil.WriteFile(filepath.Join(root, "a.txt"), []byte("new"), 0664)
+	if _, err := trash.Restore(entry.ID); !filesystem.IsFileAlreadyExists(err) {
+		t.Errorf("expected restoring over an existing item to fail but got %v", err)
+	}
+	os.Remove(filepath.Join(root, "a.txt"))
+	if _, err := trash.Restore(entry.ID); err != nil {
+		t.Fatalf("failed to restore root: %s", err)
+	}
+	if data, _ := ioutil.ReadFile(filepath.Join(root, "a.txt")); string(data) != aContent {
+		t.Errorf("unexpected restored content: %q", data)
+	}
+
+	entry, _ = trash.Recycle("a.txt", "")
+	if usage, err := trash.Usage(entry, ""); err != nil || usage != (filesystem.DiskUsage{Bytes: int64(len(aContent)), Files: 1}) {
+		t.Errorf("unexpected usage of the entry: %+v %v", usage, err)
+	}
+	var purging []filesystem.TrashEntry
+	trash.Purging = func(entry filesystem.TrashEntry) { purging = append(purging, entry) }
+	if err := trash.Purge(entry.ID); err != nil {
+		t.Errorf("failed to purge entry: %s", err)
+	}
+	if len(purging) != 1 || purging[0].ID != entry.ID {
+		t.Errorf("expected the purged entry to be reported but got %+v", purging)
+	}
+	if _, err := trash.Restore(entry.ID); !os.IsNotExist(err) {
+		t.Errorf("expected a purged entry to be gone but got %v", err)
+	}
+
+	trash.Retention = time.Hour
+	trash.Recycle("sub", "")
+	if purged, _ := trash.PurgeExpired(time.Now()); purged != 0 {
+		t.Errorf("expected recent entries to be kept but %d were purged", purged)
+	}
+	if purged, _ := trash.PurgeExpired(time.Now().Add(2 * time.Hour)); purged != 1 {
+		t.Errorf("expected expired entries to be purged but %d were purged", purged)
+	}
+	if item, _ := (filesystem.DirManager{Root: root}).Get(filesystem.TrashDir); len(item.Children) != 0 {
+		t.Errorf("expected the trash directory to be empty but got %+v", item.Children)
+	}
+}
+
+// failingMover fails to move the item at one path.
+type failingMover struct {
+	filesystem.DirManager
+	fail string
+}
+
+func (m failingMover) Move(oldPath, newPath string) error {
+	if oldPath == m.fail {
+		return os.ErrPermission
+	}
+	return m.DirManager.Move(oldPath, newPath)
+}
+
+func TestTrashFailedMove(t *testing.T) {
+	root := setupTestDir(t)
+	createBasicDirStructure(root)
+	trash, err := filesystem.NewTrash(failingMover{DirManager: filesystem.DirManager{Root: root}, fail: "sub"})
+	if err != nil {
+		t.Fatalf("failed to create trash: %s", err)
+	}
+	for _, itemPath := range []string{"sub", ""} {
+		if _, err := trash.Recycle(itemPath, ""); !os.IsPermission(err) {
+			t.Errorf("expected deleting %q to fail but got %v", itemPath, err)
+		}
+	}
+	if entries, err := trash.Entries(); err != nil || len(entries) != 0 {
+		t.Errorf("expected no entry to be left behind but got %+v %v", entries, err)
+	}
+	if item, _ := (filesystem.DirManager{Root: root}).Get(filesystem.TrashDir); len(item.Children) != 0 {
+		t.Errorf("expected the trash directory to be empty but got %+v", item.Children)
+	}
+	if data, _ := ioutil.ReadFile(filepath.Join(root, "a.txt")); string(data) != aContent {
+		t.Errorf("expected the children moved before the failure to be put back but got %q", data)
+	}
+}
+
+func TestVisibleEvent(t *testing.T) {
+	cases := []struct {
+		event    filesystem.Event
+		expected filesystem.Event
+		visible  bool
+	}{
+		{
+			event:    filesystem.Event{Type: filesystem.Renamed, Path: ".trash/x/a.txt", OldPath: "a.txt"},
+			expected: filesystem.Event{Type: filesystem.Deleted, Path: "a.txt"},
+			visible:  true,
+		},
+		{
+			event:    filesystem.Event{Type: filesystem.Renamed, Path: "a.txt", OldPath: ".trash/x/a.txt"},
+			expected: filesystem.Event{Type: filesystem.Created, Path: "a.txt"},
+			visible:  true,
+		},
+		{event: filesystem.Event{Type: filesystem.Created, Path: ".trash/x.json"}},
+		{event: filesystem.Event{Type: filesystem.Modified, Path: ".versions/a.txt/1"}},
+		{
+			event:    filesystem.Event{Type: filesystem.Modified, Path: "a.txt"},
+			expected: filesystem.Event{Type: filesystem.Modified, Path: "a.txt"},
+			visible:  true,
+		},
+	}
+	for _, testCase := range cases {
+		event, visible := filesystem.VisibleEvent(testCase.event)
+		if visible != testCase.visible || (visible && event != testCase.expected) {
+			t.Errorf("unexpected visibility of %+v: got %+v %v", testCase.event, event, visible)
+		}
+	}
+}
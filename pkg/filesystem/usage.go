@@ -0,0 +1,165 @@
+package filesystem
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DiskUsage is the storage used by an item and everything beneath it.
+//
+// Bytes only counts the content of regular files, the size reported for
+// directories depends on the file system and is ignored.
+type DiskUsage struct {
+	Bytes int64
+	Files int64
+	Dirs  int64
+}
+
+func (u DiskUsage) add(other DiskUsage) DiskUsage {
+	return DiskUsage{Bytes: u.Bytes + other.Bytes, Files: u.Files + other.Files, Dirs: u.Dirs + other.Dirs}
+}
+
+func usageOf(item Item) DiskUsage {
+	switch {
+	case item.FileMode.IsDir():
+		return DiskUsage{Dirs: 1}
+	case item.FileMode.IsRegular():
+		return DiskUsage{Bytes: item.Size, Files: 1}
+	}
+	return DiskUsage{Files: 1}
+}
+
+// Measure returns the usage of the item at root, along with the usage of each
+// of its children keyed by name when it is a directory.
+//
+// The tree is walked reading at most concurrency directories at once.
+func Measure(ctx context.Context, viewer Viewer, root string, concurrency int) (DiskUsage, map[string]DiskUsage, error) {
+	root = strings.Trim(root, "/")
+	item, err := viewer.Get(root)
+	if err != nil {
+		return DiskUsage{}, nil, err
+	}
+	total := usageOf(item)
+	if !item.FileMode.IsDir() {
+		return total, nil, nil
+	}
+
+	var mu sync.Mutex
+	children := make(map[string]DiskUsage, len(item.Children))
+	err = Walk(ctx, viewer, root, concurrency, func(relative string, item Item) {
+		name := relative
+		if root != "" {
+			name = relative[len(root)+1:]
+		}
+		if i := strings.IndexByte(name, '/'); i >= 0 {
+			name = name[:i]
+		}
+		usage := usageOf(item)
+		mu.Lock()
+		children[name] = children[name].add(usage)
+		mu.Unlock()
+	})
+	if err != nil {
+		return DiskUsage{}, nil, err
+	}
+	for _, usage := range children {
+		total = total.add(usage)
+	}
+	return total, children, nil
+}
+
+type usageEntry struct {
+	total    DiskUsage
+	children map[string]DiskUsage
+	measured time.Time
+}
+
+// UsageCache remembers measured disk usage until the measured tree changes.
+//
+// Changes are reported with Invalidate, or followed from a Watcher. Entries
+// older than MaxAge are measured again when it is positive, which bounds how
+// stale the usage gets when changes are not reported. The zero value is ready
+// to use.
+type UsageCache struct {
+	MaxAge time.Duration
+
+	// Concurrency is the number of directories read at once while measuring.
+	Concurrency int
+
+	mu         sync.Mutex
+	entries    map[string]usageEntry
+	generation uint64
+}
+
+// Usage returns the usage of the item at root along with the usage of its
+// children, measuring it when it is not cached.
+func (c *UsageCache) Usage(ctx context.Context, viewer Viewer, root string) (DiskUsage, map[string]DiskUsage, error) {
+	root = strings.Trim(root, "/")
+	c.mu.Lock()
+	entry, ok := c.entries[root]
+	generation := c.generation
+	c.mu.Unlock()
+	if ok && (c.MaxAge <= 0 || time.Since(entry.measured) < c.MaxAge) {
+		return entry.total, entry.children, nil
+	}
+
+	total, children, err := Measure(ctx, viewer, root, c.Concurrency)
+	if err != nil {
+		return total, children, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// a change reported while measuring may not be reflected, so it is not cached.
+	if c.generation == generation {
+		if c.entries == nil {
+			c.entries = make(map[string]usageEntry)
+		}
+		c.entries[root] = usageEntry{total: total, children: children, measured: time.Now()}
+	}
+	return total, children, nil
+}
+
+// Invalidate forgets the usage of every tree containing the given path.
+func (c *UsageCache) Invalidate(itemPath string) {
+	itemPath = strings.Trim(itemPath, "/")
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	for p := range c.entries {
+		if p == "" || p == itemPath || strings.HasPrefix(itemPath, p+"/") || strings.HasPrefix(p, itemPath+"/") {
+			delete(c.entries, p)
+		}
+	}
+}
+
+func (c *UsageCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	c.entries = nil
+}
+
+// Follow invalidates the cache with every change reported by watcher until the
+// returned subscription is closed.
+func (c *UsageCache) Follow(watcher Watcher) (*Subscription, error) {
+	subscription, err := watcher.Watch("", true, 0)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		for event := range subscription.Events() {
+			c.Invalidate(event.Path)
+			if event.Type == Renamed {
+				c.Invalidate(event.OldPath)
+			}
+		}
+		if subscription.Overflowed() {
+			c.clear()
+			log.Printf("disk usage cache fell behind the changes, usage may be stale")
+		}
+	}()
+	return subscription, nil
+}
@@ -0,0 +1,89 @@
+package filesystem_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/peymanmortazavi/fs-server/pkg/filesystem"
+)
+
+func TestMeasure(t *testing.T) {
+	root := setupTestDir(t)
+	createBasicDirStructure(root)
+	os.MkdirAll(filepath.Join(root, "sub", "deep"), 0775)
+	ioutil.WriteFile(filepath.Join(root, "sub", "deep", "c.log"), []byte("0123456789"), 0664)
+	manager := filesystem.DirManager{Root: root}
+
+	total, children, err := filesystem.Measure(context.Background(), manager, "", 2)
+	if err != nil {
+		t.Fatalf("failed to measure usage: %s", err)
+	}
+	bytes := int64(len(aContent) + len(bContent) + 10)
+	if expected := (filesystem.DiskUsage{Bytes: bytes, Files: 3, Dirs: 3}); total != expected {
+		t.Errorf("expected total usage %+v but got %+v", expected, total)
+	}
+	if expected := (filesystem.DiskUsage{Bytes: int64(len(bContent) + 10), Files: 2, Dirs: 2}); children["sub"] != expected {
+		t.Errorf("expected usage of sub %+v but got %+v", expected, children["sub"])
+	}
+	if expected := (filesystem.DiskUsage{Bytes: int64(len(aContent)), Files: 1}); children["a.txt"] != expected {
+		t.Errorf("expected usage of a.txt %+v but got %+v", expected, children["a.txt"])
+	}
+
+	total, children, err = filesystem.Measure(context.Background(), manager, "sub/b.txt", 2)
+	if err != nil || total.Bytes != int64(len(bContent)) || children != nil {
+		t.Errorf("unexpected usage of a file: %+v %+v %v", total, children, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, err := filesystem.Measure(ctx, manager, "", 2); err != context.Canceled {
+		t.Errorf("expected a canceled measurement to fail but got %v", err)
+	}
+}
+
+func TestUsageCache(t *testing.T) {
+	root := setupTestDir(t)
+	createBasicDirStructure(root)
+	manager := filesystem.DirManager{Root: root}
+	var cache filesystem.UsageCache
+
+	before, _, err := cache.Usage(context.Background(), manager, "sub")
+	if err != nil {
+		t.Fatalf("failed to measure usage: %s", err)
+	}
+	ioutil.WriteFile(filepath.Join(root, "sub", "c.txt"), []byte("more"), 0664)
+	if cached, _, _ := cache.Usage(context.Background(), manager, "sub"); cached != before {
+		t.Errorf("expected the cached usage %+v but got %+v", before, cached)
+	}
+
+	cache.Invalidate("sub/c.txt")
+	after, _, _ := cache.Usage(context.Background(), manager, "sub")
+	if after.Bytes != before.Bytes+4 || after.Files != before.Files+1 {
+		t.Errorf("expected the usage to be measured again, got %+v after %+v", after, before)
+	}
+
+	notifier := filesystem.NewNotifier(manager)
+	subscription, err := cache.Follow(notifier)
+	if err != nil {
+		t.Fatalf("failed to follow changes: %s", err)
+	}
+	defer subscription.Close()
+	cache.Usage(context.Background(), manager, "")
+	if err := notifier.Delete("sub/c.txt"); err != nil {
+		t.Fatalf("failed to delete file: %s", err)
+	}
+	for i := 0; ; i++ {
+		usage, _, _ := cache.Usage(context.Background(), manager, "")
+		if usage.Bytes == int64(len(aContent)+len(bContent)) {
+			break
+		}
+		if i == 100 {
+			t.Fatalf("expected the deletion to invalidate the cache, got %+v", usage)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
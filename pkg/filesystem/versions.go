@@ -0,0 +1,476 @@
+package filesystem
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// VersionsDir is the hidden directory beneath the root holding previous
+// content of files.
+const VersionsDir = ".versions"
+
+// Version describes previous content of a file.
+type Version struct {
+	Number int
+	Size   int64
+	Time   time.Time
+}
+
+// Versioned is an Editor keeping the previous content of files every time they
+// are overwritten or deleted, so they can be read or restored later.
+//
+// Versions are stored through the decorated Editor beneath VersionsDir, which
+// is hidden from every path handled by Versioned, so it works over any backend.
+// Empty files are not kept.
+type Versioned struct {
+	Editor
+
+	// MaxVersions is the number of versions kept for every file when positive.
+	MaxVersions int
+
+	// MaxAge is how long versions are kept by Prune when positive.
+	MaxAge time.Duration
+
+	// Kept and Removed are called with the path of a file and every version
+	// of it kept or removed, so the storage versions use can be accounted for.
+	Kept    func(itemPath string, version Version)
+	Removed func(itemPath string, version Version)
+
+	mu sync.Mutex
+}
+
+// NewVersioned returns a Versioned keeping the previous content of the files of editor.
+func NewVersioned(editor Editor) *Versioned {
+	return &Versioned{Editor: editor}
+}
+
+func hiddenVersion(itemPath string) bool {
+	itemPath = strings.Trim(itemPath, "/")
+	return itemPath == VersionsDir || strings.HasPrefix(itemPath, VersionsDir+"/")
+}
+
+// versionsPath returns the directory holding the versions of a file, paths are
+// escaped so the versions of every file live side by side.
+func versionsPath(itemPath string) string {
+	return path.Join(VersionsDir, url.PathEscape(strings.Trim(itemPath, "/")))
+}
+
+func versionPath(itemPath string, number int) string {
+	return path.Join(versionsPath(itemPath), strconv.Itoa(number))
+}
+
+// Get returns the item at the given path, keeping a version before it is overwritten.
+func (v *Versioned) Get(itemPath string) (Item, error) {
+	if hiddenVersion(itemPath) {
+		return Item{}, hiddenError("get", itemPath)
+	}
+	item, err := v.Editor.Get(itemPath)
+	if err != nil {
+		return item, err
+	}
+	itemPath = strings.Trim(itemPath, "/")
+	v.wrap(&item, itemPath)
+	children := item.Children[:0:0]
+	for _, child := range item.Children {
+		if itemPath == "" && child.Name == VersionsDir {
+			continue
+		}
+		v.wrap(&child, path.Join(itemPath, child.Name))
+		children = append(children, child)
+	}
+	if item.Children != nil {
+		item.Children = children
+	}
+	return item, nil
+}
+
+// CreateFile creates a file outside of the versions directory.
+func (v *Versioned) CreateFile(itemPath string) (Item, error) {
+	if hiddenVersion(itemPath) {
+		return Item{}, &os.PathError{Op: "create", Path: itemPath, Err: os.ErrPermission}
+	}
+	item, err := v.Editor.CreateFile(itemPath)
+	if err != nil {
+		return item, err
+	}
+	v.wrap(&item, strings.Trim(itemPath, "/"))
+	return item, nil
+}
+
+// CreateDir creates a directory outside of the versions directory.
+func (v *Versioned) CreateDir(itemPath string) (Item, error) {
+	if hiddenVersion(itemPath) {
+		return Item{}, &os.PathError{Op: "create", Path: itemPath, Err: os.ErrPermission}
+	}
+	return v.Editor.CreateDir(itemPath)
+}
+
+// Delete keeps a version of every file beneath the given path and removes it.
+func (v *Versioned) Delete(itemPath string) error {
+	if hiddenVersion(itemPath) {
+		return hiddenError("delete", itemPath)
+	}
+	itemPath = strings.Trim(itemPath, "/")
+	item, err := v.Editor.Get(itemPath)
+	if err != nil {
+		return err
+	}
+	if itemPath == "" {
+		// the root is emptied one child at a time so the versions are not lost.
+		for _, child := range item.Children {
+			if child.Name == VersionsDir {
+				continue
+			}
+			if err := v.Delete(child.Name); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if item.FileMode.IsRegular() {
+		err = v.snapshot(itemPath, item)
+	} else if item.IsDir() {
+		var mu sync.Mutex
+		walkErr := Walk(context.Background(), v.Editor, itemPath, 0, func(relative string, child Item) {
+			if child.FileMode.IsRegular() && child.Opener != nil {
+				mu.Lock()
+				defer mu.Unlock()
+				if snapshotErr := v.snapshot(relative, child); snapshotErr != nil && err == nil {
+					err = snapshotErr
+				}
+			}
+		})
+		if err == nil {
+			err = walkErr
+		}
+	}
+	if err != nil {
+		// deleting without keeping the content would lose it for good.
+		return err
+	}
+	return v.Editor.Delete(itemPath)
+}
+
+// Move moves an item when the decorated Editor is a Mover, versions stay with
+// the original path.
+func (v *Versioned) Move(oldPath, newPath string) error {
+	mover, ok := v.Editor.(Mover)
+	if !ok {
+		return MoveUnsupported
+	}
+	if hiddenVersion(oldPath) || hiddenVersion(newPath) {
+		return hiddenError("move", oldPath)
+	}
+	return mover.Move(oldPath, newPath)
+}
+
+func (v *Versioned) wrap(item *Item, itemPath string) {
+	if item.Opener != nil && !hidden(itemPath) {
+		item.Opener = versionedOpener{Opener: item.Opener, versioned: v, path: itemPath}
+	}
+}
+
+// snapshot keeps the current content of a file as a new version.
+func (v *Versioned) snapshot(itemPath string, item Item) error {
+	if item.Size == 0 || item.Opener == nil || hidden(itemPath) {
+		return nil
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	versions, err := v.versions(itemPath)
+	if err != nil {
+		return err
+	}
+	number := 1
+	if len(versions) > 0 {
+		number = versions[len(versions)-1].Number + 1
+	}
+	if _, err := v.Editor.CreateDir(versionsPath(itemPath)); err != nil {
+		return err
+	}
+	if err := v.copy(item, versionPath(itemPath, number)); err != nil {
+		v.Editor.Delete(versionPath(itemPath, number))
+		return err
+	}
+	if v.Kept != nil {
+		v.Kept(itemPath, Version{Number: number, Size: item.Size, Time: time.Now()})
+	}
+	if v.MaxVersions > 0 && len(versions)+1 > v.MaxVersions {
+		for _, version := range versions[:len(versions)+1-v.MaxVersions] {
+			if err := v.remove(itemPath, version); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// remove deletes a version, the caller must hold the lock.
+func (v *Versioned) remove(itemPath string, version Version) error {
+	if err := v.Editor.Delete(versionPath(itemPath, version.Number)); err != nil {
+		return err
+	}
+	if v.Removed != nil {
+		v.Removed(itemPath, version)
+	}
+	return nil
+}
+
+// copy writes the content of item to a new file at the given path.
+func (v *Versioned) copy(item Item, target string) error {
+	source, err := item.Open(os.O_RDONLY)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	created, err := v.Editor.CreateFile(target)
+	if err != nil {
+		return err
+	}
+	destination, err := created.Open(os.O_WRONLY | os.O_TRUNC)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(destination, source); err != nil {
+		destination.Close()
+		return err
+	}
+	return destination.Close()
+}
+
+// Versions returns the versions of the file at the given path, oldest first.
+func (v *Versioned) Versions(itemPath string) ([]Version, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.versions(itemPath)
+}
+
+func (v *Versioned) versions(itemPath string) ([]Version, error) {
+	item, err := v.Editor.Get(versionsPath(itemPath))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	versions := make([]Version, 0, len(item.Children))
+	for _, child := range item.Children {
+		number, err := strconv.Atoi(child.Name)
+		if err != nil || number <= 0 {
+			continue
+		}
+		versions = append(versions, Version{Number: number, Size: child.Size, Time: child.ModTime})
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Number < versions[j].Number })
+	return versions, nil
+}
+
+// Usage returns what the versions of the files at the given path, or beneath
+// it, use.
+func (v *Versioned) Usage(itemPath string) (DiskUsage, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	dir, err := v.Editor.Get(VersionsDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return DiskUsage{}, nil
+		}
+		return DiskUsage{}, err
+	}
+	itemPath = strings.Trim(itemPath, "/")
+	var usage DiskUsage
+	for _, child := range dir.Children {
+		filePath, err := url.PathUnescape(child.Name)
+		if err != nil || (itemPath != "" && filePath != itemPath && !strings.HasPrefix(filePath, itemPath+"/")) {
+			continue
+		}
+		versions, err := v.versions(filePath)
+		if err != nil {
+			return DiskUsage{}, err
+		}
+		for _, version := range versions {
+			usage.Bytes += version.Size
+			usage.Files++
+		}
+	}
+	return usage, nil
+}
+
+// GetVersion returns a version of the file at the given path as a read only item.
+func (v *Versioned) GetVersion(itemPath string, number int) (Item, error) {
+	if number <= 0 {
+		return Item{}, hiddenError("get", itemPath)
+	}
+	item, err := v.Editor.Get(versionPath(itemPath, number))
+	if err != nil {
+		return item, err
+	}
+	item.Name = path.Base(strings.Trim(itemPath, "/"))
+	item.Opener = readOnlyOpener{item.Opener}
+	return item, nil
+}
+
+// RestoreVersion writes a version back to the file at the given path, creating
+// it when it was deleted. The content being replaced is kept as a new version.
+func (v *Versioned) RestoreVersion(itemPath string, number int) error {
+	version, err := v.GetVersion(itemPath, number)
+	if err != nil {
+		return err
+	}
+	if _, err := v.Get(itemPath); os.IsNotExist(err) {
+		if parent := path.Dir(strings.Trim(itemPath, "/")); parent != "." {
+			if _, err := v.CreateDir(parent); err != nil {
+				return err
+			}
+		}
+		if _, err := v.CreateFile(itemPath); err != nil {
+			return err
+		}
+	}
+	current, err := v.Get(itemPath)
+	if err != nil {
+		return err
+	}
+	if !current.FileMode.IsRegular() {
+		return NotRegularFile
+	}
+	source, err := version.Open(os.O_RDONLY)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	destination, err := current.Open(os.O_WRONLY | os.O_TRUNC)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(destination, source); err != nil {
+		destination.Close()
+		return err
+	}
+	return destination.Close()
+}
+
+// Prune removes the versions older than MaxAge, returning how many were removed.
+func (v *Versioned) Prune(now time.Time) (int, error) {
+	if v.MaxAge <= 0 {
+		return 0, nil
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	dir, err := v.Editor.Get(VersionsDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	pruned := 0
+	for _, child := range dir.Children {
+		itemPath, err := url.PathUnescape(child.Name)
+		if err != nil {
+			continue
+		}
+		versions, err := v.versions(itemPath)
+		if err != nil {
+			return pruned, err
+		}
+		kept := len(versions)
+		for _, version := range versions {
+			if version.Time.IsZero() || now.Sub(version.Time) < v.MaxAge {
+				continue
+			}
+			if err := v.remove(itemPath, version); err != nil {
+				return pruned, err
+			}
+			kept--
+			pruned++
+		}
+		if kept == 0 {
+			if err := v.Editor.Delete(versionsPath(itemPath)); err != nil {
+				return pruned, err
+			}
+		}
+	}
+	return pruned, nil
+}
+
+// PruneEvery runs Prune periodically until the context is done.
+func (v *Versioned) PruneEvery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if _, err := v.Prune(now); err != nil {
+				log.Printf("failed to prune old versions: %s", err)
+			}
+		}
+	}
+}
+
+type versionedOpener struct {
+	Opener
+	versioned *Versioned
+	path      string
+}
+
+// Open keeps a version of the file before it is truncated or first written to.
+func (o versionedOpener) Open(flag int) (io.ReadWriteCloser, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR) == 0 {
+		return o.Opener.Open(flag)
+	}
+	if flag&os.O_TRUNC != 0 {
+		if err := o.keep(); err != nil {
+			return nil, err
+		}
+		return o.Opener.Open(flag)
+	}
+	file, err := o.Opener.Open(flag)
+	if err != nil {
+		return nil, err
+	}
+	return &versionedFile{ReadWriteCloser: file, opener: o}, nil
+}
+
+// keep snapshots the current content of the file, if there is any.
+func (o versionedOpener) keep() error {
+	item, err := o.versioned.Editor.Get(o.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if !item.FileMode.IsRegular() {
+		return nil
+	}
+	return o.versioned.snapshot(o.path, item)
+}
+
+// versionedFile keeps a version before the first write.
+type versionedFile struct {
+	io.ReadWriteCloser
+	opener versionedOpener
+	kept   bool
+}
+
+func (f *versionedFile) Write(data []byte) (int, error) {
+	if !f.kept {
+		if err := f.opener.keep(); err != nil {
+			return 0, err
+		}
+		f.kept = true
+	}
+	return f.ReadWriteCloser.Write(data)
+}
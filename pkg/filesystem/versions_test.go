@@ -0,0 +1,119 @@
+package filesystem_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/peymanmortazavi/fs-server/pkg/filesystem"
+)
+
+func writeItem(t *testing.T, editor filesystem.Editor, path, content string) {
+	t.Helper()
+	item, err := editor.Get(path)
+	if os.IsNotExist(err) {
+		item, err = editor.CreateFile(path)
+	}
+	if err != nil {
+		t.Fatalf("failed to get %s: %s", path, err)
+	}
+	file, err := item.Open(os.O_WRONLY | os.O_TRUNC)
+	if err != nil {
+		t.Fatalf("failed to open %s: %s", path, err)
+	}
+	file.Write([]byte(content))
+	file.Close()
+}
+
+func readItem(t *testing.T, item filesystem.Item) string {
+	t.Helper()
+	file, err := item.Open(os.O_RDONLY)
+	if err != nil {
+		t.Fatalf("failed to open %s: %s", item.Name, err)
+	}
+	defer file.Close()
+	data, _ := ioutil.ReadAll(file)
+	return string(data)
+}
+
+func TestVersioned(t *testing.T) {
+	root := setupTestDir(t)
+	createBasicDirStructure(root)
+	versioned := filesystem.NewVersioned(filesystem.DirManager{Root: root})
+	versioned.MaxVersions = 3
+	var kept filesystem.DiskUsage
+	versioned.Kept = func(itemPath string, version filesystem.Version) {
+		kept = filesystem.DiskUsage{Bytes: kept.Bytes + version.Size, Files: kept.Files + 1}
+	}
+	versioned.Removed = func(itemPath string, version filesystem.Version) {
+		kept = filesystem.DiskUsage{Bytes: kept.Bytes - version.Size, Files: kept.Files - 1}
+	}
+
+	writeItem(t, versioned, "a.txt", "second")
+	writeItem(t, versioned, "a.txt", "third")
+	versions, err := versioned.Versions("a.txt")
+	if err != nil || len(versions) != 2 || versions[0].Number != 1 || versions[1].Number != 2 {
+		t.Fatalf("unexpected versions: %+v %v", versions, err)
+	}
+	item, err := versioned.GetVersion("a.txt", 1)
+	if err != nil || readItem(t, item) != aContent {
+		t.Errorf("unexpected first version: %v", err)
+	}
+	if _, err := item.Open(os.O_WRONLY); !filesystem.IsReadOnly(err) {
+		t.Errorf("expected versions to be read only but got %v", err)
+	}
+
+	listing, _ := versioned.Get("")
+	for _, child := range listing.Children {
+		if child.Name == filesystem.VersionsDir {
+			t.Errorf("expected the versions directory to be hidden")
+		}
+	}
+
+	// restoring keeps the replaced content as a version too.
+	if err := versioned.RestoreVersion("a.txt", 1); err != nil {
+		t.Fatalf("failed to restore version: %s", err)
+	}
+	if data, _ := ioutil.ReadFile(filepath.Join(root, "a.txt")); string(data) != aContent {
+		t.Errorf("unexpected restored content: %q", data)
+	}
+	writeItem(t, versioned, "a.txt", "fourth")
+	versions, _ = versioned.Versions("a.txt")
+	if len(versions) != 3 || versions[0].Number != 2 {
+		t.Errorf("expected the oldest versions to be pruned beyond 3 but got %+v", versions)
+	}
+
+	// deleting a directory keeps every file beneath it.
+	if err := versioned.Delete("sub"); err != nil {
+		t.Fatalf("failed to delete directory: %s", err)
+	}
+	if err := versioned.RestoreVersion("sub/b.txt", 1); err != nil {
+		t.Fatalf("failed to restore deleted file: %s", err)
+	}
+	if data, _ := ioutil.ReadFile(filepath.Join(root, "sub", "b.txt")); string(data) != bContent {
+		t.Errorf("unexpected restored content: %q", data)
+	}
+
+	if usage, err := versioned.Usage(""); err != nil || usage != kept || kept.Files != 4 {
+		t.Errorf("expected the usage of versions to be %+v but got %+v %v", kept, usage, err)
+	}
+	if usage, _ := versioned.Usage("sub"); usage != (filesystem.DiskUsage{Bytes: int64(len(bContent)), Files: 1}) {
+		t.Errorf("unexpected usage of the versions beneath sub: %+v", usage)
+	}
+
+	versioned.MaxAge = time.Hour
+	if pruned, _ := versioned.Prune(time.Now()); pruned != 0 {
+		t.Errorf("expected recent versions to be kept but %d were pruned", pruned)
+	}
+	if pruned, _ := versioned.Prune(time.Now().Add(2 * time.Hour)); pruned != 4 {
+		t.Errorf("expected old versions to be pruned but %d were pruned", pruned)
+	}
+	if versions, _ := versioned.Versions("a.txt"); len(versions) != 0 {
+		t.Errorf("expected no versions left but got %+v", versions)
+	}
+	if kept != (filesystem.DiskUsage{}) {
+		t.Errorf("expected the pruned versions to be reported but %+v are left", kept)
+	}
+}
@@ -0,0 +1,73 @@
+package filesystem
+
+import (
+	"context"
+	"os"
+	"path"
+	"strings"
+	"sync"
+)
+
+// WalkFunc is called with every item found by Walk along with its path relative
+// to the root of the file system.
+type WalkFunc func(relative string, item Item)
+
+// Walk calls fn with every item beneath root, root itself is not included.
+//
+// At most concurrency directories are read at once and fn may be called from
+// several goroutines at the same time. Items removed while walking are skipped.
+// The walk stops early when the context is done.
+func Walk(ctx context.Context, viewer Viewer, root string, concurrency int, fn WalkFunc) error {
+	if concurrency <= 0 {
+		concurrency = defaultSearchConcurrency
+	}
+	semaphore := make(chan struct{}, concurrency)
+
+	var (
+		wg       sync.WaitGroup
+		errMu    sync.Mutex
+		firstErr error
+	)
+	var walk func(dir string)
+	walk = func(dir string) {
+		defer wg.Done()
+		select {
+		case semaphore <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+		item, err := viewer.Get(dir)
+		if err != nil {
+			<-semaphore
+			if !os.IsNotExist(err) {
+				errMu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				errMu.Unlock()
+			}
+			return
+		}
+		for _, child := range item.Children {
+			if ctx.Err() != nil {
+				break
+			}
+			relative := path.Join(dir, child.Name)
+			fn(relative, child)
+			if child.FileMode.IsDir() {
+				wg.Add(1)
+				go walk(relative)
+			}
+		}
+		<-semaphore
+	}
+
+	wg.Add(1)
+	walk(strings.Trim(root, "/"))
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return firstErr
+}
@@ -0,0 +1,223 @@
+//go:build linux
+// +build linux
+
+package filesystem
+
+import (
+	"errors"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+const watchMask = syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_CLOSE_WRITE |
+	syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_ONLYDIR | syscall.IN_DONT_FOLLOW
+
+// moveWait is how long the first half of a rename waits for its counterpart
+// when it ends a read, before the item is considered moved out of the tree.
+const moveWait = 50 * time.Millisecond
+
+// DirWatcher watches a local directory tree with inotify and publishes its changes.
+//
+// Unlike a Notifier, it also observes changes made by other processes.
+type DirWatcher struct {
+	EventHub
+
+	root  string
+	fd    int
+	file  *os.File
+	mu    sync.Mutex
+	paths map[int]string
+	done  chan struct{}
+}
+
+// pendingMove is the first half of a rename, waiting for its matching MOVED_TO.
+type pendingMove struct {
+	cookie uint32
+	path   string
+	dir    bool
+}
+
+// NewDirWatcher starts watching every directory beneath root.
+func NewDirWatcher(root string) (*DirWatcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+	w := &DirWatcher{
+		root: root,
+		fd:   fd,
+		// a non-blocking descriptor is handled by the runtime poller, which
+		// lets Close interrupt a pending read.
+		file:  os.NewFile(uintptr(fd), "inotify"),
+		paths: make(map[int]string),
+		done:  make(chan struct{}),
+	}
+	if err := w.addTree("", false); err != nil {
+		w.file.Close()
+		return nil, err
+	}
+	go w.run()
+	return w, nil
+}
+
+// Close stops watching the directory, waits for the watcher to finish and ends
+// every subscription.
+func (w *DirWatcher) Close() error {
+	err := w.file.Close()
+	<-w.done
+	w.CloseSubscriptions()
+	return err
+}
+
+// addTree watches the directory at relative path and everything beneath it.
+//
+// When publish is true, a create event is published for every item found
+// beneath it since those may have been created before the watch was added.
+func (w *DirWatcher) addTree(rel string, publish bool) error {
+	base := filepath.Join(w.root, filepath.FromSlash(rel))
+	return filepath.Walk(base, func(absolute string, info os.FileInfo, err error) error {
+		if err != nil {
+			// items may vanish while walking, that is reported by their own events.
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		relative, _ := filepath.Rel(w.root, absolute)
+		relative = filepath.ToSlash(relative)
+		if relative == "." {
+			relative = ""
+		}
+		if publish && absolute != base {
+			w.Publish(Created, relative, "")
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		wd, err := syscall.InotifyAddWatch(w.fd, absolute, watchMask)
+		if err != nil {
+			if err == syscall.ENOENT || err == syscall.ENOTDIR {
+				return nil
+			}
+			return os.NewSyscallError("inotify_add_watch", err)
+		}
+		w.mu.Lock()
+		w.paths[wd] = relative
+		w.mu.Unlock()
+		return nil
+	})
+}
+
+// movePaths updates watched directories after a directory was renamed.
+func (w *DirWatcher) movePaths(from, to string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for wd, p := range w.paths {
+		if p == from || strings.HasPrefix(p, from+"/") {
+			w.paths[wd] = to + p[len(from):]
+		}
+	}
+}
+
+// removePaths stops watching directories that left the watched tree.
+func (w *DirWatcher) removePaths(prefix string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for wd, p := range w.paths {
+		if p == prefix || strings.HasPrefix(p, prefix+"/") {
+			_, _ = syscall.InotifyRmWatch(w.fd, uint32(wd))
+			delete(w.paths, wd)
+		}
+	}
+}
+
+func (w *DirWatcher) flush(pending *pendingMove) {
+	if pending == nil {
+		return
+	}
+	w.Publish(Deleted, pending.path, "")
+	if pending.dir {
+		w.removePaths(pending.path)
+	}
+}
+
+func (w *DirWatcher) run() {
+	defer close(w.done)
+	buffer := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	// the halves of a rename may be split across reads, so a pending move is
+	// kept until the next event or until moveWait passes without one.
+	var pending *pendingMove
+	for {
+		deadline := time.Time{}
+		if pending != nil {
+			deadline = time.Now().Add(moveWait)
+		}
+		_ = w.file.SetReadDeadline(deadline)
+		n, err := w.file.Read(buffer)
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			// the move has no counterpart, it left the watched tree.
+			w.flush(pending)
+			pending = nil
+			continue
+		}
+		if err != nil {
+			return
+		}
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			raw := (*syscall.InotifyEvent)(unsafe.Pointer(&buffer[offset]))
+			nameStart := offset + syscall.SizeofInotifyEvent
+			name := strings.TrimRight(string(buffer[nameStart:nameStart+int(raw.Len)]), "\x00")
+			offset = nameStart + int(raw.Len)
+
+			if raw.Mask&syscall.IN_Q_OVERFLOW != 0 {
+				log.Printf("inotify queue overflowed for %s, some events were lost", w.root)
+				continue
+			}
+			w.mu.Lock()
+			parent, ok := w.paths[int(raw.Wd)]
+			if raw.Mask&syscall.IN_IGNORED != 0 {
+				delete(w.paths, int(raw.Wd))
+			}
+			w.mu.Unlock()
+			if !ok || name == "" {
+				continue
+			}
+
+			itemPath := path.Join(parent, name)
+			dir := raw.Mask&syscall.IN_ISDIR != 0
+			if raw.Mask&syscall.IN_MOVED_TO != 0 && pending != nil && pending.cookie == raw.Cookie {
+				w.Publish(Renamed, itemPath, pending.path)
+				if dir {
+					w.movePaths(pending.path, itemPath)
+				}
+				pending = nil
+				continue
+			}
+			w.flush(pending)
+			pending = nil
+
+			switch {
+			case raw.Mask&syscall.IN_MOVED_FROM != 0:
+				pending = &pendingMove{cookie: raw.Cookie, path: itemPath, dir: dir}
+			case raw.Mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0:
+				w.Publish(Created, itemPath, "")
+				if dir {
+					if err := w.addTree(itemPath, true); err != nil {
+						log.Printf("failed to watch %s: %s", itemPath, err)
+					}
+				}
+			case raw.Mask&syscall.IN_DELETE != 0:
+				w.Publish(Deleted, itemPath, "")
+			case raw.Mask&syscall.IN_CLOSE_WRITE != 0:
+				w.Publish(Modified, itemPath, "")
+			}
+		}
+	}
+}
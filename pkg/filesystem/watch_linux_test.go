@@ -0,0 +1,42 @@
+package filesystem_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/peymanmortazavi/fs-server/pkg/filesystem"
+)
+
+func TestDirWatcher(t *testing.T) {
+	root := setupTestDir(t)
+	createBasicDirStructure(root)
+	watcher, err := filesystem.NewDirWatcher(root)
+	if err != nil {
+		t.Fatalf("failed to watch %s: %s", root, err)
+	}
+	defer watcher.Close()
+	subscription, _ := watcher.Watch("", true, 0)
+	defer subscription.Close()
+
+	ioutil.WriteFile(filepath.Join(root, "sub", "c.txt"), []byte("c"), 0664)
+	expectEvent(t, subscription, filesystem.Created, "sub/c.txt")
+	expectEvent(t, subscription, filesystem.Modified, "sub/c.txt")
+
+	os.Rename(filepath.Join(root, "sub"), filepath.Join(root, "moved"))
+	event := expectEvent(t, subscription, filesystem.Renamed, "moved")
+	if event.OldPath != "sub" {
+		t.Errorf("expected rename from sub but got %s", event.OldPath)
+	}
+
+	// directories created after the watch started, and renamed ones, are watched as well.
+	os.MkdirAll(filepath.Join(root, "moved", "new"), 0775)
+	expectEvent(t, subscription, filesystem.Created, "moved/new")
+	os.Remove(filepath.Join(root, "moved", "b.txt"))
+	expectEvent(t, subscription, filesystem.Deleted, "moved/b.txt")
+
+	// a move without its counterpart left the tree, even once no other event follows.
+	os.Rename(filepath.Join(root, "moved", "new"), filepath.Join(setupTestDir(t), "new"))
+	expectEvent(t, subscription, filesystem.Deleted, "moved/new")
+}
@@ -0,0 +1,21 @@
+//go:build !linux
+// +build !linux
+
+package filesystem
+
+// DirWatcher watches a local directory tree and publishes its changes.
+//
+// It is only supported on Linux.
+type DirWatcher struct {
+	EventHub
+}
+
+// NewDirWatcher returns WatchUnsupported on this platform.
+func NewDirWatcher(root string) (*DirWatcher, error) {
+	return nil, WatchUnsupported
+}
+
+// Close does nothing on this platform.
+func (w *DirWatcher) Close() error {
+	return nil
+}
@@ -0,0 +1,4 @@
+// Package fsgrpc serves a filesystem.Editor over gRPC with the FileSystem
+// service of package fspb, answering failures with the status codes matching
+// the errors of the HTTP API served by package fshttp.
+package fsgrpc
@@ -0,0 +1,548 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: pkg/fsgrpc/fspb/filesystem.proto
+
+// The file system served by fs-server, see pkg/fsgrpc for the server. Paths
+// are relative to the served root, the empty path being the root itself.
+//
+// Regenerate the Go code with `make proto`.
+
+package fspb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	FileSystem_Stat_FullMethodName   = "/fsserver.v1.FileSystem/Stat"
+	FileSystem_List_FullMethodName   = "/fsserver.v1.FileSystem/List"
+	FileSystem_Read_FullMethodName   = "/fsserver.v1.FileSystem/Read"
+	FileSystem_Write_FullMethodName  = "/fsserver.v1.FileSystem/Write"
+	FileSystem_Create_FullMethodName = "/fsserver.v1.FileSystem/Create"
+	FileSystem_Mkdir_FullMethodName  = "/fsserver.v1.FileSystem/Mkdir"
+	FileSystem_Delete_FullMethodName = "/fsserver.v1.FileSystem/Delete"
+	FileSystem_Move_FullMethodName   = "/fsserver.v1.FileSystem/Move"
+	FileSystem_Watch_FullMethodName  = "/fsserver.v1.FileSystem/Watch"
+)
+
+// FileSystemClient is the client API for FileSystem service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type FileSystemClient interface {
+	// Stat returns the item at a path, without its children.
+	Stat(ctx context.Context, in *StatRequest, opts ...grpc.CallOption) (*Item, error)
+	// List streams the children of a directory, or the file itself.
+	List(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (FileSystem_ListClient, error)
+	// Read streams the content of a file in chunks.
+	Read(ctx context.Context, in *ReadRequest, opts ...grpc.CallOption) (FileSystem_ReadClient, error)
+	// Write replaces the content of a file with the data of every message, the
+	// first one giving the path.
+	Write(ctx context.Context, opts ...grpc.CallOption) (FileSystem_WriteClient, error)
+	// Create creates a file with some content, failing when it already exists.
+	Create(ctx context.Context, in *CreateRequest, opts ...grpc.CallOption) (*Item, error)
+	// Mkdir creates a directory along with the missing ones leading to it.
+	Mkdir(ctx context.Context, in *MkdirRequest, opts ...grpc.CallOption) (*Item, error)
+	// Delete deletes an item, a directory with content only when recursive.
+	Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*DeleteResponse, error)
+	// Move moves an item to a path where nothing exists.
+	Move(ctx context.Context, in *MoveRequest, opts ...grpc.CallOption) (*Item, error)
+	// Watch streams the changes at a path. The stream ends when the watcher is
+	// too slow, watching again after the last event received catches up.
+	Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (FileSystem_WatchClient, error)
+}
+
+type fileSystemClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewFileSystemClient(cc grpc.ClientConnInterface) FileSystemClient {
+	return &fileSystemClient{cc}
+}
+
+func (c *fileSystemClient) Stat(ctx context.Context, in *StatRequest, opts ...grpc.CallOption) (*Item, error) {
+	out := new(Item)
+	err := c.cc.Invoke(ctx, FileSystem_Stat_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fileSystemClient) List(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (FileSystem_ListClient, error) {
+	stream, err := c.cc.NewStream(ctx, &FileSystem_ServiceDesc.Streams[0], FileSystem_List_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &fileSystemListClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type FileSystem_ListClient interface {
+	Recv() (*Item, error)
+	grpc.ClientStream
+}
+
+type fileSystemListClient struct {
+	grpc.ClientStream
+}
+
+func (x *fileSystemListClient) Recv() (*Item, error) {
+	m := new(Item)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *fileSystemClient) Read(ctx context.Context, in *ReadRequest, opts ...grpc.CallOption) (FileSystem_ReadClient, error) {
+	stream, err := c.cc.NewStream(ctx, &FileSystem_ServiceDesc.Streams[1], FileSystem_Read_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &fileSystemReadClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type FileSystem_ReadClient interface {
+	Recv() (*Chunk, error)
+	grpc.ClientStream
+}
+
+type fileSystemReadClient struct {
+	grpc.ClientStream
+}
+
+func (x *fileSystemReadClient) Recv() (*Chunk, error) {
+	m := new(Chunk)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *fileSystemClient) Write(ctx context.Context, opts ...grpc.CallOption) (FileSystem_WriteClient, error) {
+	stream, err := c.cc.NewStream(ctx, &FileSystem_ServiceDesc.Streams[2], FileSystem_Write_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &fileSystemWriteClient{stream}
+	return x, nil
+}
+
+type FileSystem_WriteClient interface {
+	Send(*WriteRequest) error
+	CloseAndRecv() (*Item, error)
+	grpc.ClientStream
+}
+
+type fileSystemWriteClient struct {
+	grpc.ClientStream
+}
+
+func (x *fileSystemWriteClient) Send(m *WriteRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *fileSystemWriteClient) CloseAndRecv() (*Item, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(Item)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *fileSystemClient) Create(ctx context.Context, in *CreateRequest, opts ...grpc.CallOption) (*Item, error) {
+	out := new(Item)
+	err := c.cc.Invoke(ctx, FileSystem_Create_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fileSystemClient) Mkdir(ctx context.Context, in *MkdirRequest, opts ...grpc.CallOption) (*Item, error) {
+	out := new(Item)
+	err := c.cc.Invoke(ctx, FileSystem_Mkdir_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fileSystemClient) Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*DeleteResponse, error) {
+	out := new(DeleteResponse)
+	err := c.cc.Invoke(ctx, FileSystem_Delete_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fileSystemClient) Move(ctx context.Context, in *MoveRequest, opts ...grpc.CallOption) (*Item, error) {
+	out := new(Item)
+	err := c.cc.Invoke(ctx, FileSystem_Move_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fileSystemClient) Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (FileSystem_WatchClient, error) {
+	stream, err := c.cc.NewStream(ctx, &FileSystem_ServiceDesc.Streams[3], FileSystem_Watch_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &fileSystemWatchClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type FileSystem_WatchClient interface {
+	Recv() (*Event, error)
+	grpc.ClientStream
+}
+
+type fileSystemWatchClient struct {
+	grpc.ClientStream
+}
+
+func (x *fileSystemWatchClient) Recv() (*Event, error) {
+	m := new(Event)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// FileSystemServer is the server API for FileSystem service.
+// All implementations must embed UnimplementedFileSystemServer
+// for forward compatibility
+type FileSystemServer interface {
+	// Stat returns the item at a path, without its children.
+	Stat(context.Context, *StatRequest) (*Item, error)
+	// List streams the children of a directory, or the file itself.
+	List(*ListRequest, FileSystem_ListServer) error
+	// Read streams the content of a file in chunks.
+	Read(*ReadRequest, FileSystem_ReadServer) error
+	// Write replaces the content of a file with the data of every message, the
+	// first one giving the path.
+	Write(FileSystem_WriteServer) error
+	// Create creates a file with some content, failing when it already exists.
+	Create(context.Context, *CreateRequest) (*Item, error)
+	// Mkdir creates a directory along with the missing ones leading to it.
+	Mkdir(context.Context, *MkdirRequest) (*Item, error)
+	// Delete deletes an item, a directory with content only when recursive.
+	Delete(context.Context, *DeleteRequest) (*DeleteResponse, error)
+	// Move moves an item to a path where nothing exists.
+	Move(context.Context, *MoveRequest) (*Item, error)
+	// Watch streams the changes at a path. The stream ends when the watcher is
+	// too slow, watching again after the last event received catches up.
+	Watch(*WatchRequest, FileSystem_WatchServer) error
+	mustEmbedUnimplementedFileSystemServer()
+}
+
+// UnimplementedFileSystemServer must be embedded to have forward compatible implementations.
+type UnimplementedFileSystemServer struct {
+}
+
+func (UnimplementedFileSystemServer) Stat(context.Context, *StatRequest) (*Item, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Stat not implemented")
+}
+func (UnimplementedFileSystemServer) List(*ListRequest, FileSystem_ListServer) error {
+	return status.Errorf(codes.Unimplemented, "method List not implemented")
+}
+func (UnimplementedFileSystemServer) Read(*ReadRequest, FileSystem_ReadServer) error {
+	return status.Errorf(codes.Unimplemented, "method Read not implemented")
+}
+func (UnimplementedFileSystemServer) Write(FileSystem_WriteServer) error {
+	return status.Errorf(codes.Unimplemented, "method Write not implemented")
+}
+func (UnimplementedFileSystemServer) Create(context.Context, *CreateRequest) (*Item, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Create not implemented")
+}
+func (UnimplementedFileSystemServer) Mkdir(context.Context, *MkdirRequest) (*Item, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Mkdir not implemented")
+}
+func (UnimplementedFileSystemServer) Delete(context.Context, *DeleteRequest) (*DeleteResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Delete not implemented")
+}
+func (UnimplementedFileSystemServer) Move(context.Context, *MoveRequest) (*Item, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Move not implemented")
+}
+func (UnimplementedFileSystemServer) Watch(*WatchRequest, FileSystem_WatchServer) error {
+	return status.Errorf(codes.Unimplemented, "method Watch not implemented")
+}
+func (UnimplementedFileSystemServer) mustEmbedUnimplementedFileSystemServer() {}
+
+// UnsafeFileSystemServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to FileSystemServer will
+// result in compilation errors.
+type UnsafeFileSystemServer interface {
+	mustEmbedUnimplementedFileSystemServer()
+}
+
+func RegisterFileSystemServer(s grpc.ServiceRegistrar, srv FileSystemServer) {
+	s.RegisterService(&FileSystem_ServiceDesc, srv)
+}
+
+func _FileSystem_Stat_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StatRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileSystemServer).Stat(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FileSystem_Stat_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileSystemServer).Stat(ctx, req.(*StatRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FileSystem_List_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ListRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(FileSystemServer).List(m, &fileSystemListServer{stream})
+}
+
+type FileSystem_ListServer interface {
+	Send(*Item) error
+	grpc.ServerStream
+}
+
+type fileSystemListServer struct {
+	grpc.ServerStream
+}
+
+func (x *fileSystemListServer) Send(m *Item) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _FileSystem_Read_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ReadRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(FileSystemServer).Read(m, &fileSystemReadServer{stream})
+}
+
+type FileSystem_ReadServer interface {
+	Send(*Chunk) error
+	grpc.ServerStream
+}
+
+type fileSystemReadServer struct {
+	grpc.ServerStream
+}
+
+func (x *fileSystemReadServer) Send(m *Chunk) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _FileSystem_Write_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(FileSystemServer).Write(&fileSystemWriteServer{stream})
+}
+
+type FileSystem_WriteServer interface {
+	SendAndClose(*Item) error
+	Recv() (*WriteRequest, error)
+	grpc.ServerStream
+}
+
+type fileSystemWriteServer struct {
+	grpc.ServerStream
+}
+
+func (x *fileSystemWriteServer) SendAndClose(m *Item) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *fileSystemWriteServer) Recv() (*WriteRequest, error) {
+	m := new(WriteRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _FileSystem_Create_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileSystemServer).Create(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FileSystem_Create_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileSystemServer).Create(ctx, req.(*CreateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FileSystem_Mkdir_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MkdirRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileSystemServer).Mkdir(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FileSystem_Mkdir_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileSystemServer).Mkdir(ctx, req.(*MkdirRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FileSystem_Delete_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileSystemServer).Delete(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FileSystem_Delete_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileSystemServer).Delete(ctx, req.(*DeleteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FileSystem_Move_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MoveRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileSystemServer).Move(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FileSystem_Move_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileSystemServer).Move(ctx, req.(*MoveRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FileSystem_Watch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(FileSystemServer).Watch(m, &fileSystemWatchServer{stream})
+}
+
+type FileSystem_WatchServer interface {
+	Send(*Event) error
+	grpc.ServerStream
+}
+
+type fileSystemWatchServer struct {
+	grpc.ServerStream
+}
+
+func (x *fileSystemWatchServer) Send(m *Event) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// FileSystem_ServiceDesc is the grpc.ServiceDesc for FileSystem service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var FileSystem_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "fsserver.v1.FileSystem",
+	HandlerType: (*FileSystemServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Stat",
+			Handler:    _FileSystem_Stat_Handler,
+		},
+		{
+			MethodName: "Create",
+			Handler:    _FileSystem_Create_Handler,
+		},
+		{
+			MethodName: "Mkdir",
+			Handler:    _FileSystem_Mkdir_Handler,
+		},
+		{
+			MethodName: "Delete",
+			Handler:    _FileSystem_Delete_Handler,
+		},
+		{
+			MethodName: "Move",
+			Handler:    _FileSystem_Move_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "List",
+			Handler:       _FileSystem_List_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Read",
+			Handler:       _FileSystem_Read_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Write",
+			Handler:       _FileSystem_Write_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "Watch",
+			Handler:       _FileSystem_Watch_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "pkg/fsgrpc/fspb/filesystem.proto",
+}
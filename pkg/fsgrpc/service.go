@@ -0,0 +1,499 @@
+package fsgrpc
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/peymanmortazavi/fs-server/pkg/filesystem"
+	"github.com/peymanmortazavi/fs-server/pkg/fsgrpc/fspb"
+	"github.com/peymanmortazavi/fs-server/pkg/fshttp"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// DefaultChunkSize is the size of the chunks Read streams.
+const DefaultChunkSize = 64 << 10
+
+// Service implements the FileSystem service over an Editor, register it with
+// fspb.RegisterFileSystemServer.
+//
+// Changes are rejected as they are by the HTTP API, serve a
+// filesystem.ReadOnly to reject every one of them.
+type Service struct {
+	fspb.UnimplementedFileSystemServer
+
+	Editor filesystem.Editor
+
+	// Watcher streams changes to clients, the Editor is used when it is a
+	// filesystem.Watcher and this is not set.
+	Watcher filesystem.Watcher
+
+	// Protected lists paths that can never be deleted nor moved, neither can
+	// the directories containing them.
+	Protected []string
+
+	// Digests and Usage are the caches shared with an fshttp.Handler, they
+	// are invalidated by the changes made through the service when set.
+	Digests *filesystem.DigestCache
+	Usage   *filesystem.UsageCache
+
+	// Trash keeps deleted items when set, it should also be the Editor so
+	// the trash directory is hidden.
+	Trash *filesystem.Trash
+
+	// Quotas, Audit and Listeners are shared with an fshttp.Handler, the
+	// changes made through the service count against the same quotas, are
+	// recorded in the same audit log and told to the same listeners.
+	Quotas    *fshttp.Quotas
+	Audit     *fshttp.AuditLog
+	Listeners []fshttp.MutationListener
+
+	// Auth authenticates every call with the basic authentication
+	// credentials in its authorization metadata when set.
+	Auth *fshttp.BasicAuth
+
+	// ChunkSize is the size of the chunks Read streams, DefaultChunkSize
+	// when zero.
+	ChunkSize int
+
+	// TempDir is the local directory holding the data of writes until their
+	// stream ends, the default directory for temporary files when empty.
+	TempDir string
+}
+
+// cleanPath returns the path relative to the served root, so nothing outside
+// of it is reached through dot-dot elements.
+func cleanPath(itemPath string) string {
+	return strings.Trim(path.Clean("/"+itemPath), "/")
+}
+
+// itemOf returns the message describing the item at the path.
+func itemOf(itemPath string, item filesystem.Item) *fspb.Item {
+	result := &fspb.Item{
+		Path:       itemPath,
+		Name:       item.Name,
+		Permission: uint32(item.Perm()),
+		Owner:      item.Owner,
+		Size:       item.Size,
+	}
+	switch {
+	case item.IsDir():
+		result.Type = fspb.ItemType_ITEM_TYPE_DIR
+	case item.IsRegular():
+		result.Type = fspb.ItemType_ITEM_TYPE_FILE
+	}
+	if !item.ModTime.IsZero() {
+		result.Modified = timestamppb.New(item.ModTime)
+	}
+	return result
+}
+
+// changed invalidates the caches describing the item at the path.
+func (s *Service) changed(itemPath string) {
+	s.Digests.Forget(itemPath)
+	if s.Usage != nil {
+		s.Usage.Invalidate(itemPath)
+	}
+}
+
+// changes returns what accounts for the changes made through the service.
+func (s *Service) changes() fshttp.Changes {
+	return fshttp.Changes{
+		Editor:    s.Editor,
+		Trash:     s.Trash,
+		Quotas:    s.Quotas,
+		Digests:   s.Digests,
+		Usage:     s.Usage,
+		Audit:     s.Audit,
+		Listeners: s.Listeners,
+	}
+}
+
+// notify records a successful mutation made by the call, see
+// fshttp.Changes.Notify.
+func (s *Service) notify(ctx context.Context, operation string, mutationType fshttp.MutationType, itemPath string, before *fshttp.AuditState) error {
+	if err := s.changes().Notify(s.actorOf(ctx), "", mutationType, itemPath, before); err != nil {
+		return failure(operation, itemPath, err)
+	}
+	return nil
+}
+
+// stat returns the message describing the item at the path.
+func (s *Service) stat(operation, itemPath string) (*fspb.Item, error) {
+	item, err := s.Editor.Get(itemPath)
+	if err != nil {
+		return nil, failure(operation, itemPath, err)
+	}
+	return itemOf(itemPath, item), nil
+}
+
+// Stat returns the item at a path, without its children.
+func (s *Service) Stat(ctx context.Context, request *fspb.StatRequest) (*fspb.Item, error) {
+	if err := s.authenticate(ctx); err != nil {
+		return nil, err
+	}
+	return s.stat("get", cleanPath(request.Path))
+}
+
+// List streams the children of a directory, or the file itself.
+func (s *Service) List(request *fspb.ListRequest, stream fspb.FileSystem_ListServer) error {
+	if err := s.authenticate(stream.Context()); err != nil {
+		return err
+	}
+	itemPath := cleanPath(request.Path)
+	item, err := s.Editor.Get(itemPath)
+	if err != nil {
+		return failure("list", itemPath, err)
+	}
+	if !item.IsDir() {
+		return stream.Send(itemOf(itemPath, item))
+	}
+	for _, child := range filesystem.WithoutProbes(itemPath, item).Children {
+		if err := stream.Send(itemOf(path.Join(itemPath, child.Name), child)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Read streams the content of a file in chunks, from the offset of the
+// request and at most its length when it is not zero.
+func (s *Service) Read(request *fspb.ReadRequest, stream fspb.FileSystem_ReadServer) error {
+	if err := s.authenticate(stream.Context()); err != nil {
+		return err
+	}
+	if request.Offset < 0 || request.Length < 0 {
+		return statusOf(negativeRange)
+	}
+	itemPath := cleanPath(request.Path)
+	item, err := s.Editor.Get(itemPath)
+	if err != nil {
+		return failure("read", itemPath, err)
+	}
+	if !item.IsRegular() || item.Opener == nil {
+		return failure("read", itemPath, filesystem.NotRegularFile)
+	}
+	file, err := item.Open(os.O_RDONLY)
+	if err != nil {
+		return failure("read", itemPath, err)
+	}
+	defer file.Close()
+
+	var reader io.Reader = file
+	if request.Offset > 0 {
+		if seeker, ok := file.(io.Seeker); ok {
+			_, err = seeker.Seek(request.Offset, io.SeekStart)
+		} else {
+			_, err = io.CopyN(ioutil.Discard, file, request.Offset)
+		}
+		if err == io.EOF {
+			// reading past the end streams nothing.
+			return nil
+		}
+		if err != nil {
+			return failure("read", itemPath, err)
+		}
+	}
+	if request.Length > 0 {
+		reader = io.LimitReader(reader, request.Length)
+	}
+	size := s.ChunkSize
+	if size <= 0 {
+		size = DefaultChunkSize
+	}
+	buffer := make([]byte, size)
+	offset := request.Offset
+	for {
+		n, err := io.ReadFull(reader, buffer)
+		if n > 0 {
+			// the message is sent before the buffer is reused.
+			if err := stream.Send(&fspb.Chunk{Offset: offset, Data: buffer[:n]}); err != nil {
+				return err
+			}
+			offset += int64(n)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if err != nil {
+			return failure("read", itemPath, err)
+		}
+	}
+}
+
+// Write replaces the content of a file with the data of every message, the
+// first one giving the path and whether the file is created when missing.
+//
+// The data is staged in TempDir and the file is only created or replaced once
+// the client closes the stream, so an interrupted write leaves it as it was.
+func (s *Service) Write(stream fspb.FileSystem_WriteServer) error {
+	if err := s.authenticate(stream.Context()); err != nil {
+		return err
+	}
+	first, err := stream.Recv()
+	if err == io.EOF {
+		return statusOf(pathExpected)
+	}
+	if err != nil {
+		return err
+	}
+	itemPath := cleanPath(first.Path)
+	item, err := s.Editor.Get(itemPath)
+	create := os.IsNotExist(err) && first.Create
+	if err != nil && !create {
+		return failure("write", itemPath, err)
+	}
+	if !create && (!item.IsRegular() || item.Opener == nil) {
+		return failure("write", itemPath, filesystem.NotRegularFile)
+	}
+
+	staged, err := s.stage()
+	if err != nil {
+		return failure("write", itemPath, err)
+	}
+	defer os.Remove(staged.Name())
+	defer staged.Close()
+	if err := s.receive(stream, itemPath, staged, first.Data); err != nil {
+		return err
+	}
+	size, err := staged.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return failure("write", itemPath, err)
+	}
+	if _, err := staged.Seek(0, io.SeekStart); err != nil {
+		return failure("write", itemPath, err)
+	}
+
+	ctx := stream.Context()
+	reservation, err := s.Quotas.Reserve(s.actorOf(ctx).Principal, itemPath, item.Size, size, create)
+	if err != nil {
+		return failure("write", itemPath, err)
+	}
+	defer reservation.Release()
+	var before *fshttp.AuditState
+	mutationType := fshttp.MutationCreate
+	if create {
+		if item, err = s.Editor.CreateFile(itemPath); err != nil {
+			return failure("write", itemPath, err)
+		}
+	} else {
+		before, mutationType = s.changes().State(itemPath), fshttp.MutationWrite
+	}
+	file, err := item.Open(os.O_CREATE | os.O_WRONLY | os.O_TRUNC)
+	if err != nil {
+		return failure("write", itemPath, err)
+	}
+	defer s.changed(itemPath)
+	if _, err := io.Copy(file, staged); err != nil {
+		file.Close()
+		return failure("write", itemPath, err)
+	}
+	if err := file.Close(); err != nil {
+		return failure("write", itemPath, err)
+	}
+	reservation.Commit(size)
+	if err := s.notify(ctx, "write", mutationType, itemPath, before); err != nil {
+		return err
+	}
+	written, err := s.stat("write", itemPath)
+	if err != nil {
+		return err
+	}
+	return stream.SendAndClose(written)
+}
+
+// stage creates the temporary file holding the data of a write.
+func (s *Service) stage() (*os.File, error) {
+	if s.TempDir != "" {
+		if err := os.MkdirAll(s.TempDir, 0700); err != nil {
+			return nil, err
+		}
+	}
+	return ioutil.TempFile(s.TempDir, "write-*")
+}
+
+// receive writes the data of the first message, then of every message until
+// the client closes the stream.
+func (s *Service) receive(stream fspb.FileSystem_WriteServer, itemPath string, file io.Writer, data []byte) error {
+	for {
+		if _, err := file.Write(data); err != nil {
+			return failure("write", itemPath, err)
+		}
+		message, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		data = message.Data
+	}
+}
+
+// Create creates a file with some content, failing when it already exists.
+func (s *Service) Create(ctx context.Context, request *fspb.CreateRequest) (*fspb.Item, error) {
+	if err := s.authenticate(ctx); err != nil {
+		return nil, err
+	}
+	itemPath := cleanPath(request.Path)
+	size := int64(len(request.Data))
+	reservation, err := s.Quotas.Reserve(s.actorOf(ctx).Principal, itemPath, 0, size, true)
+	if err != nil {
+		return nil, failure("create", itemPath, err)
+	}
+	defer reservation.Release()
+	item, err := s.Editor.CreateFile(itemPath)
+	if err != nil {
+		return nil, failure("create", itemPath, err)
+	}
+	defer s.changed(itemPath)
+	file, err := item.Open(os.O_CREATE | os.O_WRONLY | os.O_TRUNC)
+	if err != nil {
+		return nil, failure("create", itemPath, err)
+	}
+	if _, err := file.Write(request.Data); err != nil {
+		file.Close()
+		return nil, failure("create", itemPath, err)
+	}
+	if err := file.Close(); err != nil {
+		return nil, failure("create", itemPath, err)
+	}
+	reservation.Commit(size)
+	if err := s.notify(ctx, "create", fshttp.MutationCreate, itemPath, nil); err != nil {
+		return nil, err
+	}
+	return s.stat("create", itemPath)
+}
+
+// Mkdir creates a directory along with the missing ones leading to it.
+func (s *Service) Mkdir(ctx context.Context, request *fspb.MkdirRequest) (*fspb.Item, error) {
+	if err := s.authenticate(ctx); err != nil {
+		return nil, err
+	}
+	itemPath := cleanPath(request.Path)
+	reservation, err := s.Quotas.Reserve(s.actorOf(ctx).Principal, itemPath, 0, 0, true)
+	if err != nil {
+		return nil, failure("mkdir", itemPath, err)
+	}
+	defer reservation.Release()
+	item, err := s.Editor.CreateDir(itemPath)
+	if err != nil {
+		return nil, failure("mkdir", itemPath, err)
+	}
+	reservation.Commit(0)
+	if err := s.notify(ctx, "mkdir", fshttp.MutationCreate, itemPath, nil); err != nil {
+		return nil, err
+	}
+	return itemOf(itemPath, item), nil
+}
+
+// Delete deletes an item, a directory with content only when recursive.
+func (s *Service) Delete(ctx context.Context, request *fspb.DeleteRequest) (*fspb.DeleteResponse, error) {
+	if err := s.authenticate(ctx); err != nil {
+		return nil, err
+	}
+	itemPath := cleanPath(request.Path)
+	if err := fshttp.CheckDelete(s.Editor, itemPath, request.Recursive, s.Protected); err != nil {
+		return nil, failure("delete", itemPath, err)
+	}
+	changes := s.changes()
+	before := changes.State(itemPath)
+	defer s.changed(itemPath)
+	if err := changes.Remove(ctx, s.actorOf(ctx).Principal, itemPath, false); err != nil {
+		return nil, failure("delete", itemPath, err)
+	}
+	if err := s.notify(ctx, "delete", fshttp.MutationDelete, itemPath, before); err != nil {
+		return nil, err
+	}
+	return &fspb.DeleteResponse{}, nil
+}
+
+// Move moves an item to a path where nothing exists. The item leaves its old
+// path, so the root and protected paths cannot move.
+func (s *Service) Move(ctx context.Context, request *fspb.MoveRequest) (*fspb.Item, error) {
+	if err := s.authenticate(ctx); err != nil {
+		return nil, err
+	}
+	oldPath, newPath := cleanPath(request.OldPath), cleanPath(request.NewPath)
+	if _, ok := s.Editor.(filesystem.Mover); !ok {
+		return nil, statusOf(moveUnsupported)
+	}
+	if err := fshttp.CheckDelete(s.Editor, oldPath, true, s.Protected); err != nil {
+		return nil, failure("move", oldPath, err)
+	}
+	if newPath == "" {
+		return nil, failure("move", newPath, filesystem.FileAlreadyExists)
+	}
+	changes := s.changes()
+	before := changes.State(oldPath)
+	defer s.changed(newPath)
+	defer s.changed(oldPath)
+	if err := changes.Move(ctx, oldPath, newPath); err != nil {
+		return nil, failure("move", oldPath, err)
+	}
+	// a move is recorded as the deletion of the item and its creation at
+	// its new path.
+	if err := s.notify(ctx, "move", fshttp.MutationDelete, oldPath, before); err != nil {
+		return nil, err
+	}
+	if err := s.notify(ctx, "move", fshttp.MutationCreate, newPath, nil); err != nil {
+		return nil, err
+	}
+	return s.stat("move", newPath)
+}
+
+// watcher returns the watcher of the service, falling back to the Editor.
+func (s *Service) watcher() filesystem.Watcher {
+	if s.Watcher != nil {
+		return s.Watcher
+	}
+	if watcher, ok := s.Editor.(filesystem.Watcher); ok {
+		return watcher
+	}
+	return nil
+}
+
+// Watch streams the changes at a path until the client goes away, or the
+// subscription is closed because the client is too slow.
+func (s *Service) Watch(request *fspb.WatchRequest, stream fspb.FileSystem_WatchServer) error {
+	if err := s.authenticate(stream.Context()); err != nil {
+		return err
+	}
+	itemPath := cleanPath(request.Path)
+	watcher := s.watcher()
+	if watcher == nil {
+		return failure("watch", itemPath, filesystem.WatchUnsupported)
+	}
+	subscription, err := watcher.Watch(itemPath, request.Recursive, request.After)
+	if err != nil {
+		return failure("watch", itemPath, err)
+	}
+	defer subscription.Close()
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case event, ok := <-subscription.Events():
+			if !ok {
+				// the client watches again after the last event and catches up.
+				return nil
+			}
+			if event, ok = filesystem.VisibleEvent(event); !ok {
+				continue
+			}
+			message := &fspb.Event{
+				Id:      event.ID,
+				Type:    string(event.Type),
+				Path:    event.Path,
+				OldPath: event.OldPath,
+				Time:    timestamppb.New(event.Time),
+			}
+			if err := stream.Send(message); err != nil {
+				return nil
+			}
+		}
+	}
+}
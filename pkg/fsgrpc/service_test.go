@@ -0,0 +1,393 @@
+package fsgrpc_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/peymanmortazavi/fs-server/pkg/filesystem"
+	"github.com/peymanmortazavi/fs-server/pkg/fsgrpc"
+	"github.com/peymanmortazavi/fs-server/pkg/fsgrpc/fspb"
+	"github.com/peymanmortazavi/fs-server/pkg/fshttp"
+	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// dial serves the service on an in-process listener and returns a client of it.
+func dial(t *testing.T, service *fsgrpc.Service) fspb.FileSystemClient {
+	t.Helper()
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	fspb.RegisterFileSystemServer(server, service)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return listener.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("failed to dial the service: %s", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return fspb.NewFileSystemClient(conn)
+}
+
+// expectStatus fails the test unless the error is a status with the code and
+// an ErrorInfo detail with the reason.
+func expectStatus(t *testing.T, err error, code codes.Code, reason string) {
+	t.Helper()
+	s, _ := status.FromError(err)
+	if s.Code() != code {
+		t.Errorf("expected %s but got %v", code, err)
+		return
+	}
+	for _, detail := range s.Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok && info.Reason == reason && info.Domain == "fs-server" {
+			return
+		}
+	}
+	t.Errorf("expected the reason %q but got the details %v", reason, s.Details())
+}
+
+func read(t *testing.T, client fspb.FileSystemClient, request *fspb.ReadRequest) (string, int) {
+	t.Helper()
+	stream, err := client.Read(context.Background(), request)
+	if err != nil {
+		t.Fatalf("failed to read %s: %s", request.Path, err)
+	}
+	var content strings.Builder
+	chunks := 0
+	for {
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			return content.String(), chunks
+		}
+		if err != nil {
+			t.Fatalf("failed to read %s: %s", request.Path, err)
+		}
+		if chunk.Offset != request.Offset+int64(content.Len()) {
+			t.Errorf("unexpected offset %d after %d bytes", chunk.Offset, content.Len())
+		}
+		content.Write(chunk.Data)
+		chunks++
+	}
+}
+
+func TestService(t *testing.T) {
+	ctx := context.Background()
+	client := dial(t, &fsgrpc.Service{Editor: filesystem.NewMemory(), Protected: []string{"/keep/me"}, ChunkSize: 4})
+
+	if _, err := client.Mkdir(ctx, &fspb.MkdirRequest{Path: "/docs/drafts"}); err != nil {
+		t.Fatalf("failed to create directories: %s", err)
+	}
+	created, err := client.Create(ctx, &fspb.CreateRequest{Path: "docs/a.txt", Data: []byte("0123456789")})
+	if err != nil {
+		t.Fatalf("failed to create a file: %s", err)
+	}
+	if created.Path != "docs/a.txt" || created.Name != "a.txt" || created.Type != fspb.ItemType_ITEM_TYPE_FILE || created.Size != 10 {
+		t.Errorf("unexpected created item: %v", created)
+	}
+	_, err = client.Create(ctx, &fspb.CreateRequest{Path: "docs/a.txt"})
+	expectStatus(t, err, codes.AlreadyExists, "file-already-exists")
+
+	if content, chunks := read(t, client, &fspb.ReadRequest{Path: "docs/a.txt"}); content != "0123456789" || chunks != 3 {
+		t.Errorf("expected the content in 3 chunks but got %q in %d", content, chunks)
+	}
+	if content, _ := read(t, client, &fspb.ReadRequest{Path: "docs/../docs/a.txt", Offset: 3, Length: 5}); content != "34567" {
+		t.Errorf("expected a range of the content but got %q", content)
+	}
+	if content, _ := read(t, client, &fspb.ReadRequest{Path: "docs/a.txt", Offset: 20}); content != "" {
+		t.Errorf("expected nothing past the end but got %q", content)
+	}
+	stream, _ := client.Read(ctx, &fspb.ReadRequest{Path: "docs"})
+	_, err = stream.Recv()
+	expectStatus(t, err, codes.InvalidArgument, "file-expected")
+	stream, _ = client.Read(ctx, &fspb.ReadRequest{Path: "docs/a.txt", Offset: -1})
+	_, err = stream.Recv()
+	expectStatus(t, err, codes.InvalidArgument, "bad-input")
+
+	writer, err := client.Write(ctx)
+	if err != nil {
+		t.Fatalf("failed to write: %s", err)
+	}
+	writer.Send(&fspb.WriteRequest{Path: "docs/b.txt", Create: true, Data: []byte("hello ")})
+	writer.Send(&fspb.WriteRequest{Data: []byte("world")})
+	written, err := writer.CloseAndRecv()
+	if err != nil || written.Size != 11 {
+		t.Fatalf("expected b.txt to be written but got %v, %v", written, err)
+	}
+	if content, _ := read(t, client, &fspb.ReadRequest{Path: "docs/b.txt"}); content != "hello world" {
+		t.Errorf("unexpected content of b.txt: %q", content)
+	}
+	writer, _ = client.Write(ctx)
+	writer.Send(&fspb.WriteRequest{Path: "docs/missing.txt", Data: []byte("data")})
+	_, err = writer.CloseAndRecv()
+	expectStatus(t, err, codes.NotFound, "not-found")
+
+	lister, err := client.List(ctx, &fspb.ListRequest{Path: "docs"})
+	if err != nil {
+		t.Fatalf("failed to list: %s", err)
+	}
+	listed := make(map[string]fspb.ItemType)
+	for {
+		item, err := lister.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("failed to list: %s", err)
+		}
+		listed[item.Path] = item.Type
+	}
+	if len(listed) != 3 || listed["docs/drafts"] != fspb.ItemType_ITEM_TYPE_DIR || listed["docs/b.txt"] != fspb.ItemType_ITEM_TYPE_FILE {
+		t.Errorf("unexpected listing: %v", listed)
+	}
+
+	moved, err := client.Move(ctx, &fspb.MoveRequest{OldPath: "docs/b.txt", NewPath: "docs/drafts/b.txt"})
+	if err != nil || moved.Path != "docs/drafts/b.txt" {
+		t.Fatalf("expected b.txt to move but got %v, %v", moved, err)
+	}
+	_, err = client.Move(ctx, &fspb.MoveRequest{OldPath: "docs/a.txt", NewPath: "docs/drafts/b.txt"})
+	expectStatus(t, err, codes.AlreadyExists, "file-already-exists")
+	if _, err := client.Stat(ctx, &fspb.StatRequest{Path: "docs/b.txt"}); status.Code(err) != codes.NotFound {
+		t.Errorf("expected b.txt to be gone from its old path but got %v", err)
+	}
+
+	client.Mkdir(ctx, &fspb.MkdirRequest{Path: "keep/me"})
+	_, err = client.Delete(ctx, &fspb.DeleteRequest{Path: "keep", Recursive: true})
+	expectStatus(t, err, codes.PermissionDenied, "protected-path")
+	_, err = client.Move(ctx, &fspb.MoveRequest{OldPath: "keep/me", NewPath: "elsewhere"})
+	expectStatus(t, err, codes.PermissionDenied, "protected-path")
+	_, err = client.Delete(ctx, &fspb.DeleteRequest{Path: "/"})
+	expectStatus(t, err, codes.PermissionDenied, "root-delete-denied")
+	_, err = client.Delete(ctx, &fspb.DeleteRequest{Path: "docs"})
+	expectStatus(t, err, codes.FailedPrecondition, "directory-not-empty")
+	if _, err := client.Delete(ctx, &fspb.DeleteRequest{Path: "docs", Recursive: true}); err != nil {
+		t.Errorf("failed to delete recursively: %s", err)
+	}
+	_, err = client.Stat(ctx, &fspb.StatRequest{Path: "docs/a.txt"})
+	expectStatus(t, err, codes.NotFound, "not-found")
+
+	watcher, _ := client.Watch(ctx, &fspb.WatchRequest{})
+	_, err = watcher.Recv()
+	expectStatus(t, err, codes.Unimplemented, "watch-not-supported")
+}
+
+func TestServiceInterruptedWrite(t *testing.T) {
+	memory := filesystem.NewMemory()
+	staging := t.TempDir()
+	client := dial(t, &fsgrpc.Service{Editor: memory, TempDir: staging})
+	if _, err := client.Create(context.Background(), &fspb.CreateRequest{Path: "a.txt", Data: []byte("original")}); err != nil {
+		t.Fatalf("failed to create a file: %s", err)
+	}
+
+	// staged waits until the number of writes being staged is the expected one.
+	staged := func(expected int) {
+		t.Helper()
+		for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(5 * time.Millisecond) {
+			entries, _ := ioutil.ReadDir(staging)
+			if len(entries) == expected {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("expected %d staged writes but got %d", expected, len(entries))
+			}
+		}
+	}
+	for _, request := range []*fspb.WriteRequest{
+		{Path: "a.txt", Data: []byte("partial")},
+		{Path: "new.txt", Create: true, Data: []byte("partial")},
+	} {
+		ctx, cancel := context.WithCancel(context.Background())
+		writer, err := client.Write(ctx)
+		if err != nil {
+			t.Fatalf("failed to write: %s", err)
+		}
+		writer.Send(request)
+		staged(1)
+		cancel()
+		staged(0)
+	}
+	if content, _ := read(t, client, &fspb.ReadRequest{Path: "a.txt"}); content != "original" {
+		t.Errorf("expected an interrupted write to keep the content but got %q", content)
+	}
+	if _, err := memory.Get("new.txt"); !os.IsNotExist(err) {
+		t.Errorf("expected an interrupted write not to create the file but got %v", err)
+	}
+}
+
+// recorder is a listener keeping the mutations it is told about.
+type recorder struct {
+	mutations []fshttp.Mutation
+}
+
+func (r *recorder) OnMutation(mutation fshttp.Mutation) {
+	r.mutations = append(r.mutations, mutation)
+}
+
+func TestServiceChanges(t *testing.T) {
+	root := filesystem.DirManager{Root: t.TempDir()}
+	trash, err := filesystem.NewTrash(root)
+	if err != nil {
+		t.Fatalf("failed to create trash: %s", err)
+	}
+	quotas := &fshttp.Quotas{Rules: []fshttp.QuotaRule{{Prefix: "docs", MaxBytes: 10}}, Trash: trash}
+	if err := quotas.Init(trash); err != nil {
+		t.Fatalf("failed to measure usage: %s", err)
+	}
+	var output bytes.Buffer
+	key := []byte(strings.Repeat("k", 32))
+	listener := &recorder{}
+	hash, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	client := dial(t, &fsgrpc.Service{
+		Editor:    trash,
+		Trash:     trash,
+		Quotas:    quotas,
+		Audit:     fshttp.NewAuditLog(&output, key, fshttp.AuditRecord{}),
+		Listeners: []fshttp.MutationListener{listener},
+		Auth:      &fshttp.BasicAuth{Users: map[string]string{"alice": string(hash)}},
+	})
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte("alice:secret")))
+	write := func(path, data string) error {
+		writer, err := client.Write(ctx)
+		if err != nil {
+			return err
+		}
+		writer.Send(&fspb.WriteRequest{Path: path, Create: true, Data: []byte(data)})
+		_, err = writer.CloseAndRecv()
+		return err
+	}
+
+	if _, err := client.Mkdir(ctx, &fspb.MkdirRequest{Path: "docs"}); err != nil {
+		t.Fatalf("failed to create a directory: %s", err)
+	}
+	if _, err := client.Create(ctx, &fspb.CreateRequest{Path: "docs/a.txt", Data: []byte("12345")}); err != nil {
+		t.Fatalf("failed to create a file: %s", err)
+	}
+	expectStatus(t, write("docs/a.txt", "0123456789a"), codes.ResourceExhausted, "quota-exceeded")
+	if err := write("docs/a.txt", "123456"); err != nil {
+		t.Errorf("expected a write within the quota to succeed but got %v", err)
+	}
+	if _, err := client.Move(ctx, &fspb.MoveRequest{OldPath: "docs/a.txt", NewPath: "a.txt"}); err != nil {
+		t.Fatalf("failed to move a file out of the quota: %s", err)
+	}
+	if err := write("docs/b.txt", "123456789"); err != nil {
+		t.Errorf("expected the moved file to free its quota but got %v", err)
+	}
+	_, err = client.Move(ctx, &fspb.MoveRequest{OldPath: "a.txt", NewPath: "docs/a.txt"})
+	expectStatus(t, err, codes.ResourceExhausted, "quota-exceeded")
+	if _, err := client.Delete(ctx, &fspb.DeleteRequest{Path: "docs/b.txt"}); err != nil {
+		t.Fatalf("failed to delete a file: %s", err)
+	}
+	// trashed files keep counting until they are purged.
+	_, err = client.Create(ctx, &fspb.CreateRequest{Path: "docs/c.txt", Data: []byte("12")})
+	expectStatus(t, err, codes.ResourceExhausted, "quota-exceeded")
+	if entries, _ := trash.Entries(); len(entries) != 1 || entries[0].DeletedBy != "alice" {
+		t.Errorf("expected b.txt to be trashed by alice but got %+v", entries)
+	}
+
+	var changes []string
+	for _, mutation := range listener.mutations {
+		changes = append(changes, string(mutation.Type)+" "+mutation.Path+" by "+mutation.Actor.Principal)
+	}
+	expected := []string{
+		"create docs by alice", "create docs/a.txt by alice", "write docs/a.txt by alice",
+		"delete docs/a.txt by alice", "create a.txt by alice", "create docs/b.txt by alice", "delete docs/b.txt by alice",
+	}
+	if strings.Join(changes, ", ") != strings.Join(expected, ", ") {
+		t.Errorf("expected the listener to be told\n%v\nbut got\n%v", expected, changes)
+	}
+	last, err := fshttp.VerifyAudit(&output, key, fshttp.AuditRecord{})
+	if err != nil || last.Sequence != uint64(len(expected)) || last.Actor.Principal != "alice" {
+		t.Errorf("expected every change to be audited but got %+v, %v", last, err)
+	}
+}
+
+func TestServiceReadOnly(t *testing.T) {
+	ctx := context.Background()
+	memory := filesystem.NewMemory()
+	memory.CreateDir("docs")
+	client := dial(t, &fsgrpc.Service{Editor: filesystem.ReadOnly{Viewer: memory}})
+
+	if item, err := client.Stat(ctx, &fspb.StatRequest{Path: "docs"}); err != nil || item.Type != fspb.ItemType_ITEM_TYPE_DIR {
+		t.Errorf("expected docs to be served but got %v, %v", item, err)
+	}
+	_, err := client.Create(ctx, &fspb.CreateRequest{Path: "a.txt"})
+	expectStatus(t, err, codes.PermissionDenied, "write-access-denied")
+	_, err = client.Move(ctx, &fspb.MoveRequest{OldPath: "docs", NewPath: "other"})
+	expectStatus(t, err, codes.PermissionDenied, "write-access-denied")
+
+	client = dial(t, &fsgrpc.Service{Editor: filesystem.NewNotifier(memory)})
+	_, err = client.Move(ctx, &fspb.MoveRequest{OldPath: "docs", NewPath: "other"})
+	expectStatus(t, err, codes.Unimplemented, "move-unsupported")
+}
+
+func TestServiceWatch(t *testing.T) {
+	notifier := filesystem.NewNotifier(filesystem.NewMemory())
+	client := dial(t, &fsgrpc.Service{Editor: notifier})
+	first := notifier.Publish(filesystem.Created, "old.txt", "")
+	notifier.Publish(filesystem.Deleted, "old.txt", "")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	stream, err := client.Watch(ctx, &fspb.WatchRequest{Recursive: true, After: first.ID})
+	if err != nil {
+		t.Fatalf("failed to watch: %s", err)
+	}
+	// the replayed event arrives once the subscription exists.
+	event, err := stream.Recv()
+	if err != nil || event.Type != "delete" || event.Path != "old.txt" {
+		t.Fatalf("expected the replayed deletion but got %v, %v", event, err)
+	}
+	if _, err := client.Mkdir(ctx, &fspb.MkdirRequest{Path: "sub"}); err != nil {
+		t.Fatalf("failed to create a directory: %s", err)
+	}
+	if event, err = stream.Recv(); err != nil || event.Type != "create" || event.Path != "sub" || event.Id <= first.ID {
+		t.Errorf("expected the creation of sub but got %v, %v", event, err)
+	}
+}
+
+func TestServiceAuth(t *testing.T) {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	auth := &fshttp.BasicAuth{Users: map[string]string{"alice": string(hash)}}
+	service := &fsgrpc.Service{Editor: filesystem.NewMemory(), Auth: auth}
+	client := dial(t, service)
+	signIn := func(credentials string) context.Context {
+		return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(credentials)))
+	}
+
+	if _, err := client.Stat(context.Background(), &fspb.StatRequest{}); err != nil {
+		t.Errorf("expected anonymous calls to be accepted but got %v", err)
+	}
+	_, err := client.Stat(signIn("alice:wrong"), &fspb.StatRequest{})
+	expectStatus(t, err, codes.Unauthenticated, "unauthorized")
+
+	auth.Required = true
+	_, err = client.Stat(context.Background(), &fspb.StatRequest{})
+	expectStatus(t, err, codes.Unauthenticated, "unauthorized")
+	stream, _ := client.List(context.Background(), &fspb.ListRequest{})
+	_, err = stream.Recv()
+	expectStatus(t, err, codes.Unauthenticated, "unauthorized")
+	if _, err := client.Stat(signIn("alice:secret"), &fspb.StatRequest{}); err != nil {
+		t.Errorf("expected alice to be signed in but got %v", err)
+	}
+
+	auth.Failures = &fshttp.LoginLimit{Rate: fshttp.Rate{Limit: 0.01, Burst: 1}}
+	_, err = client.Stat(signIn("alice:wrong"), &fspb.StatRequest{})
+	expectStatus(t, err, codes.Unauthenticated, "unauthorized")
+	_, err = client.Stat(signIn("alice:secret"), &fspb.StatRequest{})
+	expectStatus(t, err, codes.ResourceExhausted, "rate-limited")
+}
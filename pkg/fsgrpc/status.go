@@ -0,0 +1,164 @@
+package fsgrpc
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"github.com/peymanmortazavi/fs-server/pkg/filesystem"
+	"github.com/peymanmortazavi/fs-server/pkg/fshttp"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// errorDomain is the domain of the ErrorInfo detail of failed calls.
+const errorDomain = "fs-server"
+
+var (
+	unauthenticated = fshttp.Error{
+		Status:        http.StatusUnauthorized,
+		ID:            "unauthorized",
+		UserMessage:   "please sign in to continue.",
+		SystemMessage: "missing or invalid credentials.",
+	}
+
+	tooManyFailures = fshttp.Error{
+		Status:        http.StatusTooManyRequests,
+		ID:            "rate-limited",
+		UserMessage:   "slow down! too many failed sign-ins, please retry later.",
+		SystemMessage: "the client failed to sign in too often.",
+	}
+
+	pathExpected = fshttp.Error{
+		Status:        http.StatusBadRequest,
+		ID:            "bad-input",
+		UserMessage:   "the first message must give the path of the file.",
+		SystemMessage: "the write stream ended before any message.",
+	}
+
+	negativeRange = fshttp.Error{
+		Status:        http.StatusBadRequest,
+		ID:            "bad-input",
+		UserMessage:   "offset and length must not be negative.",
+		SystemMessage: "offset and length must not be negative.",
+	}
+
+	moveUnsupported = fshttp.Error{
+		Status:        http.StatusNotImplemented,
+		ID:            "move-unsupported",
+		UserMessage:   "moving items is not supported by this server.",
+		SystemMessage: "the file system does not implement filesystem.Mover.",
+	}
+
+	crossMountMove = fshttp.Error{
+		Status:        http.StatusConflict,
+		ID:            "cross-mount-move",
+		UserMessage:   "items cannot move to another mount.",
+		SystemMessage: "the old and new paths are served by different mounts.",
+	}
+)
+
+// codeOf returns the status code matching the HTTP status of the error.
+func codeOf(e fshttp.Error) codes.Code {
+	if e.ID == "file-already-exists" {
+		return codes.AlreadyExists
+	}
+	switch e.Status {
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		return codes.Unimplemented
+	case http.StatusConflict, http.StatusPreconditionFailed:
+		return codes.FailedPrecondition
+	case http.StatusRequestEntityTooLarge, http.StatusTooManyRequests, http.StatusInsufficientStorage:
+		return codes.ResourceExhausted
+	}
+	return codes.Internal
+}
+
+// statusOf returns the status answering a call failed with the error, the
+// reason of its ErrorInfo detail being the ID of the matching fshttp.Error.
+func statusOf(e fshttp.Error) error {
+	s := status.New(codeOf(e), e.UserMessage)
+	if detailed, err := s.WithDetails(&errdetails.ErrorInfo{Reason: e.ID, Domain: errorDomain}); err == nil {
+		s = detailed
+	}
+	return s.Err()
+}
+
+// failure returns the status answering a failed operation on the item at the
+// path, logging the failures the API does not expect.
+func failure(operation, path string, err error) error {
+	switch err {
+	case filesystem.MoveUnsupported:
+		return statusOf(moveUnsupported)
+	case filesystem.CrossMountMove:
+		return statusOf(crossMountMove)
+	}
+	e := fshttp.ErrorOf(err)
+	if e.Status == http.StatusInternalServerError {
+		log.Printf("failed to %s %s: %s", operation, path, err)
+	}
+	return statusOf(e)
+}
+
+// authenticate returns the status rejecting the call when Auth is set and the
+// client did not sign in with valid credentials in its authorization
+// metadata, anonymous calls are only rejected when Auth.Required is set.
+func (s *Service) authenticate(ctx context.Context) error {
+	if s.Auth == nil {
+		return nil
+	}
+	name, password, provided := credentials(ctx)
+	if provided {
+		verified, wait := s.Auth.VerifyFrom(remoteAddr(ctx), name, password)
+		if wait > 0 {
+			return statusOf(tooManyFailures)
+		}
+		if verified {
+			return nil
+		}
+	}
+	if provided || s.Auth.Required {
+		return statusOf(unauthenticated)
+	}
+	return nil
+}
+
+// credentials returns the basic authentication credentials in the
+// authorization metadata of the call.
+func credentials(ctx context.Context) (name, password string, provided bool) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	// the metadata carries the same header as an HTTP request.
+	request := http.Request{Header: http.Header{"Authorization": md.Get("authorization")}}
+	return request.BasicAuth()
+}
+
+// remoteAddr returns the address of the client making the call.
+func remoteAddr(ctx context.Context) string {
+	if client, ok := peer.FromContext(ctx); ok {
+		return client.Addr.String()
+	}
+	return ""
+}
+
+// actorOf returns who made an authenticated call, the principal is empty
+// when the call is anonymous or Auth is not set.
+func (s *Service) actorOf(ctx context.Context) fshttp.Actor {
+	actor := fshttp.Actor{RemoteAddr: remoteAddr(ctx)}
+	if s.Auth != nil {
+		if name, _, provided := credentials(ctx); provided {
+			actor.Principal = name
+		}
+	}
+	return actor
+}
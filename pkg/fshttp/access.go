@@ -0,0 +1,151 @@
+package fshttp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// AccessRecord describes a request served by a Handler.
+type AccessRecord struct {
+	Time       time.Time `json:"time"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Status     int       `json:"status"`
+	Error      string    `json:"error,omitempty"`
+	BytesIn    int64     `json:"bytes_in"`
+	BytesOut   int64     `json:"bytes_out"`
+	Duration   float64   `json:"duration_seconds"`
+	RemoteAddr string    `json:"remote_addr"`
+	Principal  string    `json:"principal,omitempty"`
+	RequestID  string    `json:"request_id,omitempty"`
+	TraceID    string    `json:"trace_id,omitempty"`
+}
+
+// AccessLog writes an AccessRecord per request as a line of JSON.
+type AccessLog struct {
+	mu      sync.Mutex
+	encoder *json.Encoder
+}
+
+// NewAccessLog returns an AccessLog writing to the writer.
+func NewAccessLog(writer io.Writer) *AccessLog {
+	return &AccessLog{encoder: json.NewEncoder(writer)}
+}
+
+// write records a served request.
+func (l *AccessLog) write(served exchange) {
+	if l == nil {
+		return
+	}
+	record := AccessRecord{
+		Time:       served.started.UTC(),
+		Method:     served.request.Method,
+		Path:       fullPath(served.request),
+		Status:     served.status,
+		Error:      served.errorID,
+		BytesIn:    served.received,
+		BytesOut:   served.sent,
+		Duration:   served.duration.Seconds(),
+		RemoteAddr: served.request.RemoteAddr,
+		Principal:  served.principal,
+		RequestID:  RequestID(served.request),
+	}
+	if span := trace.SpanContextFromContext(served.request.Context()); span.IsValid() {
+		record.TraceID = span.TraceID().String()
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.encoder.Encode(record); err != nil {
+		log.Printf("failed to write access log: %s", err)
+	}
+}
+
+// exchange describes a request once served, the ID of the error written and
+// the principal authenticated are reported by the handlers serving it.
+type exchange struct {
+	request   *http.Request
+	started   time.Time
+	duration  time.Duration
+	status    int
+	errorID   string
+	principal string
+	received  int64
+	sent      int64
+}
+
+type exchangeKey struct{}
+
+// record serves a request with the handler, counting the bytes read and written.
+func record(writer http.ResponseWriter, request *http.Request, handler http.Handler) exchange {
+	served := &exchange{request: request, started: time.Now(), principal: Principal(request)}
+	body := &countingReader{ReadCloser: request.Body}
+	if request.Body != nil {
+		request.Body = body
+	}
+	counting := &countingWriter{ResponseWriter: writer, status: http.StatusOK}
+	handler.ServeHTTP(counting, request.WithContext(context.WithValue(request.Context(), exchangeKey{}, served)))
+	served.duration = time.Since(served.started)
+	served.status, served.received, served.sent = counting.status, body.count, counting.count
+	return *served
+}
+
+// reportError tells the middleware recording the request the ID of the error
+// written in response.
+func reportError(request *http.Request, id string) {
+	if served, ok := request.Context().Value(exchangeKey{}).(*exchange); ok {
+		served.errorID = id
+	}
+}
+
+type countingReader struct {
+	io.ReadCloser
+	count int64
+}
+
+func (r *countingReader) Read(buffer []byte) (int, error) {
+	n, err := r.ReadCloser.Read(buffer)
+	r.count += int64(n)
+	return n, err
+}
+
+// countingWriter counts the bytes of a response, keeping the ability to flush
+// and hijack the connection used by watch streams.
+type countingWriter struct {
+	http.ResponseWriter
+	status int
+	count  int64
+}
+
+func (w *countingWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *countingWriter) Write(buffer []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(buffer)
+	w.count += int64(n)
+	return n, err
+}
+
+func (w *countingWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *countingWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	return hijacker.Hijack()
+}
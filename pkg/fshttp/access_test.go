@@ -0,0 +1,47 @@
+package fshttp_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/peymanmortazavi/fs-server/pkg/filesystem"
+	"github.com/peymanmortazavi/fs-server/pkg/fshttp"
+)
+
+func TestAccessLog(t *testing.T) {
+	var output bytes.Buffer
+	observer := &fshttp.Observer{AccessLog: fshttp.NewAccessLog(&output)}
+	handler := fshttp.Chain(&fshttp.Handler{Editor: filesystem.NewMemory()}, observer.Middleware)
+
+	create := httptest.NewRequest("POST", "/a.txt", strings.NewReader(`{"type": "file", "data": "hello"}`))
+	create.Header.Set("X-Request-ID", "first")
+	handler.ServeHTTP(httptest.NewRecorder(), fshttp.WithPrincipal(create, "alice"))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/missing", nil))
+
+	decoder := json.NewDecoder(&output)
+	var records []fshttp.AccessRecord
+	for decoder.More() {
+		var record fshttp.AccessRecord
+		if err := decoder.Decode(&record); err != nil {
+			t.Fatalf("failed to decode access record: %s", err)
+		}
+		records = append(records, record)
+	}
+	if len(records) != 2 {
+		t.Fatalf("expected a record per request but got %d", len(records))
+	}
+	created, missing := records[0], records[1]
+	if created.Method != "POST" || created.Path != "/a.txt" || created.Status != http.StatusOK || created.Error != "" {
+		t.Errorf("unexpected record of the creation: %+v", created)
+	}
+	if created.BytesIn != 33 || created.Principal != "alice" || created.RequestID != "first" || created.RemoteAddr == "" || created.Time.IsZero() {
+		t.Errorf("unexpected record of the creation: %+v", created)
+	}
+	if missing.Status != http.StatusNotFound || missing.Error != "not-found" || missing.BytesOut == 0 || missing.Principal != "" {
+		t.Errorf("unexpected record of the missing file: %+v", missing)
+	}
+}
@@ -0,0 +1,206 @@
+package fshttp
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/peymanmortazavi/fs-server/pkg/filesystem"
+)
+
+var auditFailed = Error{
+	Status:        http.StatusInternalServerError,
+	ID:            "audit-failed",
+	UserMessage:   "the change was made but could not be recorded, please contact an administrator.",
+	SystemMessage: "the audit record of the change could not be written.",
+}
+
+// AuditState describes an item before or after a mutation, only files have a
+// size and a digest.
+type AuditState struct {
+	Type   FileType `json:"type"`
+	Size   int64    `json:"size"`
+	SHA256 string   `json:"sha256,omitempty"`
+}
+
+// AuditRecord describes a mutation in the audit log.
+//
+// Records are chained, every one holds the hash of the record before it and
+// is sealed with the HMAC-SHA256 of its JSON encoding without the hash, so
+// changing, removing or reordering records breaks the chain and the chain
+// cannot be rebuilt without the key.
+type AuditRecord struct {
+	Sequence  uint64       `json:"seq"`
+	Time      time.Time    `json:"time"`
+	Type      MutationType `json:"type"`
+	Path      string       `json:"path"`
+	Actor     Actor        `json:"actor"`
+	RequestID string       `json:"request_id,omitempty"`
+	Before    *AuditState  `json:"before,omitempty"`
+	After     *AuditState  `json:"after,omitempty"`
+	Previous  string       `json:"prev"`
+	Hash      string       `json:"hash,omitempty"`
+}
+
+// minAuditKeySize is the minimum size of the key sealing audit records.
+const minAuditKeySize = 32
+
+// digest returns the hash sealing the record with the key.
+func (r AuditRecord) digest(key []byte) (string, error) {
+	r.Hash = ""
+	data, err := json.Marshal(r)
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// LoadAuditKey reads the key sealing audit records from a file, surrounding
+// whitespace is ignored. It should not be stored beside the log, whoever can
+// read it can rewrite the log.
+func LoadAuditKey(path string) ([]byte, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key := bytes.TrimSpace(data)
+	if len(key) < minAuditKeySize {
+		return nil, fmt.Errorf("the audit key in %s is shorter than %d bytes", path, minAuditKeySize)
+	}
+	return key, nil
+}
+
+// AuditLog writes an AuditRecord per mutation as a line of JSON.
+type AuditLog struct {
+	mu     sync.Mutex
+	writer io.Writer
+	key    []byte
+	last   AuditRecord
+
+	// failed is the error of the last write, nil once one succeeds.
+	failed error
+}
+
+// NewAuditLog returns an AuditLog writing to the writer and sealing records
+// with the key, chaining them after the last one already written, which is
+// the zero value for a new log.
+func NewAuditLog(writer io.Writer, key []byte, last AuditRecord) *AuditLog {
+	return &AuditLog{writer: writer, key: key, last: last}
+}
+
+// Append chains the record to the last one, seals it and writes it.
+func (l *AuditLog) Append(record AuditRecord) (AuditRecord, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	record.Sequence = l.last.Sequence + 1
+	record.Previous = l.last.Hash
+	var err error
+	if record.Hash, err = record.digest(l.key); err != nil {
+		return record, err
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return record, err
+	}
+	if _, err := l.writer.Write(append(data, '\n')); err != nil {
+		l.failed = err
+		return record, err
+	}
+	l.last, l.failed = record, nil
+	return record, nil
+}
+
+// AuditCheck fails while the last record could not be written to the audit
+// log, so the server is taken out of rotation until it can be again.
+func AuditCheck(l *AuditLog) HealthCheck {
+	return HealthCheck{Name: "audit", Check: func(context.Context) error {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		return l.failed
+	}}
+}
+
+// VerifyAudit reads an audit log, checking every record is sealed by the key and follows
+// the one before it, the first one following last. When last is the zero
+// value the first record is only checked to be sealed, so a rotated file can
+// be verified on its own.
+//
+// It returns the last valid record along with the first problem found.
+func VerifyAudit(reader io.Reader, key []byte, last AuditRecord) (AuditRecord, error) {
+	decoder := json.NewDecoder(reader)
+	decoder.DisallowUnknownFields()
+	for {
+		var record AuditRecord
+		if err := decoder.Decode(&record); err == io.EOF {
+			return last, nil
+		} else if err != nil {
+			return last, fmt.Errorf("invalid audit record after %d: %s", last.Sequence, err)
+		}
+		if hash, err := record.digest(key); err != nil || hash != record.Hash {
+			return last, fmt.Errorf("audit record %d is not sealed by its hash", record.Sequence)
+		}
+		if last.Hash != "" && (record.Previous != last.Hash || record.Sequence != last.Sequence+1) {
+			return last, fmt.Errorf("audit record %d does not follow record %d", record.Sequence, last.Sequence)
+		}
+		last = record
+	}
+}
+
+// State describes the item at the given path for the audit log, it is nil
+// without an audit log or when nothing is found.
+func (c Changes) State(itemPath string) *AuditState {
+	if c.Audit == nil {
+		return nil
+	}
+	item, err := c.Editor.Get(itemPath)
+	if err != nil {
+		return nil
+	}
+	if item.IsDir() {
+		return &AuditState{Type: DirType}
+	}
+	state := &AuditState{Type: RegularFile, Size: item.Size}
+	if sum, err := c.Digests.Digest(itemPath, item, filesystem.SHA256); err != nil {
+		log.Printf("failed to hash %s for the audit log: %s", itemPath, err)
+	} else {
+		state.SHA256 = hex.EncodeToString(sum)
+	}
+	return state
+}
+
+// audit records a mutation at the given path, before describes the item it
+// changed. It fails with auditFailed when the record cannot be written, the
+// mutation must then not be acknowledged.
+func (c Changes) audit(actor Actor, requestID string, mutationType MutationType, itemPath string, before *AuditState) error {
+	if c.Audit == nil {
+		return nil
+	}
+	record := AuditRecord{
+		Time:      time.Now().UTC(),
+		Type:      mutationType,
+		Path:      itemPath,
+		Actor:     actor,
+		RequestID: requestID,
+		Before:    before,
+	}
+	if mutationType != MutationDelete {
+		record.After = c.State(itemPath)
+	}
+	if _, err := c.Audit.Append(record); err != nil {
+		log.Printf("failed to write the audit record of %s %s: %s", mutationType, itemPath, err)
+		return auditFailed
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package fshttp_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/peymanmortazavi/fs-server/pkg/filesystem"
+	"github.com/peymanmortazavi/fs-server/pkg/fshttp"
+)
+
+func sha256Hex(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+// failingWriter fails every write while failing is set.
+type failingWriter struct {
+	io.Writer
+	failing bool
+}
+
+func (w *failingWriter) Write(data []byte) (int, error) {
+	if w.failing {
+		return 0, errors.New("disk full")
+	}
+	return w.Writer.Write(data)
+}
+
+func TestAudit(t *testing.T) {
+	var output bytes.Buffer
+	key := []byte(strings.Repeat("k", 32))
+	handler := &fshttp.Handler{Editor: filesystem.NewMemory(), Audit: fshttp.NewAuditLog(&output, key, fshttp.AuditRecord{})}
+
+	for _, request := range []struct {
+		method, url, body string
+		status            int
+	}{
+		{"POST", "/a.txt", `{"type": "file", "data": "hello"}`, http.StatusOK},
+		{"PUT", "/a.txt", `{"data": "hello there"}`, http.StatusOK},
+		{"POST", "/a.txt", `{"type": "file", "data": "again"}`, http.StatusBadRequest},
+		{"DELETE", "/a.txt", "", http.StatusOK},
+	} {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, fshttp.WithPrincipal(mustMakeRequest(request.method, request.url, request.body, nil), "alice"))
+		if recorder.Code != request.status {
+			t.Fatalf("expected %s %s to return %d but got %d: %s", request.method, request.url, request.status, recorder.Code, recorder.Body)
+		}
+	}
+
+	log := output.String()
+	last, err := fshttp.VerifyAudit(strings.NewReader(log), key, fshttp.AuditRecord{})
+	if err != nil {
+		t.Fatalf("failed to verify the audit log: %s", err)
+	}
+	if last.Sequence != 3 {
+		t.Fatalf("expected a record per successful mutation but got %d", last.Sequence)
+	}
+	if last.Type != fshttp.MutationDelete || last.Actor.Principal != "alice" || last.After != nil {
+		t.Errorf("unexpected record of the deletion: %+v", last)
+	}
+	if last.Before == nil || last.Before.Size != 11 || last.Before.SHA256 != sha256Hex("hello there") {
+		t.Errorf("expected the deletion to describe the removed file but got %+v", last.Before)
+	}
+
+	lines := strings.SplitAfter(log, "\n")
+	write, err := fshttp.VerifyAudit(strings.NewReader(lines[1]), key, fshttp.AuditRecord{})
+	if err != nil {
+		t.Fatalf("failed to verify a single record: %s", err)
+	}
+	if write.Before == nil || write.Before.SHA256 != sha256Hex("hello") || write.After == nil || write.After.SHA256 != sha256Hex("hello there") {
+		t.Errorf("expected the write to describe the file before and after but got %+v and %+v", write.Before, write.After)
+	}
+
+	// records can be appended after the last one, across restarts.
+	resumed := fshttp.NewAuditLog(&output, key, last)
+	if _, err := resumed.Append(fshttp.AuditRecord{Type: fshttp.MutationCreate, Path: "b"}); err != nil {
+		t.Fatalf("failed to append a record: %s", err)
+	}
+	if last, err := fshttp.VerifyAudit(strings.NewReader(output.String()), key, fshttp.AuditRecord{}); err != nil || last.Sequence != 4 {
+		t.Errorf("expected the resumed log to verify but got %d, %v", last.Sequence, err)
+	}
+
+	for name, tampered := range map[string]string{
+		"changed":   lines[0] + strings.Replace(lines[1], `"size":11`, `"size":12`, 1) + lines[2],
+		"removed":   lines[0] + lines[2],
+		"reordered": lines[1] + lines[0] + lines[2],
+	} {
+		if _, err := fshttp.VerifyAudit(strings.NewReader(tampered), key, fshttp.AuditRecord{}); err == nil {
+			t.Errorf("expected the %s log to fail verification", name)
+		}
+	}
+	if _, err := fshttp.VerifyAudit(strings.NewReader(log), []byte(strings.Repeat("x", 32)), fshttp.AuditRecord{}); err == nil {
+		t.Errorf("expected the log to fail verification with another key")
+	}
+}
+
+func TestAuditFailure(t *testing.T) {
+	writer := &failingWriter{Writer: ioutil.Discard, failing: true}
+	audit := fshttp.NewAuditLog(writer, []byte(strings.Repeat("k", 32)), fshttp.AuditRecord{})
+	handler := &fshttp.Handler{Editor: filesystem.NewMemory(), Audit: audit}
+	health := &fshttp.Health{Readiness: []fshttp.HealthCheck{fshttp.AuditCheck(audit)}}
+	ready := func() int {
+		recorder := httptest.NewRecorder()
+		health.ServeHTTP(recorder, mustMakeGETRequest("http://some.url.com/readyz"))
+		return recorder.Code
+	}
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, mustMakeRequest("POST", "/a.txt", `{"type": "file", "data": "hello"}`, nil))
+	if recorder.Code != http.StatusInternalServerError || !strings.Contains(recorder.Body.String(), "audit-failed") {
+		t.Errorf("expected a mutation that cannot be audited to fail but got %d: %s", recorder.Code, recorder.Body)
+	}
+	if code := ready(); code != http.StatusServiceUnavailable {
+		t.Errorf("expected a failing audit log to fail readiness but got %d", code)
+	}
+
+	writer.failing = false
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, mustMakeRequest("PUT", "/a.txt", `{"data": "hello there"}`, nil))
+	if recorder.Code != http.StatusOK {
+		t.Errorf("expected the write to succeed once the audit log recovers but got %d: %s", recorder.Code, recorder.Body)
+	}
+	if code := ready(); code != http.StatusOK {
+		t.Errorf("expected to be ready once the audit log recovers but got %d", code)
+	}
+}
+
+func TestLoadAuditKey(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{"short": "secret\n", "long": strings.Repeat("k", 32) + "\n"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := fshttp.LoadAuditKey(filepath.Join(dir, "short")); err == nil {
+		t.Errorf("expected a short key to be rejected")
+	}
+	if key, err := fshttp.LoadAuditKey(filepath.Join(dir, "long")); err != nil || string(key) != strings.Repeat("k", 32) {
+		t.Errorf("expected the key without its newline but got %q, %v", key, err)
+	}
+}
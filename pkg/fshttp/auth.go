@@ -0,0 +1,191 @@
+package fshttp
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// unknownUserHash is compared with the passwords of unknown users so they
+// take as long to reject as wrong passwords.
+var unknownUserHash = []byte("$2a$10$Q2odWGuK1lvSj2c29GqsCe/b/jEXtmIgy9C5q3E89jnmF0RwHetzK")
+
+var unauthorizedError = Error{
+	Status:        http.StatusUnauthorized,
+	ID:            "unauthorized",
+	UserMessage:   "please sign in to continue.",
+	SystemMessage: "missing or invalid credentials.",
+}
+
+// BasicAuth authenticates requests with HTTP basic authentication and passes
+// them to Next along with their principal.
+type BasicAuth struct {
+	// Users maps user names to the bcrypt hashes of their passwords.
+	Users map[string]string
+
+	// Realm is sent to clients asking them to authenticate.
+	Realm string
+
+	// Required rejects anonymous requests, they are passed on without a
+	// principal otherwise. Invalid credentials are always rejected.
+	Required bool
+
+	// Failures limits the failed sign-ins of every IP address when set,
+	// clients beyond it are answered with 429 Too Many Requests before their
+	// credentials are verified.
+	Failures *LoginLimit
+
+	Next http.Handler
+}
+
+// LoadUsers reads users from a file with a "name:bcrypt-hash" line per user,
+// as written by htpasswd -B. Empty lines and lines starting with # are ignored.
+func LoadUsers(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	users := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for number := 1; scanner.Scan(); number++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid user on line %d of %s, expected name:bcrypt-hash", number, path)
+		}
+		if _, err := bcrypt.Cost([]byte(parts[1])); err != nil {
+			return nil, fmt.Errorf("invalid password hash on line %d of %s, expected a bcrypt hash: %s", number, path, err)
+		}
+		users[parts[0]] = parts[1]
+	}
+	return users, scanner.Err()
+}
+
+// VerifyFrom returns if the password is the one of the named user like
+// Verify, for a client at the remote address. When the client failed to sign
+// in too often nothing is verified and how long it has to wait is returned.
+func (b *BasicAuth) VerifyFrom(remoteAddr, name, password string) (bool, time.Duration) {
+	if wait := b.Failures.wait(remoteAddr, time.Now()); wait > 0 {
+		return false, wait
+	}
+	if b.Verify(name, password) {
+		return true, 0
+	}
+	b.Failures.fail(remoteAddr, time.Now())
+	return false, 0
+}
+
+// Verify returns if the password is the one of the named user.
+func (b *BasicAuth) Verify(name, password string) bool {
+	hash, known := b.Users[name]
+	if !known {
+		_ = bcrypt.CompareHashAndPassword(unknownUserHash, []byte(password))
+		return false
+	}
+	if verified.remembers(name, hash, password) {
+		return true
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+		return false
+	}
+	verified.remember(name, hash, password)
+	return true
+}
+
+// verified remembers the last password verified for every user, since
+// comparing bcrypt hashes is deliberately slow and clients send their
+// credentials with every request.
+var verified credentialCache
+
+// credentialCache keeps keyed digests of verified passwords, the key is
+// random for every process so the digests are useless outside of it.
+type credentialCache struct {
+	once    sync.Once
+	key     []byte
+	mu      sync.Mutex
+	digests map[string][]byte
+}
+
+func (c *credentialCache) digest(hash, password string) []byte {
+	c.once.Do(func() {
+		key := make([]byte, sha256.Size)
+		if _, err := rand.Read(key); err == nil {
+			c.key = key
+		}
+	})
+	if c.key == nil {
+		// nothing is remembered without a key.
+		return nil
+	}
+	mac := hmac.New(sha256.New, c.key)
+	mac.Write([]byte(hash))
+	mac.Write([]byte{0})
+	mac.Write([]byte(password))
+	return mac.Sum(nil)
+}
+
+// remembers returns if the password was verified against the hash of the user.
+func (c *credentialCache) remembers(name, hash, password string) bool {
+	digest := c.digest(hash, password)
+	if digest == nil {
+		return false
+	}
+	c.mu.Lock()
+	remembered, ok := c.digests[name]
+	c.mu.Unlock()
+	return ok && hmac.Equal(remembered, digest)
+}
+
+func (c *credentialCache) remember(name, hash, password string) {
+	digest := c.digest(hash, password)
+	if digest == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.digests == nil {
+		c.digests = make(map[string][]byte)
+	}
+	c.digests[name] = digest
+}
+
+func (b *BasicAuth) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	name, password, provided := request.BasicAuth()
+	ok := false
+	if provided {
+		var wait time.Duration
+		if ok, wait = b.VerifyFrom(request.RemoteAddr, name, password); wait > 0 {
+			writer.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			writeError(writer, request, rateLimited)
+			return
+		}
+	}
+	if !ok && (provided || b.Required) {
+		realm := b.Realm
+		if realm == "" {
+			realm = "fs-server"
+		}
+		writer.Header().Set("WWW-Authenticate", fmt.Sprintf("Basic realm=%q, charset=\"UTF-8\"", realm))
+		writeError(writer, request, unauthorizedError)
+		return
+	}
+	if ok {
+		request = WithPrincipal(request, name)
+	}
+	b.Next.ServeHTTP(writer, request)
+}
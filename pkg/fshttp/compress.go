@@ -0,0 +1,394 @@
+package fshttp
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+var (
+	unsupportedEncoding = Error{
+		Status:        http.StatusUnsupportedMediaType,
+		ID:            "unsupported-encoding",
+		UserMessage:   "the content encoding of the request is not supported.",
+		SystemMessage: "the content encoding of the request body is not supported, see the Accept-Encoding header.",
+	}
+
+	decodedBodyTooLarge = Error{
+		Status:        http.StatusRequestEntityTooLarge,
+		ID:            "decoded-body-too-large",
+		UserMessage:   "the request body is too large once decoded.",
+		SystemMessage: "the decoded request body exceeds the MaxDecodedSize of the compression.",
+	}
+)
+
+const (
+	// defaultMinCompressSize is the size responses are compressed from when
+	// the Compression has no MinSize.
+	defaultMinCompressSize = 1024
+
+	// DefaultMaxDecodedSize bounds decoded request bodies when the
+	// Compression has no MaxDecodedSize.
+	DefaultMaxDecodedSize = 64 << 20
+)
+
+// Codec compresses and decompresses a content coding.
+type Codec struct {
+	// Name is the content coding, like gzip.
+	Name      string
+	NewWriter func(w io.Writer) (io.WriteCloser, error)
+	NewReader func(r io.Reader) (io.ReadCloser, error)
+}
+
+var (
+	// GzipCodec is the gzip content coding.
+	GzipCodec = Codec{
+		Name:      "gzip",
+		NewWriter: func(w io.Writer) (io.WriteCloser, error) { return gzip.NewWriter(w), nil },
+		NewReader: func(r io.Reader) (io.ReadCloser, error) { return gzip.NewReader(r) },
+	}
+
+	// DeflateCodec is the deflate content coding.
+	DeflateCodec = Codec{
+		Name:      "deflate",
+		NewWriter: func(w io.Writer) (io.WriteCloser, error) { return flate.NewWriter(w, flate.DefaultCompression) },
+		NewReader: func(r io.Reader) (io.ReadCloser, error) { return flate.NewReader(r), nil },
+	}
+
+	// ZstdCodec is the zstd content coding.
+	ZstdCodec = Codec{
+		Name:      "zstd",
+		NewWriter: func(w io.Writer) (io.WriteCloser, error) { return zstd.NewWriter(w, zstd.WithEncoderConcurrency(1)) },
+		NewReader: func(r io.Reader) (io.ReadCloser, error) {
+			decoder, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1), zstd.WithDecoderLowmem(true))
+			if err != nil {
+				return nil, err
+			}
+			return decoder.IOReadCloser(), nil
+		},
+	}
+
+	// BrotliCodec is the br content coding.
+	BrotliCodec = Codec{
+		Name:      "br",
+		NewWriter: func(w io.Writer) (io.WriteCloser, error) { return brotli.NewWriter(w), nil },
+		NewReader: func(r io.Reader) (io.ReadCloser, error) { return ioutil.NopCloser(brotli.NewReader(r)), nil },
+	}
+
+	// DefaultCompressedTypes are the media types of the JSON and text responses
+	// worth compressing.
+	DefaultCompressedTypes = []string{
+		"text/*", "application/json", "application/*+json", "application/xml", "application/*+xml",
+		"application/javascript", "image/svg+xml",
+	}
+)
+
+// Compression compresses responses with the content coding preferred by the
+// Accept-Encoding header of clients, and decodes request bodies sent with a
+// Content-Encoding. Only responses of compressible media types are
+// compressed, neither partial responses nor event streams are.
+type Compression struct {
+	// Codecs are the content codings supported in order of preference,
+	// GzipCodec and DeflateCodec when empty.
+	Codecs []Codec
+
+	// Types are the media types compressed, a * matches any part of a type.
+	// DefaultCompressedTypes when empty.
+	Types []string
+
+	// MinSize is the size of the smallest response compressed, 1KiB when zero.
+	MinSize int
+
+	// MaxDecodedSize bounds the size of request bodies once decoded, reading
+	// beyond it fails with 413 Request Entity Too Large. DefaultMaxDecodedSize
+	// when zero.
+	MaxDecodedSize int64
+}
+
+func (c *Compression) codecs() []Codec {
+	if len(c.Codecs) == 0 {
+		return []Codec{GzipCodec, DeflateCodec}
+	}
+	return c.Codecs
+}
+
+// codec returns the codec of the content coding.
+func (c *Compression) codec(name string) (Codec, bool) {
+	for _, codec := range c.codecs() {
+		if strings.EqualFold(codec.Name, name) {
+			return codec, true
+		}
+	}
+	return Codec{}, false
+}
+
+// negotiate returns the codec with the highest quality in the Accept-Encoding
+// header, the first of them in preference.
+func (c *Compression) negotiate(accept string) (Codec, bool) {
+	qualities := make(map[string]float64)
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		quality := 1.0
+		for _, param := range params[1:] {
+			if pair := strings.SplitN(param, "=", 2); len(pair) == 2 && strings.TrimSpace(pair[0]) == "q" {
+				if parsed, err := strconv.ParseFloat(strings.TrimSpace(pair[1]), 64); err == nil {
+					quality = parsed
+				}
+			}
+		}
+		if name := strings.ToLower(strings.TrimSpace(params[0])); name != "" {
+			qualities[name] = quality
+		}
+	}
+	var best Codec
+	var bestQuality float64
+	for _, codec := range c.codecs() {
+		quality, ok := qualities[strings.ToLower(codec.Name)]
+		if !ok {
+			quality = qualities["*"]
+		}
+		if quality > bestQuality {
+			best, bestQuality = codec, quality
+		}
+	}
+	return best, bestQuality > 0
+}
+
+// compressible returns if responses of the media type are compressed.
+func (c *Compression) compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType == "text/event-stream" {
+		return false
+	}
+	types := c.Types
+	if len(types) == 0 {
+		types = DefaultCompressedTypes
+	}
+	for _, pattern := range types {
+		if matchWildcard(strings.ToLower(pattern), mediaType) {
+			return true
+		}
+	}
+	return false
+}
+
+// Middleware decodes the request bodies and compresses the responses of next.
+func (c *Compression) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if encoding := request.Header.Get("Content-Encoding"); encoding != "" && !strings.EqualFold(encoding, "identity") {
+			decoded, err := c.decode(request, encoding)
+			if err != nil {
+				if err == unsupportedEncoding {
+					names := make([]string, 0, len(c.codecs()))
+					for _, codec := range c.codecs() {
+						names = append(names, codec.Name)
+					}
+					writer.Header().Set("Accept-Encoding", strings.Join(names, ", "))
+				}
+				writeError(writer, request, err.(Error))
+				return
+			}
+			defer decoded.Body.Close()
+			request = decoded
+		}
+
+		writer.Header().Add("Vary", "Accept-Encoding")
+		codec, ok := c.negotiate(request.Header.Get("Accept-Encoding"))
+		if !ok || request.Method == http.MethodHead || request.Header.Get("Range") != "" {
+			next.ServeHTTP(writer, request)
+			return
+		}
+		minSize := c.MinSize
+		if minSize == 0 {
+			minSize = defaultMinCompressSize
+		}
+		compressing := &compressWriter{ResponseWriter: writer, compression: c, codec: codec, minSize: minSize}
+		defer compressing.finish()
+		next.ServeHTTP(compressing, request)
+	})
+}
+
+// decode returns a copy of the request with a body decoded from the content
+// coding.
+func (c *Compression) decode(request *http.Request, encoding string) (*http.Request, error) {
+	codec, ok := c.codec(strings.TrimSpace(encoding))
+	if !ok || request.Body == nil {
+		return nil, unsupportedEncoding
+	}
+	reader, err := codec.NewReader(request.Body)
+	if err != nil {
+		return nil, newBadInputError("the request body is not " + codec.Name + " encoded.")
+	}
+	decoded := request.WithContext(request.Context())
+	decoded.Header = request.Header.Clone()
+	decoded.Header.Del("Content-Encoding")
+	decoded.Header.Del("Content-Length")
+	decoded.ContentLength = -1
+	limit := c.MaxDecodedSize
+	if limit <= 0 {
+		limit = DefaultMaxDecodedSize
+	}
+	decoded.Body = decodedBody{
+		Reader:  &limitedReader{reader: reader, remaining: limit},
+		closers: []io.Closer{reader, request.Body},
+	}
+	return decoded, nil
+}
+
+type decodedBody struct {
+	io.Reader
+	closers []io.Closer
+}
+
+// limitedReader fails with decodedBodyTooLarge once more than remaining bytes
+// are read, so a small compressed body cannot inflate without bounds.
+type limitedReader struct {
+	reader    io.Reader
+	remaining int64
+}
+
+func (r *limitedReader) Read(buffer []byte) (int, error) {
+	if r.remaining < 0 {
+		return 0, decodedBodyTooLarge
+	}
+	if int64(len(buffer)) > r.remaining+1 {
+		buffer = buffer[:r.remaining+1]
+	}
+	n, err := r.reader.Read(buffer)
+	r.remaining -= int64(n)
+	if r.remaining < 0 {
+		// the byte beyond the limit only tells it is exceeded.
+		return n + int(r.remaining), decodedBodyTooLarge
+	}
+	return n, err
+}
+
+func (b decodedBody) Close() error {
+	var first error
+	for _, closer := range b.closers {
+		if err := closer.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// compressWriter buffers the start of a response until it knows whether it is
+// worth compressing, keeping the ability to flush and hijack the connection
+// used by watch streams.
+type compressWriter struct {
+	http.ResponseWriter
+	compression *Compression
+	codec       Codec
+	minSize     int
+
+	status  int
+	buffer  []byte
+	decided bool
+	encoder io.WriteCloser
+}
+
+func (w *compressWriter) WriteHeader(status int) {
+	if w.decided || w.status != 0 {
+		return
+	}
+	w.status = status
+}
+
+func (w *compressWriter) Write(buffer []byte) (int, error) {
+	if !w.decided {
+		w.buffer = append(w.buffer, buffer...)
+		if len(w.buffer) < w.minSize {
+			return len(buffer), nil
+		}
+		if err := w.decide(); err != nil {
+			return 0, err
+		}
+		return len(buffer), nil
+	}
+	if w.encoder != nil {
+		return w.encoder.Write(buffer)
+	}
+	return w.ResponseWriter.Write(buffer)
+}
+
+// decide sends the header, compressing the response when it is large enough
+// and of a compressible type, and writes what was buffered.
+func (w *compressWriter) decide() error {
+	w.decided = true
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	header := w.Header()
+	if header.Get("Content-Type") == "" && len(w.buffer) > 0 {
+		// sniffed now, the compressed content would not be recognized.
+		header.Set("Content-Type", http.DetectContentType(w.buffer))
+	}
+	compress := len(w.buffer) >= w.minSize &&
+		w.status >= 200 && w.status < 300 && w.status != http.StatusNoContent && w.status != http.StatusPartialContent &&
+		header.Get("Content-Range") == "" && header.Get("Content-Encoding") == "" &&
+		w.compression.compressible(header.Get("Content-Type"))
+	if compress {
+		encoder, err := w.codec.NewWriter(w.ResponseWriter)
+		if err != nil {
+			return err
+		}
+		w.encoder = encoder
+		header.Set("Content-Encoding", w.codec.Name)
+		header.Del("Content-Length")
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	buffered := w.buffer
+	w.buffer = nil
+	if len(buffered) == 0 {
+		return nil
+	}
+	_, err := w.Write(buffered)
+	return err
+}
+
+// finish sends what is still buffered and ends the compressed stream.
+func (w *compressWriter) finish() {
+	if !w.decided && (w.status != 0 || len(w.buffer) > 0) {
+		if err := w.decide(); err != nil {
+			return
+		}
+	}
+	if w.encoder != nil {
+		w.encoder.Close()
+	}
+}
+
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		if err := w.decide(); err != nil {
+			return
+		}
+	}
+	if flusher, ok := w.encoder.(interface{ Flush() error }); ok {
+		flusher.Flush()
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	// nothing is left to write once the connection is taken over.
+	w.decided = true
+	return hijacker.Hijack()
+}
@@ -0,0 +1,165 @@
+package fshttp_test
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/peymanmortazavi/fs-server/pkg/filesystem"
+	"github.com/peymanmortazavi/fs-server/pkg/fshttp"
+)
+
+func TestCompression(t *testing.T) {
+	content := strings.Repeat("compressible text ", 200)
+	compression := &fshttp.Compression{}
+	handler := fshttp.Chain(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		switch request.URL.Path {
+		case "/text":
+			writer.Write([]byte(content))
+		case "/small":
+			writer.Write([]byte(`{"small": true}`))
+		case "/image":
+			writer.Header().Set("Content-Type", "image/png")
+			writer.Write([]byte(content))
+		case "/partial":
+			writer.Header().Set("Content-Range", "bytes 0-9/100")
+			writer.WriteHeader(http.StatusPartialContent)
+			writer.Write([]byte(content))
+		}
+	}), compression.Middleware)
+
+	serve := func(path, accept string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest("GET", path, nil)
+		if accept != "" {
+			request.Header.Set("Accept-Encoding", accept)
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	gzipped := serve("/text", "deflate;q=0.5, gzip")
+	if gzipped.Header().Get("Content-Encoding") != "gzip" || !strings.HasPrefix(gzipped.Header().Get("Content-Type"), "text/plain") {
+		t.Fatalf("expected the text to be gzipped but got %v", gzipped.Header())
+	}
+	reader, err := gzip.NewReader(gzipped.Body)
+	if err != nil {
+		t.Fatalf("failed to read the gzipped response: %s", err)
+	}
+	if decoded, _ := ioutil.ReadAll(reader); string(decoded) != content {
+		t.Errorf("unexpected content of the gzipped response: %q", decoded)
+	}
+
+	deflated := serve("/text", "gzip;q=0, *")
+	if deflated.Header().Get("Content-Encoding") != "deflate" {
+		t.Fatalf("expected the text to be deflated but got %v", deflated.Header())
+	}
+	if decoded, _ := ioutil.ReadAll(flate.NewReader(deflated.Body)); string(decoded) != content {
+		t.Errorf("unexpected content of the deflated response: %q", decoded)
+	}
+
+	for path, accept := range map[string]string{
+		"/text":    "",
+		"/small":   "gzip",
+		"/image":   "gzip",
+		"/partial": "gzip",
+	} {
+		recorder := serve(path, accept)
+		if recorder.Header().Get("Content-Encoding") != "" || recorder.Header().Get("Vary") != "Accept-Encoding" {
+			t.Errorf("expected %s accepting %q to be sent as is but got %v", path, accept, recorder.Header())
+		}
+	}
+	if partial := serve("/partial", "gzip"); partial.Code != http.StatusPartialContent || partial.Body.String() != content {
+		t.Errorf("unexpected partial response: %d", partial.Code)
+	}
+}
+
+func TestCompressedUpload(t *testing.T) {
+	memory := filesystem.NewMemory()
+	compression := &fshttp.Compression{}
+	handler := fshttp.Chain(&fshttp.Handler{Editor: memory}, compression.Middleware)
+
+	var body bytes.Buffer
+	encoder := gzip.NewWriter(&body)
+	encoder.Write([]byte(`{"type": "file", "data": "hello"}`))
+	encoder.Close()
+	request := httptest.NewRequest("POST", "/a.txt", &body)
+	request.Header.Set("Content-Encoding", "gzip")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("failed to create a file with a gzipped body: %d %s", recorder.Code, recorder.Body.String())
+	}
+	if item, err := memory.Get("a.txt"); err != nil || item.Size != 5 {
+		t.Errorf("expected the body to be decoded but got %+v, %v", item, err)
+	}
+
+	for encoding, status := range map[string]int{"lz4": http.StatusUnsupportedMediaType, "gzip": http.StatusBadRequest} {
+		request := httptest.NewRequest("POST", "/b.txt", strings.NewReader(`{"type": "file"}`))
+		request.Header.Set("Content-Encoding", encoding)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		if recorder.Code != status {
+			t.Errorf("expected a body claiming to be %s to be answered with %d but got %d", encoding, status, recorder.Code)
+		}
+	}
+}
+
+func TestCompressionCodecs(t *testing.T) {
+	content := strings.Repeat("compressible text ", 200)
+	for _, codec := range []fshttp.Codec{fshttp.ZstdCodec, fshttp.BrotliCodec} {
+		compression := &fshttp.Compression{Codecs: []fshttp.Codec{codec}}
+		handler := compression.Middleware(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			writer.Write([]byte(content))
+		}))
+		request := httptest.NewRequest("GET", "/", nil)
+		request.Header.Set("Accept-Encoding", "gzip, "+codec.Name)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		if recorder.Header().Get("Content-Encoding") != codec.Name {
+			t.Fatalf("expected the response to be encoded with %s but got %v", codec.Name, recorder.Header())
+		}
+		reader, err := codec.NewReader(recorder.Body)
+		if err != nil {
+			t.Fatalf("failed to read the %s response: %s", codec.Name, err)
+		}
+		decoded, _ := ioutil.ReadAll(reader)
+		reader.Close()
+		if string(decoded) != content {
+			t.Errorf("unexpected content of the %s response: %q", codec.Name, decoded)
+		}
+	}
+}
+
+func TestDecodedSizeLimit(t *testing.T) {
+	memory := filesystem.NewMemory()
+	compression := &fshttp.Compression{MaxDecodedSize: 1024}
+	handler := fshttp.Chain(&fshttp.Handler{Editor: memory}, compression.Middleware)
+
+	upload := func(data string) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		encoder := gzip.NewWriter(&body)
+		encoder.Write([]byte(`{"type": "file", "data": "` + data + `"}`))
+		encoder.Close()
+		request := httptest.NewRequest("POST", "/a.txt", &body)
+		request.Header.Set("Content-Encoding", "gzip")
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	if recorder := upload(strings.Repeat("a", 4096)); recorder.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected a body inflating beyond the limit to be rejected but got %d %s", recorder.Code, recorder.Body.String())
+	}
+	if _, err := memory.Get("a.txt"); err == nil {
+		t.Errorf("expected no file to be created from a rejected body")
+	}
+	if recorder := upload(strings.Repeat("a", 512)); recorder.Code != http.StatusOK {
+		t.Errorf("expected a body within the limit to be accepted but got %d %s", recorder.Code, recorder.Body.String())
+	}
+}
@@ -0,0 +1,191 @@
+package fshttp
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var corsDenied = Error{
+	Status:        http.StatusForbidden,
+	ID:            "cors-denied",
+	UserMessage:   "this site is not allowed to make this request.",
+	SystemMessage: "the origin, method or headers of the preflight request are not allowed.",
+}
+
+var (
+	// DefaultCORSMethods are the methods served by a Handler.
+	DefaultCORSMethods = []string{http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPost, http.MethodPatch, http.MethodPut, http.MethodDelete}
+
+	// DefaultCORSHeaders are the request headers read by a Handler.
+	DefaultCORSHeaders = []string{
+		"Authorization", "Content-Type", "Content-Digest", "Want-Digest", "Want-Content-Digest", "Last-Event-ID",
+		"Tus-Resumable", "Upload-Length", "Upload-Offset", "Upload-Checksum", RequestIDHeader, "traceparent",
+	}
+
+	// DefaultCORSExposedHeaders are the response headers of a Handler scripts
+	// need to read.
+	DefaultCORSExposedHeaders = []string{
+		"Location", "Digest", "Content-Digest", RequestIDHeader,
+		"Tus-Resumable", "Tus-Version", "Tus-Extension", "Tus-Max-Size", "Tus-Checksum-Algorithm",
+		"Upload-Offset", "Upload-Length", "Upload-Expires",
+	}
+)
+
+// CORS lets browsers call the handlers it wraps from the pages of other
+// origins. Preflight requests are answered without reaching the handlers, so
+// they are never rejected for lacking credentials.
+type CORS struct {
+	// AllowedOrigins are the origins allowed, like https://app.example.com. A
+	// * matches any part of an origin, so https://*.example.com allows every
+	// subdomain and * allows every origin.
+	AllowedOrigins []string
+
+	// AllowedMethods and AllowedHeaders are the methods and request headers
+	// allowed, the defaults when empty. A * in AllowedHeaders allows every
+	// header.
+	AllowedMethods []string
+	AllowedHeaders []string
+
+	// ExposedHeaders are the response headers scripts can read, the defaults
+	// when empty.
+	ExposedHeaders []string
+
+	// AllowCredentials lets requests carry cookies and authorization headers.
+	AllowCredentials bool
+
+	// MaxAge is how long browsers cache the answer to a preflight request,
+	// the browser decides when zero.
+	MaxAge time.Duration
+}
+
+// Middleware answers preflight requests and allows the other requests of
+// allowed origins to reach next.
+func (c *CORS) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		origin := request.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(writer, request)
+			return
+		}
+		header := writer.Header()
+		header.Add("Vary", "Origin")
+		preflight := request.Method == http.MethodOptions && request.Header.Get("Access-Control-Request-Method") != ""
+		if preflight {
+			header.Add("Vary", "Access-Control-Request-Method")
+			header.Add("Vary", "Access-Control-Request-Headers")
+			c.preflight(writer, request, origin)
+			return
+		}
+		if c.allowsOrigin(origin) {
+			c.allow(header, origin)
+			header.Set("Access-Control-Expose-Headers", strings.Join(orDefault(c.ExposedHeaders, DefaultCORSExposedHeaders), ", "))
+		}
+		next.ServeHTTP(writer, request)
+	})
+}
+
+// preflight answers whether the request described by a preflight request is
+// allowed.
+func (c *CORS) preflight(writer http.ResponseWriter, request *http.Request, origin string) {
+	methods := orDefault(c.AllowedMethods, DefaultCORSMethods)
+	method := request.Header.Get("Access-Control-Request-Method")
+	headers := requestedHeaders(request)
+	if !c.allowsOrigin(origin) || !contains(methods, method, false) || !c.allowsHeaders(headers) {
+		writeError(writer, request, corsDenied)
+		return
+	}
+	header := writer.Header()
+	c.allow(header, origin)
+	header.Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+	if len(headers) > 0 {
+		header.Set("Access-Control-Allow-Headers", strings.Join(headers, ", "))
+	}
+	if c.MaxAge > 0 {
+		header.Set("Access-Control-Max-Age", strconv.Itoa(int(c.MaxAge.Seconds())))
+	}
+	writer.WriteHeader(http.StatusNoContent)
+}
+
+// allow lets the origin read the response. The origin is echoed rather than
+// answering *, which browsers refuse along with credentials.
+func (c *CORS) allow(header http.Header, origin string) {
+	header.Set("Access-Control-Allow-Origin", origin)
+	if c.AllowCredentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+func (c *CORS) allowsOrigin(origin string) bool {
+	for _, pattern := range c.AllowedOrigins {
+		if matchWildcard(strings.ToLower(pattern), strings.ToLower(origin)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *CORS) allowsHeaders(headers []string) bool {
+	allowed := orDefault(c.AllowedHeaders, DefaultCORSHeaders)
+	if contains(allowed, "*", false) {
+		return true
+	}
+	for _, header := range headers {
+		if !contains(allowed, header, true) {
+			return false
+		}
+	}
+	return true
+}
+
+// requestedHeaders returns the headers listed by a preflight request.
+func requestedHeaders(request *http.Request) []string {
+	var headers []string
+	for _, value := range request.Header.Values("Access-Control-Request-Headers") {
+		for _, header := range strings.Split(value, ",") {
+			if header = strings.TrimSpace(header); header != "" {
+				headers = append(headers, header)
+			}
+		}
+	}
+	return headers
+}
+
+// matchWildcard returns if the value matches the pattern, where every * matches
+// any sequence of characters.
+func matchWildcard(pattern, value string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == value
+	}
+	if !strings.HasPrefix(value, parts[0]) {
+		return false
+	}
+	value = value[len(parts[0]):]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(value, part)
+		if i < 0 {
+			return false
+		}
+		value = value[i+len(part):]
+	}
+	last := parts[len(parts)-1]
+	return len(value) >= len(last) && strings.HasSuffix(value, last)
+}
+
+func orDefault(values, defaults []string) []string {
+	if len(values) == 0 {
+		return defaults
+	}
+	return values
+}
+
+func contains(values []string, value string, foldCase bool) bool {
+	for _, v := range values {
+		if v == value || foldCase && strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,75 @@
+package fshttp_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/peymanmortazavi/fs-server/pkg/filesystem"
+	"github.com/peymanmortazavi/fs-server/pkg/fshttp"
+)
+
+func TestCORS(t *testing.T) {
+	cors := &fshttp.CORS{
+		AllowedOrigins:   []string{"https://app.example.com", "https://*.preview.example.com"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	}
+	auth := fshttp.BasicAuth{Users: map[string]string{}, Required: true}
+	handler := fshttp.Chain(&fshttp.Handler{Editor: filesystem.NewMemory()}, cors.Middleware, auth.Middleware)
+
+	serve := func(method, origin string, headers map[string]string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, "/a.txt", nil)
+		if origin != "" {
+			request.Header.Set("Origin", origin)
+		}
+		for key, value := range headers {
+			request.Header.Set(key, value)
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	preflight := serve("OPTIONS", "https://pr-12.preview.example.com", map[string]string{
+		"Access-Control-Request-Method":  "PUT",
+		"Access-Control-Request-Headers": "authorization, upload-offset",
+	})
+	header := preflight.Header()
+	if preflight.Code != http.StatusNoContent ||
+		header.Get("Access-Control-Allow-Origin") != "https://pr-12.preview.example.com" ||
+		header.Get("Access-Control-Allow-Credentials") != "true" ||
+		header.Get("Access-Control-Allow-Headers") != "authorization, upload-offset" ||
+		header.Get("Access-Control-Allow-Methods") == "" ||
+		header.Get("Access-Control-Max-Age") != "600" {
+		t.Errorf("expected the preflight request to be allowed without credentials but got %d %v", preflight.Code, header)
+	}
+
+	for name, headers := range map[string]map[string]string{
+		"https://evil.example.com":          {"Access-Control-Request-Method": "GET"},
+		"https://app.example.com.evil.com":  {"Access-Control-Request-Method": "GET"},
+		"https://app.example.com":           {"Access-Control-Request-Method": "TRACE"},
+		"https://preview.example.com":       {"Access-Control-Request-Method": "GET"},
+		"https://a.preview.example.com:443": {"Access-Control-Request-Method": "GET", "Access-Control-Request-Headers": "x-unknown"},
+	} {
+		denied := serve("OPTIONS", name, headers)
+		if denied.Code != http.StatusForbidden || denied.Header().Get("Access-Control-Allow-Origin") != "" {
+			t.Errorf("expected the preflight request from %s with %v to be denied but got %d %v", name, headers, denied.Code, denied.Header())
+		}
+	}
+
+	rejected := serve("GET", "https://app.example.com", nil)
+	if rejected.Code != http.StatusUnauthorized || rejected.Header().Get("Access-Control-Allow-Origin") != "https://app.example.com" || rejected.Header().Get("Access-Control-Expose-Headers") == "" {
+		t.Errorf("expected the rejection to be readable by the allowed origin but got %d %v", rejected.Code, rejected.Header())
+	}
+	if other := serve("GET", "https://evil.example.com", nil); other.Header().Get("Access-Control-Allow-Origin") != "" || other.Header().Get("Vary") != "Origin" {
+		t.Errorf("expected no CORS headers for another origin but got %v", other.Header())
+	}
+	if plain := serve("GET", "", nil); plain.Header().Get("Vary") != "" {
+		t.Errorf("expected requests without an origin to be left alone but got %v", plain.Header())
+	}
+	if options := serve("OPTIONS", "https://app.example.com", nil); options.Code != http.StatusUnauthorized {
+		t.Errorf("expected an OPTIONS request that is not a preflight to reach the handler but got %d", options.Code)
+	}
+}
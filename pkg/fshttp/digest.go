@@ -0,0 +1,112 @@
+package fshttp
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/peymanmortazavi/fs-server/pkg/filesystem"
+)
+
+const (
+	wantDigestHeader        = "Want-Digest"
+	wantContentDigestHeader = "Want-Content-Digest"
+	digestHeader            = "Digest"
+	contentDigestHeader     = "Content-Digest"
+)
+
+// digestTokens maps algorithms to their names in the Digest (RFC 3230) and
+// Content-Digest (RFC 9530) headers.
+var digestTokens = map[filesystem.DigestAlgorithm][2]string{
+	filesystem.SHA256: {"SHA-256", "sha-256"},
+	filesystem.SHA1:   {"SHA", "sha"},
+	filesystem.MD5:    {"MD5", "md5"},
+	filesystem.CRC32C: {"CRC32C", "crc32c"},
+}
+
+// preferredDigest picks the supported algorithm with the highest q-value from
+// a Want-Digest or Want-Content-Digest header value.
+func preferredDigest(value string) (filesystem.DigestAlgorithm, bool) {
+	var (
+		best    filesystem.DigestAlgorithm
+		bestQ   = 0.0
+		matched = false
+	)
+	for _, part := range strings.Split(value, ",") {
+		name, q := strings.TrimSpace(part), 1.0
+		if i := strings.IndexAny(name, ";="); i >= 0 {
+			weight := strings.TrimPrefix(strings.TrimSpace(name[i+1:]), "q=")
+			name = strings.TrimSpace(name[:i])
+			if parsed, err := strconv.ParseFloat(weight, 64); err == nil {
+				q = parsed
+			}
+		}
+		algorithm, err := filesystem.ParseDigestAlgorithm(name)
+		if err != nil || q <= 0 {
+			continue
+		}
+		if !matched || q > bestQ {
+			best, bestQ, matched = algorithm, q, true
+		}
+	}
+	return best, matched
+}
+
+// setDigestHeaders sets Digest and/or Content-Digest response headers for a file
+// when the client asked for them.
+func (h *Handler) setDigestHeaders(writer http.ResponseWriter, request *http.Request, path string, item filesystem.Item) error {
+	for i, header := range [2]string{wantDigestHeader, wantContentDigestHeader} {
+		want := request.Header.Get(header)
+		if want == "" {
+			continue
+		}
+		algorithm, ok := preferredDigest(want)
+		if !ok {
+			continue
+		}
+		sum, err := h.Digests.Digest(path, item, algorithm)
+		if err != nil {
+			return err
+		}
+		encoded := base64.StdEncoding.EncodeToString(sum)
+		if i == 0 {
+			writer.Header().Set(digestHeader, digestTokens[algorithm][0]+"="+encoded)
+		} else {
+			writer.Header().Set(contentDigestHeader, digestTokens[algorithm][1]+"=:"+encoded+":")
+		}
+	}
+	return nil
+}
+
+// verifyChecksum makes sure data matches the expected checksum if there is one.
+func verifyChecksum(expected *Checksum, data string) error {
+	if expected == nil {
+		return nil
+	}
+	algorithm, err := filesystem.ParseDigestAlgorithm(expected.Algorithm)
+	if err != nil {
+		return unsupportedChecksum
+	}
+	want, err := hex.DecodeString(expected.Value)
+	if err != nil {
+		return newBadInputError("checksum value must be hex encoded.")
+	}
+	h, _ := algorithm.NewHash()
+	h.Write([]byte(data))
+	if !bytes.Equal(h.Sum(nil), want) {
+		return checksumMismatch
+	}
+	return nil
+}
+
+// checksumOf returns the checksum of a file item in the FileItem format.
+func (h *Handler) checksumOf(path string, item filesystem.Item, algorithm filesystem.DigestAlgorithm) (*Checksum, error) {
+	sum, err := h.Digests.Digest(path, item, algorithm)
+	if err != nil {
+		return nil, err
+	}
+	return &Checksum{Algorithm: string(algorithm), Value: hex.EncodeToString(sum)}, nil
+}
@@ -1,6 +1,11 @@
 package fshttp
 
-import "net/http"
+import (
+	"net/http"
+	"os"
+
+	"github.com/peymanmortazavi/fs-server/pkg/filesystem"
+)
 
 var (
 	methodNotAllowedError = Error{
@@ -17,6 +22,13 @@ var (
 		SystemMessage: "unexpected server error occurred.",
 	}
 
+	corruptedFile = Error{
+		Status:        http.StatusInternalServerError,
+		ID:            "corrupted-file",
+		UserMessage:   "oops! the file cannot be read, it is damaged on our end.",
+		SystemMessage: "the stored content failed to decrypt or decompress, or its key is missing.",
+	}
+
 	notFoundError = Error{
 		Status:        http.StatusNotFound,
 		ID:            "not-found",
@@ -52,12 +64,47 @@ var (
 		SystemMessage: "you do not have permission to delete file or dir.",
 	}
 
+	rootDeleteDenied = Error{
+		Status:        http.StatusForbidden,
+		ID:            "root-delete-denied",
+		UserMessage:   "the root directory cannot be deleted.",
+		SystemMessage: "deleting the served root is not allowed.",
+	}
+
+	protectedPathDenied = Error{
+		Status:        http.StatusForbidden,
+		ID:            "protected-path",
+		UserMessage:   "this item is protected and cannot be deleted.",
+		SystemMessage: "the path is, or contains, a protected path.",
+	}
+
+	directoryNotEmpty = Error{
+		Status:        http.StatusConflict,
+		ID:            "directory-not-empty",
+		UserMessage:   "the directory is not empty, delete it recursively to remove everything in it.",
+		SystemMessage: "deleting a non-empty directory requires recursive=true.",
+	}
+
 	fileAlreadyExists = Error{
 		Status:        http.StatusBadRequest,
 		ID:            "file-already-exists",
 		UserMessage:   "this file already exists at the given path, cannot create a new one.",
 		SystemMessage: "this file already exists at the given path, cannot create a new one.",
 	}
+
+	checksumMismatch = Error{
+		Status:        http.StatusBadRequest,
+		ID:            "checksum-mismatch",
+		UserMessage:   "the data does not match the expected checksum, nothing was written.",
+		SystemMessage: "digest of the request data does not match the expected checksum.",
+	}
+
+	unsupportedChecksum = Error{
+		Status:        http.StatusBadRequest,
+		ID:            "unsupported-checksum",
+		UserMessage:   "unsupported checksum algorithm, use one of sha256, sha1, md5 or crc32c.",
+		SystemMessage: "unsupported checksum algorithm, use one of sha256, sha1, md5 or crc32c.",
+	}
 )
 
 func newBadInputError(message string) Error {
@@ -69,6 +116,29 @@ func newBadInputError(message string) Error {
 	}
 }
 
+// ErrorOf returns the Error the API answers a failed file system operation
+// with, an internal server error when the failure is unexpected.
+func ErrorOf(err error) Error {
+	if e, ok := err.(Error); ok {
+		return e
+	}
+	switch {
+	case os.IsNotExist(err):
+		return notFoundError
+	case isPermission(err):
+		return writeAccessDenied
+	case filesystem.IsFileAlreadyExists(err):
+		return fileAlreadyExists
+	case err == filesystem.NotRegularFile:
+		return fileExpected
+	case err == filesystem.WatchUnsupported:
+		return watchNotSupported
+	case filesystem.IsCorrupted(err):
+		return corruptedFile
+	}
+	return internalServerError
+}
+
 // Error holds information about an error.
 // TODO add http status here.
 type Error struct {
@@ -76,6 +146,9 @@ type Error struct {
 	ID            string `json:"id,omitempty"`
 	UserMessage   string `json:"user_message,omitempty"`
 	SystemMessage string `json:"system_message,omitempty"`
+
+	// RequestID is the ID of the request that failed, set once written.
+	RequestID string `json:"request_id,omitempty"`
 }
 
 func (e Error) Error() string {
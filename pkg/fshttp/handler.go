@@ -6,6 +6,7 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"path"
 	"strings"
 
 	"github.com/peymanmortazavi/fs-server/pkg/filesystem"
@@ -14,45 +15,192 @@ import (
 // Handler provides an HTTP interface to a file system handler.
 type Handler struct {
 	filesystem.Editor
+
+	// Viewer is served when the Editor is not set. The handler is then
+	// read-only, as it is when the Editor is a filesystem.ReadOnly, and
+	// answers mutations with 405 Method Not Allowed.
+	Viewer filesystem.Viewer
+
+	// Digests caches file digests served via checksum queries and digest
+	// headers, it is optional.
+	Digests *filesystem.DigestCache
+
+	// Uploads enables resumable uploads when set.
+	Uploads *Uploads
+
+	// Watcher streams changes to clients, the Editor is used when it is a
+	// filesystem.Watcher and this is not set.
+	Watcher filesystem.Watcher
+
+	// Listeners are notified after every successful mutation.
+	Listeners []MutationListener
+
+	// Index answers searches when set, otherwise every search walks the tree
+	// reading at most SearchConcurrency directories or files at once.
+	Index             *filesystem.Index
+	SearchConcurrency int
+
+	// Quotas limits the storage used by changes when set.
+	Quotas *Quotas
+
+	// Usage caches the disk usage served via usage queries, it is invalidated
+	// by the changes made through the Handler. Usage is measured for every
+	// request when it is not set.
+	Usage *filesystem.UsageCache
+
+	// Trash keeps deleted items so they can be restored when set. It should
+	// also be the Editor so the trash directory is hidden.
+	Trash *filesystem.Trash
+
+	// Versions keeps previous content of files so it can be read and restored
+	// when set. It should also be the Editor, or be decorated by it, so
+	// overwrites and deletes are versioned.
+	Versions *filesystem.Versioned
+
+	// Protected lists paths that can never be deleted, neither can the
+	// directories containing them.
+	Protected []string
+
+	// Administrators are the principals allowed to delete permanently and
+	// to purge the trash.
+	Administrators []string
+
+	// Audit records every mutation when set.
+	Audit *AuditLog
 }
 
-func writeError(writer http.ResponseWriter, e Error) {
+func writeError(writer http.ResponseWriter, request *http.Request, e Error) {
+	e.RequestID = RequestID(request)
+	reportError(request, e.ID)
+	writer.Header().Set("Content-Type", "application/json")
 	writer.WriteHeader(e.Status)
 	if err := json.NewEncoder(writer).Encode(e); err != nil {
 		log.Printf("failed to write error %s: %s", e, err)
 	}
 }
 
-// Serve writes the response to the HTTP response.
+// writeJSON writes value as the JSON body of the response.
+func writeJSON(writer http.ResponseWriter, value interface{}) error {
+	writer.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(writer).Encode(value)
+}
+
+// readOnlyMethods are the methods served by a read-only handler.
+var readOnlyMethods = []string{http.MethodGet, http.MethodHead, http.MethodOptions}
+
+// viewer returns the Editor, or the Viewer of a read-only handler.
+func (h *Handler) viewer() filesystem.Viewer {
+	if h.Editor != nil {
+		return h.Editor
+	}
+	return h.Viewer
+}
+
+// readOnly returns if the handler rejects every mutation.
+func (h *Handler) readOnly() bool {
+	if h.Editor == nil {
+		return true
+	}
+	_, ok := h.Editor.(filesystem.ReadOnly)
+	return ok
+}
+
+// isPermission returns if the error is a change the file system does not allow.
+func isPermission(err error) bool {
+	return os.IsPermission(err) || filesystem.IsReadOnly(err)
+}
+
+// cleanPath returns the request with a clean path, so nothing outside of the
+// served tree is reached through dot-dot elements whatever serves the handler.
+func cleanPath(request *http.Request) *http.Request {
+	cleaned := path.Clean("/" + request.URL.Path)
+	if cleaned == request.URL.Path {
+		return request
+	}
+	copied := *request
+	url := *request.URL
+	url.Path, url.RawPath = cleaned, ""
+	copied.URL = &url
+	return &copied
+}
+
+// Serve writes the response to the HTTP response. The file system operations
+// are traced when an Observer started a span for the request.
 func (h *Handler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	request = withRequestID(writer, cleanPath(request))
+	h.traced(request.Context()).serve(writer, request)
+}
+
+// serve writes the response.
+func (h *Handler) serve(writer http.ResponseWriter, request *http.Request) {
 	var err error
-	switch request.Method {
+	upload := isUploadRequest(request)
+	method := request.Method
+	if h.readOnly() && !isReadOnlyMethod(method) {
+		method = ""
+	}
+	switch method {
 	case http.MethodPost:
-		err = h.handlePost(writer, request)
+		switch {
+		case upload:
+			err = h.handleUploadCreate(writer, request)
+		case request.URL.Query().Get("restore") != "":
+			err = h.handleRestore(writer, request)
+		default:
+			err = h.handlePost(writer, request)
+		}
+	case http.MethodPatch:
+		err = h.handleUploadPatch(writer, request)
 	case http.MethodPut:
 		err = h.handlePut(writer, request)
 	case http.MethodDelete:
-		err = h.handleDelete(writer, request)
+		if upload {
+			err = h.handleUploadDelete(writer, request)
+		} else {
+			err = h.handleDelete(writer, request)
+		}
+	case http.MethodHead:
+		if upload {
+			err = h.handleUploadHead(writer, request)
+		} else {
+			err = h.handleGet(writer, request)
+		}
+	case http.MethodOptions:
+		err = h.handleUploadOptions(writer, request)
 	case http.MethodGet:
 		err = h.handleGet(writer, request)
 	default:
-		writeError(writer, methodNotAllowedError)
+		allowed := strings.Join(readOnlyMethods, ", ")
+		if !h.readOnly() {
+			allowed += ", POST, PATCH, PUT, DELETE"
+		}
+		writer.Header().Set("Allow", allowed)
+		err = methodNotAllowedError
 	}
 
-	if err != nil {
-		switch err := err.(type) {
-		case Error:
-			writeError(writer, err)
-		default:
-			writeError(writer, internalServerError)
+	if err == nil {
+		return
+	}
+	e, ok := err.(Error)
+	if !ok {
+		e = internalServerError
+	}
+	writeError(writer, request, e)
+}
+
+func isReadOnlyMethod(method string) bool {
+	for _, allowed := range readOnlyMethods {
+		if method == allowed {
+			return true
 		}
 	}
+	return false
 }
 
 func writeToFile(opener filesystem.Opener, data string) error {
-	file, err := opener.Open(os.O_CREATE | os.O_RDWR)
+	file, err := opener.Open(os.O_CREATE | os.O_WRONLY | os.O_TRUNC)
 	if err != nil {
-		if os.IsPermission(err) {
+		if isPermission(err) {
 			return writeAccessDenied
 		}
 		return internalServerError
@@ -64,20 +212,42 @@ func writeToFile(opener filesystem.Opener, data string) error {
 	return nil
 }
 
+// decodeJSON decodes the JSON body of a request, failing with jsonExpected
+// unless reading the body failed with an Error of its own.
+func decodeJSON(request *http.Request, value interface{}) error {
+	if err := json.NewDecoder(request.Body).Decode(value); err != nil {
+		if e, ok := err.(Error); ok {
+			return e
+		}
+		return jsonExpected
+	}
+	return nil
+}
+
 func (h *Handler) handlePost(writer http.ResponseWriter, request *http.Request) error {
 	path := strings.Trim(request.URL.Path, "/")
 	if request.Body != nil {
 		defer request.Body.Close()
 	}
 	var req CreateFileItemRequest
-	if err := json.NewDecoder(request.Body).Decode(&req); err != nil {
-		return jsonExpected
+	if err := decodeJSON(request, &req); err != nil {
+		return err
 	}
+	principal := Principal(request)
 	switch req.Type {
 	case RegularFile:
+		if err := verifyChecksum(req.Checksum, req.Data); err != nil {
+			return err
+		}
+		size := int64(len(req.Data))
+		reservation, err := h.Quotas.Reserve(principal, path, 0, size, true)
+		if err != nil {
+			return err
+		}
+		defer reservation.Release()
 		item, err := h.CreateFile(path)
 		if err != nil {
-			if os.IsPermission(err) {
+			if isPermission(err) {
 				return writeAccessDenied
 			}
 			if filesystem.IsFileAlreadyExists(err) {
@@ -86,25 +256,39 @@ func (h *Handler) handlePost(writer http.ResponseWriter, request *http.Request)
 			log.Printf("failed to create file %s: %s", path, err)
 			return internalServerError
 		}
-		if err := writeToFile(item, req.Data); err != nil {
+		err = writeToFile(item, req.Data)
+		if err != nil {
+			size = 0
+		}
+		reservation.Commit(size)
+		if err != nil {
 			log.Printf("failed to write to file %s: %s", path, err)
 			return err
 		}
 	case DirType:
+		reservation, err := h.Quotas.Reserve(principal, path, 0, 0, true)
+		if err != nil {
+			return err
+		}
+		defer reservation.Release()
 		if _, err := h.CreateDir(path); err != nil {
-			if os.IsPermission(err) {
+			if isPermission(err) {
 				return writeAccessDenied
 			}
 			return internalServerError
 		}
+		reservation.Commit(0)
 	default:
 		return newBadInputError("invalid type, only file and dir are accepted.")
 	}
 
-	return nil
+	return h.notify(request, MutationCreate, path, nil)
 }
 
 func (h *Handler) handlePut(writer http.ResponseWriter, request *http.Request) error {
+	if request.URL.Query().Get("version") != "" {
+		return h.handleRestoreVersion(writer, request)
+	}
 	path := strings.Trim(request.URL.Path, "/")
 	item, err := h.Get(path)
 	if err != nil {
@@ -120,51 +304,182 @@ func (h *Handler) handlePut(writer http.ResponseWriter, request *http.Request) e
 		defer request.Body.Close()
 	}
 	var req FileWriteRequest
-	if err := json.NewDecoder(request.Body).Decode(&req); err != nil {
-		return jsonExpected
+	if err := decodeJSON(request, &req); err != nil {
+		return err
+	}
+	if err := verifyChecksum(req.Checksum, req.Data); err != nil {
+		return err
+	}
+	principal := Principal(request)
+	reservation, err := h.Quotas.Reserve(principal, path, item.Size, int64(len(req.Data)), false)
+	if err != nil {
+		return err
 	}
+	defer reservation.Release()
+	before := h.changes().State(path)
+	defer h.Digests.Forget(path)
 	if err := writeToFile(item, req.Data); err != nil {
 		log.Printf("failed to write to file %s: %s", path, err)
 		return err
 	}
-	return nil
+	reservation.Commit(int64(len(req.Data)))
+	return h.notify(request, MutationWrite, path, before)
 }
 
 func (h *Handler) handleDelete(writer http.ResponseWriter, request *http.Request) error {
 	path := strings.Trim(request.URL.Path, "/")
-	if err := h.Delete(path); err != nil {
+	query := request.URL.Query()
+	if id := query.Get("trash"); id != "" {
+		return h.handlePurge(request, id)
+	}
+	permanent := query.Get("permanent") == "true"
+	if permanent && !h.isAdministrator(request) {
+		return permanentDeleteDenied
+	}
+	if err := h.checkDelete(path, query.Get("recursive") == "true"); err != nil {
+		return err
+	}
+	changes := h.changes()
+	before := changes.State(path)
+	if err := changes.Remove(request.Context(), Principal(request), path, permanent); err != nil {
 		switch {
 		case os.IsNotExist(err):
 			return notFoundError
-		case os.IsPermission(err):
+		case isPermission(err):
 			return deleteAccessDenied
 		}
 
 		return err
 	}
+	return h.notify(request, MutationDelete, path, before)
+}
+
+// checkDelete returns why the item at path cannot be deleted, if it cannot.
+func (h *Handler) checkDelete(path string, recursive bool) error {
+	return CheckDelete(h.viewer(), path, recursive, h.Protected)
+}
+
+// CheckDelete returns the Error explaining why the item at path cannot be
+// deleted, if it cannot. The root and protected paths are never deleted, nor
+// are directories with content unless recursive.
+func CheckDelete(viewer filesystem.Viewer, path string, recursive bool, protected []string) error {
+	if path == "" {
+		return rootDeleteDenied
+	}
+	for _, protected := range protected {
+		if within(strings.Trim(protected, "/"), path) {
+			return protectedPathDenied
+		}
+	}
+	item, err := viewer.Get(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return notFoundError
+		}
+		return err
+	}
+	if item.IsDir() && len(item.Children) > 0 && !recursive {
+		return directoryNotEmpty
+	}
 	return nil
 }
 
 func (h *Handler) handleGet(writer http.ResponseWriter, request *http.Request) error {
+	if request.URL.Query().Get("watch") == "true" {
+		return h.handleWatch(writer, request)
+	}
+	if _, ok := request.URL.Query()["search"]; ok {
+		return h.handleSearch(writer, request)
+	}
+	if request.URL.Query().Get("quota") == "true" {
+		return h.handleQuota(writer, request)
+	}
+	if request.URL.Query().Get("trash") == "true" {
+		return h.handleTrash(writer, request)
+	}
+	if _, ok := request.URL.Query()["versions"]; ok {
+		return h.handleVersions(writer, request)
+	}
+	if request.URL.Query().Get("version") != "" {
+		return h.handleGetVersion(writer, request)
+	}
+
 	// get the path
 	path := strings.Trim(request.URL.Path, "/")
-	item, err := h.Get(path)
+	item, err := h.viewer().Get(path)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return notFoundError
 		}
 		return err
 	}
+	item = filesystem.WithoutProbes(path, item)
 	query := request.URL.Query()
 	populateData := item.FileMode.IsRegular() || query.Get("populateData") == "true"
 	result, err := fileItemFromFSItem(item, populateData)
 	if err != nil {
 		log.Printf("failed to populate data for %s: %s", item.Name, err)
+		if filesystem.IsCorrupted(err) {
+			return corruptedFile
+		}
 		return internalServerError
 	}
-	if err := json.NewEncoder(writer).Encode(result); err != nil {
+	if name := query.Get("checksum"); name != "" {
+		algorithm, err := filesystem.ParseDigestAlgorithm(name)
+		if err != nil {
+			return unsupportedChecksum
+		}
+		if err := h.populateChecksums(path, item, &result, algorithm); err != nil {
+			log.Printf("failed to compute checksum for %s: %s", path, err)
+			return internalServerError
+		}
+	}
+	if query.Get("usage") == "true" {
+		if err := h.populateUsage(request, path, &result); err != nil {
+			if _, ok := err.(Error); ok {
+				return err
+			}
+			if request.Context().Err() != nil {
+				// the client went away, there is no one to respond to.
+				return nil
+			}
+			log.Printf("failed to measure disk usage of %s: %s", path, err)
+			return internalServerError
+		}
+	}
+	if item.FileMode.IsRegular() {
+		if err := h.setDigestHeaders(writer, request, path, item); err != nil {
+			log.Printf("failed to compute digest for %s: %s", path, err)
+			return internalServerError
+		}
+	}
+	if err := writeJSON(writer, result); err != nil {
 		log.Printf("failed to write file item for %s: %s", path, err)
 		return err
 	}
 	return nil
 }
+
+// populateChecksums sets the checksum of a file or the checksums of the regular
+// files directly inside a directory.
+func (h *Handler) populateChecksums(itemPath string, item filesystem.Item, result *FileItem, algorithm filesystem.DigestAlgorithm) error {
+	if item.FileMode.IsRegular() {
+		checksum, err := h.checksumOf(itemPath, item, algorithm)
+		if err != nil {
+			return err
+		}
+		result.Checksum = checksum
+		return nil
+	}
+	for i, child := range item.Children {
+		if !child.FileMode.IsRegular() || child.Opener == nil {
+			continue
+		}
+		checksum, err := h.checksumOf(path.Join(itemPath, child.Name), child, algorithm)
+		if err != nil {
+			return err
+		}
+		result.Children[i].Checksum = checksum
+	}
+	return nil
+}
@@ -2,11 +2,14 @@ package fshttp_test
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -102,7 +105,7 @@ func TestView(t *testing.T) {
 	}
 
 	viewer := &dummyViewer{root}
-	handler := fshttp.Handler{viewer}
+	handler := fshttp.Handler{Editor: viewer}
 
 	testCases := []struct {
 		request  *http.Request
@@ -151,3 +154,297 @@ func TestView(t *testing.T) {
 		}
 	}
 }
+
+func TestOverwrite(t *testing.T) {
+	root := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(root, "a.txt"), []byte("a much longer content"), 0644); err != nil {
+		t.Fatalf("failed to write file: %s", err)
+	}
+	handler := &fshttp.Handler{Editor: filesystem.DirManager{Root: root}}
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("PUT", "/a.txt", strings.NewReader(`{"data": "short"}`)))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("failed to overwrite a.txt: %d %s", recorder.Code, recorder.Body)
+	}
+	if data, _ := ioutil.ReadFile(filepath.Join(root, "a.txt")); string(data) != "short" {
+		t.Errorf("expected the shorter content to replace the file but got %q", data)
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	root := filesystem.Item{
+		Name:     "root",
+		FileMode: os.ModeDir,
+		Children: []filesystem.Item{
+			{Name: "a.txt", Opener: stringOpener("a")},
+		},
+	}
+	handler := fshttp.Handler{Editor: &dummyViewer{root}, Digests: &filesystem.DigestCache{}}
+
+	recorder := httptest.NewRecorder()
+	request := mustMakeGETRequest("http://some.url.com/a.txt?checksum=sha256")
+	request.Header.Set("Want-Content-Digest", "md5=0.5, sha-256=1")
+	handler.ServeHTTP(recorder, request)
+
+	var item fshttp.FileItem
+	if err := json.NewDecoder(recorder.Body).Decode(&item); err != nil {
+		t.Fatalf("failed to decode response: %s", err)
+	}
+	expected := "ca978112ca1bbdcafac231b39a23dc4da786eff8147c4e72b9807785afee48bb"
+	if item.Checksum == nil || item.Checksum.Algorithm != "sha256" || item.Checksum.Value != expected {
+		t.Errorf("unexpected checksum: %+v", item.Checksum)
+	}
+	digest := "sha-256=:ypeBEsobvcr6wjGzmiPcTaeG7/gUfE5yuYB3ha/uSLs=:"
+	if header := recorder.Result().Header.Get("Content-Digest"); header != digest {
+		t.Errorf("unexpected Content-Digest header: expected %s, got %s", digest, header)
+	}
+
+	testCases := []struct {
+		body   string
+		status int
+	}{
+		{body: `{"data": "b", "checksum": {"algorithm": "sha256", "value": "` + expected + `"}}`, status: 400},
+		{body: `{"data": "a", "checksum": {"algorithm": "sha512", "value": "` + expected + `"}}`, status: 400},
+		{body: `{"data": "a", "checksum": {"algorithm": "sha256", "value": "` + expected + `"}}`, status: 200},
+	}
+	for _, testCase := range testCases {
+		recorder := httptest.NewRecorder()
+		request, _ := http.NewRequest("PUT", "http://some.url.com/a.txt", strings.NewReader(testCase.body))
+		handler.ServeHTTP(recorder, request)
+		if recorder.Code != testCase.status {
+			t.Errorf("unexpected status code for %s: expected %d, got %d", testCase.body, testCase.status, recorder.Code)
+		}
+	}
+}
+
+func TestSearch(t *testing.T) {
+	root := filesystem.Item{
+		Name:     "root",
+		FileMode: os.ModeDir,
+		Children: []filesystem.Item{
+			{
+				Name:     "sub",
+				FileMode: os.ModeDir,
+				Children: []filesystem.Item{
+					{Name: "b.txt", Size: 5, Opener: stringOpener("hello\nworld")},
+				},
+			},
+			{Name: "a.txt", Size: 1, Opener: stringOpener("a")},
+		},
+	}
+	handler := fshttp.Handler{Editor: &dummyViewer{root}}
+
+	testCases := []struct {
+		url     string
+		status  int
+		matches []string
+	}{
+		{url: "/?search=*.txt", status: 200, matches: []string{"a.txt", "sub/b.txt"}},
+		{url: "/sub?search=*.txt", status: 200, matches: []string{"sub/b.txt"}},
+		{url: "/?search=&type=dir", status: 200, matches: []string{"sub"}},
+		{url: "/?search=&minSize=2", status: 200, matches: []string{"sub/b.txt"}},
+		{url: "/?search=&grep=wor", status: 200, matches: []string{"sub/b.txt"}},
+		{url: "/?search=&limit=1", status: 200, matches: []string{"a.txt"}},
+		{url: "/?search=&grep=(", status: 400},
+		{url: "/a.txt?search=", status: 400},
+		{url: "/nope?search=", status: 404},
+	}
+	for _, testCase := range testCases {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, mustMakeGETRequest("http://some.url.com"+testCase.url))
+		if recorder.Code != testCase.status {
+			t.Errorf("unexpected status code for %s: expected %d, got %d", testCase.url, testCase.status, recorder.Code)
+			continue
+		}
+		if testCase.status != 200 {
+			continue
+		}
+		var result fshttp.SearchResult
+		json.NewDecoder(recorder.Body).Decode(&result)
+		paths := make([]string, 0, len(result.Matches))
+		for _, match := range result.Matches {
+			paths = append(paths, match.Path)
+		}
+		if strings.Join(paths, ",") != strings.Join(testCase.matches, ",") {
+			t.Errorf("unexpected matches for %s: expected %v, got %v", testCase.url, testCase.matches, paths)
+		}
+	}
+}
+
+func TestUsage(t *testing.T) {
+	root := filesystem.Item{
+		Name:     "root",
+		FileMode: os.ModeDir,
+		Children: []filesystem.Item{
+			{
+				Name:     "sub",
+				FileMode: os.ModeDir,
+				Size:     4096,
+				Children: []filesystem.Item{
+					{Name: "b.txt", Size: 5, Opener: stringOpener("hello")},
+					{Name: "c.txt", Size: 3, Opener: stringOpener("abc")},
+				},
+			},
+			{Name: "a.txt", Size: 1, Opener: stringOpener("a")},
+		},
+	}
+	handler := fshttp.Handler{Editor: &dummyViewer{root}, Usage: &filesystem.UsageCache{}}
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, mustMakeGETRequest("http://some.url.com/?usage=true&depth=1"))
+	if recorder.Code != 200 {
+		t.Fatalf("unexpected status code: %d", recorder.Code)
+	}
+	var item fshttp.FileItem
+	json.NewDecoder(recorder.Body).Decode(&item)
+	if item.Usage == nil || *item.Usage != (fshttp.DiskUsage{Bytes: 9, Files: 3, Dirs: 2}) {
+		t.Errorf("unexpected usage: %+v", item.Usage)
+	}
+	for _, child := range item.Children {
+		expected := fshttp.DiskUsage{Bytes: 1, Files: 1}
+		if child.Name == "sub" {
+			expected = fshttp.DiskUsage{Bytes: 8, Files: 2, Dirs: 1}
+		}
+		if child.Usage == nil || *child.Usage != expected {
+			t.Errorf("unexpected usage of %s: expected %+v, got %+v", child.Name, expected, child.Usage)
+		}
+	}
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, mustMakeGETRequest("http://some.url.com/sub?usage=true"))
+	item = fshttp.FileItem{}
+	json.NewDecoder(recorder.Body).Decode(&item)
+	if item.Usage == nil || item.Usage.Bytes != 8 || item.Children[0].Usage != nil {
+		t.Errorf("unexpected usage without depth: %+v", item)
+	}
+
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, mustMakeGETRequest("http://some.url.com/?usage=true&depth=2"))
+	if recorder.Code != 400 {
+		t.Errorf("expected an invalid depth to fail with 400 but got %d", recorder.Code)
+	}
+}
+
+func TestDelete(t *testing.T) {
+	manager := filesystem.DirManager{Root: t.TempDir()}
+	handler := &fshttp.Handler{Editor: manager, Protected: []string{"/etc/keep.conf"}}
+	manager.CreateDir("docs")
+	manager.CreateFile("docs/a.txt")
+	manager.CreateDir("empty")
+	manager.CreateDir("etc")
+	manager.CreateFile("etc/keep.conf")
+	manager.CreateFile("etc/other.conf")
+
+	testCases := []struct {
+		url    string
+		status int
+	}{
+		{url: "/", status: 403},
+		{url: "/?recursive=true", status: 403},
+		{url: "/missing", status: 404},
+		{url: "/docs", status: 409},
+		{url: "/docs?recursive=true", status: 200},
+		{url: "/docs", status: 404},
+		{url: "/empty", status: 200},
+		{url: "/etc/keep.conf", status: 403},
+		{url: "/etc?recursive=true", status: 403},
+		{url: "/etc/other.conf", status: 200},
+	}
+	for _, testCase := range testCases {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest("DELETE", testCase.url, nil))
+		if recorder.Code != testCase.status {
+			t.Errorf("unexpected status code for %s: expected %d, got %d", testCase.url, testCase.status, recorder.Code)
+		}
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	manager := filesystem.DirManager{Root: t.TempDir()}
+	manager.CreateFile("a.txt")
+	handlers := []*fshttp.Handler{
+		{Viewer: manager},
+		{Editor: filesystem.ReadOnly{Viewer: manager}},
+	}
+	for i, handler := range handlers {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, mustMakeGETRequest("http://some.url.com/a.txt"))
+		if recorder.Code != 200 {
+			t.Errorf("handler %d: expected reading to succeed but got %d", i, recorder.Code)
+		}
+		for _, method := range []string{"POST", "PUT", "PATCH", "DELETE"} {
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, httptest.NewRequest(method, "/a.txt", strings.NewReader(`{"type": "file"}`)))
+			if recorder.Code != 405 || recorder.Header().Get("Allow") != "GET, HEAD, OPTIONS" {
+				t.Errorf("handler %d: expected %s to be rejected with 405 but got %d, allowing %q", i, method, recorder.Code, recorder.Header().Get("Allow"))
+			}
+		}
+	}
+	if _, err := manager.Get("a.txt"); err != nil {
+		t.Errorf("expected the file to be untouched but got %s", err)
+	}
+
+	recorder := httptest.NewRecorder()
+	(&fshttp.Handler{Editor: manager}).ServeHTTP(recorder, httptest.NewRequest("TRACE", "/", nil))
+	if allow := recorder.Header().Get("Allow"); recorder.Code != 405 || !strings.Contains(allow, "DELETE") {
+		t.Errorf("expected an unknown method to be rejected with 405 but got %d, allowing %q", recorder.Code, allow)
+	}
+}
+
+func TestPathTraversal(t *testing.T) {
+	root := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(root, "secret.txt"), []byte("secret"), 0644); err != nil {
+		t.Fatalf("failed to write file: %s", err)
+	}
+	served := filepath.Join(root, "served")
+	os.Mkdir(served, 0755)
+	handler := &fshttp.Handler{Editor: filesystem.DirManager{Root: served}}
+
+	for _, url := range []string{"/../secret.txt", "/a/../../secret.txt", "/./../secret.txt?raw=true"} {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest("GET", url, nil))
+		if recorder.Code != http.StatusNotFound || strings.Contains(recorder.Body.String(), "secret") {
+			t.Errorf("expected %s to stay within the served root but got %d: %s", url, recorder.Code, recorder.Body)
+		}
+	}
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("DELETE", "/../secret.txt", nil))
+	if _, err := os.Stat(filepath.Join(root, "secret.txt")); err != nil {
+		t.Errorf("expected the file outside of the served root to be kept: %s", err)
+	}
+}
+
+func TestCorruptedFile(t *testing.T) {
+	keys, err := filesystem.NewKeyring(map[string][]byte{"k": bytes.Repeat([]byte{1}, 32)}, "k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, wrap := range map[string]func(filesystem.Editor) filesystem.Editor{
+		"encrypted":  func(editor filesystem.Editor) filesystem.Editor { return filesystem.NewEncrypted(editor, keys) },
+		"compressed": func(editor filesystem.Editor) filesystem.Editor { return filesystem.NewCompressed(editor) },
+	} {
+		stored := filesystem.NewMemory()
+		handler := &fshttp.Handler{Editor: wrap(stored)}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, mustMakeRequest("POST", "/a.txt", `{"type": "file", "data": "`+strings.Repeat("hello ", 100)+`"}`, nil))
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("%s: failed to create the file: %d %s", name, recorder.Code, recorder.Body)
+		}
+
+		item, _ := stored.Get("a.txt")
+		file, _ := item.Open(os.O_RDONLY)
+		content, _ := ioutil.ReadAll(file)
+		file.Close()
+		content[len(content)/4] ^= 0xff
+		file, _ = item.Open(os.O_WRONLY | os.O_TRUNC)
+		file.Write(content)
+		file.Close()
+
+		recorder = httptest.NewRecorder()
+		handler.ServeHTTP(recorder, mustMakeGETRequest("http://some.url.com/a.txt"))
+		if recorder.Code != http.StatusInternalServerError || !strings.Contains(recorder.Body.String(), "corrupted-file") {
+			t.Errorf("%s: expected a corrupted file to fail but got %d %s", name, recorder.Code, recorder.Body)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package fshttp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/peymanmortazavi/fs-server/pkg/filesystem"
+)
+
+const (
+	// defaultCheckTimeout bounds every check when the Health has no timeout.
+	defaultCheckTimeout = 5 * time.Second
+
+	// probeReuse is how long the result of a probe answers writable checks.
+	probeReuse = time.Second
+)
+
+// HealthCheck is a named check of the server, Check returns nil when healthy.
+type HealthCheck struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+// Health serves liveness checks at /healthz and readiness checks at /readyz,
+// answering 503 Service Unavailable when any of them fails. Liveness checks
+// should only cover the process itself, a failing backend belongs to the
+// readiness checks so it takes the server out of rotation without restarting it.
+type Health struct {
+	Liveness  []HealthCheck
+	Readiness []HealthCheck
+
+	// Timeout bounds every check, a check still running after it fails.
+	Timeout time.Duration
+}
+
+// ReadableCheck checks the item at the given path can be read.
+func ReadableCheck(viewer filesystem.Viewer, itemPath string) HealthCheck {
+	return HealthCheck{Name: "readable", Check: func(context.Context) error {
+		_, err := viewer.Get(itemPath)
+		return err
+	}}
+}
+
+// WritableCheck checks a file can be written beneath the root of the editor
+// with filesystem.Probe. The editor should not be decorated by a Trash or a
+// Notifier, which would keep or announce the probe.
+//
+// Probes run one at a time and their result is reused for a second, so
+// frequent or concurrent checks do not pile up writes.
+func WritableCheck(editor filesystem.Editor) HealthCheck {
+	var mu sync.Mutex
+	var probed time.Time
+	var result error
+	return HealthCheck{Name: "writable", Check: func(context.Context) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if time.Since(probed) >= probeReuse {
+			result, probed = filesystem.Probe(editor), time.Now()
+		}
+		return result
+	}}
+}
+
+// ServeHTTP runs the checks of the requested endpoint.
+func (h *Health) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	var checks []HealthCheck
+	switch request.URL.Path {
+	case "/healthz":
+		checks = h.Liveness
+	case "/readyz":
+		checks = h.Readiness
+	default:
+		writeError(writer, request, notFoundError)
+		return
+	}
+	if request.Method != http.MethodGet && request.Method != http.MethodHead {
+		writer.Header().Set("Allow", "GET, HEAD")
+		writeError(writer, request, methodNotAllowedError)
+		return
+	}
+
+	status := h.run(request.Context(), checks)
+	writer.Header().Set("Content-Type", "application/json")
+	writer.Header().Set("Cache-Control", "no-store")
+	if status.Status != HealthOK {
+		writer.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(writer).Encode(status); err != nil {
+		log.Printf("failed to write health status: %s", err)
+	}
+}
+
+// run runs the checks concurrently.
+func (h *Health) run(ctx context.Context, checks []HealthCheck) HealthStatus {
+	timeout := h.Timeout
+	if timeout <= 0 {
+		timeout = defaultCheckTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	status := HealthStatus{Status: HealthOK, Checks: make(map[string]CheckStatus, len(checks))}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, check := range checks {
+		wg.Add(1)
+		go func(check HealthCheck) {
+			defer wg.Done()
+			started := time.Now()
+			err := runCheck(ctx, check)
+			result := CheckStatus{Status: HealthOK, Duration: time.Since(started).String()}
+			if err != nil {
+				result.Status, result.Error = HealthFailed, err.Error()
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			status.Checks[check.Name] = result
+			if err != nil {
+				status.Status = HealthFailed
+			}
+		}(check)
+	}
+	wg.Wait()
+	return status
+}
+
+// runCheck returns the result of a check, or the error of the context when
+// it is done first. The check keeps running in the background in that case.
+func runCheck(ctx context.Context, check HealthCheck) error {
+	result := make(chan error, 1)
+	go func() {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				result <- fmt.Errorf("check panicked: %v", recovered)
+			}
+		}()
+		result <- check.Check(ctx)
+	}()
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
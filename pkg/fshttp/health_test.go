@@ -0,0 +1,87 @@
+package fshttp_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/peymanmortazavi/fs-server/pkg/filesystem"
+	"github.com/peymanmortazavi/fs-server/pkg/fshttp"
+)
+
+func TestHealth(t *testing.T) {
+	manager := filesystem.DirManager{Root: t.TempDir()}
+	ready := true
+	health := &fshttp.Health{
+		Readiness: []fshttp.HealthCheck{
+			fshttp.ReadableCheck(manager, ""),
+			fshttp.WritableCheck(manager),
+			{Name: "ready", Check: func(context.Context) error {
+				if !ready {
+					return errors.New("not ready")
+				}
+				return nil
+			}},
+			{Name: "slow", Check: func(ctx context.Context) error {
+				<-ctx.Done()
+				return nil
+			}},
+		},
+		Timeout: 50 * time.Millisecond,
+	}
+
+	get := func(path string) (int, fshttp.HealthStatus) {
+		t.Helper()
+		recorder := httptest.NewRecorder()
+		health.ServeHTTP(recorder, mustMakeGETRequest("http://some.url.com"+path))
+		var status fshttp.HealthStatus
+		if err := json.NewDecoder(recorder.Body).Decode(&status); err != nil {
+			t.Fatalf("failed to decode health status of %s: %s", path, err)
+		}
+		return recorder.Code, status
+	}
+
+	code, status := get("/healthz")
+	if code != 200 || status.Status != fshttp.HealthOK || len(status.Checks) != 0 {
+		t.Errorf("expected to be alive but got %d %+v", code, status)
+	}
+
+	code, status = get("/readyz")
+	if code != 503 || status.Status != fshttp.HealthFailed {
+		t.Errorf("expected a timed out check to fail readiness but got %d %+v", code, status)
+	}
+	if slow := status.Checks["slow"]; slow.Status != fshttp.HealthFailed || slow.Error != context.DeadlineExceeded.Error() {
+		t.Errorf("unexpected status of the slow check: %+v", slow)
+	}
+	for _, name := range []string{"readable", "writable", "ready"} {
+		if status.Checks[name].Status != fshttp.HealthOK {
+			t.Errorf("expected the %s check to pass but got %+v", name, status.Checks[name])
+		}
+	}
+	if item, _ := manager.Get(""); len(item.Children) != 0 {
+		t.Errorf("expected the probe to be removed but found %+v", item.Children)
+	}
+
+	health.Readiness = health.Readiness[:3]
+	ready = false
+	if code, status = get("/readyz"); code != 503 || status.Checks["ready"].Error != "not ready" {
+		t.Errorf("expected a failing check to fail readiness but got %d %+v", code, status)
+	}
+	if code, _ = get("/healthz"); code != 200 {
+		t.Errorf("expected a failing readiness check to leave liveness alone but got %d", code)
+	}
+	ready = true
+	if code, _ = get("/readyz"); code != 200 {
+		t.Errorf("expected to be ready but got %d", code)
+	}
+
+	readOnly := &fshttp.Health{Readiness: []fshttp.HealthCheck{fshttp.WritableCheck(filesystem.ReadOnly{Viewer: manager})}}
+	recorder := httptest.NewRecorder()
+	readOnly.ServeHTTP(recorder, mustMakeGETRequest("http://some.url.com/readyz"))
+	if recorder.Code != 503 {
+		t.Errorf("expected a read-only file system to fail the writable check but got %d", recorder.Code)
+	}
+}
@@ -0,0 +1,77 @@
+package fshttp
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/peymanmortazavi/fs-server/pkg/metrics"
+)
+
+// Metrics records the requests served by a Handler and the operations of its
+// backend in a metrics.Registry.
+type Metrics struct {
+	requests   *metrics.Counter
+	durations  *metrics.Histogram
+	inFlight   *metrics.Gauge
+	received   *metrics.Counter
+	sent       *metrics.Counter
+	uploads    *metrics.Histogram
+	downloads  *metrics.Histogram
+	operations *metrics.Histogram
+}
+
+// NewMetrics registers the metrics of a Handler.
+func NewMetrics(registry *metrics.Registry) *Metrics {
+	return &Metrics{
+		requests:   registry.NewCounter("fs_server_requests_total", "Requests served by method and the ID of the error returned, none when successful.", "method", "error"),
+		durations:  registry.NewHistogram("fs_server_request_duration_seconds", "How long requests take by method and error ID.", metrics.DefaultBuckets, "method", "error"),
+		inFlight:   registry.NewGauge("fs_server_requests_in_flight", "Requests being served, including watch streams."),
+		received:   registry.NewCounter("fs_server_request_bytes_total", "Bytes read from request bodies by method.", "method"),
+		sent:       registry.NewCounter("fs_server_response_bytes_total", "Bytes written to response bodies by method.", "method"),
+		uploads:    registry.NewHistogram("fs_server_upload_size_bytes", "Sizes of the bodies of successful POST, PUT and PATCH requests.", metrics.SizeBuckets),
+		downloads:  registry.NewHistogram("fs_server_download_size_bytes", "Sizes of the bodies of successful GET responses.", metrics.SizeBuckets),
+		operations: registry.NewHistogram("fs_server_backend_operation_duration_seconds", "How long backend operations take by operation and result.", metrics.DefaultBuckets, "operation", "result"),
+	}
+}
+
+// ObserveOperation records a backend operation, it suits filesystem.NewInstrumented.
+func (m *Metrics) ObserveOperation(operation string, duration time.Duration, err error) {
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	m.operations.Observe(duration.Seconds(), operation, result)
+}
+
+// methodLabel bounds the methods recorded to the ones served.
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodOptions:
+		return method
+	}
+	return "OTHER"
+}
+
+// observe records a served request.
+func (m *Metrics) observe(served exchange) {
+	if m == nil {
+		return
+	}
+	method, errorID := methodLabel(served.request.Method), served.errorID
+	if errorID == "" {
+		errorID = "none"
+	}
+	m.requests.Inc(method, errorID)
+	m.durations.Observe(served.duration.Seconds(), method, errorID)
+	m.received.Add(float64(served.received), method)
+	m.sent.Add(float64(served.sent), method)
+	if served.status >= 300 {
+		return
+	}
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch:
+		m.uploads.Observe(float64(served.received))
+	case http.MethodGet:
+		m.downloads.Observe(float64(served.sent))
+	}
+}
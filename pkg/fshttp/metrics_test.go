@@ -0,0 +1,52 @@
+package fshttp_test
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/peymanmortazavi/fs-server/pkg/filesystem"
+	"github.com/peymanmortazavi/fs-server/pkg/fshttp"
+	"github.com/peymanmortazavi/fs-server/pkg/metrics"
+)
+
+func TestMetrics(t *testing.T) {
+	var registry metrics.Registry
+	m := fshttp.NewMetrics(&registry)
+	manager := filesystem.DirManager{Root: t.TempDir()}
+	observer := &fshttp.Observer{Metrics: m}
+	handler := fshttp.Chain(&fshttp.Handler{Editor: filesystem.NewInstrumented(manager, m.ObserveOperation)}, observer.Middleware)
+
+	for _, request := range []struct{ method, url, body string }{
+		{"POST", "/a.txt", `{"type": "file", "data": "hello"}`},
+		{"GET", "/a.txt?raw=true", ""},
+		{"GET", "/missing", ""},
+		{"TRACE", "/", ""},
+	} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(request.method, request.url, strings.NewReader(request.body)))
+	}
+	m.ObserveOperation("get", time.Millisecond, nil)
+
+	var exposition strings.Builder
+	registry.WriteTo(&exposition)
+	for _, expected := range []string{
+		`fs_server_requests_total{method="POST",error="none"} 1`,
+		`fs_server_requests_total{method="GET",error="none"} 1`,
+		`fs_server_requests_total{method="GET",error="not-found"} 1`,
+		`fs_server_requests_total{method="OTHER",error="method-not-allowed"} 1`,
+		`fs_server_request_duration_seconds_count{method="GET",error="not-found"} 1`,
+		`fs_server_request_bytes_total{method="POST"} 33`,
+		`fs_server_response_bytes_total{method="GET"} `,
+		`fs_server_requests_in_flight 0`,
+		`fs_server_upload_size_bytes_count 1`,
+		`fs_server_download_size_bytes_count 1`,
+		`fs_server_backend_operation_duration_seconds_count{operation="create_file",result="ok"} 1`,
+		`fs_server_backend_operation_duration_seconds_count{operation="get",result="error"} 1`,
+		`fs_server_backend_operation_duration_seconds_count{operation="open",result="ok"} 2`,
+	} {
+		if !strings.Contains(exposition.String(), expected) {
+			t.Errorf("expected the metrics to contain %q:\n%s", expected, exposition.String())
+		}
+	}
+}
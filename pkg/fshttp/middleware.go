@@ -0,0 +1,96 @@
+package fshttp
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"runtime/debug"
+
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Middleware wraps a handler with behaviour shared by the requests it serves.
+type Middleware func(http.Handler) http.Handler
+
+// Chain returns the handler wrapped by the middleware, the first one being the
+// outermost.
+func Chain(handler http.Handler, middleware ...Middleware) http.Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+	return handler
+}
+
+// Deprecate marks the responses of next as deprecated in favor of the same
+// path beneath successor, with the Deprecation and Link headers.
+func Deprecate(successor string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			location := url.URL{Path: path.Join(successor, request.URL.Path)}
+			writer.Header().Set("Deprecation", "true")
+			writer.Header().Add("Link", "<"+location.EscapedPath()+`>; rel="successor-version"`)
+			next.ServeHTTP(writer, request)
+		})
+	}
+}
+
+// Recover answers the requests whose handler panics with an internal server
+// error, logging the panic along with its stack.
+func Recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			if recovered == http.ErrAbortHandler {
+				panic(recovered)
+			}
+			log.Printf("panic serving %s %s: %v\n%s", request.Method, request.URL.Path, recovered, debug.Stack())
+			writeError(writer, request, internalServerError)
+		}()
+		next.ServeHTTP(writer, request)
+	})
+}
+
+// Middleware authenticates requests before passing them to next, Next is
+// ignored.
+func (b BasicAuth) Middleware(next http.Handler) http.Handler {
+	b.Next = next
+	return &b
+}
+
+// Observer identifies and records the requests served by the handlers it
+// wraps. Every request is given an ID, along with a span continuing the W3C
+// traceparent of the request when Tracer is set, and the requests are recorded
+// in Metrics and AccessLog when they are set.
+type Observer struct {
+	Metrics   *Metrics
+	AccessLog *AccessLog
+	Tracer    trace.Tracer
+}
+
+// Middleware observes the requests served by next.
+func (o *Observer) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		request = withRequestID(writer, request)
+		if o.Metrics != nil {
+			o.Metrics.inFlight.Add(1)
+			defer o.Metrics.inFlight.Add(-1)
+		}
+		var span trace.Span
+		if o.Tracer != nil {
+			ctx := propagation.TraceContext{}.Extract(request.Context(), propagation.HeaderCarrier(request.Header))
+			ctx, span = o.Tracer.Start(ctx, request.Method, trace.WithSpanKind(trace.SpanKindServer))
+			request = request.WithContext(ctx)
+		}
+		served := record(writer, request, next)
+		o.Metrics.observe(served)
+		o.AccessLog.write(served)
+		if span != nil {
+			endSpan(span, served)
+		}
+	})
+}
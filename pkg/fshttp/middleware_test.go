@@ -0,0 +1,127 @@
+package fshttp_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/peymanmortazavi/fs-server/pkg/fshttp"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestChain(t *testing.T) {
+	var order []string
+	tag := func(name string) fshttp.Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+				order = append(order, name)
+				next.ServeHTTP(writer, request)
+			})
+		}
+	}
+	handler := fshttp.Chain(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		order = append(order, "handler")
+	}), tag("outer"), tag("inner"))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if strings.Join(order, ",") != "outer,inner,handler" {
+		t.Errorf("unexpected order of the middleware: %v", order)
+	}
+}
+
+func TestRecover(t *testing.T) {
+	var output bytes.Buffer
+	observer := &fshttp.Observer{AccessLog: fshttp.NewAccessLog(&output)}
+	handler := fshttp.Chain(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic("broken")
+	}), observer.Middleware, fshttp.Recover)
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/a.txt", nil))
+	var e fshttp.Error
+	if err := json.NewDecoder(recorder.Body).Decode(&e); err != nil || recorder.Code != http.StatusInternalServerError || e.RequestID == "" {
+		t.Errorf("expected an internal server error but got %d %+v, %v", recorder.Code, e, err)
+	}
+	var record fshttp.AccessRecord
+	if err := json.Unmarshal(output.Bytes(), &record); err != nil || record.Status != http.StatusInternalServerError || record.Error != e.ID {
+		t.Errorf("expected the panic to be logged as an error but got %+v, %v", record, err)
+	}
+
+	aborted := fshttp.Recover(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+	defer func() {
+		if recovered := recover(); recovered != http.ErrAbortHandler {
+			t.Errorf("expected an aborted handler to keep panicking but got %v", recovered)
+		}
+	}()
+	aborted.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+}
+
+func TestBasicAuthMiddleware(t *testing.T) {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	auth := fshttp.BasicAuth{Users: map[string]string{"alice": string(hash)}, Required: true}
+	var output bytes.Buffer
+	observer := &fshttp.Observer{AccessLog: fshttp.NewAccessLog(&output)}
+	handler := fshttp.Chain(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		writer.Write([]byte(fshttp.Principal(request)))
+	}), observer.Middleware, auth.Middleware)
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+	if recorder.Code != http.StatusUnauthorized {
+		t.Errorf("expected an anonymous request to be rejected but got %d", recorder.Code)
+	}
+	request := httptest.NewRequest("GET", "/", nil)
+	request.SetBasicAuth("alice", "secret")
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusOK || recorder.Body.String() != "alice" {
+		t.Errorf("expected alice to be authenticated but got %d %q", recorder.Code, recorder.Body.String())
+	}
+	var record fshttp.AccessRecord
+	for decoder := json.NewDecoder(&output); decoder.More(); {
+		if err := decoder.Decode(&record); err != nil {
+			t.Fatalf("failed to decode access record: %s", err)
+		}
+	}
+	if record.Principal != "alice" {
+		t.Errorf("expected the principal to be logged by the observer around the authentication but got %+v", record)
+	}
+}
+
+func TestFailedLogins(t *testing.T) {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	auth := fshttp.BasicAuth{Users: map[string]string{"alice": string(hash)}, Failures: &fshttp.LoginLimit{Rate: fshttp.Rate{Limit: 0.01, Burst: 2}}}
+	handler := auth.Middleware(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {}))
+	signIn := func(remoteAddr, password string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest("GET", "/", nil)
+		request.RemoteAddr = remoteAddr
+		request.SetBasicAuth("alice", password)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	for i := 0; i < 2; i++ {
+		if code := signIn("10.0.0.1:1000", "wrong").Code; code != http.StatusUnauthorized {
+			t.Fatalf("expected failure %d to be verified but got %d", i, code)
+		}
+	}
+	recorder := signIn("10.0.0.1:2000", "secret")
+	if recorder.Code != http.StatusTooManyRequests || recorder.Header().Get("Retry-After") == "" {
+		t.Errorf("expected the address to be limited after its failures but got %d", recorder.Code)
+	}
+	if code := signIn("10.0.0.2:1000", "secret").Code; code != http.StatusOK {
+		t.Errorf("expected another address to sign in but got %d", code)
+	}
+	anonymous := httptest.NewRequest("GET", "/", nil)
+	anonymous.RemoteAddr = "10.0.0.1:3000"
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, anonymous)
+	if recorder.Code != http.StatusOK {
+		t.Errorf("expected anonymous requests of the address to be served but got %d", recorder.Code)
+	}
+}
@@ -0,0 +1,132 @@
+package fshttp
+
+import (
+	"context"
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/peymanmortazavi/fs-server/pkg/filesystem"
+)
+
+// MutationType describes the kind of change a mutation made.
+type MutationType string
+
+const (
+	// MutationCreate is a newly created file or directory.
+	MutationCreate MutationType = "create"
+
+	// MutationWrite is new content written to an existing file.
+	MutationWrite MutationType = "write"
+
+	// MutationDelete is a removed file or directory.
+	MutationDelete MutationType = "delete"
+)
+
+// Actor describes who made a request.
+type Actor struct {
+	Principal  string `json:"principal,omitempty"`
+	RemoteAddr string `json:"remote_addr,omitempty"`
+}
+
+// Mutation describes a successful change made through the Handler.
+type Mutation struct {
+	Type  MutationType `json:"type"`
+	Path  string       `json:"path"`
+	Item  FileItem     `json:"item"`
+	Actor Actor        `json:"actor"`
+	Time  time.Time    `json:"time"`
+}
+
+// MutationListener is notified after every successful mutation.
+//
+// Listeners are called synchronously before the response is written so they
+// should hand off any slow work.
+type MutationListener interface {
+	OnMutation(Mutation)
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a copy of the request carrying the authenticated
+// principal, which is also reported to the Observer recording the request.
+func WithPrincipal(request *http.Request, principal string) *http.Request {
+	if served, ok := request.Context().Value(exchangeKey{}).(*exchange); ok {
+		served.principal = principal
+	}
+	return request.WithContext(context.WithValue(request.Context(), principalKey{}, principal))
+}
+
+// Principal returns the authenticated principal of the request, empty when anonymous.
+func Principal(request *http.Request) string {
+	principal, _ := request.Context().Value(principalKey{}).(string)
+	return principal
+}
+
+func actorOf(request *http.Request) Actor {
+	return Actor{Principal: Principal(request), RemoteAddr: request.RemoteAddr}
+}
+
+// Changes accounts for the changes made to the file system of the Handler,
+// or of any other API serving it like the gRPC service, so they are treated
+// alike: they count against the Quotas, invalidate the caches describing the
+// changed items, are recorded in the Audit log and told to the Listeners.
+type Changes struct {
+	Editor    filesystem.Editor
+	Trash     *filesystem.Trash
+	Quotas    *Quotas
+	Digests   *filesystem.DigestCache
+	Usage     *filesystem.UsageCache
+	Audit     *AuditLog
+	Listeners []MutationListener
+}
+
+// changes returns what accounts for the changes made through the handler.
+func (h *Handler) changes() Changes {
+	return Changes{
+		Editor:    h.Editor,
+		Trash:     h.Trash,
+		Quotas:    h.Quotas,
+		Digests:   h.Digests,
+		Usage:     h.Usage,
+		Audit:     h.Audit,
+		Listeners: h.Listeners,
+	}
+}
+
+// Notify records a successful mutation at the given path made by the actor in
+// the audit log and tells every listener about it, before describes the item
+// it changed for the audit log and requestID identifies the request making
+// it. The error of the audit log is returned so the mutation is not
+// acknowledged unless it was recorded, listeners are told either way.
+func (c Changes) Notify(actor Actor, requestID string, mutationType MutationType, itemPath string, before *AuditState) error {
+	c.Digests.Forget(itemPath)
+	if c.Usage != nil {
+		c.Usage.Invalidate(itemPath)
+	}
+	err := c.audit(actor, requestID, mutationType, itemPath, before)
+	if len(c.Listeners) == 0 {
+		return err
+	}
+	mutation := Mutation{
+		Type:  mutationType,
+		Path:  itemPath,
+		Item:  FileItem{Name: path.Base(itemPath)},
+		Actor: actor,
+		Time:  time.Now().UTC(),
+	}
+	if mutationType != MutationDelete {
+		if item, err := c.Editor.Get(itemPath); err == nil {
+			mutation.Item, _ = fileItemFromFSItem(item, false)
+		}
+	}
+	for _, listener := range c.Listeners {
+		listener.OnMutation(mutation)
+	}
+	return err
+}
+
+// notify records a successful mutation made by the request, see Changes.Notify.
+func (h *Handler) notify(request *http.Request, mutationType MutationType, itemPath string, before *AuditState) error {
+	return h.changes().Notify(actorOf(request), RequestID(request), mutationType, itemPath, before)
+}
@@ -0,0 +1,43 @@
+package fshttp
+
+import (
+	_ "embed"
+	"encoding/json"
+	"log"
+	"net/http"
+	"path"
+)
+
+//go:embed openapi.json
+var openAPI []byte
+
+// OpenAPI returns the OpenAPI 3 document describing the API served by a
+// Handler, along with the errors of the middlewares of this package.
+func OpenAPI() []byte {
+	return append([]byte(nil), openAPI...)
+}
+
+// ServeOpenAPI serves the OpenAPI document with the directory it is requested
+// from as the server of the API, so /api/v1/openapi.json describes the API
+// served at /api/v1.
+func ServeOpenAPI(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet && request.Method != http.MethodHead {
+		writer.Header().Set("Allow", "GET, HEAD")
+		writeError(writer, request, methodNotAllowedError)
+		return
+	}
+	var document map[string]interface{}
+	if err := json.Unmarshal(openAPI, &document); err != nil {
+		log.Printf("failed to parse the OpenAPI document: %s", err)
+		writeError(writer, request, internalServerError)
+		return
+	}
+	document["servers"] = []map[string]string{{"url": path.Dir(fullPath(request))}}
+	writer.Header().Set("Content-Type", "application/json")
+	if request.Method == http.MethodHead {
+		return
+	}
+	if err := json.NewEncoder(writer).Encode(document); err != nil {
+		log.Printf("failed to write the OpenAPI document: %s", err)
+	}
+}
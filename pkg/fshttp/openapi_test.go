@@ -0,0 +1,400 @@
+package fshttp_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/peymanmortazavi/fs-server/pkg/filesystem"
+	"github.com/peymanmortazavi/fs-server/pkg/fshttp"
+)
+
+// resolve returns what a local reference like #/components/schemas/Error
+// points to in the document.
+func resolve(document map[string]interface{}, ref string) (map[string]interface{}, error) {
+	if !strings.HasPrefix(ref, "#/") {
+		return nil, fmt.Errorf("%s is not a local reference", ref)
+	}
+	var current interface{} = document
+	for _, key := range strings.Split(ref[2:], "/") {
+		key = strings.NewReplacer("~1", "/", "~0", "~").Replace(key)
+		object, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s does not resolve", ref)
+		}
+		if current, ok = object[key]; !ok {
+			return nil, fmt.Errorf("%s does not resolve", ref)
+		}
+	}
+	resolved, ok := current.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s is not an object", ref)
+	}
+	return resolved, nil
+}
+
+// validateSchema checks the value decoded from JSON against the subset of JSON
+// Schema the document uses.
+func validateSchema(document, schema map[string]interface{}, value interface{}, at string) error {
+	if ref, ok := schema["$ref"].(string); ok {
+		resolved, err := resolve(document, ref)
+		if err != nil {
+			return err
+		}
+		return validateSchema(document, resolved, value, at)
+	}
+	if anyOf, ok := schema["anyOf"].([]interface{}); ok {
+		var failures []string
+		for _, option := range anyOf {
+			err := validateSchema(document, option.(map[string]interface{}), value, at)
+			if err == nil {
+				return nil
+			}
+			failures = append(failures, err.Error())
+		}
+		return fmt.Errorf("%s matches none of: %s", at, strings.Join(failures, "; "))
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, allowed := range enum {
+			found = found || allowed == value
+		}
+		if !found {
+			return fmt.Errorf("%s: %v is not one of %v", at, value, enum)
+		}
+	}
+	switch schema["type"] {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s: %v is not an object", at, value)
+		}
+		required, _ := schema["required"].([]interface{})
+		for _, name := range required {
+			if _, ok := object[name.(string)]; !ok {
+				return fmt.Errorf("%s: %s is required", at, name)
+			}
+		}
+		properties, _ := schema["properties"].(map[string]interface{})
+		for name, property := range object {
+			propertySchema, ok := properties[name]
+			if !ok {
+				if schema["additionalProperties"] == false {
+					return fmt.Errorf("%s: %s is not a property", at, name)
+				}
+				continue
+			}
+			if err := validateSchema(document, propertySchema.(map[string]interface{}), property, at+"."+name); err != nil {
+				return err
+			}
+		}
+	case "array":
+		array, ok := value.([]interface{})
+		if !ok {
+			return fmt.Errorf("%s: %v is not an array", at, value)
+		}
+		for i, item := range array {
+			if err := validateSchema(document, schema["items"].(map[string]interface{}), item, fmt.Sprintf("%s[%d]", at, i)); err != nil {
+				return err
+			}
+		}
+	case "string":
+		text, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("%s: %v is not a string", at, value)
+		}
+		if schema["format"] == "date-time" {
+			if _, err := time.Parse(time.RFC3339Nano, text); err != nil {
+				return fmt.Errorf("%s: %q is not a date-time", at, text)
+			}
+		}
+	case "integer":
+		if number, ok := value.(float64); !ok || number != float64(int64(number)) {
+			return fmt.Errorf("%s: %v is not an integer", at, value)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%s: %v is not a boolean", at, value)
+		}
+	}
+	return nil
+}
+
+func loadOpenAPI(t *testing.T) map[string]interface{} {
+	t.Helper()
+	var document map[string]interface{}
+	if err := json.Unmarshal(fshttp.OpenAPI(), &document); err != nil {
+		t.Fatalf("failed to parse the OpenAPI document: %s", err)
+	}
+	return document
+}
+
+func TestOpenAPIDocument(t *testing.T) {
+	document := loadOpenAPI(t)
+	if version, _ := document["openapi"].(string); !strings.HasPrefix(version, "3.") {
+		t.Errorf("expected an OpenAPI 3 document but got %q", version)
+	}
+
+	// every reference resolves.
+	var walk func(value interface{})
+	walk = func(value interface{}) {
+		switch value := value.(type) {
+		case map[string]interface{}:
+			if ref, ok := value["$ref"].(string); ok {
+				if _, err := resolve(document, ref); err != nil {
+					t.Errorf("invalid reference: %s", err)
+				}
+			}
+			for _, child := range value {
+				walk(child)
+			}
+		case []interface{}:
+			for _, child := range value {
+				walk(child)
+			}
+		}
+	}
+	walk(document)
+
+	// every operation is identified, answers something and declares its path
+	// parameters.
+	operations := make(map[string]bool)
+	for route, item := range document["paths"].(map[string]interface{}) {
+		pathItem := item.(map[string]interface{})
+		declared := make(map[string]bool)
+		parameters, _ := pathItem["parameters"].([]interface{})
+		for _, parameter := range parameters {
+			if resolved, err := resolve(document, parameter.(map[string]interface{})["$ref"].(string)); err == nil && resolved["in"] == "path" {
+				declared[resolved["name"].(string)] = true
+				// item paths contain slashes, which path parameters cannot.
+				if resolved["x-wildcard"] != true {
+					t.Errorf("%s: the path parameter %s is not marked x-wildcard", route, resolved["name"])
+				}
+			}
+		}
+		for _, name := range regexp.MustCompile(`\{([^}]+)\}`).FindAllStringSubmatch(route, -1) {
+			if !declared[name[1]] {
+				t.Errorf("%s: the path parameter %s is not declared", route, name[1])
+			}
+		}
+		for method, operation := range pathItem {
+			if method == "parameters" {
+				continue
+			}
+			id, _ := operation.(map[string]interface{})["operationId"].(string)
+			if id == "" || operations[id] {
+				t.Errorf("%s %s: the operation ID %q is missing or not unique", method, route, id)
+			}
+			operations[id] = true
+			if responses, _ := operation.(map[string]interface{})["responses"].(map[string]interface{}); len(responses) == 0 {
+				t.Errorf("%s %s: no response is described", method, route)
+			}
+		}
+	}
+
+	// the error IDs are the ones of the package.
+	files, _ := filepath.Glob("*.go")
+	var ids []string
+	seen := make(map[string]bool)
+	for _, file := range files {
+		if strings.HasSuffix(file, "_test.go") {
+			continue
+		}
+		source, _ := ioutil.ReadFile(file)
+		for _, match := range regexp.MustCompile(`ID:\s+"([a-z-]+)"`).FindAllStringSubmatch(string(source), -1) {
+			if !seen[match[1]] {
+				seen[match[1]] = true
+				ids = append(ids, match[1])
+			}
+		}
+	}
+	sort.Strings(ids)
+	errorIDs, _ := resolve(document, "#/components/schemas/ErrorID")
+	var documented []string
+	for _, id := range errorIDs["enum"].([]interface{}) {
+		documented = append(documented, id.(string))
+	}
+	sort.Strings(documented)
+	if strings.Join(documented, ",") != strings.Join(ids, ",") {
+		t.Errorf("expected the documented error IDs to be\n%v\nbut got\n%v", ids, documented)
+	}
+}
+
+func TestOpenAPIResponses(t *testing.T) {
+	document := loadOpenAPI(t)
+	versioned := filesystem.NewVersioned(filesystem.DirManager{Root: t.TempDir()})
+	trash, err := filesystem.NewTrash(versioned)
+	if err != nil {
+		t.Fatalf("failed to create trash: %s", err)
+	}
+	hub := &filesystem.EventHub{}
+	hub.Publish(filesystem.Created, "docs", "")
+	hub.Publish(filesystem.Deleted, "docs", "")
+	handler := &fshttp.Handler{
+		Editor:   trash,
+		Watcher:  hub,
+		Trash:    trash,
+		Versions: versioned,
+		Quotas:   &fshttp.Quotas{Rules: []fshttp.QuotaRule{{Prefix: "docs", MaxBytes: 1 << 20}}},
+		Uploads:  &fshttp.Uploads{Dir: t.TempDir()},
+		Usage:    &filesystem.UsageCache{},
+	}
+	router := &fshttp.Router{}
+	router.Mount("/v1", handler)
+	router.Handle("/v1/openapi.json", http.HandlerFunc(fshttp.ServeOpenAPI))
+
+	var trashID, upload string
+	for _, step := range []struct {
+		method, url, body string
+		header            map[string]string
+	}{
+		{method: "POST", url: "/v1/docs", body: `{"type": "dir"}`},
+		{method: "POST", url: "/v1/docs/a.txt", body: `{"type": "file", "data": "hello"}`},
+		{method: "POST", url: "/v1/docs/a.txt", body: `{"type": "file", "data": "again"}`},
+		{method: "POST", url: "/v1/docs/b.txt", body: `not json`},
+		{method: "PUT", url: "/v1/docs/a.txt", body: `{"data": "hello world"}`},
+		{method: "PUT", url: "/v1/docs", body: `{"data": "hello world"}`},
+		{method: "GET", url: "/v1/docs/a.txt?checksum=sha256"},
+		{method: "GET", url: "/v1/docs%2Fa.txt"},
+		{method: "GET", url: "/v1/docs/a.txt?checksum=sha3"},
+		{method: "GET", url: "/v1/?populateData=true&usage=true&depth=1"},
+		{method: "GET", url: "/v1/missing.txt"},
+		{method: "GET", url: "/v1/?search=*.txt&grep=hello"},
+		{method: "GET", url: "/v1/?search=["},
+		{method: "GET", url: "/v1/docs/a.txt?versions"},
+		{method: "GET", url: "/v1/docs/a.txt?version=1"},
+		{method: "GET", url: "/v1/docs/a.txt?version=9"},
+		{method: "PUT", url: "/v1/docs/a.txt?version=1"},
+		{method: "GET", url: "/v1/?quota=true"},
+		{method: "GET", url: "/v1/?watch=true&recursive=true", header: map[string]string{"Last-Event-ID": "1"}},
+		{method: "GET", url: "/v1/?watch=true&lastEventId=x"},
+		{method: "DELETE", url: "/v1/docs"},
+		{method: "DELETE", url: "/v1/"},
+		{method: "DELETE", url: "/v1/docs?permanent=true"},
+		{method: "DELETE", url: "/v1/docs/a.txt"},
+		{method: "GET", url: "/v1/?trash=true"},
+		{method: "POST", url: "/v1/?restore={trash}"},
+		{method: "POST", url: "/v1/?restore=missing"},
+		{method: "POST", url: "/v1/docs/c.txt", header: map[string]string{"Upload-Length": "5", "Tus-Resumable": "1.0.0"}},
+		{method: "HEAD", url: "{upload}", header: map[string]string{"Tus-Resumable": "1.0.0"}},
+		{method: "PATCH", url: "{upload}", body: "hel", header: map[string]string{"Upload-Offset": "0", "Content-Type": "application/offset+octet-stream", "Tus-Resumable": "1.0.0"}},
+		{method: "PATCH", url: "{upload}", body: "lo", header: map[string]string{"Upload-Offset": "0", "Content-Type": "application/offset+octet-stream", "Tus-Resumable": "1.0.0"}},
+		{method: "PATCH", url: "{upload}", body: "lo", header: map[string]string{"Upload-Offset": "3", "Content-Type": "application/offset+octet-stream", "Tus-Resumable": "1.0.0"}},
+		{method: "HEAD", url: "{upload}", header: map[string]string{"Tus-Resumable": "1.0.0"}},
+		{method: "OPTIONS", url: "/v1/docs/c.txt"},
+		{method: "TRACE", url: "/v1/docs/a.txt"},
+		{method: "GET", url: "/v1/openapi.json"},
+	} {
+		url := strings.NewReplacer("{trash}", trashID, "{upload}", upload).Replace(step.url)
+		request := httptest.NewRequest(step.method, url, strings.NewReader(step.body))
+		for name, value := range step.header {
+			request.Header.Set(name, value)
+		}
+		if strings.Contains(url, "watch=true") {
+			// a watch streams until the client goes away.
+			ctx, cancel := context.WithTimeout(request.Context(), 50*time.Millisecond)
+			request = request.WithContext(ctx)
+			defer cancel()
+		}
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		if location := recorder.Header().Get("Location"); location != "" {
+			upload = location
+		}
+		if strings.Contains(url, "trash=true") {
+			var entries []fshttp.TrashEntry
+			json.Unmarshal(recorder.Body.Bytes(), &entries)
+			if len(entries) > 0 {
+				trashID = entries[0].ID
+			}
+		}
+
+		route := "/{path}"
+		if url == "/v1/openapi.json" {
+			route = "/openapi.json"
+		}
+		operation, ok := document["paths"].(map[string]interface{})[route].(map[string]interface{})[strings.ToLower(step.method)].(map[string]interface{})
+		if !ok {
+			if recorder.Code != http.StatusMethodNotAllowed {
+				t.Errorf("%s %s: undocumented method answered %d", step.method, url, recorder.Code)
+			}
+			continue
+		}
+		responses := operation["responses"].(map[string]interface{})
+		response, ok := responses[strconv.Itoa(recorder.Code)].(map[string]interface{})
+		if !ok {
+			if response, ok = responses["default"].(map[string]interface{}); !ok || recorder.Code < 400 {
+				t.Errorf("%s %s: the status %d is not documented", step.method, url, recorder.Code)
+				continue
+			}
+		}
+		if ref, ok := response["$ref"].(string); ok {
+			response, _ = resolve(document, ref)
+		}
+		if recorder.Body.Len() == 0 {
+			continue
+		}
+		contentType := strings.SplitN(recorder.Header().Get("Content-Type"), ";", 2)[0]
+		media, ok := response["content"].(map[string]interface{})[contentType].(map[string]interface{})
+		if !ok {
+			t.Errorf("%s %s: the %s content of %d is not documented", step.method, url, contentType, recorder.Code)
+			continue
+		}
+		if contentType == "text/event-stream" {
+			// every event carries a WatchEvent as its data.
+			events := 0
+			for _, line := range strings.Split(recorder.Body.String(), "\n") {
+				if !strings.HasPrefix(line, "data: ") {
+					continue
+				}
+				events++
+				var event interface{}
+				if err := json.Unmarshal([]byte(line[len("data: "):]), &event); err != nil {
+					t.Errorf("%s %s: the event is not JSON: %s", step.method, url, err)
+				} else if err := validateSchema(document, map[string]interface{}{"$ref": "#/components/schemas/WatchEvent"}, event, "event"); err != nil {
+					t.Errorf("%s %s streamed an event not matching the document: %s", step.method, url, err)
+				}
+			}
+			if events == 0 {
+				t.Errorf("%s %s: expected the recorded events to be replayed", step.method, url)
+			}
+			continue
+		}
+		var body interface{}
+		if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+			t.Errorf("%s %s: the body is not JSON: %s", step.method, url, err)
+			continue
+		}
+		if err := validateSchema(document, media["schema"].(map[string]interface{}), body, "body"); err != nil {
+			t.Errorf("%s %s answered %d not matching the document: %s", step.method, url, recorder.Code, err)
+		}
+	}
+	if trashID == "" {
+		t.Errorf("expected the trash to have an entry")
+	}
+	if _, err := trash.Get("docs/c.txt"); err != nil {
+		t.Errorf("expected the upload to be finished: %s", err)
+	}
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", "/v1/openapi.json", nil))
+	var served struct {
+		Servers []struct {
+			URL string `json:"url"`
+		} `json:"servers"`
+	}
+	json.Unmarshal(recorder.Body.Bytes(), &served)
+	if len(served.Servers) != 1 || served.Servers[0].URL != "/v1" {
+		t.Errorf("expected the document to be served for /v1 but got %+v", served.Servers)
+	}
+}
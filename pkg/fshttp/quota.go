@@ -0,0 +1,723 @@
+package fshttp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/peymanmortazavi/fs-server/pkg/filesystem"
+)
+
+// anyPrincipal is the principal of a rule applying to every principal without a rule of its own.
+const anyPrincipal = "*"
+
+var quotaExceeded = Error{
+	Status:        http.StatusInsufficientStorage,
+	ID:            "quota-exceeded",
+	UserMessage:   "not enough quota left for this change.",
+	SystemMessage: "the change would exceed a storage quota.",
+}
+
+// QuotaRule limits the bytes and the number of items beneath a path prefix or
+// written by a principal. Zero limits are not enforced.
+type QuotaRule struct {
+	Prefix    string `json:"prefix,omitempty"`
+	Principal string `json:"principal,omitempty"`
+	MaxBytes  int64  `json:"max_bytes,omitempty"`
+	MaxFiles  int64  `json:"max_files,omitempty"`
+}
+
+// Usage is the consumption of storage.
+type Usage struct {
+	Bytes int64 `json:"bytes"`
+	Files int64 `json:"files"`
+}
+
+func (u Usage) add(other Usage) Usage {
+	return Usage{Bytes: u.Bytes + other.Bytes, Files: u.Files + other.Files}
+}
+
+func (u Usage) negate() Usage {
+	return Usage{Bytes: -u.Bytes, Files: -u.Files}
+}
+
+// growth returns the positive parts of a change in usage.
+func (u Usage) growth() Usage {
+	var growth Usage
+	if u.Bytes > 0 {
+		growth.Bytes = u.Bytes
+	}
+	if u.Files > 0 {
+		growth.Files = u.Files
+	}
+	return growth
+}
+
+// QuotaStatus is a quota rule along with its current usage.
+type QuotaStatus struct {
+	QuotaRule
+	Used Usage `json:"used"`
+}
+
+type ownership struct {
+	Principal string `json:"principal"`
+	Size      int64  `json:"size"`
+}
+
+// Quotas enforces quota rules on the changes accounted for by Changes.
+//
+// Usage beneath prefixes is measured once by Init and then tracked with every
+// change. Usage of principals is the content they have written, the last writer
+// of a file owns it, and it is persisted to StatePath when set.
+//
+// Items moved to the Trash keep counting beneath their path and for the
+// principals who wrote them until they are purged, Purged should be set as
+// the Purging function of the Trash. Likewise the versions kept by Versions
+// count beneath the path of their file and for the principal who wrote them,
+// VersionKept and VersionRemoved should be set as its Kept and Removed
+// functions. Overwriting a file is only allowed when its previous content
+// fits as a version.
+type Quotas struct {
+	Rules     []QuotaRule
+	StatePath string
+	Trash     *filesystem.Trash
+	Versions  *filesystem.Versioned
+
+	mu         sync.Mutex
+	prefixes   map[string]Usage
+	principals map[string]Usage
+	owners     map[string]ownership
+}
+
+// LoadQuotaRules reads a JSON list of quota rules from a file.
+func LoadQuotaRules(path string) ([]QuotaRule, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules []QuotaRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("invalid quota rules in %s: %s", path, err)
+	}
+	for _, rule := range rules {
+		if rule.Prefix != "" && rule.Principal != "" {
+			return nil, fmt.Errorf("invalid quota rules in %s: a rule limits either a prefix or a principal", path)
+		}
+	}
+	return rules, nil
+}
+
+func (q *Quotas) reset() {
+	q.prefixes = make(map[string]Usage)
+	q.principals = make(map[string]Usage)
+	q.owners = make(map[string]ownership)
+}
+
+// Init measures the usage beneath every prefix, including what was moved to
+// the trash from beneath it and the versions of its files, and loads the usage
+// of principals.
+func (q *Quotas) Init(viewer filesystem.Viewer) error {
+	// the trash and versions are read before locking, purging and keeping
+	// versions lock the other way around.
+	var trashed []filesystem.TrashEntry
+	if q.Trash != nil {
+		var err error
+		if trashed, err = q.Trash.Entries(); err != nil {
+			return fmt.Errorf("failed to list the trash: %s", err)
+		}
+	}
+	versions := make(map[string]Usage)
+	if q.Versions != nil {
+		for _, rule := range q.Rules {
+			if rule.Principal != "" {
+				continue
+			}
+			prefix := strings.Trim(rule.Prefix, "/")
+			usage, err := q.Versions.Usage(prefix)
+			if err != nil {
+				return fmt.Errorf("failed to measure usage of %s in versions: %s", rule.Prefix, err)
+			}
+			versions[prefix] = Usage{Bytes: usage.Bytes, Files: usage.Files}
+		}
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.reset()
+
+	for i, rule := range q.Rules {
+		if rule.Principal != "" {
+			continue
+		}
+		q.Rules[i].Prefix = strings.Trim(rule.Prefix, "/")
+		usage, err := measure(context.Background(), viewer, q.Rules[i].Prefix)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to measure usage of %s: %s", rule.Prefix, err)
+		}
+		for _, entry := range trashed {
+			inTrash, err := q.trashUsage(entry, q.Rules[i].Prefix)
+			if err != nil {
+				return fmt.Errorf("failed to measure usage of %s in the trash: %s", rule.Prefix, err)
+			}
+			usage = usage.add(inTrash)
+		}
+		q.prefixes[q.Rules[i].Prefix] = usage.add(versions[q.Rules[i].Prefix])
+	}
+
+	if q.StatePath == "" {
+		return nil
+	}
+	data, err := ioutil.ReadFile(q.StatePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if err := json.Unmarshal(data, &q.owners); err != nil {
+		return fmt.Errorf("invalid quota state in %s: %s", q.StatePath, err)
+	}
+	for _, owner := range q.owners {
+		q.principals[owner.Principal] = q.principals[owner.Principal].add(Usage{Bytes: owner.Size, Files: 1})
+	}
+	return nil
+}
+
+// measure returns the usage of the item at path and everything beneath it.
+func measure(ctx context.Context, viewer filesystem.Viewer, itemPath string) (Usage, error) {
+	total, _, err := filesystem.Measure(ctx, viewer, itemPath, 0)
+	if err != nil {
+		return Usage{}, err
+	}
+	usage := Usage{Bytes: total.Bytes, Files: total.Files + total.Dirs}
+	if itemPath == "" {
+		// the root itself is not counted.
+		usage.Files--
+	}
+	return usage, nil
+}
+
+func within(itemPath, prefix string) bool {
+	return prefix == "" || itemPath == prefix || strings.HasPrefix(itemPath, prefix+"/")
+}
+
+func (q *Quotas) principalRule(principal string) (QuotaRule, bool) {
+	fallback, found := QuotaRule{}, false
+	for _, rule := range q.Rules {
+		switch rule.Principal {
+		case principal:
+			return rule, true
+		case anyPrincipal:
+			fallback, found = rule, true
+		}
+	}
+	return fallback, found && principal != ""
+}
+
+func exceeds(rule QuotaRule, usage, delta Usage) bool {
+	return (rule.MaxBytes > 0 && delta.Bytes > 0 && usage.Bytes+delta.Bytes > rule.MaxBytes) ||
+		(rule.MaxFiles > 0 && delta.Files > 0 && usage.Files+delta.Files > rule.MaxFiles)
+}
+
+// check returns quotaExceeded if adding delta beneath path, written by principal, exceeds a rule.
+func (q *Quotas) check(principal, itemPath string, delta, principalDelta Usage) error {
+	for _, rule := range q.Rules {
+		if rule.Principal == "" && within(itemPath, rule.Prefix) && exceeds(rule, q.prefixes[rule.Prefix], delta) {
+			return quotaExceeded
+		}
+	}
+	if rule, ok := q.principalRule(principal); ok && exceeds(rule, q.principals[principal], principalDelta) {
+		return quotaExceeded
+	}
+	return nil
+}
+
+// deltas returns the change in usage beneath path and of principal when the
+// item at path changes from oldSize to newSize bytes.
+func (q *Quotas) deltas(principal, itemPath string, oldSize, newSize int64, created bool) (Usage, Usage) {
+	delta := Usage{Bytes: newSize - oldSize}
+	if created {
+		delta.Files = 1
+	}
+	principalDelta := Usage{Bytes: newSize, Files: 1}
+	if previous, owned := q.owners[itemPath]; owned && previous.Principal == principal {
+		principalDelta = Usage{Bytes: newSize - previous.Size}
+	}
+	return delta, principalDelta
+}
+
+// Allows returns quotaExceeded if principal cannot change the item at path from
+// oldSize to newSize bytes, created tells if the item would be new.
+//
+// Nothing is held, use Reserve for a change that is about to be made.
+func (q *Quotas) Allows(principal, itemPath string, oldSize, newSize int64, created bool) error {
+	if q == nil {
+		return nil
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delta, principalDelta := q.deltas(principal, itemPath, oldSize, newSize, created)
+	return q.check(principal, itemPath, delta.add(q.version(oldSize, created)), principalDelta)
+}
+
+// version returns the usage of the version kept of an item of oldSize bytes
+// being overwritten, none when versions are not kept.
+func (q *Quotas) version(oldSize int64, created bool) Usage {
+	if q.Versions == nil || created || oldSize == 0 {
+		return Usage{}
+	}
+	return Usage{Bytes: oldSize, Files: 1}
+}
+
+// Reservation holds the usage a change is allowed to add until the change is
+// committed or released, so concurrent changes cannot exceed the quotas
+// together. A nil Reservation does nothing.
+type Reservation struct {
+	quotas    *Quotas
+	principal string
+	path      string
+	oldSize   int64
+	created   bool
+	// held is the usage added beneath path and principalHeld the one added
+	// to principal, only growth is held.
+	held          Usage
+	principalHeld Usage
+	done          bool
+}
+
+// Reserve returns quotaExceeded if principal cannot change the item at path
+// from oldSize to newSize bytes, created tells if the item would be new.
+// Otherwise the added usage is held until the returned reservation is
+// committed or released.
+func (q *Quotas) Reserve(principal, itemPath string, oldSize, newSize int64, created bool) (*Reservation, error) {
+	if q == nil {
+		return nil, nil
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.owners == nil {
+		q.reset()
+	}
+	delta, principalDelta := q.deltas(principal, itemPath, oldSize, newSize, created)
+	// the version is held along with the change, it is recorded on its own
+	// once kept.
+	delta = delta.add(q.version(oldSize, created))
+	if err := q.check(principal, itemPath, delta, principalDelta); err != nil {
+		return nil, err
+	}
+	reservation := &Reservation{
+		quotas:        q,
+		principal:     principal,
+		path:          itemPath,
+		oldSize:       oldSize,
+		created:       created,
+		held:          delta.growth(),
+		principalHeld: principalDelta.growth(),
+	}
+	q.hold(reservation, 1)
+	return reservation, nil
+}
+
+// hold adds the usage held by a reservation, or removes it when sign is -1,
+// the caller must hold the lock.
+func (q *Quotas) hold(reservation *Reservation, sign int64) {
+	held, principalHeld := reservation.held, reservation.principalHeld
+	if sign < 0 {
+		held, principalHeld = held.negate(), principalHeld.negate()
+	}
+	for prefix, usage := range q.prefixes {
+		if within(reservation.path, prefix) {
+			q.prefixes[prefix] = usage.add(held)
+		}
+	}
+	if reservation.principal == "" {
+		return
+	}
+	usage := q.principals[reservation.principal].add(principalHeld)
+	if usage == (Usage{}) {
+		// principals without any content are not reported.
+		delete(q.principals, reservation.principal)
+		return
+	}
+	q.principals[reservation.principal] = usage
+}
+
+// Commit records that the change was made and the item now has newSize bytes.
+func (r *Reservation) Commit(newSize int64) {
+	if r == nil {
+		return
+	}
+	q := r.quotas
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if r.done {
+		return
+	}
+	r.done = true
+	q.hold(r, -1)
+	q.record(r.principal, r.path, r.oldSize, newSize, r.created)
+}
+
+// Release gives back the usage held for a change that was not made, it does
+// nothing once the reservation is committed so it can be deferred.
+func (r *Reservation) Release() {
+	if r == nil {
+		return
+	}
+	q := r.quotas
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if r.done {
+		return
+	}
+	r.done = true
+	q.hold(r, -1)
+}
+
+// record tracks that principal changed the item at path from oldSize to
+// newSize bytes, created tells if the item is new. The caller must hold the lock.
+func (q *Quotas) record(principal, itemPath string, oldSize, newSize int64, created bool) {
+	delta, _ := q.deltas(principal, itemPath, oldSize, newSize, created)
+	for prefix, usage := range q.prefixes {
+		if within(itemPath, prefix) {
+			q.prefixes[prefix] = usage.add(delta)
+		}
+	}
+	if previous, owned := q.owners[itemPath]; owned {
+		q.principals[previous.Principal] = q.principals[previous.Principal].add(Usage{Bytes: -previous.Size, Files: -1})
+		delete(q.owners, itemPath)
+	}
+	if principal != "" {
+		q.owners[itemPath] = ownership{Principal: principal, Size: newSize}
+		q.principals[principal] = q.principals[principal].add(Usage{Bytes: newSize, Files: 1})
+	}
+	q.save()
+}
+
+// Discharge records the removal of the item at path, which used removed along
+// with everything beneath it.
+func (q *Quotas) Discharge(itemPath string, removed Usage) {
+	if q == nil {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for prefix, usage := range q.prefixes {
+		switch {
+		case within(itemPath, prefix):
+			q.prefixes[prefix] = usage.add(Usage{Bytes: -removed.Bytes, Files: -removed.Files})
+		case within(prefix, itemPath):
+			// the whole prefix was removed.
+			q.prefixes[prefix] = Usage{}
+		}
+	}
+	for p, owner := range q.owners {
+		if within(p, itemPath) && !reserved(p) {
+			q.principals[owner.Principal] = q.principals[owner.Principal].add(Usage{Bytes: -owner.Size, Files: -1})
+			delete(q.owners, p)
+		}
+	}
+	q.save()
+}
+
+// Move moves the item at oldPath to newPath and records that the storage it
+// uses moved along, failing with quotaExceeded when a prefix it enters cannot
+// take it.
+func (c Changes) Move(ctx context.Context, oldPath, newPath string) error {
+	mover, ok := c.Editor.(filesystem.Mover)
+	if !ok {
+		return filesystem.MoveUnsupported
+	}
+	if c.Quotas == nil {
+		return mover.Move(oldPath, newPath)
+	}
+	moved, err := measure(ctx, c.Editor, oldPath)
+	if err != nil {
+		return err
+	}
+	return c.Quotas.move(ctx, c.Editor, oldPath, newPath, moved, mover)
+}
+
+// move moves the item at oldPath, which uses moved along with everything
+// beneath it, to newPath unless a prefix it enters cannot take it. The usage
+// of the prefixes and the owners of its files follow it, prefixes beneath
+// newPath are measured again as they were empty.
+func (q *Quotas) move(ctx context.Context, viewer filesystem.Viewer, oldPath, newPath string, moved Usage, mover filesystem.Mover) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.owners == nil {
+		q.reset()
+	}
+	for _, rule := range q.Rules {
+		if rule.Principal == "" && within(newPath, rule.Prefix) && !within(oldPath, rule.Prefix) && exceeds(rule, q.prefixes[rule.Prefix], moved) {
+			return quotaExceeded
+		}
+	}
+	if err := mover.Move(oldPath, newPath); err != nil {
+		return err
+	}
+	for prefix, usage := range q.prefixes {
+		left, entered := within(oldPath, prefix), within(newPath, prefix)
+		switch {
+		case left && !entered:
+			q.prefixes[prefix] = usage.add(moved.negate())
+		case entered && !left:
+			q.prefixes[prefix] = usage.add(moved)
+		case within(prefix, oldPath):
+			q.prefixes[prefix] = Usage{}
+		case within(prefix, newPath):
+			q.prefixes[prefix], _ = measure(ctx, viewer, prefix)
+		}
+	}
+	owned := make(map[string]ownership)
+	for p, owner := range q.owners {
+		if within(p, oldPath) && !reserved(p) {
+			owned[newPath+strings.TrimPrefix(p, oldPath)] = owner
+			delete(q.owners, p)
+		}
+	}
+	for p, owner := range owned {
+		q.owners[p] = owner
+	}
+	q.save()
+	return nil
+}
+
+// reserved returns if the ownership key is the one of an item in the trash or
+// of a version.
+func reserved(key string) bool {
+	return within(key, filesystem.TrashDir) || within(key, filesystem.VersionsDir)
+}
+
+// versionKey returns the key the ownership of a version of the file at path
+// is kept with.
+func versionKey(itemPath string, number int) string {
+	return path.Join(filesystem.VersionsDir, url.PathEscape(itemPath), strconv.Itoa(number))
+}
+
+// VersionKept records that a version of the file at path was kept, it counts
+// for the principal who wrote the file.
+func (q *Quotas) VersionKept(itemPath string, version filesystem.Version) {
+	if q == nil {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.owners == nil {
+		q.reset()
+	}
+	usage := Usage{Bytes: version.Size, Files: 1}
+	for prefix, current := range q.prefixes {
+		if within(itemPath, prefix) {
+			q.prefixes[prefix] = current.add(usage)
+		}
+	}
+	if owner, owned := q.owners[itemPath]; owned {
+		q.owners[versionKey(itemPath, version.Number)] = ownership{Principal: owner.Principal, Size: version.Size}
+		q.principals[owner.Principal] = q.principals[owner.Principal].add(usage)
+	}
+	q.save()
+}
+
+// VersionRemoved records that a version of the file at path was removed.
+func (q *Quotas) VersionRemoved(itemPath string, version filesystem.Version) {
+	if q == nil {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	usage := Usage{Bytes: -version.Size, Files: -1}
+	for prefix, current := range q.prefixes {
+		if within(itemPath, prefix) {
+			q.prefixes[prefix] = current.add(usage)
+		}
+	}
+	key := versionKey(itemPath, version.Number)
+	if owner, owned := q.owners[key]; owned {
+		q.principals[owner.Principal] = q.principals[owner.Principal].add(Usage{Bytes: -owner.Size, Files: -1})
+		delete(q.owners, key)
+	}
+	q.save()
+}
+
+// trashKey returns the key the ownership of the file at path is kept with
+// while it is in the trash entry with the given id.
+func trashKey(id, itemPath string) string {
+	return path.Join(filesystem.TrashDir, id, itemPath)
+}
+
+// trashUsage returns what the items of a trash entry that were beneath prefix use.
+func (q *Quotas) trashUsage(entry filesystem.TrashEntry, prefix string) (Usage, error) {
+	if !within(entry.Path, prefix) && !within(prefix, entry.Path) {
+		return Usage{}, nil
+	}
+	usage, err := q.Trash.Usage(entry, prefix)
+	return Usage{Bytes: usage.Bytes, Files: usage.Files + usage.Dirs}, err
+}
+
+// Trashed records that the item at the path of entry was moved to the trash,
+// its usage keeps counting until the entry is purged.
+func (q *Quotas) Trashed(entry filesystem.TrashEntry) {
+	if q == nil {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for p, owner := range q.owners {
+		if within(p, entry.Path) && !reserved(p) {
+			q.owners[trashKey(entry.ID, p)] = owner
+			delete(q.owners, p)
+		}
+	}
+	q.save()
+}
+
+// Restored records that the items of a trash entry returned to their path.
+func (q *Quotas) Restored(entry filesystem.TrashEntry) {
+	if q == nil {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	prefix := trashKey(entry.ID, "")
+	for p, owner := range q.owners {
+		if strings.HasPrefix(p, prefix+"/") {
+			q.owners[p[len(prefix)+1:]] = owner
+			delete(q.owners, p)
+		}
+	}
+	q.save()
+}
+
+// Purged records the removal of a trash entry, it must be called while its
+// content can still be measured.
+func (q *Quotas) Purged(entry filesystem.TrashEntry) {
+	if q == nil || q.Trash == nil {
+		return
+	}
+	removed := make(map[string]Usage)
+	for _, rule := range q.Rules {
+		if rule.Principal != "" {
+			continue
+		}
+		usage, err := q.trashUsage(entry, rule.Prefix)
+		if err != nil {
+			log.Printf("failed to measure usage of %s in the trash: %s", rule.Prefix, err)
+			continue
+		}
+		removed[rule.Prefix] = usage
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for prefix, usage := range removed {
+		if current, ok := q.prefixes[prefix]; ok {
+			q.prefixes[prefix] = current.add(usage.negate())
+		}
+	}
+	prefix := trashKey(entry.ID, "")
+	for p, owner := range q.owners {
+		if strings.HasPrefix(p, prefix+"/") {
+			q.principals[owner.Principal] = q.principals[owner.Principal].add(Usage{Bytes: -owner.Size, Files: -1})
+			delete(q.owners, p)
+		}
+	}
+	q.save()
+}
+
+// save persists the ownership of files, the caller must hold the lock.
+func (q *Quotas) save() {
+	if q.StatePath == "" {
+		return
+	}
+	data, err := json.Marshal(q.owners)
+	if err != nil {
+		return
+	}
+	temporary := q.StatePath + ".tmp"
+	if err := ioutil.WriteFile(temporary, data, 0600); err != nil {
+		log.Printf("failed to save quota state: %s", err)
+		return
+	}
+	if err := os.Rename(temporary, q.StatePath); err != nil {
+		log.Printf("failed to save quota state: %s", err)
+	}
+}
+
+// Status returns every rule along with its current usage. Rules applying to any
+// principal are reported once for every principal using storage.
+func (q *Quotas) Status() []QuotaStatus {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	statuses := make([]QuotaStatus, 0, len(q.Rules))
+	explicit := make(map[string]bool)
+	for _, rule := range q.Rules {
+		if rule.Principal != "" {
+			explicit[rule.Principal] = true
+		}
+	}
+	for _, rule := range q.Rules {
+		switch rule.Principal {
+		case "":
+			statuses = append(statuses, QuotaStatus{QuotaRule: rule, Used: q.prefixes[rule.Prefix]})
+		case anyPrincipal:
+			principals := make([]string, 0, len(q.principals))
+			for principal := range q.principals {
+				if !explicit[principal] {
+					principals = append(principals, principal)
+				}
+			}
+			sort.Strings(principals)
+			for _, principal := range principals {
+				perPrincipal := rule
+				perPrincipal.Principal = principal
+				statuses = append(statuses, QuotaStatus{QuotaRule: perPrincipal, Used: q.principals[principal]})
+			}
+		default:
+			statuses = append(statuses, QuotaStatus{QuotaRule: rule, Used: q.principals[rule.Principal]})
+		}
+	}
+	return statuses
+}
+
+// PrincipalStatus returns the rule limiting principal along with its usage.
+func (q *Quotas) PrincipalStatus(principal string) (QuotaStatus, bool) {
+	if principal == "" {
+		return QuotaStatus{}, false
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	rule, ok := q.principalRule(principal)
+	if !ok {
+		return QuotaStatus{}, false
+	}
+	rule.Principal = principal
+	return QuotaStatus{QuotaRule: rule, Used: q.principals[principal]}, true
+}
+
+// handleQuota writes the quota usage, every quota to Administrators and only
+// the one limiting the principal of the request to anyone else.
+func (h *Handler) handleQuota(writer http.ResponseWriter, request *http.Request) error {
+	statuses := []QuotaStatus{}
+	switch {
+	case h.Quotas == nil:
+	case h.isAdministrator(request):
+		statuses = h.Quotas.Status()
+	default:
+		if status, ok := h.Quotas.PrincipalStatus(Principal(request)); ok {
+			statuses = append(statuses, status)
+		}
+	}
+	if err := writeJSON(writer, statuses); err != nil {
+		log.Printf("failed to write quota usage: %s", err)
+	}
+	return nil
+}
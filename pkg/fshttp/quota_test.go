@@ -0,0 +1,179 @@
+package fshttp_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/peymanmortazavi/fs-server/pkg/filesystem"
+	"github.com/peymanmortazavi/fs-server/pkg/fshttp"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestQuotas(t *testing.T) {
+	manager := filesystem.DirManager{Root: t.TempDir()}
+	quotas := &fshttp.Quotas{Rules: []fshttp.QuotaRule{
+		{Prefix: "limited", MaxBytes: 10},
+		{Principal: "*", MaxFiles: 2},
+	}}
+	if err := quotas.Init(manager); err != nil {
+		t.Fatalf("failed to initialize quotas: %s", err)
+	}
+	handler := &fshttp.Handler{Editor: manager, Quotas: quotas, Administrators: []string{"root"}}
+
+	testCases := []struct {
+		principal string
+		method    string
+		path      string
+		body      string
+		status    int
+	}{
+		{principal: "alice", method: "POST", path: "/limited", body: `{"type": "dir"}`, status: 200},
+		{principal: "alice", method: "POST", path: "/limited/a.txt", body: `{"type": "file", "data": "12345678"}`, status: 200},
+		{principal: "alice", method: "POST", path: "/other.txt", body: `{"type": "file"}`, status: 507},
+		{principal: "bob", method: "POST", path: "/limited/b.txt", body: `{"type": "file", "data": "123"}`, status: 507},
+		{principal: "bob", method: "POST", path: "/limited/b.txt", body: `{"type": "file", "data": "12"}`, status: 200},
+		{principal: "bob", method: "PUT", path: "/limited/b.txt", body: `{"data": "123"}`, status: 507},
+		{principal: "alice", method: "DELETE", path: "/limited/a.txt", status: 200},
+		{principal: "bob", method: "PUT", path: "/limited/b.txt", body: `{"data": "123"}`, status: 200},
+	}
+	for _, testCase := range testCases {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(testCase.method, testCase.path, strings.NewReader(testCase.body))
+		handler.ServeHTTP(recorder, fshttp.WithPrincipal(request, testCase.principal))
+		if recorder.Code != testCase.status {
+			t.Errorf("unexpected status code for %s %s by %s: expected %d, got %d: %s",
+				testCase.method, testCase.path, testCase.principal, testCase.status, recorder.Code, recorder.Body)
+		}
+	}
+
+	usage := func(principal string) []fshttp.QuotaStatus {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, fshttp.WithPrincipal(httptest.NewRequest("GET", "/?quota=true", nil), principal))
+		var statuses []fshttp.QuotaStatus
+		if err := json.NewDecoder(recorder.Body).Decode(&statuses); err != nil {
+			t.Fatalf("failed to decode quota usage: %s", err)
+		}
+		return statuses
+	}
+
+	// principals only see their own usage.
+	if statuses := usage(""); len(statuses) != 0 {
+		t.Errorf("expected anonymous requests to see no quota but got %+v", statuses)
+	}
+	if statuses := usage("carol"); len(statuses) != 1 || statuses[0].Principal != "carol" || statuses[0].Used != (fshttp.Usage{}) {
+		t.Errorf("unexpected quota usage of carol: %+v", statuses)
+	}
+	statuses := usage("root")
+	expected := map[string]fshttp.Usage{
+		"limited": {Bytes: 3, Files: 2},
+		"alice":   {Bytes: 0, Files: 1},
+		"bob":     {Bytes: 3, Files: 1},
+	}
+	if len(statuses) != len(expected) {
+		t.Fatalf("unexpected quota usage: %+v", statuses)
+	}
+	for _, status := range statuses {
+		name := status.Prefix + status.Principal
+		if status.Used != expected[name] {
+			t.Errorf("unexpected usage of %s: expected %+v, got %+v", name, expected[name], status.Used)
+		}
+	}
+}
+
+func TestQuotaReservations(t *testing.T) {
+	quotas := &fshttp.Quotas{Rules: []fshttp.QuotaRule{
+		{Prefix: "limited", MaxBytes: 10},
+		{Principal: "alice", MaxFiles: 2},
+	}}
+	if err := quotas.Init(filesystem.NewMemory()); err != nil {
+		t.Fatalf("failed to initialize quotas: %s", err)
+	}
+
+	// changes in flight hold their usage until they are committed or released.
+	first, err := quotas.Reserve("alice", "limited/a.txt", 0, 6, true)
+	if err != nil {
+		t.Fatalf("failed to reserve: %s", err)
+	}
+	if _, err := quotas.Reserve("bob", "limited/b.txt", 0, 6, true); err == nil {
+		t.Errorf("expected a reservation beyond the prefix quota to fail")
+	}
+	second, err := quotas.Reserve("alice", "c.txt", 0, 1, true)
+	if err != nil {
+		t.Fatalf("failed to reserve: %s", err)
+	}
+	if _, err := quotas.Reserve("alice", "d.txt", 0, 1, true); err == nil {
+		t.Errorf("expected a reservation beyond the principal quota to fail")
+	}
+	second.Release()
+	first.Commit(4)
+	first.Release()
+	if _, err := quotas.Reserve("bob", "limited/b.txt", 0, 6, true); err != nil {
+		t.Errorf("expected released and committed usage to be accounted: %s", err)
+	}
+
+	used := make(map[string]fshttp.Usage)
+	for _, status := range quotas.Status() {
+		used[status.Prefix+status.Principal] = status.Used
+	}
+	if used["limited"] != (fshttp.Usage{Bytes: 10, Files: 2}) || used["alice"] != (fshttp.Usage{Bytes: 4, Files: 1}) {
+		t.Errorf("unexpected usage: %+v", used)
+	}
+}
+
+func TestBasicAuth(t *testing.T) {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	var principal string
+	auth := &fshttp.BasicAuth{
+		Users: map[string]string{"alice": string(hash)},
+		Next: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal = fshttp.Principal(r)
+		}),
+	}
+
+	testCases := []struct {
+		user, password string
+		required       bool
+		status         int
+		principal      string
+	}{
+		{user: "alice", password: "secret", status: 200, principal: "alice"},
+		{user: "alice", password: "wrong", status: 401},
+		{user: "mallory", password: "secret", status: 401},
+		{status: 200},
+		{required: true, status: 401},
+	}
+	for _, testCase := range testCases {
+		principal = ""
+		auth.Required = testCase.required
+		request := httptest.NewRequest("GET", "/", nil)
+		if testCase.user != "" {
+			request.SetBasicAuth(testCase.user, testCase.password)
+		}
+		recorder := httptest.NewRecorder()
+		auth.ServeHTTP(recorder, request)
+		if recorder.Code != testCase.status || principal != testCase.principal {
+			t.Errorf("unexpected result for %s: status %d, principal %q", testCase.user, recorder.Code, principal)
+		}
+	}
+}
+
+func TestLoadUsers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users")
+	hash, _ := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	ioutil.WriteFile(path, []byte("# users\nalice:"+string(hash)+"\n"), 0600)
+	users, err := fshttp.LoadUsers(path)
+	if err != nil || users["alice"] != string(hash) {
+		t.Errorf("unexpected users %v: %v", users, err)
+	}
+
+	// unsalted digests are not accepted.
+	ioutil.WriteFile(path, []byte("alice:2bb80d537b1da3e38bd30361aa855686bde0eacd7162fef6a25fe97bf527a25b\n"), 0600)
+	if _, err := fshttp.LoadUsers(path); err == nil {
+		t.Errorf("expected a SHA-256 digest to be rejected")
+	}
+}
@@ -0,0 +1,314 @@
+package fshttp
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var rateLimited = Error{
+	Status:        http.StatusTooManyRequests,
+	ID:            "rate-limited",
+	UserMessage:   "slow down! too many requests, please retry later.",
+	SystemMessage: "the client exceeded its rate limit.",
+}
+
+// sweepInterval is how often the buckets of idle clients are forgotten.
+const sweepInterval = time.Minute
+
+// Rate is the budget of a token bucket, Limit tokens are added every second up
+// to Burst. A zero Limit is unlimited and a zero Burst holds a second worth of
+// tokens.
+type Rate struct {
+	Limit float64
+	Burst float64
+}
+
+func (r Rate) burst() float64 {
+	if r.Burst > 0 {
+		return r.Burst
+	}
+	return math.Max(1, r.Limit)
+}
+
+// bucket holds the tokens of a Rate, it may go into debt.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// refill adds the tokens earned since the last refill, a new bucket is full.
+func (b *bucket) refill(rate Rate, now time.Time) {
+	if b.last.IsZero() {
+		b.tokens = rate.burst()
+	} else {
+		b.tokens = math.Min(rate.burst(), b.tokens+now.Sub(b.last).Seconds()*rate.Limit)
+	}
+	b.last = now
+}
+
+// wait returns how long until the bucket holds n tokens.
+func (b *bucket) wait(rate Rate, n float64) time.Duration {
+	if b.tokens >= n {
+		return 0
+	}
+	return time.Duration((n - b.tokens) / rate.Limit * float64(time.Second))
+}
+
+// client holds the buckets of a client.
+type client struct {
+	reads, writes, bandwidth bucket
+	last                     time.Time
+}
+
+// RateLimit bounds the requests of every client, identified by its principal,
+// or its IP address when anonymous. Reads are GET, HEAD and OPTIONS requests
+// and writes the others, each taking a token of their Rate. The bytes of
+// request and response bodies are taken from Bandwidth as they are
+// transferred, a client beyond it is slowed down and its new requests are
+// rejected until it is back within it. Rejected requests are answered with
+// 429 Too Many Requests and a Retry-After header.
+type RateLimit struct {
+	Reads     Rate
+	Writes    Rate
+	Bandwidth Rate
+
+	mu      sync.Mutex
+	clients map[string]*client
+	swept   time.Time
+}
+
+// clientKey identifies the client of a request.
+func clientKey(request *http.Request) string {
+	if principal := Principal(request); principal != "" {
+		return "principal:" + principal
+	}
+	return "ip:" + remoteHost(request.RemoteAddr)
+}
+
+// remoteHost returns the IP address of a remote address with its port.
+func remoteHost(remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return remoteAddr
+	}
+	return host
+}
+
+// client returns the buckets of the client, forgetting the clients whose
+// buckets are full again. The mutex must be held.
+func (l *RateLimit) client(key string, now time.Time) *client {
+	if now.Sub(l.swept) > sweepInterval {
+		l.swept = now
+		for other, c := range l.clients {
+			if now.Sub(c.last) > l.refillTime() {
+				delete(l.clients, other)
+			}
+		}
+	}
+	c, ok := l.clients[key]
+	if !ok {
+		if l.clients == nil {
+			l.clients = make(map[string]*client)
+		}
+		c = &client{}
+		l.clients[key] = c
+	}
+	c.last = now
+	return c
+}
+
+// refillTime returns how long the emptiest bucket takes to be full again.
+func (l *RateLimit) refillTime() time.Duration {
+	var longest float64
+	for _, rate := range []Rate{l.Reads, l.Writes, l.Bandwidth} {
+		if rate.Limit > 0 {
+			longest = math.Max(longest, rate.burst()/rate.Limit)
+		}
+	}
+	return time.Duration(longest * float64(time.Second))
+}
+
+// admit takes a token for a request of the client, returning how long it has
+// to wait when it is out of tokens.
+func (l *RateLimit) admit(key string, read bool, now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	c := l.client(key, now)
+	if l.Bandwidth.Limit > 0 {
+		c.bandwidth.refill(l.Bandwidth, now)
+		if wait := c.bandwidth.wait(l.Bandwidth, 0); wait > 0 {
+			return wait
+		}
+	}
+	rate, b := l.Writes, &c.writes
+	if read {
+		rate, b = l.Reads, &c.reads
+	}
+	if rate.Limit <= 0 {
+		return 0
+	}
+	b.refill(rate, now)
+	if wait := b.wait(rate, 1); wait > 0 {
+		return wait
+	}
+	b.tokens--
+	return 0
+}
+
+// transfer takes n bytes from the bandwidth of the client, returning how long
+// to wait before sending them.
+func (l *RateLimit) transfer(key string, n int, now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	c := l.client(key, now)
+	c.bandwidth.refill(l.Bandwidth, now)
+	c.bandwidth.tokens -= float64(n)
+	return c.bandwidth.wait(l.Bandwidth, 0)
+}
+
+// throttle waits until n bytes can be transferred by the client, or the
+// request is canceled.
+func (l *RateLimit) throttle(ctx context.Context, key string, n int) error {
+	wait := l.transfer(key, n, time.Now())
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Middleware rejects the requests of clients out of tokens and slows down the
+// transfers of clients beyond their bandwidth. It must follow the
+// authentication so clients are identified by their principal.
+func (l *RateLimit) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		key := clientKey(request)
+		if wait := l.admit(key, isReadOnlyMethod(request.Method), time.Now()); wait > 0 {
+			writer.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			writeError(writer, request, rateLimited)
+			return
+		}
+		if l.Bandwidth.Limit > 0 {
+			throttle := func(n int) error { return l.throttle(request.Context(), key, n) }
+			if request.Body != nil {
+				request.Body = &throttledReader{ReadCloser: request.Body, throttle: throttle}
+			}
+			writer = &throttledWriter{ResponseWriter: writer, throttle: throttle}
+		}
+		next.ServeHTTP(writer, request)
+	})
+}
+
+// LoginLimit bounds the failed sign-ins of every IP address, each failure
+// taking a token of Rate. An address out of tokens is rejected before its
+// credentials are verified, so guessing passwords does not cost a bcrypt
+// comparison per guess once it is limited.
+type LoginLimit struct {
+	Rate Rate
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	swept   time.Time
+}
+
+// bucket returns the bucket of the address, refilled, forgetting the buckets
+// full again. The mutex must be held.
+func (l *LoginLimit) bucket(host string, now time.Time) *bucket {
+	if now.Sub(l.swept) > sweepInterval {
+		l.swept = now
+		refill := time.Duration(l.Rate.burst() / l.Rate.Limit * float64(time.Second))
+		for other, b := range l.buckets {
+			if now.Sub(b.last) > refill {
+				delete(l.buckets, other)
+			}
+		}
+	}
+	b, ok := l.buckets[host]
+	if !ok {
+		if l.buckets == nil {
+			l.buckets = make(map[string]*bucket)
+		}
+		b = &bucket{}
+		l.buckets[host] = b
+	}
+	b.refill(l.Rate, now)
+	return b
+}
+
+// wait returns how long the client at the remote address has to wait before
+// signing in again, zero when it may try now or the limit is nil.
+func (l *LoginLimit) wait(remoteAddr string, now time.Time) time.Duration {
+	if l == nil || l.Rate.Limit <= 0 {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.bucket(remoteHost(remoteAddr), now).wait(l.Rate, 1)
+}
+
+// fail takes a token from the client at the remote address after it failed to
+// sign in.
+func (l *LoginLimit) fail(remoteAddr string, now time.Time) {
+	if l == nil || l.Rate.Limit <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.bucket(remoteHost(remoteAddr), now).tokens--
+}
+
+type throttledReader struct {
+	io.ReadCloser
+	throttle func(n int) error
+}
+
+func (r *throttledReader) Read(buffer []byte) (int, error) {
+	n, err := r.ReadCloser.Read(buffer)
+	if n > 0 {
+		if throttled := r.throttle(n); throttled != nil && err == nil {
+			err = throttled
+		}
+	}
+	return n, err
+}
+
+// throttledWriter slows down a response, keeping the ability to flush and
+// hijack the connection used by watch streams.
+type throttledWriter struct {
+	http.ResponseWriter
+	throttle func(n int) error
+}
+
+func (w *throttledWriter) Write(buffer []byte) (int, error) {
+	if err := w.throttle(len(buffer)); err != nil {
+		return 0, err
+	}
+	return w.ResponseWriter.Write(buffer)
+}
+
+func (w *throttledWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *throttledWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	return hijacker.Hijack()
+}
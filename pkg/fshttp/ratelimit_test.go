@@ -0,0 +1,90 @@
+package fshttp_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/peymanmortazavi/fs-server/pkg/fshttp"
+)
+
+func TestRateLimit(t *testing.T) {
+	limit := &fshttp.RateLimit{
+		Reads:  fshttp.Rate{Limit: 1, Burst: 2},
+		Writes: fshttp.Rate{Limit: 1},
+	}
+	handler := fshttp.Chain(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}), limit.Middleware)
+
+	serve := func(method, remoteAddr, principal string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, "/a.txt", nil)
+		request.RemoteAddr = remoteAddr
+		if principal != "" {
+			request = fshttp.WithPrincipal(request, principal)
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	for i := 0; i < 2; i++ {
+		if recorder := serve("GET", "10.0.0.1:1000", ""); recorder.Code != http.StatusOK {
+			t.Fatalf("expected read %d to be within the burst but got %d", i, recorder.Code)
+		}
+	}
+	limited := serve("GET", "10.0.0.1:2000", "")
+	var e fshttp.Error
+	if err := json.NewDecoder(limited.Body).Decode(&e); err != nil || limited.Code != http.StatusTooManyRequests || e.ID != "rate-limited" || limited.Header().Get("Retry-After") != "1" {
+		t.Errorf("expected the third read to be limited but got %d %v %+v, %v", limited.Code, limited.Header(), e, err)
+	}
+	if recorder := serve("PUT", "10.0.0.1:3000", ""); recorder.Code != http.StatusOK {
+		t.Errorf("expected writes to have their own budget but got %d", recorder.Code)
+	}
+	if recorder := serve("PUT", "10.0.0.1:3000", ""); recorder.Code != http.StatusTooManyRequests {
+		t.Errorf("expected the second write to be limited but got %d", recorder.Code)
+	}
+	if recorder := serve("GET", "10.0.0.2:1000", ""); recorder.Code != http.StatusOK {
+		t.Errorf("expected another address to have its own budget but got %d", recorder.Code)
+	}
+	for i := 0; i < 2; i++ {
+		if recorder := serve("GET", "10.0.0.1:1000", "alice"); recorder.Code != http.StatusOK {
+			t.Errorf("expected a principal to have its own budget but got %d", recorder.Code)
+		}
+	}
+}
+
+func TestBandwidthLimit(t *testing.T) {
+	limit := &fshttp.RateLimit{Bandwidth: fshttp.Rate{Limit: 10000, Burst: 1000}}
+	content := bytes.Repeat([]byte("x"), 1000)
+	burstSpent := make(chan struct{})
+	handler := fshttp.Chain(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		for i := 0; i < 5; i++ {
+			writer.Write(content)
+			if i == 0 && request.URL.Path == "/a.txt" {
+				close(burstSpent)
+			}
+		}
+	}), limit.Middleware)
+
+	started := time.Now()
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/a.txt", nil))
+		done <- recorder
+	}()
+	<-burstSpent
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/b.txt", nil))
+	if recorder.Code != http.StatusTooManyRequests || recorder.Header().Get("Retry-After") == "" {
+		t.Errorf("expected a request during a throttled transfer to be limited but got %d", recorder.Code)
+	}
+	if transferred := <-done; transferred.Body.Len() != 5000 {
+		t.Errorf("expected the whole response to be written but got %d bytes", transferred.Body.Len())
+	}
+	if elapsed := time.Since(started); elapsed < 350*time.Millisecond {
+		t.Errorf("expected 4000 bytes beyond the burst to take 400ms at 10000 bytes per second but took %s", elapsed)
+	}
+}
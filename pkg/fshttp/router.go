@@ -0,0 +1,125 @@
+package fshttp
+
+import (
+	"context"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+)
+
+// Router dispatches requests to the handlers registered at exact paths or
+// mounted beneath a prefix. Mounted handlers see the path without their
+// prefix, so a Handler mounted at /api/v1/files serves /api/v1/files/a.txt as
+// /a.txt. Exact paths take precedence, then the longest prefix matching.
+type Router struct {
+	// NotFound serves the requests matching nothing, a not found error is
+	// written when nil.
+	NotFound http.Handler
+
+	mu     sync.RWMutex
+	exact  map[string]http.Handler
+	mounts []mount
+}
+
+type mount struct {
+	prefix  string
+	handler http.Handler
+}
+
+// Handle registers the handler for the exact path, which is passed as is.
+func (r *Router) Handle(path string, handler http.Handler) {
+	path = cleanPrefix(path)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.exact[path]; ok {
+		panic("fshttp: multiple registrations for " + path)
+	}
+	if r.exact == nil {
+		r.exact = make(map[string]http.Handler)
+	}
+	r.exact[path] = handler
+}
+
+// Mount registers the handler for the prefix and every path beneath it, the
+// prefix is stripped from the path passed to the handler.
+func (r *Router) Mount(prefix string, handler http.Handler) {
+	prefix = cleanPrefix(prefix)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	i := 0
+	for ; i < len(r.mounts); i++ {
+		if r.mounts[i].prefix == prefix {
+			panic("fshttp: multiple mounts at " + prefix)
+		}
+		if len(r.mounts[i].prefix) < len(prefix) {
+			break
+		}
+	}
+	r.mounts = append(r.mounts, mount{})
+	copy(r.mounts[i+1:], r.mounts[i:])
+	r.mounts[i] = mount{prefix: prefix, handler: handler}
+}
+
+// ServeHTTP passes the request to the handler registered for its path.
+func (r *Router) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	request = cleanPath(request)
+	r.mu.RLock()
+	handler, ok := r.exact[request.URL.Path]
+	var prefix string
+	if !ok {
+		for _, m := range r.mounts {
+			if m.prefix == "/" || request.URL.Path == m.prefix || strings.HasPrefix(request.URL.Path, m.prefix+"/") {
+				handler, prefix, ok = m.handler, m.prefix, true
+				break
+			}
+		}
+	}
+	r.mu.RUnlock()
+
+	switch {
+	case !ok && r.NotFound != nil:
+		r.NotFound.ServeHTTP(writer, request)
+	case !ok:
+		writeError(writer, request, notFoundError)
+	case prefix == "/":
+		handler.ServeHTTP(writer, request)
+	default:
+		handler.ServeHTTP(writer, stripPrefix(request, prefix))
+	}
+}
+
+// cleanPrefix returns the path absolute and clean, without a trailing slash
+// but for the root.
+func cleanPrefix(prefix string) string {
+	return path.Clean("/" + prefix)
+}
+
+type mountPrefixKey struct{}
+
+// MountPrefix returns the prefixes stripped from the path of a request by the
+// routers it went through, so the path the client requested is the prefix
+// followed by the path of the request.
+func MountPrefix(request *http.Request) string {
+	prefix, _ := request.Context().Value(mountPrefixKey{}).(string)
+	return prefix
+}
+
+// fullPath returns the path requested by the client.
+func fullPath(request *http.Request) string {
+	return MountPrefix(request) + request.URL.Path
+}
+
+// stripPrefix returns a copy of the request without the prefix in its path,
+// recording the prefix for MountPrefix.
+func stripPrefix(request *http.Request, prefix string) *http.Request {
+	ctx := context.WithValue(request.Context(), mountPrefixKey{}, MountPrefix(request)+prefix)
+	stripped := request.WithContext(ctx)
+	url := *request.URL
+	url.Path, url.RawPath = strings.TrimPrefix(request.URL.Path, prefix), ""
+	if url.Path == "" {
+		url.Path = "/"
+	}
+	stripped.URL = &url
+	return stripped
+}
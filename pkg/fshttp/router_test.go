@@ -0,0 +1,78 @@
+package fshttp_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/peymanmortazavi/fs-server/pkg/filesystem"
+	"github.com/peymanmortazavi/fs-server/pkg/fshttp"
+)
+
+func TestRouter(t *testing.T) {
+	echo := func(name string) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			writer.Write([]byte(name + " " + fshttp.MountPrefix(request) + " " + request.URL.Path))
+		})
+	}
+	router := &fshttp.Router{}
+	router.Handle("/healthz", echo("health"))
+	router.Mount("/api/v1/files/", echo("files"))
+	router.Mount("/api", echo("api"))
+
+	for url, expected := range map[string]string{
+		"/healthz":                  "health  /healthz",
+		"/api/v1/files":             "files /api/v1/files /",
+		"/api/v1/files/a/b.txt":     "files /api/v1/files /a/b.txt",
+		"/api/v1/files/../other":    "api /api /v1/other",
+		"/api/v1/filesystem":        "api /api /v1/filesystem",
+		"/api//v1/files/./c.txt":    "files /api/v1/files /c.txt",
+		"/apis":                     "",
+		"/elsewhere/api/v1/files/a": "",
+	} {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest("GET", url, nil))
+		if expected == "" {
+			if recorder.Code != http.StatusNotFound {
+				t.Errorf("expected %s not to be found but got %d %q", url, recorder.Code, recorder.Body.String())
+			}
+		} else if recorder.Body.String() != expected {
+			t.Errorf("expected %s to be served as %q but got %q", url, expected, recorder.Body.String())
+		}
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected mounting twice at the same prefix to panic")
+			}
+		}()
+		router.Mount("/api/", echo("again"))
+	}()
+}
+
+func TestMountedHandler(t *testing.T) {
+	router := &fshttp.Router{}
+	router.Mount("/api/v1/files", &fshttp.Handler{Editor: filesystem.NewMemory(), Uploads: &fshttp.Uploads{Dir: t.TempDir()}})
+
+	serve := func(request *http.Request) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, request)
+		return recorder
+	}
+	if recorder := serve(httptest.NewRequest("POST", "/api/v1/files/a.txt", strings.NewReader(`{"type": "file", "data": "hello"}`))); recorder.Code != http.StatusOK {
+		t.Fatalf("failed to create a file beneath the prefix: %d %s", recorder.Code, recorder.Body.String())
+	}
+	if recorder := serve(httptest.NewRequest("GET", "/api/v1/files/a.txt", nil)); !strings.Contains(recorder.Body.String(), `"data":"hello"`) {
+		t.Errorf("unexpected content of the file beneath the prefix: %q", recorder.Body.String())
+	}
+
+	create := httptest.NewRequest("POST", "/api/v1/files/big.bin", nil)
+	create.Header.Set("Tus-Resumable", "1.0.0")
+	create.Header.Set("Upload-Length", "5")
+	location := serve(create).Header().Get("Location")
+	if !strings.HasPrefix(location, "/api/v1/files/big.bin?") {
+		t.Errorf("expected the upload location to keep the prefix but got %q", location)
+	}
+}
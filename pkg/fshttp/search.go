@@ -0,0 +1,112 @@
+package fshttp
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/peymanmortazavi/fs-server/pkg/filesystem"
+)
+
+const defaultSearchLimit = 1000
+
+// parseSearchQuery converts the query string of a search request to a filesystem.Query.
+//
+// The search parameter is a name glob, regex is matched against paths, grep
+// against file content and size and modification time predicates are given
+// with minSize, maxSize, modifiedAfter and modifiedBefore.
+func parseSearchQuery(values url.Values) (filesystem.Query, error) {
+	query := filesystem.Query{Name: values.Get("search"), Type: values.Get("type"), Limit: defaultSearchLimit}
+	if _, err := path.Match(query.Name, ""); err != nil {
+		return query, newBadInputError("search must be a valid glob pattern.")
+	}
+	if query.Type != "" && query.Type != string(RegularFile) && query.Type != string(DirType) {
+		return query, newBadInputError("invalid type, only file and dir are accepted.")
+	}
+
+	var err error
+	for name, target := range map[string]**regexp.Regexp{"regex": &query.Pattern, "grep": &query.Content} {
+		if value := values.Get(name); value != "" {
+			if *target, err = regexp.Compile(value); err != nil {
+				return query, newBadInputError(name + " must be a valid regular expression.")
+			}
+		}
+	}
+	for name, target := range map[string]*int64{"minSize": &query.MinSize, "maxSize": &query.MaxSize} {
+		if value := values.Get(name); value != "" {
+			if *target, err = strconv.ParseInt(value, 10, 64); err != nil {
+				return query, newBadInputError(name + " must be a number of bytes.")
+			}
+		}
+	}
+	for name, target := range map[string]*time.Time{"modifiedAfter": &query.ModifiedAfter, "modifiedBefore": &query.ModifiedBefore} {
+		if value := values.Get(name); value != "" {
+			if *target, err = time.Parse(time.RFC3339, value); err != nil {
+				return query, newBadInputError(name + " must be an RFC 3339 time.")
+			}
+		}
+	}
+	if value := values.Get("limit"); value != "" {
+		if query.Limit, err = strconv.Atoi(value); err != nil || query.Limit <= 0 {
+			return query, newBadInputError("limit must be a positive number.")
+		}
+	}
+	return query, nil
+}
+
+// handleSearch finds items beneath the requested path, using the index when there is one.
+func (h *Handler) handleSearch(writer http.ResponseWriter, request *http.Request) error {
+	root := strings.Trim(request.URL.Path, "/")
+	query, err := parseSearchQuery(request.URL.Query())
+	if err != nil {
+		return err
+	}
+	if item, err := h.viewer().Get(root); err != nil || !item.IsDir() {
+		if err == nil {
+			return newBadInputError("search is only supported for directories.")
+		}
+		return notFoundError
+	}
+
+	// ask for one more result than the limit to know if there are more.
+	limit := query.Limit
+	query.Limit++
+	var matches []filesystem.Match
+	if h.Index != nil {
+		matches, err = h.Index.Search(request.Context(), root, query)
+	} else {
+		matches, err = filesystem.Search(request.Context(), h.viewer(), root, query, h.SearchConcurrency)
+	}
+	if err != nil {
+		if request.Context().Err() != nil {
+			return nil
+		}
+		log.Printf("failed to search %s: %s", root, err)
+		return internalServerError
+	}
+
+	result := SearchResult{Matches: make([]SearchMatch, 0, len(matches))}
+	if len(matches) > limit {
+		matches, result.Truncated = matches[:limit], true
+	}
+	for _, match := range matches {
+		if filesystem.IsProbe(match.Path) {
+			continue
+		}
+		item, _ := fileItemFromFSItem(match.Item, false)
+		found := SearchMatch{Path: match.Path, Item: item}
+		for _, line := range match.Lines {
+			found.Lines = append(found.Lines, LineMatch{Number: line.Number, Text: line.Text})
+		}
+		result.Matches = append(result.Matches, found)
+	}
+	if err := writeJSON(writer, result); err != nil {
+		log.Printf("failed to write search result for %s: %s", root, err)
+	}
+	return nil
+}
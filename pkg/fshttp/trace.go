@@ -0,0 +1,113 @@
+package fshttp
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/peymanmortazavi/fs-server/pkg/filesystem"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RequestIDHeader carries the ID of a request, it is accepted from clients and
+// proxies and echoed in every response.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds the IDs accepted from clients.
+const maxRequestIDLength = 128
+
+// tracerName names the tracer of the spans started by the package.
+const tracerName = "github.com/peymanmortazavi/fs-server/pkg/fshttp"
+
+type requestIDKey struct{}
+
+// RequestID returns the ID of a request served by a Handler.
+func RequestID(request *http.Request) string {
+	id, _ := request.Context().Value(requestIDKey{}).(string)
+	return id
+}
+
+// validRequestID returns if an ID given by a client is short and printable.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < '!' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// withRequestID returns a copy of the request carrying its ID, generating one
+// unless the client gave a valid one, and echoes it in the response. Requests
+// already given an ID are returned as is.
+func withRequestID(writer http.ResponseWriter, request *http.Request) *http.Request {
+	if RequestID(request) != "" {
+		return request
+	}
+	id := request.Header.Get(RequestIDHeader)
+	if !validRequestID(id) {
+		var random [16]byte
+		if _, err := rand.Read(random[:]); err != nil {
+			panic(err)
+		}
+		id = hex.EncodeToString(random[:])
+	}
+	writer.Header().Set(RequestIDHeader, id)
+	return request.WithContext(context.WithValue(request.Context(), requestIDKey{}, id))
+}
+
+// traced returns a copy of the handler tracing the operations of its file
+// system as children of the span of ctx, if it is recording.
+func (h *Handler) traced(ctx context.Context) *Handler {
+	parent := trace.SpanFromContext(ctx)
+	if !parent.IsRecording() {
+		return h
+	}
+	tracer := parent.TracerProvider().Tracer(tracerName)
+	start := func(operation, itemPath string) func(error) {
+		_, span := tracer.Start(ctx, "filesystem."+operation, trace.WithSpanKind(trace.SpanKindInternal), trace.WithAttributes(attribute.String("fs.path", itemPath)))
+		return func(err error) {
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+			span.End()
+		}
+	}
+	traced := *h
+	if traced.Watcher == nil {
+		traced.Watcher, _ = h.viewer().(filesystem.Watcher)
+	}
+	if h.readOnly() {
+		traced.Editor, traced.Viewer = nil, filesystem.NewTraced(filesystem.ReadOnly{Viewer: h.viewer()}, start)
+	} else {
+		traced.Editor = filesystem.NewTraced(h.Editor, start)
+	}
+	return &traced
+}
+
+// endSpan describes a served request in its span and ends it.
+func endSpan(span trace.Span, served exchange) {
+	span.SetAttributes(
+		attribute.String("http.request.method", served.request.Method),
+		attribute.String("url.path", fullPath(served.request)),
+		attribute.Int("http.response.status_code", served.status),
+		attribute.String("fs.request_id", RequestID(served.request)),
+	)
+	if served.principal != "" {
+		span.SetAttributes(attribute.String("enduser.id", served.principal))
+	}
+	if served.errorID != "" {
+		span.SetAttributes(attribute.String("fs.error_id", served.errorID))
+		if served.status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, served.errorID)
+		}
+	}
+	span.End()
+}
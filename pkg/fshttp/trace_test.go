@@ -0,0 +1,91 @@
+package fshttp_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/peymanmortazavi/fs-server/pkg/filesystem"
+	"github.com/peymanmortazavi/fs-server/pkg/fshttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestRequestID(t *testing.T) {
+	handler := &fshttp.Handler{Editor: filesystem.NewMemory()}
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/missing", nil))
+	generated := recorder.Header().Get(fshttp.RequestIDHeader)
+	if len(generated) != 32 {
+		t.Fatalf("expected a request ID to be generated but got %q", generated)
+	}
+	var e fshttp.Error
+	if err := json.NewDecoder(recorder.Body).Decode(&e); err != nil || e.RequestID != generated {
+		t.Errorf("expected the error to hold the request ID %s but got %+v, %v", generated, e, err)
+	}
+
+	for given, accepted := range map[string]bool{
+		"client-id-1":            true,
+		"has spaces":             false,
+		strings.Repeat("x", 129): false,
+	} {
+		request := httptest.NewRequest("GET", "/", nil)
+		request.Header.Set(fshttp.RequestIDHeader, given)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		if echoed := recorder.Header().Get(fshttp.RequestIDHeader); (echoed == given) != accepted || echoed == "" {
+			t.Errorf("unexpected request ID %q echoed for %q", echoed, given)
+		}
+	}
+}
+
+func TestTracing(t *testing.T) {
+	exported := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(exported))
+	observer := &fshttp.Observer{Tracer: provider.Tracer("fs-server")}
+	handler := fshttp.Chain(&fshttp.Handler{Editor: filesystem.NewMemory()}, observer.Middleware)
+
+	request := httptest.NewRequest("POST", "/a.txt", strings.NewReader(`{"type": "file", "data": "hello"}`))
+	request.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	request.Header.Set(fshttp.RequestIDHeader, "traced")
+	handler.ServeHTTP(httptest.NewRecorder(), request)
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/missing", nil))
+
+	byName := make(map[string][]sdktrace.ReadOnlySpan)
+	for _, span := range exported.Ended() {
+		byName[span.Name()] = append(byName[span.Name()], span)
+	}
+	if len(byName["POST"]) != 1 || len(byName["GET"]) != 1 {
+		t.Fatalf("expected a span per request but got %v", byName)
+	}
+	attributes := func(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+		values := make(map[attribute.Key]attribute.Value)
+		for _, kv := range span.Attributes() {
+			values[kv.Key] = kv.Value
+		}
+		return values
+	}
+	post := byName["POST"][0]
+	postAttributes := attributes(post)
+	if post.SpanKind() != trace.SpanKindServer || post.Parent().SpanID().String() != "00f067aa0ba902b7" || post.SpanContext().TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" || postAttributes["fs.request_id"].AsString() != "traced" || postAttributes["http.response.status_code"].AsInt64() != http.StatusOK {
+		t.Errorf("unexpected request span: %+v", post)
+	}
+	if len(byName["filesystem.create_file"]) != 1 || len(byName["filesystem.open"]) != 1 {
+		t.Fatalf("expected the file system operations to be traced but got %v", byName)
+	}
+	for _, name := range []string{"filesystem.create_file", "filesystem.open"} {
+		if child := byName[name][0]; child.Parent().SpanID() != post.SpanContext().SpanID() || child.SpanContext().TraceID() != post.SpanContext().TraceID() || attributes(child)["fs.path"].AsString() != "a.txt" {
+			t.Errorf("expected %s to be a child of the request span but got %+v", name, child)
+		}
+	}
+	get := byName["GET"][0]
+	if attributes(get)["fs.error_id"].AsString() != "not-found" || get.Status().Code == codes.Error || get.SpanContext().TraceID() == post.SpanContext().TraceID() {
+		t.Errorf("unexpected span of the missing file: %+v", get)
+	}
+}
@@ -0,0 +1,162 @@
+package fshttp
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/peymanmortazavi/fs-server/pkg/filesystem"
+)
+
+var (
+	trashDisabled = Error{
+		Status:        http.StatusNotImplemented,
+		ID:            "trash-disabled",
+		UserMessage:   "the trash is not enabled on this server, deletes are permanent.",
+		SystemMessage: "the handler has no trash.",
+	}
+
+	trashEntryNotFound = Error{
+		Status:        http.StatusNotFound,
+		ID:            "trash-entry-not-found",
+		UserMessage:   "no such item in the trash.",
+		SystemMessage: "no trash entry exists with the requested id.",
+	}
+
+	permanentDeleteDenied = Error{
+		Status:        http.StatusForbidden,
+		ID:            "permanent-delete-denied",
+		UserMessage:   "only administrators can delete permanently.",
+		SystemMessage: "the principal is not an administrator of the handler.",
+	}
+)
+
+func trashEntryFromFSEntry(entry filesystem.TrashEntry) TrashEntry {
+	return TrashEntry{
+		ID:        entry.ID,
+		Path:      entry.Path,
+		Type:      fileTypeOf(entry.Dir),
+		DeletedBy: entry.DeletedBy,
+		DeletedAt: entry.DeletedAt,
+	}
+}
+
+func fileTypeOf(dir bool) FileType {
+	if dir {
+		return DirType
+	}
+	return RegularFile
+}
+
+// isAdministrator returns if the principal of the request may delete permanently.
+func (h *Handler) isAdministrator(request *http.Request) bool {
+	principal := Principal(request)
+	for _, administrator := range h.Administrators {
+		if principal != "" && principal == administrator {
+			return true
+		}
+	}
+	return false
+}
+
+// Remove deletes the item at path for the principal, moving it to the trash
+// unless permanent, and records the storage it frees. Trashed items keep
+// counting until they are purged.
+func (c Changes) Remove(ctx context.Context, principal, itemPath string, permanent bool) error {
+	defer c.Digests.Forget(itemPath)
+	if c.Trash != nil && !permanent {
+		entry, err := c.Trash.Recycle(itemPath, principal)
+		if err == nil {
+			c.Quotas.Trashed(entry)
+		}
+		return err
+	}
+	var removed Usage
+	if c.Quotas != nil {
+		// measure what is about to be removed, the item is gone afterwards.
+		removed, _ = measure(ctx, c.Editor, itemPath)
+	}
+	var err error
+	if c.Trash != nil {
+		err = c.Trash.Erase(itemPath)
+	} else {
+		err = c.Editor.Delete(itemPath)
+	}
+	if err != nil {
+		return err
+	}
+	c.Quotas.Discharge(itemPath, removed)
+	return nil
+}
+
+// handleTrash lists the trash entries deleted from beneath the requested path.
+func (h *Handler) handleTrash(writer http.ResponseWriter, request *http.Request) error {
+	if h.Trash == nil {
+		return trashDisabled
+	}
+	root := strings.Trim(request.URL.Path, "/")
+	entries, err := h.Trash.Entries()
+	if err != nil {
+		log.Printf("failed to list trash entries: %s", err)
+		return internalServerError
+	}
+	result := []TrashEntry{}
+	for _, entry := range entries {
+		if within(entry.Path, root) {
+			result = append(result, trashEntryFromFSEntry(entry))
+		}
+	}
+	if err := writeJSON(writer, result); err != nil {
+		log.Printf("failed to write trash entries: %s", err)
+	}
+	return nil
+}
+
+// handleRestore moves the trash entry given by the restore query parameter back
+// to its original path.
+func (h *Handler) handleRestore(writer http.ResponseWriter, request *http.Request) error {
+	if h.Trash == nil {
+		return trashDisabled
+	}
+	entry, err := h.Trash.Restore(request.URL.Query().Get("restore"))
+	if err != nil {
+		switch {
+		case os.IsNotExist(err):
+			return trashEntryNotFound
+		case filesystem.IsFileAlreadyExists(err):
+			return fileAlreadyExists
+		case isPermission(err):
+			return writeAccessDenied
+		}
+		log.Printf("failed to restore trash entry %s: %s", entry.ID, err)
+		return internalServerError
+	}
+	h.Quotas.Restored(entry)
+	if err := h.notify(request, MutationCreate, entry.Path, nil); err != nil {
+		return err
+	}
+	if err := writeJSON(writer, trashEntryFromFSEntry(entry)); err != nil {
+		log.Printf("failed to write trash entry: %s", err)
+	}
+	return nil
+}
+
+// handlePurge permanently removes the trash entry with the given id.
+func (h *Handler) handlePurge(request *http.Request, id string) error {
+	if h.Trash == nil {
+		return trashDisabled
+	}
+	if !h.isAdministrator(request) {
+		return permanentDeleteDenied
+	}
+	if err := h.Trash.Purge(id); err != nil {
+		if os.IsNotExist(err) {
+			return trashEntryNotFound
+		}
+		log.Printf("failed to purge trash entry %s: %s", id, err)
+		return internalServerError
+	}
+	return nil
+}
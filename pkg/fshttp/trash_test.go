@@ -0,0 +1,141 @@
+package fshttp_test
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/peymanmortazavi/fs-server/pkg/filesystem"
+	"github.com/peymanmortazavi/fs-server/pkg/fshttp"
+)
+
+func TestTrash(t *testing.T) {
+	manager := filesystem.DirManager{Root: t.TempDir()}
+	trash, err := filesystem.NewTrash(manager)
+	if err != nil {
+		t.Fatalf("failed to create trash: %s", err)
+	}
+	handler := &fshttp.Handler{Editor: trash, Trash: trash, Administrators: []string{"root"}}
+	serve := func(principal, method, url, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(method, url, strings.NewReader(body))
+		handler.ServeHTTP(recorder, fshttp.WithPrincipal(request, principal))
+		return recorder
+	}
+	entries := func(url string) []fshttp.TrashEntry {
+		t.Helper()
+		var result []fshttp.TrashEntry
+		if err := json.NewDecoder(serve("", "GET", url, "").Body).Decode(&result); err != nil {
+			t.Fatalf("failed to decode trash entries: %s", err)
+		}
+		return result
+	}
+
+	serve("alice", "POST", "/docs", `{"type": "dir"}`)
+	serve("alice", "POST", "/docs/a.txt", `{"type": "file", "data": "hello"}`)
+	if code := serve("alice", "DELETE", "/docs?recursive=true", "").Code; code != 200 {
+		t.Fatalf("unexpected status code for delete: %d", code)
+	}
+	if code := serve("", "GET", "/docs", "").Code; code != 404 {
+		t.Errorf("expected deleted directory to be gone but got %d", code)
+	}
+	listed := entries("/?trash=true")
+	if len(listed) != 1 || listed[0].Path != "docs" || listed[0].DeletedBy != "alice" || listed[0].Type != fshttp.DirType {
+		t.Fatalf("unexpected trash entries: %+v", listed)
+	}
+	if other := entries("/other?trash=true"); len(other) != 0 {
+		t.Errorf("expected no entries beneath other but got %+v", other)
+	}
+
+	if code := serve("alice", "POST", "/?restore="+listed[0].ID, "").Code; code != 200 {
+		t.Fatalf("unexpected status code for restore: %d", code)
+	}
+	var item fshttp.FileItem
+	json.NewDecoder(serve("", "GET", "/docs/a.txt", "").Body).Decode(&item)
+	if item.Data != "hello" {
+		t.Errorf("unexpected restored content: %q", item.Data)
+	}
+	if code := serve("alice", "POST", "/?restore="+listed[0].ID, "").Code; code != 404 {
+		t.Errorf("expected restoring twice to fail with 404 but got %d", code)
+	}
+
+	if code := serve("alice", "DELETE", "/docs?permanent=true", "").Code; code != 403 {
+		t.Errorf("expected permanent delete by a non administrator to be denied but got %d", code)
+	}
+	if code := serve("root", "DELETE", "/docs?permanent=true&recursive=true", "").Code; code != 200 {
+		t.Errorf("unexpected status code for permanent delete: %d", code)
+	}
+	if listed := entries("/?trash=true"); len(listed) != 0 {
+		t.Errorf("expected permanent delete to bypass the trash but got %+v", listed)
+	}
+
+	serve("alice", "POST", "/b.txt", `{"type": "file"}`)
+	serve("alice", "DELETE", "/b.txt", "")
+	listed = entries("/?trash=true")
+	if code := serve("alice", "DELETE", "/?trash="+listed[0].ID, "").Code; code != 403 {
+		t.Errorf("expected purging by a non administrator to be denied but got %d", code)
+	}
+	if code := serve("root", "DELETE", "/?trash="+listed[0].ID, "").Code; code != 200 {
+		t.Errorf("unexpected status code for purge: %d", code)
+	}
+	if code := serve("root", "DELETE", "/?trash="+listed[0].ID, "").Code; code != 404 {
+		t.Errorf("expected purging twice to fail with 404 but got %d", code)
+	}
+	if code := serve("", "GET", "/.trash", "").Code; code != 404 {
+		t.Errorf("expected the trash directory to be hidden but got %d", code)
+	}
+}
+
+func TestTrashQuotas(t *testing.T) {
+	manager := filesystem.DirManager{Root: t.TempDir()}
+	trash, _ := filesystem.NewTrash(manager)
+	rules := []fshttp.QuotaRule{{Prefix: "docs", MaxBytes: 10}, {Principal: "*", MaxBytes: 10}}
+	quotas := &fshttp.Quotas{Rules: rules, Trash: trash}
+	trash.Purging = quotas.Purged
+	quotas.Init(trash)
+	handler := &fshttp.Handler{Editor: trash, Trash: trash, Quotas: quotas, Administrators: []string{"root"}}
+	serve := func(principal, method, url, body string) int {
+		t.Helper()
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(method, url, strings.NewReader(body))
+		handler.ServeHTTP(recorder, fshttp.WithPrincipal(request, principal))
+		return recorder.Code
+	}
+	used := func(quotas *fshttp.Quotas) map[string]fshttp.Usage {
+		result := make(map[string]fshttp.Usage)
+		for _, status := range quotas.Status() {
+			result[status.Prefix+status.Principal] = status.Used
+		}
+		return result
+	}
+
+	serve("alice", "POST", "/docs", `{"type": "dir"}`)
+	serve("alice", "POST", "/docs/a.txt", `{"type": "file", "data": "12345678"}`)
+	serve("alice", "DELETE", "/docs/a.txt", "")
+
+	// trashed bytes keep counting, also once measured again.
+	if code := serve("alice", "POST", "/docs/a.txt", `{"type": "file", "data": "123"}`); code != 507 {
+		t.Errorf("expected trashed bytes to count against the quota but got %d", code)
+	}
+	restarted := &fshttp.Quotas{Rules: rules, Trash: trash}
+	restarted.Init(trash)
+	if usage := used(restarted); usage["docs"] != (fshttp.Usage{Bytes: 8, Files: 2}) {
+		t.Errorf("unexpected usage after measuring again: %+v", usage)
+	}
+
+	var listed []fshttp.TrashEntry
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/?trash=true", nil))
+	json.NewDecoder(recorder.Body).Decode(&listed)
+	if code := serve("root", "DELETE", "/?trash="+listed[0].ID, ""); code != 200 {
+		t.Fatalf("unexpected status code for purge: %d", code)
+	}
+	if usage := used(quotas); usage["docs"] != (fshttp.Usage{Files: 1}) || usage["alice"] != (fshttp.Usage{Files: 1}) {
+		t.Errorf("expected purging to release the usage but got %+v", usage)
+	}
+	if code := serve("alice", "POST", "/docs/a.txt", `{"type": "file", "data": "123"}`); code != 200 {
+		t.Errorf("expected the purged bytes to be released but got %d", code)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"io"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/peymanmortazavi/fs-server/pkg/filesystem"
 )
@@ -27,13 +28,34 @@ type FileItem struct {
 	Permission os.FileMode `json:"permission,omitempty"`
 	Owner      string      `json:"owner,omitempty"`
 	Size       int64       `json:"size,omitempty"`
+	Modified   *time.Time  `json:"modified,omitempty"`
 	Data       string      `json:"data,omitempty"`
+	Checksum   *Checksum   `json:"checksum,omitempty"`
+	Usage      *DiskUsage  `json:"usage,omitempty"`
 	Children   []FileItem  `json:"children,omitempty"`
 }
 
+// Checksum holds a hex encoded digest of file content.
+type Checksum struct {
+	Algorithm string `json:"algorithm"`
+	Value     string `json:"value"`
+}
+
+// DiskUsage is the storage used by an item and everything beneath it.
+//
+// Bytes only counts the content of regular files.
+type DiskUsage struct {
+	Bytes int64 `json:"bytes"`
+	Files int64 `json:"files"`
+	Dirs  int64 `json:"dirs"`
+}
+
 // FileWriteRequest describes a file write request.
+//
+// When Checksum is set, the data is only written if its digest matches.
 type FileWriteRequest struct {
-	Data string `json:"data,omitempty"`
+	Data     string    `json:"data,omitempty"`
+	Checksum *Checksum `json:"checksum,omitempty"`
 }
 
 // CreateFileItemRequest represents a request to create a new file item.
@@ -42,6 +64,71 @@ type CreateFileItemRequest struct {
 	Type             FileType `json:"type"`
 }
 
+// LineMatch is a line of a file matching a content search.
+type LineMatch struct {
+	Number int    `json:"number"`
+	Text   string `json:"text"`
+}
+
+// SearchMatch is an item found by a search.
+type SearchMatch struct {
+	Path  string      `json:"path"`
+	Item  FileItem    `json:"item"`
+	Lines []LineMatch `json:"lines,omitempty"`
+}
+
+// SearchResult is the response of a search.
+//
+// Truncated is set when more items matched than the limit of the search.
+type SearchResult struct {
+	Matches   []SearchMatch `json:"matches"`
+	Truncated bool          `json:"truncated,omitempty"`
+}
+
+// FileVersion describes previous content of a file.
+type FileVersion struct {
+	Version int       `json:"version"`
+	Size    int64     `json:"size"`
+	Time    time.Time `json:"time"`
+}
+
+// TrashEntry describes an item in the trash.
+type TrashEntry struct {
+	ID        string    `json:"id"`
+	Path      string    `json:"path"`
+	Type      FileType  `json:"type"`
+	DeletedBy string    `json:"deleted_by,omitempty"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+// WatchEvent describes a change streamed to watchers.
+type WatchEvent struct {
+	ID      uint64    `json:"id"`
+	Type    string    `json:"type"`
+	Path    string    `json:"path"`
+	OldPath string    `json:"old_path,omitempty"`
+	Time    time.Time `json:"time"`
+}
+
+// HealthOK and HealthFailed are the statuses of health checks.
+const (
+	HealthOK     = "ok"
+	HealthFailed = "failed"
+)
+
+// HealthStatus is the result of the health checks of an endpoint.
+type HealthStatus struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckStatus `json:"checks"`
+}
+
+// CheckStatus is the result of one health check.
+type CheckStatus struct {
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
 // fileItemFromFSItem converts filesystem.Item to FileItem.
 //
 // This method only fails when populating data.
@@ -52,6 +139,10 @@ func fileItemFromFSItem(item filesystem.Item, populateData bool) (FileItem, erro
 		Permission: item.Perm(),
 		Owner:      item.Owner,
 	}
+	if !item.ModTime.IsZero() {
+		modified := item.ModTime.UTC()
+		result.Modified = &modified
+	}
 
 	switch {
 	case item.FileMode.IsDir():
@@ -72,10 +163,12 @@ func fileItemFromFSItem(item filesystem.Item, populateData bool) (FileItem, erro
 			builder := &strings.Builder{}
 			file, err := item.Open(os.O_RDONLY)
 			if err != nil {
-				return result, fmt.Errorf("failed to read %s: %s", item.Name, err)
+				return result, fmt.Errorf("failed to read %s: %w", item.Name, err)
 			}
 			defer file.Close()
-			io.Copy(builder, file)
+			if _, err := io.Copy(builder, file); err != nil {
+				return result, fmt.Errorf("failed to read %s: %w", item.Name, err)
+			}
 			result.Data = builder.String()
 		}
 	}
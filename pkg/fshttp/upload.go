@@ -0,0 +1,546 @@
+package fshttp
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/peymanmortazavi/fs-server/pkg/filesystem"
+)
+
+// The resumable upload protocol follows the core of tus 1.0.0 along with its
+// creation, expiration, termination and checksum extensions.
+const (
+	tusVersion          = "1.0.0"
+	tusExtensions       = "creation,expiration,termination,checksum"
+	tusChecksums        = "sha1,sha256,md5,crc32c"
+	offsetOctetStream   = "application/offset+octet-stream"
+	uploadQuery         = "upload"
+	defaultUploadExpiry = 24 * time.Hour
+)
+
+var (
+	uploadNotFound = Error{
+		Status:        http.StatusNotFound,
+		ID:            "upload-not-found",
+		UserMessage:   "no such upload, it may have expired.",
+		SystemMessage: "no upload session exists with the given id for this path.",
+	}
+
+	uploadOffsetMismatch = Error{
+		Status:        http.StatusConflict,
+		ID:            "upload-offset-mismatch",
+		UserMessage:   "upload offset does not match, query the current offset and retry.",
+		SystemMessage: "Upload-Offset header does not match the offset of the upload.",
+	}
+
+	uploadTooLarge = Error{
+		Status:        http.StatusRequestEntityTooLarge,
+		ID:            "upload-too-large",
+		UserMessage:   "the upload is larger than allowed.",
+		SystemMessage: "the upload exceeds the declared Upload-Length or the maximum size.",
+	}
+
+	uploadBusy = Error{
+		Status:        http.StatusLocked,
+		ID:            "upload-busy",
+		UserMessage:   "another request is writing to this upload.",
+		SystemMessage: "another request is writing to this upload.",
+	}
+
+	unsupportedUploadVersion = Error{
+		Status:        http.StatusPreconditionFailed,
+		ID:            "unsupported-upload-version",
+		UserMessage:   "unsupported resumable upload protocol version.",
+		SystemMessage: "only Tus-Resumable 1.0.0 is supported.",
+	}
+
+	uploadContentType = Error{
+		Status:        http.StatusUnsupportedMediaType,
+		ID:            "bad-input",
+		UserMessage:   "upload chunks must use the application/offset+octet-stream content type.",
+		SystemMessage: "upload chunks must use the application/offset+octet-stream content type.",
+	}
+
+	uploadChecksumMismatch = Error{
+		Status:        460,
+		ID:            "checksum-mismatch",
+		UserMessage:   "the chunk does not match its checksum, nothing was written.",
+		SystemMessage: "digest of the chunk does not match the Upload-Checksum header.",
+	}
+)
+
+// Uploads stores the state of resumable uploads on the local disk.
+//
+// Partial content is kept in Dir until the upload completes, at which point it
+// is copied into the target path through the filesystem.Editor. Uploads that
+// see no activity for Expiry are removed by Collect.
+type Uploads struct {
+	// Dir holds partial uploads and their metadata.
+	Dir string
+
+	// Expiry is how long an upload is kept after its last change, 24 hours by default.
+	Expiry time.Duration
+
+	// MaxSize limits the length of a single upload when positive.
+	MaxSize int64
+
+	mu     sync.Mutex
+	active map[string]bool
+}
+
+// upload is the metadata of a resumable upload.
+type upload struct {
+	ID      string    `json:"id"`
+	Path    string    `json:"path"`
+	Length  int64     `json:"length"`
+	Expires time.Time `json:"expires"`
+}
+
+func (u *Uploads) expiry() time.Duration {
+	if u.Expiry > 0 {
+		return u.Expiry
+	}
+	return defaultUploadExpiry
+}
+
+func (u *Uploads) metaPath(id string) string {
+	return filepath.Join(u.Dir, id+".json")
+}
+
+func (u *Uploads) dataPath(id string) string {
+	return filepath.Join(u.Dir, id+".part")
+}
+
+func newUploadID() (string, error) {
+	buffer := make([]byte, 16)
+	if _, err := rand.Read(buffer); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buffer), nil
+}
+
+func validUploadID(id string) bool {
+	if len(id) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
+
+// acquire marks an upload as in use so concurrent requests cannot interleave.
+func (u *Uploads) acquire(id string) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.active == nil {
+		u.active = make(map[string]bool)
+	}
+	if u.active[id] {
+		return false
+	}
+	u.active[id] = true
+	return true
+}
+
+func (u *Uploads) release(id string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	delete(u.active, id)
+}
+
+func (u *Uploads) create(path string, length int64) (upload, error) {
+	id, err := newUploadID()
+	if err != nil {
+		return upload{}, err
+	}
+	if err := os.MkdirAll(u.Dir, 0700); err != nil {
+		return upload{}, err
+	}
+	// keep Collect away from the upload until its metadata is written.
+	u.acquire(id)
+	defer u.release(id)
+	up := upload{ID: id, Path: path, Length: length, Expires: time.Now().Add(u.expiry()).UTC()}
+	file, err := os.OpenFile(u.dataPath(id), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return upload{}, err
+	}
+	_ = file.Close()
+	if err := u.save(up); err != nil {
+		_ = os.Remove(u.dataPath(id))
+		return upload{}, err
+	}
+	return up, nil
+}
+
+func (u *Uploads) save(up upload) error {
+	data, err := json.Marshal(up)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(u.metaPath(up.ID), data, 0600)
+}
+
+// load returns the upload with the given id and its current offset.
+func (u *Uploads) load(id string) (upload, int64, error) {
+	var up upload
+	if !validUploadID(id) {
+		return up, 0, os.ErrNotExist
+	}
+	data, err := ioutil.ReadFile(u.metaPath(id))
+	if err != nil {
+		return up, 0, err
+	}
+	if err := json.Unmarshal(data, &up); err != nil {
+		return up, 0, err
+	}
+	info, err := os.Stat(u.dataPath(id))
+	if err != nil {
+		return up, 0, err
+	}
+	return up, info.Size(), nil
+}
+
+func (u *Uploads) remove(id string) error {
+	dataErr := os.Remove(u.dataPath(id))
+	if err := os.Remove(u.metaPath(id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if dataErr != nil && !os.IsNotExist(dataErr) {
+		return dataErr
+	}
+	return nil
+}
+
+// Collect removes every upload that expired before now.
+func (u *Uploads) Collect(now time.Time) error {
+	entries, err := ioutil.ReadDir(u.Dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	seen := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		id := strings.TrimSuffix(strings.TrimSuffix(entry.Name(), ".json"), ".part")
+		if seen[id] || !validUploadID(id) || !u.acquire(id) {
+			continue
+		}
+		seen[id] = true
+		up, _, err := u.load(id)
+		if err != nil || now.After(up.Expires) {
+			if err := u.remove(id); err != nil {
+				log.Printf("failed to remove expired upload %s: %s", id, err)
+			}
+		}
+		u.release(id)
+	}
+	return nil
+}
+
+// CollectEvery runs Collect periodically until the context is done.
+func (u *Uploads) CollectEvery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := u.Collect(now); err != nil {
+				log.Printf("failed to collect expired uploads: %s", err)
+			}
+		}
+	}
+}
+
+func isUploadRequest(request *http.Request) bool {
+	return request.Header.Get("Upload-Length") != "" || request.URL.Query().Get(uploadQuery) != ""
+}
+
+func setUploadHeaders(writer http.ResponseWriter, up upload, offset int64) {
+	header := writer.Header()
+	header.Set("Tus-Resumable", tusVersion)
+	header.Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	header.Set("Upload-Length", strconv.FormatInt(up.Length, 10))
+	header.Set("Upload-Expires", up.Expires.Format(http.TimeFormat))
+	header.Set("Cache-Control", "no-store")
+}
+
+// loadUpload returns the upload referred to by the request, making sure it
+// belongs to the requested path and is not expired.
+func (h *Handler) loadUpload(request *http.Request) (upload, int64, error) {
+	path := strings.Trim(request.URL.Path, "/")
+	if h.Uploads == nil {
+		return upload{}, 0, methodNotAllowedError
+	}
+	if v := request.Header.Get("Tus-Resumable"); v != "" && v != tusVersion {
+		return upload{}, 0, unsupportedUploadVersion
+	}
+	up, offset, err := h.Uploads.load(request.URL.Query().Get(uploadQuery))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return up, 0, uploadNotFound
+		}
+		return up, 0, err
+	}
+	if up.Path != path || time.Now().After(up.Expires) {
+		return up, 0, uploadNotFound
+	}
+	return up, offset, nil
+}
+
+func (h *Handler) handleUploadCreate(writer http.ResponseWriter, request *http.Request) error {
+	path := strings.Trim(request.URL.Path, "/")
+	if h.Uploads == nil {
+		return methodNotAllowedError
+	}
+	if v := request.Header.Get("Tus-Resumable"); v != "" && v != tusVersion {
+		return unsupportedUploadVersion
+	}
+	length, err := strconv.ParseInt(request.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		return newBadInputError("Upload-Length must be a non-negative integer.")
+	}
+	if h.Uploads.MaxSize > 0 && length > h.Uploads.MaxSize {
+		return uploadTooLarge
+	}
+	item, err := h.Get(path)
+	if err == nil && item.IsDir() {
+		return fileExpected
+	}
+	if err := h.Quotas.Allows(Principal(request), path, item.Size, length, err != nil); err != nil {
+		return err
+	}
+	up, err := h.Uploads.create(path, length)
+	if err != nil {
+		log.Printf("failed to create upload for %s: %s", path, err)
+		return internalServerError
+	}
+	if length == 0 {
+		if err := h.finishUpload(request, up); err != nil {
+			return err
+		}
+	}
+	location := *request.URL
+	location.Path, location.RawPath = fullPath(request), ""
+	location.RawQuery = uploadQuery + "=" + up.ID
+	writer.Header().Set("Location", location.RequestURI())
+	setUploadHeaders(writer, up, 0)
+	writer.WriteHeader(http.StatusCreated)
+	return nil
+}
+
+func (h *Handler) handleUploadHead(writer http.ResponseWriter, request *http.Request) error {
+	up, offset, err := h.loadUpload(request)
+	if err != nil {
+		return err
+	}
+	setUploadHeaders(writer, up, offset)
+	writer.WriteHeader(http.StatusOK)
+	return nil
+}
+
+func (h *Handler) handleUploadPatch(writer http.ResponseWriter, request *http.Request) error {
+	if request.Body != nil {
+		defer request.Body.Close()
+	}
+	if request.Header.Get("Content-Type") != offsetOctetStream {
+		return uploadContentType
+	}
+	up, offset, err := h.loadUpload(request)
+	if err != nil {
+		return err
+	}
+	if !h.Uploads.acquire(up.ID) {
+		return uploadBusy
+	}
+	defer h.Uploads.release(up.ID)
+
+	// the offset may have changed while waiting for the upload.
+	if _, offset, err = h.Uploads.load(up.ID); err != nil {
+		return uploadNotFound
+	}
+	if request.Header.Get("Upload-Offset") != strconv.FormatInt(offset, 10) {
+		return uploadOffsetMismatch
+	}
+	checksum, err := parseUploadChecksum(request.Header.Get("Upload-Checksum"))
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(h.Uploads.dataPath(up.ID), os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return internalServerError
+	}
+	var reader io.Reader = io.LimitReader(request.Body, up.Length-offset+1)
+	if checksum != nil {
+		reader = io.TeeReader(reader, checksum)
+	}
+	written, copyErr := io.Copy(file, reader)
+	if offset+written > up.Length || (checksum != nil && !checksum.matches()) {
+		// never keep data that is invalid for the upload.
+		_ = file.Truncate(offset)
+		_ = file.Close()
+		if offset+written > up.Length {
+			return uploadTooLarge
+		}
+		return uploadChecksumMismatch
+	}
+	if err := file.Close(); err != nil {
+		return internalServerError
+	}
+	if copyErr != nil {
+		// keep what has been received so far, the client resumes from there.
+		log.Printf("upload %s for %s interrupted at %d: %s", up.ID, up.Path, offset+written, copyErr)
+	}
+
+	offset += written
+	up.Expires = time.Now().Add(h.Uploads.expiry()).UTC()
+	if err := h.Uploads.save(up); err != nil {
+		return internalServerError
+	}
+	if offset == up.Length {
+		if err := h.finishUpload(request, up); err != nil {
+			return err
+		}
+	}
+	setUploadHeaders(writer, up, offset)
+	writer.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (h *Handler) handleUploadDelete(writer http.ResponseWriter, request *http.Request) error {
+	up, _, err := h.loadUpload(request)
+	if err != nil {
+		return err
+	}
+	if !h.Uploads.acquire(up.ID) {
+		return uploadBusy
+	}
+	defer h.Uploads.release(up.ID)
+	if err := h.Uploads.remove(up.ID); err != nil {
+		return internalServerError
+	}
+	writer.Header().Set("Tus-Resumable", tusVersion)
+	writer.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// finishUpload copies a completed upload into its target path and removes it.
+func (h *Handler) finishUpload(request *http.Request, up upload) error {
+	mutationType := MutationWrite
+	item, err := h.Get(up.Path)
+	switch {
+	case os.IsNotExist(err):
+		mutationType = MutationCreate
+	case err == nil && item.IsDir():
+		return fileExpected
+	}
+	principal, created := Principal(request), mutationType == MutationCreate
+	reservation, reserveErr := h.Quotas.Reserve(principal, up.Path, item.Size, up.Length, created)
+	if reserveErr != nil {
+		return reserveErr
+	}
+	defer reservation.Release()
+	before := h.changes().State(up.Path)
+	if created {
+		item, err = h.CreateFile(up.Path)
+	}
+	if err != nil {
+		if isPermission(err) {
+			return writeAccessDenied
+		}
+		log.Printf("failed to create file %s: %s", up.Path, err)
+		return internalServerError
+	}
+
+	source, err := os.Open(h.Uploads.dataPath(up.ID))
+	if err != nil {
+		return internalServerError
+	}
+	defer source.Close()
+	target, err := item.Open(os.O_WRONLY | os.O_CREATE | os.O_TRUNC)
+	if err != nil {
+		if isPermission(err) {
+			return writeAccessDenied
+		}
+		return internalServerError
+	}
+	defer h.Digests.Forget(up.Path)
+	if _, err := io.Copy(target, source); err != nil {
+		_ = target.Close()
+		log.Printf("failed to write upload %s to %s: %s", up.ID, up.Path, err)
+		return internalServerError
+	}
+	if err := target.Close(); err != nil {
+		return internalServerError
+	}
+	reservation.Commit(up.Length)
+	if err := h.Uploads.remove(up.ID); err != nil {
+		log.Printf("failed to remove finished upload %s: %s", up.ID, err)
+	}
+	return h.notify(request, mutationType, up.Path, before)
+}
+
+type chunkHash struct {
+	hash.Hash
+	expected []byte
+}
+
+func (c *chunkHash) matches() bool {
+	return bytes.Equal(c.Sum(nil), c.expected)
+}
+
+// parseUploadChecksum parses an Upload-Checksum header of the form
+// "<algorithm> <base64 digest>".
+func parseUploadChecksum(value string) (*chunkHash, error) {
+	if value == "" {
+		return nil, nil
+	}
+	parts := strings.Fields(value)
+	if len(parts) != 2 {
+		return nil, newBadInputError("Upload-Checksum must be an algorithm and a base64 digest.")
+	}
+	algorithm, err := filesystem.ParseDigestAlgorithm(parts[0])
+	if err != nil {
+		return nil, unsupportedChecksum
+	}
+	expected, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, newBadInputError("Upload-Checksum digest must be base64 encoded.")
+	}
+	h, _ := algorithm.NewHash()
+	return &chunkHash{Hash: h, expected: expected}, nil
+}
+
+// handleUploadOptions advertises the resumable upload capabilities.
+func (h *Handler) handleUploadOptions(writer http.ResponseWriter, request *http.Request) error {
+	if h.Uploads == nil {
+		return methodNotAllowedError
+	}
+	header := writer.Header()
+	header.Set("Tus-Resumable", tusVersion)
+	header.Set("Tus-Version", tusVersion)
+	header.Set("Tus-Extension", tusExtensions)
+	header.Set("Tus-Checksum-Algorithm", tusChecksums)
+	if h.Uploads.MaxSize > 0 {
+		header.Set("Tus-Max-Size", strconv.FormatInt(h.Uploads.MaxSize, 10))
+	}
+	writer.WriteHeader(http.StatusNoContent)
+	return nil
+}
@@ -0,0 +1,130 @@
+package fshttp_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/peymanmortazavi/fs-server/pkg/filesystem"
+	"github.com/peymanmortazavi/fs-server/pkg/fshttp"
+)
+
+func mustMakeRequest(method, url, body string, headers map[string]string) *http.Request {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		panic(err)
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	return req
+}
+
+func TestResumableUpload(t *testing.T) {
+	root := t.TempDir()
+	uploads := &fshttp.Uploads{Dir: t.TempDir()}
+	handler := &fshttp.Handler{Editor: filesystem.DirManager{Root: root}, Uploads: uploads}
+
+	serve := func(req *http.Request) *http.Response {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		return recorder.Result()
+	}
+
+	resp := serve(mustMakeRequest("POST", "http://some.url.com/big.bin", "", map[string]string{
+		"Tus-Resumable": "1.0.0",
+		"Upload-Length": "11",
+	}))
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("unexpected status code for upload creation: %d", resp.StatusCode)
+	}
+	location := "http://some.url.com" + resp.Header.Get("Location")
+
+	patch := func(offset, body string, extra map[string]string) *http.Response {
+		headers := map[string]string{
+			"Tus-Resumable": "1.0.0",
+			"Content-Type":  "application/offset+octet-stream",
+			"Upload-Offset": offset,
+		}
+		for key, value := range extra {
+			headers[key] = value
+		}
+		return serve(mustMakeRequest("PATCH", location, body, headers))
+	}
+
+	testCases := []struct {
+		offset   string
+		body     string
+		headers  map[string]string
+		status   int
+		expected string
+	}{
+		{offset: "0", body: "hello", status: http.StatusNoContent, expected: "5"},
+		{offset: "0", body: "hello", status: http.StatusConflict},
+		// sha1 of "nope" is not the digest of " world".
+		{offset: "5", body: " world", headers: map[string]string{"Upload-Checksum": "sha1 vd8lU3bFLZ2F5IZ6lhTKf8rBOXA="}, status: 460},
+		{offset: "5", body: " world and more", status: http.StatusRequestEntityTooLarge},
+	}
+	for _, testCase := range testCases {
+		resp := patch(testCase.offset, testCase.body, testCase.headers)
+		if resp.StatusCode != testCase.status {
+			t.Errorf("unexpected status code for chunk %q at %s: expected %d, got %d",
+				testCase.body, testCase.offset, testCase.status, resp.StatusCode)
+		}
+		if testCase.expected != "" && resp.Header.Get("Upload-Offset") != testCase.expected {
+			t.Errorf("unexpected offset after chunk %q: %s", testCase.body, resp.Header.Get("Upload-Offset"))
+		}
+	}
+
+	resp = serve(mustMakeRequest("HEAD", location, "", map[string]string{"Tus-Resumable": "1.0.0"}))
+	if offset := resp.Header.Get("Upload-Offset"); offset != "5" {
+		t.Errorf("expected the failed chunks to be discarded, got offset %s", offset)
+	}
+
+	if resp := patch("5", " world", nil); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("unexpected status code for the last chunk: %d", resp.StatusCode)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(root, "big.bin"))
+	if err != nil {
+		t.Fatalf("failed to read the uploaded file: %s", err)
+	}
+	if string(data) != "hello world" {
+		t.Errorf("unexpected uploaded content: %q", data)
+	}
+	if resp := patch("11", "", nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected finished upload to be gone, got status %d", resp.StatusCode)
+	}
+}
+
+func TestUploadCollect(t *testing.T) {
+	uploads := &fshttp.Uploads{Dir: t.TempDir(), Expiry: time.Minute}
+	handler := &fshttp.Handler{Editor: filesystem.DirManager{Root: t.TempDir()}, Uploads: uploads}
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, mustMakeRequest("POST", "http://some.url.com/a.bin", "", map[string]string{"Upload-Length": "3"}))
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("unexpected status code for upload creation: %d", recorder.Code)
+	}
+
+	if err := uploads.Collect(time.Now()); err != nil {
+		t.Fatalf("collect failed: %s", err)
+	}
+	if entries, _ := ioutil.ReadDir(uploads.Dir); len(entries) != 2 {
+		t.Errorf("expected the active upload to be kept, found %d files", len(entries))
+	}
+
+	if err := uploads.Collect(time.Now().Add(2 * time.Minute)); err != nil {
+		t.Fatalf("collect failed: %s", err)
+	}
+	if entries, _ := ioutil.ReadDir(uploads.Dir); len(entries) != 0 {
+		t.Errorf("expected the expired upload to be removed, found %d files", len(entries))
+	}
+	if _, err := os.Stat(uploads.Dir); err != nil {
+		t.Errorf("upload directory should be kept: %s", err)
+	}
+}
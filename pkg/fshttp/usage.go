@@ -0,0 +1,42 @@
+package fshttp
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/peymanmortazavi/fs-server/pkg/filesystem"
+)
+
+func diskUsageOf(usage filesystem.DiskUsage) *DiskUsage {
+	return &DiskUsage{Bytes: usage.Bytes, Files: usage.Files, Dirs: usage.Dirs}
+}
+
+// diskUsage measures the item at path, using the cache when there is one.
+func (h *Handler) diskUsage(ctx context.Context, itemPath string) (filesystem.DiskUsage, map[string]filesystem.DiskUsage, error) {
+	if h.Usage != nil {
+		return h.Usage.Usage(ctx, h.viewer(), itemPath)
+	}
+	return filesystem.Measure(ctx, h.viewer(), itemPath, h.SearchConcurrency)
+}
+
+// populateUsage sets the disk usage of the item, and of its children when the
+// depth query parameter is 1. Measuring stops when the client goes away.
+func (h *Handler) populateUsage(request *http.Request, itemPath string, result *FileItem) error {
+	depth := request.URL.Query().Get("depth")
+	if depth != "" && depth != "0" && depth != "1" {
+		return newBadInputError("depth must be 0 or 1.")
+	}
+	total, children, err := h.diskUsage(request.Context(), itemPath)
+	if err != nil {
+		return err
+	}
+	result.Usage = diskUsageOf(total)
+	if depth == "1" {
+		for i, child := range result.Children {
+			if usage, ok := children[child.Name]; ok {
+				result.Children[i].Usage = diskUsageOf(usage)
+			}
+		}
+	}
+	return nil
+}
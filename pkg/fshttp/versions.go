@@ -0,0 +1,141 @@
+package fshttp
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/peymanmortazavi/fs-server/pkg/filesystem"
+)
+
+var (
+	versioningDisabled = Error{
+		Status:        http.StatusNotImplemented,
+		ID:            "versioning-disabled",
+		UserMessage:   "versioning is not enabled on this server.",
+		SystemMessage: "the handler has no versions.",
+	}
+
+	versionNotFound = Error{
+		Status:        http.StatusNotFound,
+		ID:            "version-not-found",
+		UserMessage:   "no such version of this file.",
+		SystemMessage: "no version exists with the requested number.",
+	}
+)
+
+func parseVersion(request *http.Request) (int, error) {
+	number, err := strconv.Atoi(request.URL.Query().Get("version"))
+	if err != nil || number <= 0 {
+		return 0, newBadInputError("version must be a positive number.")
+	}
+	return number, nil
+}
+
+// handleVersions lists the versions of the requested file.
+func (h *Handler) handleVersions(writer http.ResponseWriter, request *http.Request) error {
+	if h.Versions == nil {
+		return versioningDisabled
+	}
+	path := strings.Trim(request.URL.Path, "/")
+	versions, err := h.Versions.Versions(path)
+	if err != nil {
+		log.Printf("failed to list versions of %s: %s", path, err)
+		return internalServerError
+	}
+	result := make([]FileVersion, 0, len(versions))
+	for _, version := range versions {
+		result = append(result, FileVersion{Version: version.Number, Size: version.Size, Time: version.Time})
+	}
+	if err := writeJSON(writer, result); err != nil {
+		log.Printf("failed to write versions of %s: %s", path, err)
+	}
+	return nil
+}
+
+// handleGetVersion writes a version of the requested file.
+func (h *Handler) handleGetVersion(writer http.ResponseWriter, request *http.Request) error {
+	if h.Versions == nil {
+		return versioningDisabled
+	}
+	number, err := parseVersion(request)
+	if err != nil {
+		return err
+	}
+	path := strings.Trim(request.URL.Path, "/")
+	item, err := h.Versions.GetVersion(path, number)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return versionNotFound
+		}
+		log.Printf("failed to get version %d of %s: %s", number, path, err)
+		return internalServerError
+	}
+	result, err := fileItemFromFSItem(item, true)
+	if err != nil {
+		log.Printf("failed to populate data for version %d of %s: %s", number, path, err)
+		if filesystem.IsCorrupted(err) {
+			return corruptedFile
+		}
+		return internalServerError
+	}
+	if err := writeJSON(writer, result); err != nil {
+		log.Printf("failed to write version %d of %s: %s", number, path, err)
+	}
+	return nil
+}
+
+// handleRestoreVersion writes a version back to the requested file, recreating
+// it when it was deleted.
+func (h *Handler) handleRestoreVersion(writer http.ResponseWriter, request *http.Request) error {
+	if h.Versions == nil {
+		return versioningDisabled
+	}
+	number, err := parseVersion(request)
+	if err != nil {
+		return err
+	}
+	path := strings.Trim(request.URL.Path, "/")
+	version, err := h.Versions.GetVersion(path, number)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return versionNotFound
+		}
+		log.Printf("failed to get version %d of %s: %s", number, path, err)
+		return internalServerError
+	}
+	var oldSize int64
+	current, err := h.Get(path)
+	created := os.IsNotExist(err)
+	switch {
+	case err == nil && current.IsDir():
+		return fileExpected
+	case err == nil:
+		oldSize = current.Size
+	case !created:
+		return err
+	}
+
+	principal := Principal(request)
+	reservation, err := h.Quotas.Reserve(principal, path, oldSize, version.Size, created)
+	if err != nil {
+		return err
+	}
+	defer reservation.Release()
+	before := h.changes().State(path)
+	defer h.Digests.Forget(path)
+	if err := h.Versions.RestoreVersion(path, number); err != nil {
+		if isPermission(err) {
+			return writeAccessDenied
+		}
+		log.Printf("failed to restore version %d of %s: %s", number, path, err)
+		return internalServerError
+	}
+	reservation.Commit(version.Size)
+	if created {
+		return h.notify(request, MutationCreate, path, nil)
+	}
+	return h.notify(request, MutationWrite, path, before)
+}
@@ -0,0 +1,117 @@
+package fshttp_test
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/peymanmortazavi/fs-server/pkg/filesystem"
+	"github.com/peymanmortazavi/fs-server/pkg/fshttp"
+)
+
+func TestVersions(t *testing.T) {
+	versioned := filesystem.NewVersioned(filesystem.DirManager{Root: t.TempDir()})
+	trash, err := filesystem.NewTrash(versioned)
+	if err != nil {
+		t.Fatalf("failed to create trash: %s", err)
+	}
+	handler := &fshttp.Handler{Editor: trash, Trash: trash, Versions: versioned, Administrators: []string{"root"}}
+	serve := func(method, url, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(method, url, strings.NewReader(body))
+		handler.ServeHTTP(recorder, fshttp.WithPrincipal(request, "root"))
+		return recorder
+	}
+	read := func(url string) string {
+		t.Helper()
+		var item fshttp.FileItem
+		json.NewDecoder(serve("GET", url, "").Body).Decode(&item)
+		return item.Data
+	}
+
+	serve("POST", "/config.yaml", `{"type": "file", "data": "one"}`)
+	serve("PUT", "/config.yaml", `{"data": "two"}`)
+	serve("PUT", "/config.yaml", `{"data": "three"}`)
+
+	var versions []fshttp.FileVersion
+	json.NewDecoder(serve("GET", "/config.yaml?versions", "").Body).Decode(&versions)
+	if len(versions) != 2 || versions[0].Version != 1 || versions[0].Size != 3 {
+		t.Fatalf("unexpected versions: %+v", versions)
+	}
+	if data := read("/config.yaml?version=1"); data != "one" {
+		t.Errorf("unexpected content of the first version: %q", data)
+	}
+	if code := serve("GET", "/config.yaml?version=9", "").Code; code != 404 {
+		t.Errorf("expected a missing version to fail with 404 but got %d", code)
+	}
+	if code := serve("PUT", "/config.yaml?version=1", "").Code; code != 200 {
+		t.Fatalf("unexpected status code for restoring a version: %d", code)
+	}
+	if data := read("/config.yaml"); data != "one" {
+		t.Errorf("unexpected content after restoring: %q", data)
+	}
+
+	// moving to the trash keeps the versions out of the way, deleting permanently keeps a version.
+	serve("DELETE", "/config.yaml?permanent=true", "")
+	if code := serve("PUT", "/config.yaml?version=4", "").Code; code != 200 {
+		t.Fatalf("unexpected status code for restoring a deleted file: %d", code)
+	}
+	if data := read("/config.yaml"); data != "one" {
+		t.Errorf("unexpected content of the restored file: %q", data)
+	}
+	if code := serve("GET", "/.versions", "").Code; code != 404 {
+		t.Errorf("expected the versions directory to be hidden but got %d", code)
+	}
+}
+
+func TestVersionQuotas(t *testing.T) {
+	versioned := filesystem.NewVersioned(filesystem.DirManager{Root: t.TempDir()})
+	versioned.MaxVersions = 1
+	rules := []fshttp.QuotaRule{{Prefix: "docs", MaxBytes: 10}, {Principal: "*"}}
+	quotas := &fshttp.Quotas{Rules: rules, Versions: versioned}
+	versioned.Kept, versioned.Removed = quotas.VersionKept, quotas.VersionRemoved
+	quotas.Init(versioned)
+	handler := &fshttp.Handler{Editor: versioned, Versions: versioned, Quotas: quotas}
+	serve := func(method, url, body string) int {
+		t.Helper()
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(method, url, strings.NewReader(body))
+		handler.ServeHTTP(recorder, fshttp.WithPrincipal(request, "alice"))
+		return recorder.Code
+	}
+	used := func(quotas *fshttp.Quotas) map[string]fshttp.Usage {
+		result := make(map[string]fshttp.Usage)
+		for _, status := range quotas.Status() {
+			result[status.Prefix+status.Principal] = status.Used
+		}
+		return result
+	}
+
+	serve("POST", "/docs", `{"type": "dir"}`)
+	serve("POST", "/docs/a.txt", `{"type": "file", "data": "12345"}`)
+	if code := serve("PUT", "/docs/a.txt", `{"data": "1234"}`); code != 200 {
+		t.Fatalf("expected the overwrite and its version to fit but got %d", code)
+	}
+	if usage := used(quotas); usage["docs"] != (fshttp.Usage{Bytes: 9, Files: 3}) || usage["alice"] != (fshttp.Usage{Bytes: 9, Files: 3}) {
+		t.Errorf("expected the version to be charged but got %+v", usage)
+	}
+	// the version of the 4 bytes being replaced does not fit.
+	if code := serve("PUT", "/docs/a.txt", `{"data": "12"}`); code != 507 {
+		t.Errorf("expected versions to count against the quota but got %d", code)
+	}
+	restarted := &fshttp.Quotas{Rules: rules, Versions: versioned}
+	restarted.Init(versioned)
+	if usage := used(restarted); usage["docs"] != (fshttp.Usage{Bytes: 9, Files: 3}) {
+		t.Errorf("unexpected usage after measuring again: %+v", usage)
+	}
+
+	// versions beyond MaxVersions are discharged.
+	if code := serve("PUT", "/docs/a.txt", `{"data": "1"}`); code != 200 {
+		t.Fatalf("expected the overwrite and its version to fit but got %d", code)
+	}
+	if usage := used(quotas); usage["docs"] != (fshttp.Usage{Bytes: 5, Files: 3}) || usage["alice"] != (fshttp.Usage{Bytes: 5, Files: 3}) {
+		t.Errorf("expected the removed versions to be discharged but got %+v", usage)
+	}
+}
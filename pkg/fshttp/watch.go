@@ -0,0 +1,160 @@
+package fshttp
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/peymanmortazavi/fs-server/pkg/filesystem"
+)
+
+const watchHeartbeat = 30 * time.Second
+
+var watchNotSupported = Error{
+	Status:        http.StatusNotImplemented,
+	ID:            "watch-not-supported",
+	UserMessage:   "watching for changes is not supported by this server.",
+	SystemMessage: "the file system does not implement filesystem.Watcher.",
+}
+
+func watchEventFromFSEvent(event filesystem.Event) WatchEvent {
+	return WatchEvent{
+		ID:      event.ID,
+		Type:    string(event.Type),
+		Path:    event.Path,
+		OldPath: event.OldPath,
+		Time:    event.Time,
+	}
+}
+
+// watcher returns the watcher of the handler, falling back to the Editor.
+func (h *Handler) watcher() filesystem.Watcher {
+	if h.Watcher != nil {
+		return h.Watcher
+	}
+	if watcher, ok := h.viewer().(filesystem.Watcher); ok {
+		return watcher
+	}
+	return nil
+}
+
+// handleWatch streams changes at the requested path over Server-Sent Events or
+// a WebSocket, resuming after Last-Event-ID when one is given.
+func (h *Handler) handleWatch(writer http.ResponseWriter, request *http.Request) error {
+	watcher := h.watcher()
+	if watcher == nil {
+		return watchNotSupported
+	}
+	path := strings.Trim(request.URL.Path, "/")
+	query := request.URL.Query()
+	lastEventID := request.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = query.Get("lastEventId")
+	}
+	var after uint64
+	if lastEventID != "" {
+		var err error
+		if after, err = strconv.ParseUint(lastEventID, 10, 64); err != nil {
+			return newBadInputError("Last-Event-ID must be an event id.")
+		}
+	}
+
+	subscription, err := watcher.Watch(path, query.Get("recursive") == "true", after)
+	if err != nil {
+		log.Printf("failed to watch %s: %s", path, err)
+		return internalServerError
+	}
+	defer subscription.Close()
+
+	if isWebSocketRequest(request) {
+		return streamWebSocket(writer, request, subscription, filesystem.VisibleEvent)
+	}
+	return streamEvents(writer, request, subscription, filesystem.VisibleEvent)
+}
+
+// visibleFunc filters the events streamed to clients.
+type visibleFunc func(filesystem.Event) (filesystem.Event, bool)
+
+func streamEvents(writer http.ResponseWriter, request *http.Request, subscription *filesystem.Subscription, visible visibleFunc) error {
+	flusher, ok := writer.(http.Flusher)
+	if !ok {
+		return watchNotSupported
+	}
+	header := writer.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("X-Accel-Buffering", "no")
+	writer.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(watchHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-request.Context().Done():
+			return nil
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(writer, ": keep-alive\n\n"); err != nil {
+				return nil
+			}
+		case event, ok := <-subscription.Events():
+			if !ok {
+				// the client reconnects with Last-Event-ID and catches up.
+				return nil
+			}
+			if event, ok = visible(event); !ok {
+				continue
+			}
+			data, _ := json.Marshal(watchEventFromFSEvent(event))
+			if _, err := fmt.Fprintf(writer, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data); err != nil {
+				return nil
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+func streamWebSocket(writer http.ResponseWriter, request *http.Request, subscription *filesystem.Subscription, visible visibleFunc) error {
+	conn, err := upgradeWebSocket(writer, request)
+	if err != nil {
+		if e, ok := err.(Error); ok {
+			return e
+		}
+		return nil
+	}
+	defer conn.Close()
+	closed := make(chan struct{})
+	go func() {
+		conn.readLoop()
+		close(closed)
+	}()
+
+	heartbeat := time.NewTicker(watchHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-closed:
+			return nil
+		case <-heartbeat.C:
+			if err := conn.writeFrame(opPing, nil); err != nil {
+				return nil
+			}
+		case event, ok := <-subscription.Events():
+			if !ok {
+				_ = conn.writeFrame(opClose, nil)
+				return nil
+			}
+			if event, ok = visible(event); !ok {
+				continue
+			}
+			data, _ := json.Marshal(watchEventFromFSEvent(event))
+			if err := conn.writeFrame(opText, data); err != nil {
+				return nil
+			}
+		}
+	}
+}
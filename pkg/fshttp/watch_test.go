@@ -0,0 +1,113 @@
+package fshttp_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/peymanmortazavi/fs-server/pkg/filesystem"
+	"github.com/peymanmortazavi/fs-server/pkg/fshttp"
+)
+
+func TestWatchServerSentEvents(t *testing.T) {
+	notifier := filesystem.NewNotifier(filesystem.DirManager{Root: t.TempDir()})
+	server := httptest.NewServer(&fshttp.Handler{Editor: notifier})
+	defer server.Close()
+
+	first := notifier.Publish(filesystem.Created, "old.txt", "")
+	notifier.Publish(filesystem.Deleted, "old.txt", "")
+
+	req, _ := http.NewRequest("GET", server.URL+"/?watch=true&recursive=true", nil)
+	req.Header.Set("Last-Event-ID", "1")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("watch request failed: %s", err)
+	}
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("unexpected content type: %s", resp.Header.Get("Content-Type"))
+	}
+
+	if _, err := http.Post(server.URL+"/sub", "application/json", strings.NewReader(`{"type": "dir"}`)); err != nil {
+		t.Fatalf("failed to create directory: %s", err)
+	}
+
+	reader := bufio.NewReader(resp.Body)
+	expected := []string{"delete old.txt", "create sub"}
+	for _, want := range expected {
+		var event fshttp.WatchEvent
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				t.Fatalf("failed to read events: %s", err)
+			}
+			if strings.HasPrefix(line, "data: ") {
+				json.Unmarshal([]byte(line[len("data: "):]), &event)
+				break
+			}
+		}
+		if got := event.Type + " " + event.Path; got != want || event.ID <= first.ID {
+			t.Errorf("expected event %q but got %q (id %d)", want, got, event.ID)
+		}
+	}
+}
+
+func TestWatchWebSocket(t *testing.T) {
+	notifier := filesystem.NewNotifier(filesystem.DirManager{Root: t.TempDir()})
+	server := httptest.NewServer(&fshttp.Handler{Editor: notifier})
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatalf("failed to connect: %s", err)
+	}
+	defer conn.Close()
+	io.WriteString(conn, "GET /?watch=true HTTP/1.1\r\n"+
+		"Host: localhost\r\n"+
+		"Connection: Upgrade\r\n"+
+		"Upgrade: websocket\r\n"+
+		"Sec-WebSocket-Version: 13\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n\r\n")
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatalf("failed to read handshake: %s", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("unexpected handshake status: %d", resp.StatusCode)
+	}
+	if accept := resp.Header.Get("Sec-WebSocket-Accept"); accept != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("unexpected accept key: %s", accept)
+	}
+
+	notifier.Publish(filesystem.Created, "a.txt", "")
+
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		t.Fatalf("failed to read frame: %s", err)
+	}
+	if header[0] != 0x81 {
+		t.Fatalf("expected a final text frame but got %x", header[0])
+	}
+	payload := make([]byte, header[1])
+	io.ReadFull(reader, payload)
+	var event fshttp.WatchEvent
+	if err := json.Unmarshal(payload, &event); err != nil || event.Path != "a.txt" {
+		t.Errorf("unexpected event %s: %v", payload, err)
+	}
+}
+
+func TestWatchNotSupported(t *testing.T) {
+	handler := &fshttp.Handler{Editor: &dummyViewer{}}
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, mustMakeGETRequest("http://some.url.com/?watch=true"))
+	if recorder.Code != http.StatusNotImplemented {
+		t.Errorf("unexpected status code: %d", recorder.Code)
+	}
+}
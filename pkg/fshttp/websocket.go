@@ -0,0 +1,168 @@
+package fshttp
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// This is a minimal server side WebSocket (RFC 6455) implementation, enough to
+// push messages to clients and to notice when they go away.
+
+const (
+	webSocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+	opText  = 0x1
+	opClose = 0x8
+	opPing  = 0x9
+	opPong  = 0xA
+
+	maxClientFrameSize = 64 << 10
+)
+
+var errBadFrame = errors.New("invalid websocket frame")
+
+type webSocketConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	mu     sync.Mutex
+}
+
+func headerContains(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isWebSocketRequest(request *http.Request) bool {
+	return headerContains(request.Header, "Connection", "upgrade") &&
+		headerContains(request.Header, "Upgrade", "websocket")
+}
+
+// upgradeWebSocket completes the opening handshake and takes over the connection.
+func upgradeWebSocket(writer http.ResponseWriter, request *http.Request) (*webSocketConn, error) {
+	key := request.Header.Get("Sec-WebSocket-Key")
+	if request.Method != http.MethodGet || key == "" || request.Header.Get("Sec-WebSocket-Version") != "13" {
+		return nil, newBadInputError("invalid websocket handshake, only version 13 is supported.")
+	}
+	hijacker, ok := writer.(http.Hijacker)
+	if !ok {
+		return nil, internalServerError
+	}
+	conn, buffer, err := hijacker.Hijack()
+	if err != nil {
+		return nil, internalServerError
+	}
+	sum := sha1.Sum([]byte(key + webSocketGUID))
+	response := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(sum[:]) + "\r\n\r\n"
+	if _, err := conn.Write([]byte(response)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &webSocketConn{conn: conn, reader: buffer.Reader}, nil
+}
+
+func (c *webSocketConn) writeFrame(opcode byte, payload []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	header := make([]byte, 2, 10)
+	header[0] = 0x80 | opcode
+	switch length := len(payload); {
+	case length < 126:
+		header[1] = byte(length)
+	case length <= 0xFFFF:
+		header[1] = 126
+		header = append(header, 0, 0)
+		binary.BigEndian.PutUint16(header[2:], uint16(length))
+	default:
+		header[1] = 127
+		header = append(header, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(header[2:], uint64(length))
+	}
+	if _, err := c.conn.Write(header); err != nil {
+		return err
+	}
+	_, err := c.conn.Write(payload)
+	return err
+}
+
+// readFrame reads one frame sent by the client, unmasking its payload.
+func (c *webSocketConn) readFrame() (byte, []byte, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(c.reader, header[:]); err != nil {
+		return 0, nil, err
+	}
+	opcode := header[0] & 0x0F
+	if header[1]&0x80 == 0 {
+		// clients must mask every frame.
+		return 0, nil, errBadFrame
+	}
+	length := uint64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		var extended [2]byte
+		if _, err := io.ReadFull(c.reader, extended[:]); err != nil {
+			return 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(extended[:]))
+	case 127:
+		var extended [8]byte
+		if _, err := io.ReadFull(c.reader, extended[:]); err != nil {
+			return 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(extended[:])
+	}
+	if length > maxClientFrameSize {
+		return 0, nil, errBadFrame
+	}
+	var mask [4]byte
+	if _, err := io.ReadFull(c.reader, mask[:]); err != nil {
+		return 0, nil, err
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		return 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return opcode, payload, nil
+}
+
+// readLoop answers pings and returns once the client closes the connection.
+func (c *webSocketConn) readLoop() {
+	for {
+		opcode, payload, err := c.readFrame()
+		if err != nil {
+			return
+		}
+		switch opcode {
+		case opPing:
+			if c.writeFrame(opPong, payload) != nil {
+				return
+			}
+		case opClose:
+			_ = c.writeFrame(opClose, payload)
+			return
+		}
+	}
+}
+
+func (c *webSocketConn) Close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,102 @@
+// Package logfile appends logs to files rotated by size.
+package logfile
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// File appends to a log file, renaming it once a write would grow it beyond
+// MaxSize. The previous file becomes path.1, the one before path.2 and so on,
+// only MaxBackups of them are kept.
+type File struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// Open appends to the log file at path, creating it when missing. A maxSize of
+// 0 never rotates it.
+func Open(path string, maxSize int64, maxBackups int) (*File, error) {
+	f := &File{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Backup returns the path of the nth previous file of the log file at path.
+func Backup(path string, n int) string {
+	return fmt.Sprintf("%s.%d", path, n)
+}
+
+func (f *File) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file, f.size = file, info.Size()
+	return nil
+}
+
+// rotate moves the current file to the first backup, dropping the oldest one.
+func (f *File) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	if f.maxBackups == 0 {
+		if err := os.Remove(f.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return f.open()
+	}
+	for n := f.maxBackups - 1; n > 0; n-- {
+		if err := os.Rename(Backup(f.path, n), Backup(f.path, n+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Rename(f.path, Backup(f.path, 1)); err != nil {
+		return err
+	}
+	return f.open()
+}
+
+// Write appends to the file, rotating it first when it would grow beyond the
+// maximum size. A single write is never split across files.
+func (f *File) Write(buffer []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+	if f.maxSize > 0 && f.size > 0 && f.size+int64(len(buffer)) > f.maxSize {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(buffer)
+	f.size += int64(n)
+	return n, err
+}
+
+// Close closes the current file.
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return os.ErrClosed
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
@@ -0,0 +1,69 @@
+package logfile_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/peymanmortazavi/fs-server/pkg/logfile"
+)
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read %s: %s", path, err)
+	}
+	return string(data)
+}
+
+func TestRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	if err := ioutil.WriteFile(path, []byte("old\n"), 0644); err != nil {
+		t.Fatalf("failed to write log file: %s", err)
+	}
+	file, err := logfile.Open(path, 8, 2)
+	if err != nil {
+		t.Fatalf("failed to open log file: %s", err)
+	}
+	defer file.Close()
+
+	for _, line := range []string{"one\n", "two\n", "three\n", "four\n"} {
+		if _, err := file.Write([]byte(line)); err != nil {
+			t.Fatalf("failed to write %q: %s", line, err)
+		}
+	}
+	expected := map[string]string{
+		path:                    "four\n",
+		logfile.Backup(path, 1): "three\n",
+		logfile.Backup(path, 2): "two\n",
+	}
+	for name, content := range expected {
+		if actual := readFile(t, name); actual != content {
+			t.Errorf("expected %s to hold %q but got %q", name, content, actual)
+		}
+	}
+	if _, err := os.Stat(logfile.Backup(path, 3)); !os.IsNotExist(err) {
+		t.Errorf("expected only two backups to be kept but got %v", err)
+	}
+}
+
+func TestNoRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	file, err := logfile.Open(path, 0, 2)
+	if err != nil {
+		t.Fatalf("failed to open log file: %s", err)
+	}
+	file.Write([]byte("a line longer than the others\n"))
+	file.Write([]byte("another\n"))
+	if err := file.Close(); err != nil {
+		t.Fatalf("failed to close log file: %s", err)
+	}
+	if actual := readFile(t, path); actual != "a line longer than the others\nanother\n" {
+		t.Errorf("unexpected content %q", actual)
+	}
+	if _, err := file.Write([]byte("closed\n")); err != os.ErrClosed {
+		t.Errorf("expected writing to a closed file to fail but got %v", err)
+	}
+}
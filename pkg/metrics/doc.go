@@ -0,0 +1,3 @@
+// Package metrics keeps counters, gauges and histograms and exposes them in
+// the Prometheus text exposition format.
+package metrics
@@ -0,0 +1,241 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are the upper bounds of histograms of durations in seconds.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// SizeBuckets are the upper bounds of histograms of sizes in bytes, from 1KiB to 1GiB.
+var SizeBuckets = []float64{1 << 10, 16 << 10, 256 << 10, 1 << 20, 16 << 20, 256 << 20, 1 << 30}
+
+type kind string
+
+const (
+	counterKind   kind = "counter"
+	gaugeKind     kind = "gauge"
+	histogramKind kind = "histogram"
+)
+
+// Registry keeps metric families and writes them in the Prometheus text
+// exposition format. The zero value is ready to use.
+type Registry struct {
+	mu       sync.Mutex
+	families []*family
+}
+
+type family struct {
+	name    string
+	help    string
+	kind    kind
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	values []string
+	value  float64
+
+	// counts are per bucket and not cumulative, the last one is +Inf.
+	counts []uint64
+	count  uint64
+}
+
+func (r *Registry) register(name, help string, kind kind, buckets []float64, labels []string) *family {
+	f := &family{name: name, help: help, kind: kind, labels: labels, buckets: buckets, series: make(map[string]*series)}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.families {
+		if existing.name == name {
+			panic(fmt.Sprintf("metrics: %s is registered more than once", name))
+		}
+	}
+	r.families = append(r.families, f)
+	return f
+}
+
+// get returns the series of the label values, the caller must hold the lock.
+func (f *family) get(values []string) *series {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values but got %d", f.name, len(f.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{values: append([]string(nil), values...)}
+		if f.kind == histogramKind {
+			s.counts = make([]uint64, len(f.buckets)+1)
+		}
+		f.series[key] = s
+	}
+	return s
+}
+
+// Counter is a value that only increases, for every combination of its labels.
+type Counter struct {
+	family *family
+}
+
+// NewCounter registers a counter with the given label names.
+func (r *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	return &Counter{r.register(name, help, counterKind, nil, labels)}
+}
+
+// Add increases the counter of the label values, negative values are ignored.
+func (c *Counter) Add(value float64, labels ...string) {
+	if value < 0 {
+		return
+	}
+	c.family.mu.Lock()
+	defer c.family.mu.Unlock()
+	c.family.get(labels).value += value
+}
+
+// Inc increases the counter of the label values by one.
+func (c *Counter) Inc(labels ...string) {
+	c.Add(1, labels...)
+}
+
+// Gauge is a value that can go up and down, for every combination of its labels.
+type Gauge struct {
+	family *family
+}
+
+// NewGauge registers a gauge with the given label names.
+func (r *Registry) NewGauge(name, help string, labels ...string) *Gauge {
+	return &Gauge{r.register(name, help, gaugeKind, nil, labels)}
+}
+
+// Add changes the gauge of the label values by the given amount.
+func (g *Gauge) Add(value float64, labels ...string) {
+	g.family.mu.Lock()
+	defer g.family.mu.Unlock()
+	g.family.get(labels).value += value
+}
+
+// Set sets the gauge of the label values.
+func (g *Gauge) Set(value float64, labels ...string) {
+	g.family.mu.Lock()
+	defer g.family.mu.Unlock()
+	g.family.get(labels).value = value
+}
+
+// Histogram counts observations in buckets, for every combination of its labels.
+type Histogram struct {
+	family *family
+}
+
+// NewHistogram registers a histogram with the given ascending bucket upper
+// bounds and label names.
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if !sort.Float64sAreSorted(buckets) {
+		panic(fmt.Sprintf("metrics: the buckets of %s are not sorted", name))
+	}
+	return &Histogram{r.register(name, help, histogramKind, buckets, labels)}
+}
+
+// Observe records a value for the label values.
+func (h *Histogram) Observe(value float64, labels ...string) {
+	h.family.mu.Lock()
+	defer h.family.mu.Unlock()
+	s := h.family.get(labels)
+	s.counts[sort.SearchFloat64s(h.family.buckets, value)]++
+	s.count++
+	s.value += value
+}
+
+// WriteTo writes every metric in the Prometheus text exposition format.
+func (r *Registry) WriteTo(writer io.Writer) (int64, error) {
+	r.mu.Lock()
+	families := append([]*family(nil), r.families...)
+	r.mu.Unlock()
+	sort.Slice(families, func(i, j int) bool { return families[i].name < families[j].name })
+
+	var builder strings.Builder
+	for _, f := range families {
+		f.write(&builder)
+	}
+	n, err := io.WriteString(writer, builder.String())
+	return int64(n), err
+}
+
+// ServeHTTP writes every metric.
+func (r *Registry) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	writer.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	r.WriteTo(writer)
+}
+
+func (f *family) write(builder *strings.Builder) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fmt.Fprintf(builder, "# HELP %s %s\n# TYPE %s %s\n", f.name, escapeHelp(f.help), f.name, f.kind)
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		s := f.series[key]
+		if f.kind != histogramKind {
+			fmt.Fprintf(builder, "%s%s %s\n", f.name, f.labelSet(s.values, "", ""), formatValue(s.value))
+			continue
+		}
+		var cumulative uint64
+		for i, upper := range f.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(builder, "%s_bucket%s %d\n", f.name, f.labelSet(s.values, "le", formatValue(upper)), cumulative)
+		}
+		fmt.Fprintf(builder, "%s_bucket%s %d\n", f.name, f.labelSet(s.values, "le", "+Inf"), s.count)
+		fmt.Fprintf(builder, "%s_sum%s %s\n", f.name, f.labelSet(s.values, "", ""), formatValue(s.value))
+		fmt.Fprintf(builder, "%s_count%s %d\n", f.name, f.labelSet(s.values, "", ""), s.count)
+	}
+}
+
+// labelSet formats the labels of a series, along with an extra label when given.
+func (f *family) labelSet(values []string, extraName, extraValue string) string {
+	pairs := make([]string, 0, len(values)+1)
+	for i, name := range f.labels {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", name, escapeLabel(values[i])))
+	}
+	if extraName != "" {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", extraName, extraValue))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(help string) string {
+	return helpEscaper.Replace(help)
+}
+
+func escapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
@@ -0,0 +1,58 @@
+package metrics_test
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/peymanmortazavi/fs-server/pkg/metrics"
+)
+
+func TestRegistry(t *testing.T) {
+	var registry metrics.Registry
+	requests := registry.NewCounter("requests_total", "Requests served.", "method", "error")
+	inFlight := registry.NewGauge("in_flight", "Requests in flight.")
+	durations := registry.NewHistogram("duration_seconds", "How long requests take.", []float64{0.1, 1}, "method")
+
+	requests.Inc("GET", "none")
+	requests.Add(2, "GET", "none")
+	requests.Inc("PUT", `quote"d`)
+	requests.Add(-1, "GET", "none")
+	inFlight.Add(3)
+	inFlight.Add(-1)
+	durations.Observe(0.05, "GET")
+	durations.Observe(0.1, "GET")
+	durations.Observe(0.5, "GET")
+	durations.Observe(7, "GET")
+
+	recorder := httptest.NewRecorder()
+	registry.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	if contentType := recorder.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/plain; version=0.0.4") {
+		t.Errorf("unexpected content type %q", contentType)
+	}
+	expected := `# HELP duration_seconds How long requests take.
+# TYPE duration_seconds histogram
+duration_seconds_bucket{method="GET",le="0.1"} 2
+duration_seconds_bucket{method="GET",le="1"} 3
+duration_seconds_bucket{method="GET",le="+Inf"} 4
+duration_seconds_sum{method="GET"} 7.65
+duration_seconds_count{method="GET"} 4
+# HELP in_flight Requests in flight.
+# TYPE in_flight gauge
+in_flight 2
+# HELP requests_total Requests served.
+# TYPE requests_total counter
+requests_total{method="GET",error="none"} 3
+requests_total{method="PUT",error="quote\"d"} 1
+`
+	if body := recorder.Body.String(); body != expected {
+		t.Errorf("unexpected exposition:\n%s\nexpected:\n%s", body, expected)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected registering a name twice to panic")
+		}
+	}()
+	registry.NewGauge("in_flight", "again")
+}
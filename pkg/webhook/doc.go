@@ -0,0 +1,3 @@
+// Package webhook delivers notifications about file mutations to HTTP
+// endpoints, retrying failed deliveries from a persistent queue.
+package webhook
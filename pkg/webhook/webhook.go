@@ -0,0 +1,495 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/peymanmortazavi/fs-server/pkg/fshttp"
+)
+
+const (
+	// SignatureHeader carries the HMAC-SHA256 signature of the request body.
+	SignatureHeader = "X-FS-Signature"
+
+	// EventHeader carries the mutation type of the delivery.
+	EventHeader = "X-FS-Event"
+
+	// DeliveryHeader carries the unique id of the delivery, it is the same for retries.
+	DeliveryHeader = "X-FS-Delivery"
+
+	defaultMaxAttempts    = 8
+	defaultInitialBackoff = time.Second
+	defaultMaxBackoff     = 10 * time.Minute
+	defaultTimeout        = 10 * time.Second
+	defaultQueueSize      = 1024
+	defaultMaxPending     = 10000
+)
+
+// Target is an endpoint notified about mutations.
+type Target struct {
+	// URL receives a POST request for every matching mutation.
+	URL string `json:"url"`
+
+	// Secret signs the request body when set.
+	Secret string `json:"secret,omitempty"`
+
+	// Patterns filter mutations by path, every mutation matches when empty.
+	// Patterns use path.Match syntax and a trailing "/**" matches anything
+	// beneath a directory.
+	Patterns []string `json:"patterns,omitempty"`
+
+	// Events filters mutations by type, every type matches when empty.
+	Events []fshttp.MutationType `json:"events,omitempty"`
+}
+
+func matchPattern(pattern, p string) bool {
+	if prefix := strings.TrimSuffix(pattern, "/**"); prefix != pattern {
+		return p == prefix || strings.HasPrefix(p, prefix+"/")
+	}
+	matched, _ := path.Match(pattern, p)
+	return matched
+}
+
+// Matches returns if the target wants to be notified about the mutation.
+func (t Target) Matches(mutation fshttp.Mutation) bool {
+	if len(t.Events) > 0 {
+		found := false
+		for _, event := range t.Events {
+			found = found || event == mutation.Type
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(t.Patterns) == 0 {
+		return true
+	}
+	for _, pattern := range t.Patterns {
+		if matchPattern(pattern, mutation.Path) {
+			return true
+		}
+	}
+	return false
+}
+
+// Sign returns the signature header value of a body signed with secret.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify returns if signature is a valid signature of body for the secret.
+func Verify(secret string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, body)), []byte(signature))
+}
+
+// Payload is the JSON body sent to targets.
+type Payload struct {
+	ID string `json:"id"`
+	fshttp.Mutation
+}
+
+// delivery is one payload waiting to be sent to one target.
+type delivery struct {
+	ID          string          `json:"id"`
+	URL         string          `json:"url"`
+	Event       string          `json:"event"`
+	Body        json.RawMessage `json:"body"`
+	Attempts    int             `json:"attempts"`
+	NextAttempt time.Time       `json:"next_attempt"`
+	LastError   string          `json:"last_error,omitempty"`
+}
+
+// Dispatcher queues mutations for matching targets and delivers them with retries.
+//
+// Mutations are handed to Run through a queue of QueueSize, so notifying never
+// waits for the disk. Pending deliveries are written to QueueDir so they survive
+// restarts, deliveries that still fail after MaxAttempts are appended to the
+// DeadLetter file as JSON lines, as are the ones arriving while the queue is
+// full or MaxPending deliveries are pending. Deliveries only happen while Run
+// is running.
+type Dispatcher struct {
+	Targets []Target
+
+	// QueueDir keeps pending deliveries, they are kept in memory only when empty.
+	QueueDir string
+
+	// DeadLetter is the file failed deliveries are appended to, they are only logged when empty.
+	DeadLetter string
+
+	// MaxAttempts is the number of attempts before a delivery is given up, 8 by default.
+	MaxAttempts int
+
+	// InitialBackoff is the wait after the first failure, doubled for every
+	// following failure up to MaxBackoff. They default to a second and 10 minutes.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+
+	// Client sends the requests, a client with a 10 second timeout is used when nil.
+	Client *http.Client
+
+	// QueueSize is the number of mutations waiting for Run, 1024 by default.
+	QueueSize int
+
+	// MaxPending bounds the deliveries waiting to succeed, 10000 by default.
+	MaxPending int
+
+	// deadMu serializes appending to the DeadLetter file.
+	deadMu sync.Mutex
+
+	mu       sync.Mutex
+	incoming chan fshttp.Mutation
+	pending  map[string]*delivery
+	inflight map[string]bool
+	wake     chan struct{}
+}
+
+func (d *Dispatcher) init() {
+	if d.pending == nil {
+		size := d.QueueSize
+		if size <= 0 {
+			size = defaultQueueSize
+		}
+		d.incoming = make(chan fshttp.Mutation, size)
+		d.pending = make(map[string]*delivery)
+		d.inflight = make(map[string]bool)
+		d.wake = make(chan struct{}, 1)
+	}
+}
+
+func (d *Dispatcher) signal() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+func newDeliveryID() string {
+	buffer := make([]byte, 16)
+	_, _ = rand.Read(buffer)
+	return hex.EncodeToString(buffer)
+}
+
+// OnMutation queues the mutation for Run, which queues a delivery of it for
+// every matching target.
+func (d *Dispatcher) OnMutation(mutation fshttp.Mutation) {
+	d.mu.Lock()
+	d.init()
+	incoming := d.incoming
+	d.mu.Unlock()
+	select {
+	case incoming <- mutation:
+	default:
+		log.Printf("webhook queue is full, giving up the deliveries of %s", mutation.Path)
+		for _, entry := range d.deliveries(mutation) {
+			entry.LastError = "the webhook queue is full"
+			d.deadLetter(entry)
+		}
+	}
+}
+
+// deliveries returns a delivery of the mutation for every matching target.
+func (d *Dispatcher) deliveries(mutation fshttp.Mutation) []*delivery {
+	var entries []*delivery
+	for _, target := range d.Targets {
+		if !target.Matches(mutation) {
+			continue
+		}
+		id := newDeliveryID()
+		body, err := json.Marshal(Payload{ID: id, Mutation: mutation})
+		if err != nil {
+			log.Printf("failed to encode webhook payload for %s: %s", mutation.Path, err)
+			continue
+		}
+		entries = append(entries, &delivery{ID: id, URL: target.URL, Event: string(mutation.Type), Body: body, NextAttempt: time.Now()})
+	}
+	return entries
+}
+
+// enqueue persists the deliveries of a mutation and makes them pending, the
+// ones beyond MaxPending go to the dead letter file.
+func (d *Dispatcher) enqueue(mutation fshttp.Mutation) {
+	maxPending := d.MaxPending
+	if maxPending <= 0 {
+		maxPending = defaultMaxPending
+	}
+	for _, entry := range d.deliveries(mutation) {
+		d.mu.Lock()
+		full := len(d.pending) >= maxPending
+		d.mu.Unlock()
+		if full {
+			log.Printf("too many pending webhook deliveries, giving up delivery %s to %s", entry.ID, entry.URL)
+			entry.LastError = "too many pending deliveries"
+			d.deadLetter(entry)
+			continue
+		}
+		if err := d.persist(entry); err != nil {
+			log.Printf("failed to queue webhook delivery %s: %s", entry.ID, err)
+		}
+		d.mu.Lock()
+		d.pending[entry.ID] = entry
+		d.mu.Unlock()
+	}
+}
+
+func (d *Dispatcher) persist(entry *delivery) error {
+	if d.QueueDir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(d.QueueDir, 0700); err != nil {
+		return err
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	// write to a temporary file first so a crash never leaves a partial entry.
+	temporary := filepath.Join(d.QueueDir, entry.ID+".tmp")
+	if err := ioutil.WriteFile(temporary, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(temporary, filepath.Join(d.QueueDir, entry.ID+".json"))
+}
+
+func (d *Dispatcher) unpersist(entry *delivery) {
+	if d.QueueDir == "" {
+		return
+	}
+	if err := os.Remove(filepath.Join(d.QueueDir, entry.ID+".json")); err != nil && !os.IsNotExist(err) {
+		log.Printf("failed to remove webhook delivery %s: %s", entry.ID, err)
+	}
+}
+
+// load reads the deliveries left in the queue directory by a previous run.
+func (d *Dispatcher) load() error {
+	if d.QueueDir == "" {
+		return nil
+	}
+	files, err := filepath.Glob(filepath.Join(d.QueueDir, "*.json"))
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		var entry delivery
+		if err := json.Unmarshal(data, &entry); err != nil {
+			log.Printf("skipping invalid webhook delivery %s: %s", file, err)
+			continue
+		}
+		d.pending[entry.ID] = &entry
+	}
+	return nil
+}
+
+// Run delivers queued mutations until the context is done, the mutations
+// still queued then are persisted for the next run.
+func (d *Dispatcher) Run(ctx context.Context) error {
+	d.mu.Lock()
+	d.init()
+	err := d.load()
+	incoming := d.incoming
+	d.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		now := time.Now()
+		next := now.Add(time.Hour)
+		d.mu.Lock()
+		for id, entry := range d.pending {
+			if d.inflight[id] {
+				continue
+			}
+			if entry.NextAttempt.After(now) {
+				if entry.NextAttempt.Before(next) {
+					next = entry.NextAttempt
+				}
+				continue
+			}
+			d.inflight[id] = true
+			wg.Add(1)
+			go func(entry *delivery) {
+				defer wg.Done()
+				d.attempt(ctx, entry)
+			}(entry)
+		}
+		d.mu.Unlock()
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(next.Sub(now))
+		select {
+		case <-ctx.Done():
+			for {
+				select {
+				case mutation := <-incoming:
+					d.enqueue(mutation)
+				default:
+					return nil
+				}
+			}
+		case mutation := <-incoming:
+			d.enqueue(mutation)
+		case <-d.wake:
+		case <-timer.C:
+		}
+	}
+}
+
+func (d *Dispatcher) secretOf(url string) string {
+	for _, target := range d.Targets {
+		if target.URL == url {
+			return target.Secret
+		}
+	}
+	return ""
+}
+
+func (d *Dispatcher) send(ctx context.Context, entry *delivery) error {
+	request, err := http.NewRequest(http.MethodPost, entry.URL, bytes.NewReader(entry.Body))
+	if err != nil {
+		return err
+	}
+	request = request.WithContext(ctx)
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(EventHeader, entry.Event)
+	request.Header.Set(DeliveryHeader, entry.ID)
+	if secret := d.secretOf(entry.URL); secret != "" {
+		request.Header.Set(SignatureHeader, Sign(secret, entry.Body))
+	}
+	client := d.Client
+	if client == nil {
+		client = &http.Client{Timeout: defaultTimeout}
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, io.LimitReader(response.Body, 64<<10))
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("receiver responded with status %d", response.StatusCode)
+	}
+	return nil
+}
+
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	wait, limit := d.InitialBackoff, d.MaxBackoff
+	if wait <= 0 {
+		wait = defaultInitialBackoff
+	}
+	if limit <= 0 {
+		limit = defaultMaxBackoff
+	}
+	for i := 1; i < attempts && wait < limit; i++ {
+		wait *= 2
+	}
+	if wait > limit {
+		wait = limit
+	}
+	return wait
+}
+
+func (d *Dispatcher) attempt(ctx context.Context, entry *delivery) {
+	err := d.send(ctx, entry)
+	if err != nil && ctx.Err() != nil {
+		// shutting down, the delivery is retried by the next run.
+		d.mu.Lock()
+		delete(d.inflight, entry.ID)
+		d.mu.Unlock()
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.inflight, entry.ID)
+	if err == nil {
+		delete(d.pending, entry.ID)
+		d.unpersist(entry)
+		return
+	}
+
+	entry.Attempts++
+	entry.LastError = err.Error()
+	maxAttempts := d.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = defaultMaxAttempts
+	}
+	if entry.Attempts >= maxAttempts {
+		log.Printf("giving up webhook delivery %s to %s after %d attempts: %s", entry.ID, entry.URL, entry.Attempts, err)
+		delete(d.pending, entry.ID)
+		d.deadLetter(entry)
+		d.unpersist(entry)
+		return
+	}
+	entry.NextAttempt = time.Now().Add(d.backoff(entry.Attempts))
+	if err := d.persist(entry); err != nil {
+		log.Printf("failed to update webhook delivery %s: %s", entry.ID, err)
+	}
+	d.signal()
+}
+
+func (d *Dispatcher) deadLetter(entry *delivery) {
+	if d.DeadLetter == "" {
+		return
+	}
+	data, _ := json.Marshal(entry)
+	d.deadMu.Lock()
+	defer d.deadMu.Unlock()
+	file, err := os.OpenFile(d.DeadLetter, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		log.Printf("failed to write dead letter for webhook delivery %s: %s", entry.ID, err)
+		return
+	}
+	defer file.Close()
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		log.Printf("failed to write dead letter for webhook delivery %s: %s", entry.ID, err)
+	}
+}
+
+// LoadTargets reads a JSON list of targets from a file.
+func LoadTargets(path string) ([]Target, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var targets []Target
+	if err := json.Unmarshal(data, &targets); err != nil {
+		return nil, fmt.Errorf("invalid webhook targets in %s: %s", path, err)
+	}
+	for _, target := range targets {
+		if target.URL == "" {
+			return nil, fmt.Errorf("invalid webhook targets in %s: url is required", path)
+		}
+	}
+	return targets, nil
+}
@@ -0,0 +1,210 @@
+package webhook_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/peymanmortazavi/fs-server/pkg/filesystem"
+	"github.com/peymanmortazavi/fs-server/pkg/fshttp"
+	"github.com/peymanmortazavi/fs-server/pkg/webhook"
+)
+
+// receiver is an httptest server recording deliveries, failing the first ones.
+type receiver struct {
+	*httptest.Server
+	mu         sync.Mutex
+	failures   int
+	deliveries []webhook.Payload
+	signatures []string
+	received   chan struct{}
+}
+
+func newReceiver(t *testing.T, failures int) *receiver {
+	r := &receiver{failures: failures, received: make(chan struct{}, 100)}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if r.failures > 0 {
+			r.failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := ioutil.ReadAll(req.Body)
+		var payload webhook.Payload
+		json.Unmarshal(body, &payload)
+		r.deliveries = append(r.deliveries, payload)
+		r.signatures = append(r.signatures, req.Header.Get(webhook.SignatureHeader))
+		if !webhook.Verify("secret", body, req.Header.Get(webhook.SignatureHeader)) {
+			t.Errorf("invalid signature for delivery %s", payload.ID)
+		}
+		r.received <- struct{}{}
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+func (r *receiver) wait(t *testing.T) {
+	t.Helper()
+	select {
+	case <-r.received:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for a delivery")
+	}
+}
+
+func run(dispatcher *webhook.Dispatcher) func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		dispatcher.Run(ctx)
+		close(done)
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+func TestTargetMatches(t *testing.T) {
+	target := webhook.Target{Patterns: []string{"releases/**", "*.txt"}, Events: []fshttp.MutationType{fshttp.MutationCreate}}
+	cases := map[string]bool{
+		"releases/v1/app.tar": true,
+		"releases":            true,
+		"notes.txt":           true,
+		"sub/notes.txt":       false,
+		"releasesx/app.tar":   false,
+	}
+	for path, expected := range cases {
+		if target.Matches(fshttp.Mutation{Type: fshttp.MutationCreate, Path: path}) != expected {
+			t.Errorf("expected match of %s to be %v", path, expected)
+		}
+	}
+	if target.Matches(fshttp.Mutation{Type: fshttp.MutationDelete, Path: "notes.txt"}) {
+		t.Errorf("expected delete mutations to be filtered out")
+	}
+}
+
+func TestDeliveryWithRetries(t *testing.T) {
+	recv := newReceiver(t, 2)
+	dispatcher := &webhook.Dispatcher{
+		Targets:        []webhook.Target{{URL: recv.URL, Secret: "secret", Patterns: []string{"releases/**"}}},
+		QueueDir:       t.TempDir(),
+		InitialBackoff: time.Millisecond,
+	}
+	stop := run(dispatcher)
+
+	// the handler notifies the dispatcher after a successful mutation.
+	handler := &fshttp.Handler{Editor: filesystem.DirManager{Root: t.TempDir()}, Listeners: []fshttp.MutationListener{dispatcher}}
+	for _, path := range []string{"/other", "/releases"} {
+		req := httptest.NewRequest("POST", path, strings.NewReader(`{"type": "dir"}`))
+		req = fshttp.WithPrincipal(req, "ci")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	recv.wait(t)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		files, _ := filepath.Glob(filepath.Join(dispatcher.QueueDir, "*.json"))
+		if len(files) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the delivered entry to leave the queue, found %d", len(files))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	stop()
+	recv.mu.Lock()
+	defer recv.mu.Unlock()
+	if len(recv.deliveries) != 1 {
+		t.Fatalf("expected exactly one delivery but got %d", len(recv.deliveries))
+	}
+	payload := recv.deliveries[0]
+	if payload.Path != "releases" || payload.Type != fshttp.MutationCreate || payload.Actor.Principal != "ci" || payload.Item.Type != fshttp.DirType {
+		t.Errorf("unexpected payload: %+v", payload)
+	}
+}
+
+func TestDeadLetter(t *testing.T) {
+	recv := newReceiver(t, 1000)
+	dir := t.TempDir()
+	dispatcher := &webhook.Dispatcher{
+		Targets:        []webhook.Target{{URL: recv.URL, Secret: "secret"}},
+		DeadLetter:     filepath.Join(dir, "dead.jsonl"),
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+	}
+	stop := run(dispatcher)
+	dispatcher.OnMutation(fshttp.Mutation{Type: fshttp.MutationDelete, Path: "a.txt"})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		data, _ := ioutil.ReadFile(dispatcher.DeadLetter)
+		if strings.Count(string(data), "\n") == 1 {
+			if !strings.Contains(string(data), `"attempts":3`) {
+				t.Errorf("unexpected dead letter: %s", data)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for the dead letter")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	stop()
+}
+
+func TestQueueSurvivesRestart(t *testing.T) {
+	recv := newReceiver(t, 0)
+	queue := t.TempDir()
+	targets := []webhook.Target{{URL: recv.URL, Secret: "secret"}}
+
+	// queued right before the server stops, the stopping run persists it.
+	stopped := &webhook.Dispatcher{Targets: targets, QueueDir: queue}
+	stopped.OnMutation(fshttp.Mutation{Type: fshttp.MutationWrite, Path: "a.txt"})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	stopped.Run(ctx)
+	if files, _ := filepath.Glob(filepath.Join(queue, "*.json")); len(files) != 1 {
+		t.Fatalf("expected the delivery to be persisted but found %d", len(files))
+	}
+
+	stop := run(&webhook.Dispatcher{Targets: targets, QueueDir: queue})
+	defer stop()
+	recv.wait(t)
+}
+
+func TestQueueBounds(t *testing.T) {
+	dir := t.TempDir()
+	dispatcher := &webhook.Dispatcher{
+		Targets:    []webhook.Target{{URL: "http://127.0.0.1:0"}},
+		DeadLetter: filepath.Join(dir, "dead.jsonl"),
+		QueueSize:  2,
+		MaxPending: 1,
+	}
+	// no run takes the mutations, so the queue fills up.
+	for _, path := range []string{"a.txt", "b.txt", "c.txt"} {
+		dispatcher.OnMutation(fshttp.Mutation{Type: fshttp.MutationWrite, Path: path})
+	}
+	data, _ := ioutil.ReadFile(dispatcher.DeadLetter)
+	if strings.Count(string(data), "\n") != 1 || !strings.Contains(string(data), "queue is full") {
+		t.Fatalf("expected the mutation beyond the queue to be dead lettered but got %s", data)
+	}
+
+	// only one of the two queued ones can be pending.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	dispatcher.Run(ctx)
+	data, _ = ioutil.ReadFile(dispatcher.DeadLetter)
+	if strings.Count(string(data), "\n") != 2 || !strings.Contains(string(data), "too many pending deliveries") {
+		t.Errorf("expected the delivery beyond the pending ones to be dead lettered but got %s", data)
+	}
+}